@@ -7,21 +7,140 @@ import (
 	"github.com/fchoquet/cairn/tokens"
 )
 
+// Node is implemented by every node of the AST
 type Node interface {
 	fmt.Stringer
+
+	// Children returns the direct children of the node in source order
+	Children() []Node
+
+	// Pos returns the position of the first character of the node
+	Pos() tokens.Position
+
+	// EndPos returns the position following the last character of the node
+	EndPos() tokens.Position
+}
+
+// tokenPos returns the position of a token, or the zero position for nodes
+// built without tokens
+func tokenPos(tk *tokens.Token) tokens.Position {
+	if tk == nil {
+		return tokens.Position{}
+	}
+	return tk.Position
+}
+
+// firstPos returns the position of the first child of a node
+func firstPos(children []Node) tokens.Position {
+	if len(children) == 0 {
+		return tokens.Position{}
+	}
+	return children[0].Pos()
+}
+
+// tokenEnd returns the position following a token
+func tokenEnd(tk *tokens.Token) tokens.Position {
+	if tk == nil {
+		return tokens.Position{}
+	}
+	return tk.End
+}
+
+// lastEnd returns the end of the last child of a node whose end is known. An empty statement
+// list has no end
+func lastEnd(children []Node) tokens.Position {
+	for index := len(children) - 1; index >= 0; index-- {
+		if children[index] == nil {
+			continue
+		}
+		if end := children[index].EndPos(); end != (tokens.Position{}) {
+			return end
+		}
+	}
+	return tokens.Position{}
+}
+
+// known returns the first known position. The nodes built without tokens, such as the
+// nodes built by optimizations, end with their last child or their first token
+func known(positions ...tokens.Position) tokens.Position {
+	for _, pos := range positions {
+		if pos != (tokens.Position{}) {
+			return pos
+		}
+	}
+	return tokens.Position{}
 }
 
 type SourceFile struct {
+	Imports    []*ImportDecl
+	Types      []*TypeDecl
 	Functions  []*FuncDecl
 	Statements *StatementList
 }
 
 func (s SourceFile) String() string {
-	functions := []string{}
+	declarations := []string{}
+	for _, i := range s.Imports {
+		declarations = append(declarations, i.String())
+	}
+	for _, t := range s.Types {
+		declarations = append(declarations, t.String())
+	}
 	for _, f := range s.Functions {
-		functions = append(functions, f.String())
+		declarations = append(declarations, f.String())
 	}
-	return fmt.Sprintf("SourceFile(%s %s)", strings.Join(functions, "; "), s.Statements)
+	return fmt.Sprintf("SourceFile(%s %s)", strings.Join(declarations, "; "), s.Statements)
+}
+
+func (s SourceFile) Children() []Node {
+	children := []Node{}
+	for _, i := range s.Imports {
+		children = append(children, i)
+	}
+	for _, t := range s.Types {
+		children = append(children, t)
+	}
+	for _, f := range s.Functions {
+		children = append(children, f)
+	}
+	if s.Statements != nil {
+		children = append(children, s.Statements)
+	}
+	return children
+}
+
+func (s SourceFile) Pos() tokens.Position {
+	return firstPos(s.Children())
+}
+
+func (s SourceFile) EndPos() tokens.Position {
+	return lastEnd(s.Children())
+}
+
+// ImportDecl imports the module stored in another file. Its exported names
+// are then available as Name.Identifier
+type ImportDecl struct {
+	Token *tokens.Token
+	// Path is the STRING token holding the path of the module
+	Path *tokens.Token
+	// Name is the name of the module: the last element of the path
+	Name string
+}
+
+func (i *ImportDecl) String() string {
+	return fmt.Sprintf("Import(%s)", i.Path.Value)
+}
+
+func (i *ImportDecl) Children() []Node {
+	return []Node{}
+}
+
+func (i *ImportDecl) Pos() tokens.Position {
+	return tokenPos(i.Token)
+}
+
+func (i *ImportDecl) EndPos() tokens.Position {
+	return known(tokenEnd(i.Path), tokenEnd(i.Token))
 }
 
 type Statement interface {
@@ -40,6 +159,22 @@ func (sl StatementList) String() string {
 	return fmt.Sprintf("StatementList(%s)", strings.Join(statements, "; "))
 }
 
+func (sl StatementList) Children() []Node {
+	children := []Node{}
+	for _, st := range sl.Statements {
+		children = append(children, st)
+	}
+	return children
+}
+
+func (sl StatementList) Pos() tokens.Position {
+	return firstPos(sl.Children())
+}
+
+func (sl StatementList) EndPos() tokens.Position {
+	return lastEnd(sl.Children())
+}
+
 type BlockStmt struct {
 	Begin      *tokens.Token
 	Statements *StatementList
@@ -50,6 +185,21 @@ func (bs *BlockStmt) String() string {
 	return fmt.Sprintf("BlockStmt(%s %s %s)", bs.Begin, bs.Statements, bs.End)
 }
 
+func (bs *BlockStmt) Children() []Node {
+	if bs.Statements == nil {
+		return []Node{}
+	}
+	return []Node{bs.Statements}
+}
+
+func (bs *BlockStmt) Pos() tokens.Position {
+	return tokenPos(bs.Begin)
+}
+
+func (bs *BlockStmt) EndPos() tokens.Position {
+	return known(lastEnd(bs.Children()), tokenEnd(bs.Begin))
+}
+
 type UnaryOp struct {
 	Op   *tokens.Token
 	Expr Node
@@ -59,6 +209,18 @@ func (op *UnaryOp) String() string {
 	return fmt.Sprintf("UnaryOp(%s %s)", op.Op, op.Expr)
 }
 
+func (op *UnaryOp) Children() []Node {
+	return []Node{op.Expr}
+}
+
+func (op *UnaryOp) Pos() tokens.Position {
+	return tokenPos(op.Op)
+}
+
+func (op *UnaryOp) EndPos() tokens.Position {
+	return op.Expr.EndPos()
+}
+
 type BinOp struct {
 	Left  Node
 	Op    *tokens.Token
@@ -69,6 +231,18 @@ func (op *BinOp) String() string {
 	return fmt.Sprintf("BinOp(%s %s %s)", op.Op, op.Left, op.Right)
 }
 
+func (op *BinOp) Children() []Node {
+	return []Node{op.Left, op.Right}
+}
+
+func (op *BinOp) Pos() tokens.Position {
+	return op.Left.Pos()
+}
+
+func (op *BinOp) EndPos() tokens.Position {
+	return op.Right.EndPos()
+}
+
 type Num struct {
 	Token *tokens.Token
 	Value string
@@ -78,6 +252,39 @@ func (num *Num) String() string {
 	return fmt.Sprintf("Num(%s)", num.Token)
 }
 
+func (num *Num) Children() []Node {
+	return []Node{}
+}
+
+func (num *Num) Pos() tokens.Position {
+	return tokenPos(num.Token)
+}
+
+func (num *Num) EndPos() tokens.Position {
+	return tokenEnd(num.Token)
+}
+
+type Float struct {
+	Token *tokens.Token
+	Value string
+}
+
+func (f *Float) String() string {
+	return fmt.Sprintf("Float(%s)", f.Token)
+}
+
+func (f *Float) Children() []Node {
+	return []Node{}
+}
+
+func (f *Float) Pos() tokens.Position {
+	return tokenPos(f.Token)
+}
+
+func (f *Float) EndPos() tokens.Position {
+	return tokenEnd(f.Token)
+}
+
 type String struct {
 	Token *tokens.Token
 	Value string
@@ -87,6 +294,47 @@ func (str *String) String() string {
 	return fmt.Sprintf("String(%s)", str.Token)
 }
 
+func (str *String) Children() []Node {
+	return []Node{}
+}
+
+func (str *String) Pos() tokens.Position {
+	return tokenPos(str.Token)
+}
+
+func (str *String) EndPos() tokens.Position {
+	return tokenEnd(str.Token)
+}
+
+// Interpolation is a string embedding expressions, such as "hello ${name}".
+// Parts are String nodes for the literal text, and the embedded expressions
+type Interpolation struct {
+	Token *tokens.Token
+	Parts []Node
+	// End is the STRINGEND token ending the string
+	End *tokens.Token
+}
+
+func (i *Interpolation) String() string {
+	parts := []string{}
+	for _, p := range i.Parts {
+		parts = append(parts, p.String())
+	}
+	return fmt.Sprintf("Interpolation(%s)", strings.Join(parts, " "))
+}
+
+func (i *Interpolation) Children() []Node {
+	return append([]Node{}, i.Parts...)
+}
+
+func (i *Interpolation) Pos() tokens.Position {
+	return tokenPos(i.Token)
+}
+
+func (i *Interpolation) EndPos() tokens.Position {
+	return known(tokenEnd(i.End), lastEnd(i.Children()), tokenEnd(i.Token))
+}
+
 type Bool struct {
 	Token *tokens.Token
 	Value string
@@ -96,6 +344,18 @@ func (b *Bool) String() string {
 	return fmt.Sprintf("Bool(%s)", b.Token)
 }
 
+func (b *Bool) Children() []Node {
+	return []Node{}
+}
+
+func (b *Bool) Pos() tokens.Position {
+	return tokenPos(b.Token)
+}
+
+func (b *Bool) EndPos() tokens.Position {
+	return tokenEnd(b.Token)
+}
+
 // Assignment represent and assignment in an AST
 type Assignment struct {
 	Token    *tokens.Token
@@ -104,26 +364,255 @@ type Assignment struct {
 }
 
 func (asgn *Assignment) String() string {
-	return fmt.Sprintf("Assign(%s %s)", asgn.Variable, asgn.Right)
+	return fmt.Sprintf("Assign(%s %s)", &asgn.Variable, asgn.Right)
+}
+
+func (asgn *Assignment) Children() []Node {
+	return []Node{&asgn.Variable, asgn.Right}
+}
+
+func (asgn *Assignment) Pos() tokens.Position {
+	return asgn.Variable.Pos()
+}
+
+func (asgn *Assignment) EndPos() tokens.Position {
+	return asgn.Right.EndPos()
+}
+
+// Destructuring assigns the elements of a tuple to variables, such as q, r := divmod(7, 2).
+// The variables named _ are not assigned
+type Destructuring struct {
+	// Token is the := operator
+	Token     *tokens.Token
+	Variables []*Variable
+	Right     Node
+}
+
+func (d *Destructuring) String() string {
+	variables := []string{}
+	for _, v := range d.Variables {
+		variables = append(variables, v.String())
+	}
+	return fmt.Sprintf("Destructure(%s %s)", strings.Join(variables, " "), d.Right)
+}
+
+func (d *Destructuring) Children() []Node {
+	children := []Node{}
+	for _, v := range d.Variables {
+		children = append(children, v)
+	}
+	return append(children, d.Right)
+}
+
+func (d *Destructuring) Pos() tokens.Position {
+	return d.Variables[0].Pos()
+}
+
+func (d *Destructuring) EndPos() tokens.Position {
+	return d.Right.EndPos()
 }
 
 // Variable represents a variable in an AST
 type Variable struct {
 	Token *tokens.Token
-	Name  string
+	// Module is the name of the module of a qualified identifier such as mod.Name
+	Module string
+	Name   string
+	// End is the name of a qualified identifier
+	End *tokens.Token
 }
 
 func (v *Variable) String() string {
-	return fmt.Sprintf("Variable(%s)", v.Name)
+	return fmt.Sprintf("Variable(%s)", qualifiedName(v.Module, v.Name))
+}
+
+func (v *Variable) Children() []Node {
+	return []Node{}
+}
+
+func (v *Variable) Pos() tokens.Position {
+	return tokenPos(v.Token)
+}
+
+func (v *Variable) EndPos() tokens.Position {
+	return known(tokenEnd(v.End), tokenEnd(v.Token))
+}
+
+// FuncCall represents a function call in an AST
+type FuncCall struct {
+	Token *tokens.Token
+	// Module is the name of the module of a qualified call such as mod.Func()
+	Module string
+	Name   string
+	Args   []Node
+	// End is the closing parenthesis
+	End *tokens.Token
+}
+
+func (c *FuncCall) String() string {
+	args := []string{}
+	for _, a := range c.Args {
+		args = append(args, a.String())
+	}
+	return fmt.Sprintf("FuncCall(%s %s)", qualifiedName(c.Module, c.Name), strings.Join(args, " "))
+}
+
+// qualifiedName formats an identifier that may belong to another module
+func qualifiedName(module, name string) string {
+	if module == "" {
+		return name
+	}
+	return module + "." + name
+}
+
+func (c *FuncCall) Children() []Node {
+	return append([]Node{}, c.Args...)
+}
+
+func (c *FuncCall) Pos() tokens.Position {
+	return tokenPos(c.Token)
+}
+
+func (c *FuncCall) EndPos() tokens.Position {
+	return known(tokenEnd(c.End), lastEnd(c.Children()), tokenEnd(c.Token))
+}
+
+// ListLit is a list literal such as [1, 2, 3]
+type ListLit struct {
+	Token    *tokens.Token
+	Elements []Node
+	// End is the closing bracket
+	End *tokens.Token
+}
+
+func (l *ListLit) String() string {
+	elements := []string{}
+	for _, e := range l.Elements {
+		elements = append(elements, e.String())
+	}
+	return fmt.Sprintf("List(%s)", strings.Join(elements, " "))
+}
+
+func (l *ListLit) Children() []Node {
+	return append([]Node{}, l.Elements...)
+}
+
+func (l *ListLit) Pos() tokens.Position {
+	return tokenPos(l.Token)
+}
+
+func (l *ListLit) EndPos() tokens.Position {
+	return known(tokenEnd(l.End), lastEnd(l.Children()), tokenEnd(l.Token))
+}
+
+// TupleLit is a tuple literal such as (1, "a")
+type TupleLit struct {
+	// Token is the opening parenthesis
+	Token    *tokens.Token
+	Elements []Node
+	// End is the closing parenthesis
+	End *tokens.Token
 }
 
+func (t *TupleLit) String() string {
+	elements := []string{}
+	for _, e := range t.Elements {
+		elements = append(elements, e.String())
+	}
+	return fmt.Sprintf("Tuple(%s)", strings.Join(elements, " "))
+}
+
+func (t *TupleLit) Children() []Node {
+	return append([]Node{}, t.Elements...)
+}
+
+func (t *TupleLit) Pos() tokens.Position {
+	return tokenPos(t.Token)
+}
+
+func (t *TupleLit) EndPos() tokens.Position {
+	return known(tokenEnd(t.End), lastEnd(t.Children()), tokenEnd(t.Token))
+}
+
+// Index reads an element of a list, such as xs[0]
+type Index struct {
+	// Token is the opening bracket
+	Token *tokens.Token
+	Expr  Node
+	Index Node
+	// End is the closing bracket
+	End *tokens.Token
+}
+
+func (i *Index) String() string {
+	return fmt.Sprintf("Index(%s %s)", i.Expr, i.Index)
+}
+
+func (i *Index) Children() []Node {
+	return []Node{i.Expr, i.Index}
+}
+
+func (i *Index) Pos() tokens.Position {
+	return tokenPos(i.Token)
+}
+
+func (i *Index) EndPos() tokens.Position {
+	return known(tokenEnd(i.End), i.Index.EndPos())
+}
+
+// TypeId names a type. Generic types have type arguments, such as Option[int].
+// A list type such as [int] is named [] and has the type of its elements as only argument.
+// A tuple type such as (int, string) is named () and has the types of its elements as arguments
 type TypeId struct {
 	Token *tokens.Token
 	Name  string
+	Args  []*TypeId
+	// End is the last token of a type written with several tokens, such as the closing bracket of [int]
+	End *tokens.Token
+}
+
+// Names of the list and tuple types
+const (
+	ListType  = "[]"
+	TupleType = "()"
+)
+
+// TypeName returns the type as it is written in the source, such as [int], (int, bool) or Option[T]
+func (t *TypeId) TypeName() string {
+	if t.Name == ListType && len(t.Args) == 1 {
+		return "[" + t.Args[0].TypeName() + "]"
+	}
+	if len(t.Args) == 0 {
+		return t.Name
+	}
+	args := []string{}
+	for _, a := range t.Args {
+		args = append(args, a.TypeName())
+	}
+	if t.Name == TupleType {
+		return "(" + strings.Join(args, ", ") + ")"
+	}
+	return t.Name + "[" + strings.Join(args, ", ") + "]"
 }
 
 func (t *TypeId) String() string {
-	return fmt.Sprintf("Type(%s)", t.Name)
+	return fmt.Sprintf("Type(%s)", t.TypeName())
+}
+
+func (t *TypeId) Children() []Node {
+	children := []Node{}
+	for _, a := range t.Args {
+		children = append(children, a)
+	}
+	return children
+}
+
+func (t *TypeId) Pos() tokens.Position {
+	return tokenPos(t.Token)
+}
+
+func (t *TypeId) EndPos() tokens.Position {
+	return known(tokenEnd(t.End), lastEnd(t.Children()), tokenEnd(t.Token))
 }
 
 type Parameter struct {
@@ -136,9 +625,26 @@ func (p *Parameter) String() string {
 	return fmt.Sprintf("Parameter(%s %s)", p.Name, p.Type)
 }
 
+func (p *Parameter) Children() []Node {
+	if p.Type == nil {
+		return []Node{}
+	}
+	return []Node{p.Type}
+}
+
+func (p *Parameter) Pos() tokens.Position {
+	return tokenPos(p.Token)
+}
+
+func (p *Parameter) EndPos() tokens.Position {
+	return known(lastEnd(p.Children()), tokenEnd(p.Token))
+}
+
 type ParameterList struct {
 	Token      *tokens.Token
 	Parameters []*Parameter
+	// End is the closing parenthesis
+	End *tokens.Token
 }
 
 func (pl ParameterList) String() string {
@@ -149,6 +655,22 @@ func (pl ParameterList) String() string {
 	return fmt.Sprintf("ParameterList(%s)", strings.Join(params, " "))
 }
 
+func (pl ParameterList) Children() []Node {
+	children := []Node{}
+	for _, p := range pl.Parameters {
+		children = append(children, p)
+	}
+	return children
+}
+
+func (pl ParameterList) Pos() tokens.Position {
+	return tokenPos(pl.Token)
+}
+
+func (pl ParameterList) EndPos() tokens.Position {
+	return known(tokenEnd(pl.End), lastEnd(pl.Children()), tokenEnd(pl.Token))
+}
+
 type FuncDecl struct {
 	Token     *tokens.Token
 	Name      *tokens.Token
@@ -160,12 +682,289 @@ func (f *FuncDecl) String() string {
 	return fmt.Sprintf("FuncDecl(%s %s %s)", f.Name, f.Signature, f.Body)
 }
 
+func (f *FuncDecl) Children() []Node {
+	children := []Node{}
+	if f.Signature != nil {
+		children = append(children, f.Signature)
+	}
+	if f.Body != nil {
+		children = append(children, f.Body)
+	}
+	return children
+}
+
+func (f *FuncDecl) Pos() tokens.Position {
+	return tokenPos(f.Token)
+}
+
+func (f *FuncDecl) EndPos() tokens.Position {
+	return known(lastEnd(f.Children()), tokenEnd(f.Name))
+}
+
 type Signature struct {
-	Token      *tokens.Token
+	Token *tokens.Token
+	// TypeParams are the type parameters of a generic function, such as T in func first[T](xs:[T]) :T
+	TypeParams []*tokens.Token
 	Parameters *ParameterList
 	ReturnType *TypeId
 }
 
 func (s *Signature) String() string {
+	if len(s.TypeParams) > 0 {
+		return fmt.Sprintf("Signature(%s %s %s)", typeParams(s.TypeParams), s.Parameters, s.ReturnType)
+	}
 	return fmt.Sprintf("Signature(%s %s)", s.Parameters, s.ReturnType)
 }
+
+// typeParams formats a list of type parameters as they are declared: [K, V]
+func typeParams(params []*tokens.Token) string {
+	names := []string{}
+	for _, p := range params {
+		names = append(names, p.Value)
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+func (s *Signature) Children() []Node {
+	children := []Node{}
+	if s.Parameters != nil {
+		children = append(children, s.Parameters)
+	}
+	if s.ReturnType != nil {
+		children = append(children, s.ReturnType)
+	}
+	return children
+}
+
+func (s *Signature) Pos() tokens.Position {
+	return tokenPos(s.Token)
+}
+
+func (s *Signature) EndPos() tokens.Position {
+	return known(lastEnd(s.Children()), tokenEnd(s.Token))
+}
+
+// TypeDecl declares a sum type and its constructors, such as type Shape = Circle(r:int) | Rect(w:int, h:int).
+// Generic types have type parameters: type Option[T] = None | Some(value:T)
+type TypeDecl struct {
+	Token        *tokens.Token
+	Name         *tokens.Token
+	Params       []*tokens.Token
+	Constructors []*Constructor
+}
+
+func (t *TypeDecl) String() string {
+	constructors := []string{}
+	for _, c := range t.Constructors {
+		constructors = append(constructors, c.String())
+	}
+	name := t.Name.Value
+	if len(t.Params) > 0 {
+		name += typeParams(t.Params)
+	}
+	return fmt.Sprintf("TypeDecl(%s %s)", name, strings.Join(constructors, " | "))
+}
+
+func (t *TypeDecl) Children() []Node {
+	children := []Node{}
+	for _, c := range t.Constructors {
+		children = append(children, c)
+	}
+	return children
+}
+
+func (t *TypeDecl) Pos() tokens.Position {
+	return tokenPos(t.Token)
+}
+
+func (t *TypeDecl) EndPos() tokens.Position {
+	return known(lastEnd(t.Children()), tokenEnd(t.Name))
+}
+
+// Constructor is an alternative of a sum type. Its fields are declared like function parameters
+type Constructor struct {
+	Token  *tokens.Token
+	Name   string
+	Fields []*Parameter
+	// End is the closing parenthesis of the fields
+	End *tokens.Token
+}
+
+func (c *Constructor) String() string {
+	fields := []string{}
+	for _, f := range c.Fields {
+		fields = append(fields, f.String())
+	}
+	return fmt.Sprintf("Constructor(%s %s)", c.Name, strings.Join(fields, " "))
+}
+
+func (c *Constructor) Children() []Node {
+	children := []Node{}
+	for _, f := range c.Fields {
+		children = append(children, f)
+	}
+	return children
+}
+
+func (c *Constructor) Pos() tokens.Position {
+	return tokenPos(c.Token)
+}
+
+func (c *Constructor) EndPos() tokens.Position {
+	return known(tokenEnd(c.End), lastEnd(c.Children()), tokenEnd(c.Token))
+}
+
+// Match evaluates the first arm whose pattern matches the value of Subject
+type Match struct {
+	Token   *tokens.Token
+	Subject Node
+	Arms    []*MatchArm
+}
+
+func (m *Match) String() string {
+	arms := []string{}
+	for _, a := range m.Arms {
+		arms = append(arms, a.String())
+	}
+	return fmt.Sprintf("Match(%s %s)", m.Subject, strings.Join(arms, " "))
+}
+
+func (m *Match) Children() []Node {
+	children := []Node{m.Subject}
+	for _, a := range m.Arms {
+		children = append(children, a)
+	}
+	return children
+}
+
+func (m *Match) Pos() tokens.Position {
+	return tokenPos(m.Token)
+}
+
+func (m *Match) EndPos() tokens.Position {
+	return lastEnd(m.Children())
+}
+
+// Try evaluates Body. When Body fails with a runtime error, the error is bound to Variable
+// and Handler is evaluated instead
+type Try struct {
+	Token    *tokens.Token
+	Body     *BlockStmt
+	Variable *Variable
+	Handler  *BlockStmt
+}
+
+func (t *Try) String() string {
+	return fmt.Sprintf("Try(%s Catch(%s %s))", t.Body, t.Variable, t.Handler)
+}
+
+func (t *Try) Children() []Node {
+	return []Node{t.Body, t.Variable, t.Handler}
+}
+
+func (t *Try) Pos() tokens.Position {
+	return tokenPos(t.Token)
+}
+
+func (t *Try) EndPos() tokens.Position {
+	return lastEnd(t.Children())
+}
+
+// MatchArm is a pattern and the expression evaluated when it matches
+type MatchArm struct {
+	// Token is the arrow between the pattern and the body
+	Token   *tokens.Token
+	Pattern Node
+	Body    Node
+}
+
+func (a *MatchArm) String() string {
+	return fmt.Sprintf("Arm(%s -> %s)", a.Pattern, a.Body)
+}
+
+func (a *MatchArm) Children() []Node {
+	return []Node{a.Pattern, a.Body}
+}
+
+func (a *MatchArm) Pos() tokens.Position {
+	return a.Pattern.Pos()
+}
+
+func (a *MatchArm) EndPos() tokens.Position {
+	return a.Body.EndPos()
+}
+
+// ConstructorPattern matches the values built by a constructor, when their fields match Args.
+// Literals are patterns too: they match the values they are equal to.
+type ConstructorPattern struct {
+	Token *tokens.Token
+	// Module is the name of the module of a qualified constructor such as mod.Circle
+	Module string
+	Name   string
+	Args   []Node
+	// End is the closing parenthesis of the arguments, or the name of a qualified constructor
+	End *tokens.Token
+}
+
+func (p *ConstructorPattern) String() string {
+	args := []string{}
+	for _, a := range p.Args {
+		args = append(args, a.String())
+	}
+	return fmt.Sprintf("Pattern(%s %s)", qualifiedName(p.Module, p.Name), strings.Join(args, " "))
+}
+
+func (p *ConstructorPattern) Children() []Node {
+	return append([]Node{}, p.Args...)
+}
+
+func (p *ConstructorPattern) Pos() tokens.Position {
+	return tokenPos(p.Token)
+}
+
+func (p *ConstructorPattern) EndPos() tokens.Position {
+	return known(tokenEnd(p.End), lastEnd(p.Children()), tokenEnd(p.Token))
+}
+
+// BindingPattern matches any value, and assigns it to a variable
+type BindingPattern struct {
+	Token *tokens.Token
+	Name  string
+}
+
+func (p *BindingPattern) String() string {
+	return fmt.Sprintf("Binding(%s)", p.Name)
+}
+
+func (p *BindingPattern) Children() []Node {
+	return []Node{}
+}
+
+func (p *BindingPattern) Pos() tokens.Position {
+	return tokenPos(p.Token)
+}
+
+func (p *BindingPattern) EndPos() tokens.Position {
+	return tokenEnd(p.Token)
+}
+
+// WildcardPattern is written _ and matches any value
+type WildcardPattern struct {
+	Token *tokens.Token
+}
+
+func (p *WildcardPattern) String() string {
+	return "Wildcard"
+}
+
+func (p *WildcardPattern) Children() []Node {
+	return []Node{}
+}
+
+func (p *WildcardPattern) Pos() tokens.Position {
+	return tokenPos(p.Token)
+}
+
+func (p *WildcardPattern) EndPos() tokens.Position {
+	return tokenEnd(p.Token)
+}
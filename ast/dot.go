@@ -0,0 +1,84 @@
+package ast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDot writes a Graphviz DOT graph of the tree rooted at node.
+// Each node is labelled with its type and, when it has one, its operator, name or value.
+func WriteDot(w io.Writer, node Node) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintln(buf, "digraph AST {")
+	fmt.Fprintln(buf, "    node [shape=box fontname=monospace];")
+
+	count := 0
+	parents := []int{}
+	Inspect(node, func(n Node) bool {
+		if n == nil {
+			// leaving a node
+			parents = parents[:len(parents)-1]
+			return false
+		}
+
+		id := count
+		count++
+		fmt.Fprintf(buf, "    n%d [label=%s];\n", id, DotQuote(dotLabel(n)))
+		if len(parents) > 0 {
+			fmt.Fprintf(buf, "    n%d -> n%d;\n", parents[len(parents)-1], id)
+		}
+		parents = append(parents, id)
+		return true
+	})
+
+	fmt.Fprintln(buf, "}")
+	return buf.Flush()
+}
+
+func dotLabel(node Node) string {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	switch n := node.(type) {
+	case *UnaryOp:
+		return name + "\n" + n.Op.Value
+	case *BinOp:
+		return name + "\n" + n.Op.Value
+	case *Num:
+		return name + "\n" + n.Value
+	case *Float:
+		return name + "\n" + n.Value
+	case *String:
+		return name + "\n" + fmt.Sprintf("%q", n.Value)
+	case *Bool:
+		return name + "\n" + n.Value
+	case *ImportDecl:
+		return name + "\n" + fmt.Sprintf("%q", n.Path.Value)
+	case *Variable:
+		return name + "\n" + qualifiedName(n.Module, n.Name)
+	case *FuncCall:
+		return name + "\n" + qualifiedName(n.Module, n.Name)
+	case *TypeId:
+		return name + "\n" + n.TypeName()
+	case *Parameter:
+		return name + "\n" + n.Name
+	case *FuncDecl:
+		return name + "\n" + n.Name.Value
+	case *TypeDecl:
+		return name + "\n" + n.Name.Value
+	case *Constructor:
+		return name + "\n" + n.Name
+	case *ConstructorPattern:
+		return name + "\n" + qualifiedName(n.Module, n.Name)
+	case *BindingPattern:
+		return name + "\n" + n.Name
+	default:
+		return name
+	}
+}
+
+// DotQuote quotes a string so it can be used as a DOT identifier or label
+func DotQuote(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(s) + `"`
+}
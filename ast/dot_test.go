@@ -0,0 +1,39 @@
+package ast_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDot(t *testing.T) {
+	assert := assert.New(t)
+
+	p := parser.Parser{}
+	node, err := p.Parse("test.ca", `1 + "a\"b"`)
+	if !assert.Nil(err) {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	if !assert.Nil(ast.WriteDot(buf, node)) {
+		return
+	}
+
+	assert.Equal(`digraph AST {
+    node [shape=box fontname=monospace];
+    n0 [label="SourceFile"];
+    n1 [label="StatementList"];
+    n0 -> n1;
+    n2 [label="BinOp\n+"];
+    n1 -> n2;
+    n3 [label="Num\n1"];
+    n2 -> n3;
+    n4 [label="String\n\"a\\\"b\""];
+    n2 -> n4;
+}
+`, buf.String())
+}
@@ -0,0 +1,234 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"unicode"
+
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// nodeTypes lists every node type that can be encoded to JSON, indexed by type tag
+var nodeTypes = map[string]reflect.Type{
+	"SourceFile":         reflect.TypeOf(SourceFile{}),
+	"ImportDecl":         reflect.TypeOf(ImportDecl{}),
+	"StatementList":      reflect.TypeOf(StatementList{}),
+	"BlockStmt":          reflect.TypeOf(BlockStmt{}),
+	"UnaryOp":            reflect.TypeOf(UnaryOp{}),
+	"BinOp":              reflect.TypeOf(BinOp{}),
+	"Num":                reflect.TypeOf(Num{}),
+	"Float":              reflect.TypeOf(Float{}),
+	"String":             reflect.TypeOf(String{}),
+	"Interpolation":      reflect.TypeOf(Interpolation{}),
+	"Bool":               reflect.TypeOf(Bool{}),
+	"Assignment":         reflect.TypeOf(Assignment{}),
+	"Destructuring":      reflect.TypeOf(Destructuring{}),
+	"Variable":           reflect.TypeOf(Variable{}),
+	"FuncCall":           reflect.TypeOf(FuncCall{}),
+	"ListLit":            reflect.TypeOf(ListLit{}),
+	"TupleLit":           reflect.TypeOf(TupleLit{}),
+	"Index":              reflect.TypeOf(Index{}),
+	"TypeId":             reflect.TypeOf(TypeId{}),
+	"Parameter":          reflect.TypeOf(Parameter{}),
+	"ParameterList":      reflect.TypeOf(ParameterList{}),
+	"FuncDecl":           reflect.TypeOf(FuncDecl{}),
+	"Signature":          reflect.TypeOf(Signature{}),
+	"TypeDecl":           reflect.TypeOf(TypeDecl{}),
+	"Constructor":        reflect.TypeOf(Constructor{}),
+	"Match":              reflect.TypeOf(Match{}),
+	"MatchArm":           reflect.TypeOf(MatchArm{}),
+	"Try":                reflect.TypeOf(Try{}),
+	"ConstructorPattern": reflect.TypeOf(ConstructorPattern{}),
+	"BindingPattern":     reflect.TypeOf(BindingPattern{}),
+	"WildcardPattern":    reflect.TypeOf(WildcardPattern{}),
+}
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType = reflect.TypeOf(&tokens.Token{})
+)
+
+// ToJSON encodes a node and its subtree.
+// Each node becomes an object holding a "node" type tag, its source span from "pos" to "end"
+// and one entry per field, in declaration order and named after the field in lower camel case.
+// Tokens are encoded as {"type": ..., "value": ..., "pos": ..., "end": ...} objects:
+//
+//	{"node":"Num","pos":{"file":"f.ca","line":1,"col":1},"end":{"file":"f.ca","line":1,"col":2},"token":{...},"value":"1"}
+//
+// The encoding is stable: it only changes when the AST itself does.
+func ToJSON(node Node) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := encodeNode(buf, reflect.ValueOf(node)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FromJSON decodes a tree encoded by ToJSON
+func FromJSON(data []byte) (Node, error) {
+	nd, err := decodeNode(data)
+	if err != nil {
+		return nil, err
+	}
+	if nd == nil {
+		return nil, nil
+	}
+	return nd.Interface().(Node), nil
+}
+
+func jsonFieldName(name string) string {
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+func typeName(typ reflect.Type) string {
+	if typ.Kind() == reflect.Ptr {
+		return typ.Elem().Name()
+	}
+	return typ.Name()
+}
+
+func encodeNode(buf *bytes.Buffer, v reflect.Value) error {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		buf.WriteString("null")
+		return nil
+	}
+
+	st := reflect.Indirect(v)
+	if _, ok := nodeTypes[st.Type().Name()]; !ok || st.Kind() != reflect.Struct {
+		return fmt.Errorf("can not encode node of type %s", v.Type())
+	}
+
+	// the span is not a field. Let's compute it from an addressable node
+	addressable := reflect.New(st.Type())
+	addressable.Elem().Set(st)
+	nd := addressable.Interface().(Node)
+	encodedPos, err := json.Marshal(nd.Pos())
+	if err != nil {
+		return err
+	}
+	encodedEnd, err := json.Marshal(nd.EndPos())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(buf, `{"node":%q,"pos":%s,"end":%s`, st.Type().Name(), encodedPos, encodedEnd)
+	for index := 0; index < st.NumField(); index++ {
+		fmt.Fprintf(buf, ",%q:", jsonFieldName(st.Type().Field(index).Name))
+		if err := encodeValue(buf, st.Field(index)); err != nil {
+			return err
+		}
+	}
+	buf.WriteString("}")
+	return nil
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	switch {
+	case v.Type() == tokenType:
+		encoded, err := json.Marshal(v.Interface())
+		if err != nil {
+			return err
+		}
+		buf.Write(encoded)
+		return nil
+	case v.Kind() == reflect.Slice:
+		buf.WriteString("[")
+		for index := 0; index < v.Len(); index++ {
+			if index > 0 {
+				buf.WriteString(",")
+			}
+			if err := encodeValue(buf, v.Index(index)); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]")
+		return nil
+	case v.Type().Implements(nodeType), reflect.PtrTo(v.Type()).Implements(nodeType):
+		return encodeNode(buf, v)
+	default:
+		encoded, err := json.Marshal(v.Interface())
+		if err != nil {
+			return err
+		}
+		buf.Write(encoded)
+		return nil
+	}
+}
+
+func decodeNode(data []byte) (*reflect.Value, error) {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil, nil
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	var tag string
+	if err := json.Unmarshal(fields["node"], &tag); err != nil {
+		return nil, fmt.Errorf("missing node type in %s", data)
+	}
+
+	typ, ok := nodeTypes[tag]
+	if !ok {
+		return nil, fmt.Errorf("unknown node type: %s", tag)
+	}
+
+	nd := reflect.New(typ)
+	for index := 0; index < typ.NumField(); index++ {
+		name := jsonFieldName(typ.Field(index).Name)
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(raw, nd.Elem().Field(index)); err != nil {
+			return nil, fmt.Errorf("%s.%s: %s", tag, name, err)
+		}
+	}
+	return &nd, nil
+}
+
+func decodeValue(data []byte, dest reflect.Value) error {
+	switch {
+	case dest.Type() == tokenType:
+		return json.Unmarshal(data, dest.Addr().Interface())
+	case dest.Kind() == reflect.Slice:
+		items := []json.RawMessage{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		slice := reflect.MakeSlice(dest.Type(), len(items), len(items))
+		for index, item := range items {
+			if err := decodeValue(item, slice.Index(index)); err != nil {
+				return err
+			}
+		}
+		dest.Set(slice)
+		return nil
+	case dest.Type().Implements(nodeType), reflect.PtrTo(dest.Type()).Implements(nodeType):
+		nd, err := decodeNode(data)
+		if err != nil || nd == nil {
+			return err
+		}
+		value := *nd
+		if dest.Kind() == reflect.Struct {
+			// nodes stored by value, such as Assignment.Variable
+			value = value.Elem()
+		}
+		if !value.Type().AssignableTo(dest.Type()) {
+			return fmt.Errorf("expected %s - got %s", typeName(dest.Type()), typeName(value.Type()))
+		}
+		dest.Set(value)
+		return nil
+	default:
+		return json.Unmarshal(data, dest.Addr().Interface())
+	}
+}
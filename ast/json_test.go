@@ -0,0 +1,121 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/fchoquet/cairn/tokens"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("encodes nodes with a type tag, a position and their fields", func(t *testing.T) {
+		p := parser.Parser{}
+		node, err := p.Parse("test.ca", "12")
+		if !assert.Nil(err) {
+			return
+		}
+
+		encoded, err := ast.ToJSON(node)
+		if !assert.Nil(err) {
+			return
+		}
+
+		span := `"pos":{"file":"test.ca","line":1,"col":1},"end":{"file":"test.ca","line":1,"col":3}`
+		num := `{"node":"Num",` + span + `,"token":{"type":"INTEGER","value":"12",` + span + `},"value":"12"}`
+		assert.Equal(
+			`{"node":"SourceFile",`+span+`,"imports":[],"types":[],"functions":[],"statements":{"node":"StatementList",`+span+`,"statements":[`+num+`]}}`,
+			string(encoded),
+		)
+	})
+
+	t.Run("encodes the spans of nodes", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			span   string
+		}{
+			{`add(1, [2, 3])`, "1:1-1:15"},
+			{`1 + xs[0]`, "1:1-1:10"},
+			{`"a ${b} c"`, "1:1-1:11"},
+			{`("é", mod.x)`, "1:1-1:13"},
+			{"func f(a:[int]) :Pair[int, mod.T]\n    a", "1:1-2:6"},
+			{"match x\n    Some(-1) -> 1\n    _ -> m.v", "1:1-3:13"},
+		}
+
+		for _, f := range fixtures {
+			p := parser.Parser{}
+			node, err := p.Parse("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+
+			encoded, err := ast.ToJSON(node)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			span := struct {
+				Pos tokens.Position `json:"pos"`
+				End tokens.Position `json:"end"`
+			}{}
+			if !assert.Nil(json.Unmarshal(encoded, &span), f.source) {
+				continue
+			}
+			assert.Equal(f.span, fmt.Sprintf("%d:%d-%d:%d", span.Pos.Line, span.Pos.Col, span.End.Line, span.End.Col), f.source)
+		}
+	})
+
+	t.Run("round trips", func(t *testing.T) {
+		fixtures := []string{
+			`12`,
+			`2^4 + 2 * (3^2 - 1)`,
+			`"foo" ++ "bar"`,
+			`"a ${b} c ${1 + 2}"`,
+			`!true != !false`,
+			`foo := -12`,
+			"func add(a:int, b:int) :int\n    a + b\nadd",
+			"func foo() :int\n    1\n        2\n",
+			"type Shape = Circle(r:int) | Empty\nmatch Circle(1)\n    Circle(-1) -> 0\n    Circle(r) -> r\n    _ -> 0",
+			"type Pair[A, B] = Pair(first:A, second:[B])\nfunc first[T](xs:[T]) :T\n    xs[0]\nfirst([[1], []])[0]",
+			"func divmod(a:int, b:int) :(int, int)\n    (a / b, a - b)\nq, r := divmod(7, 2)",
+			"x := try\n    1 / 0\ncatch e\n    message(e)\nx",
+		}
+
+		for _, f := range fixtures {
+			p := parser.Parser{}
+			node, err := p.Parse("test.ca", f)
+			if !assert.Nil(err, f) {
+				continue
+			}
+
+			encoded, err := ast.ToJSON(node)
+			if !assert.Nil(err, f) {
+				continue
+			}
+
+			decoded, err := ast.FromJSON(encoded)
+			if !assert.Nil(err, f) {
+				continue
+			}
+			assert.Equal(node, decoded, f)
+		}
+	})
+
+	t.Run("rejects invalid documents", func(t *testing.T) {
+		fixtures := []string{
+			`{}`,
+			`{"node":"Foo"}`,
+			`{"node":"BinOp","left":{"node":"Num"},"right":3}`,
+			`{"node":"SourceFile","statements":{"node":"Num"}}`,
+		}
+
+		for _, f := range fixtures {
+			_, err := ast.FromJSON([]byte(f))
+			assert.Error(err, f)
+		}
+	})
+}
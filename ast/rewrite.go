@@ -0,0 +1,230 @@
+package ast
+
+import "fmt"
+
+// Rewrite traverses an AST in depth-first order and replaces every node by the
+// result of fn. Children are rewritten before their parent, so fn always receives
+// a node whose subtrees have already been rewritten. fn returns the node itself to
+// keep it unchanged.
+//
+// Nodes are updated in place and the (possibly replaced) root is returned.
+// A nil result removes a statement from its StatementList. Anywhere else, or if
+// the replacement can not be stored in the parent node, Rewrite panics: this is a
+// bug in fn, not an input error.
+func Rewrite(node Node, fn func(Node) Node) Node {
+	switch n := node.(type) {
+	case *SourceFile:
+		for index, i := range n.Imports {
+			n.Imports[index] = rewriteImportDecl(i, fn)
+		}
+		for index, t := range n.Types {
+			n.Types[index] = rewriteTypeDecl(t, fn)
+		}
+		for index, f := range n.Functions {
+			n.Functions[index] = rewriteFuncDecl(f, fn)
+		}
+		if n.Statements != nil {
+			n.Statements = rewriteStatementList(n.Statements, fn)
+		}
+	case *StatementList:
+		statements := []Statement{}
+		for _, st := range n.Statements {
+			if st = Rewrite(st, fn); st != nil {
+				statements = append(statements, st)
+			}
+		}
+		n.Statements = statements
+	case *BlockStmt:
+		if n.Statements != nil {
+			n.Statements = rewriteStatementList(n.Statements, fn)
+		}
+	case *UnaryOp:
+		n.Expr = rewriteExpr(n.Expr, fn)
+	case *BinOp:
+		n.Left = rewriteExpr(n.Left, fn)
+		n.Right = rewriteExpr(n.Right, fn)
+	case *Assignment:
+		n.Variable = *rewriteVariable(&n.Variable, fn)
+		n.Right = rewriteExpr(n.Right, fn)
+	case *Destructuring:
+		for index, v := range n.Variables {
+			n.Variables[index] = rewriteVariable(v, fn)
+		}
+		n.Right = rewriteExpr(n.Right, fn)
+	case *FuncCall:
+		for index, arg := range n.Args {
+			n.Args[index] = rewriteExpr(arg, fn)
+		}
+	case *ListLit:
+		for index, e := range n.Elements {
+			n.Elements[index] = rewriteExpr(e, fn)
+		}
+	case *TupleLit:
+		for index, e := range n.Elements {
+			n.Elements[index] = rewriteExpr(e, fn)
+		}
+	case *Index:
+		n.Expr = rewriteExpr(n.Expr, fn)
+		n.Index = rewriteExpr(n.Index, fn)
+	case *Interpolation:
+		for index, part := range n.Parts {
+			n.Parts[index] = rewriteExpr(part, fn)
+		}
+	case *TypeId:
+		for index, a := range n.Args {
+			n.Args[index] = rewriteTypeId(a, fn)
+		}
+	case *Parameter:
+		if n.Type != nil {
+			n.Type = rewriteTypeId(n.Type, fn)
+		}
+	case *ParameterList:
+		for index, p := range n.Parameters {
+			n.Parameters[index] = rewriteParameter(p, fn)
+		}
+	case *FuncDecl:
+		if n.Signature != nil {
+			n.Signature = rewriteSignature(n.Signature, fn)
+		}
+		if n.Body != nil {
+			n.Body = rewriteBlockStmt(n.Body, fn)
+		}
+	case *Signature:
+		if n.Parameters != nil {
+			n.Parameters = rewriteParameterList(n.Parameters, fn)
+		}
+		if n.ReturnType != nil {
+			n.ReturnType = rewriteTypeId(n.ReturnType, fn)
+		}
+	case *TypeDecl:
+		for index, c := range n.Constructors {
+			n.Constructors[index] = rewriteConstructor(c, fn)
+		}
+	case *Constructor:
+		for index, f := range n.Fields {
+			n.Fields[index] = rewriteParameter(f, fn)
+		}
+	case *Match:
+		n.Subject = rewriteExpr(n.Subject, fn)
+		for index, a := range n.Arms {
+			n.Arms[index] = rewriteMatchArm(a, fn)
+		}
+	case *MatchArm:
+		n.Pattern = rewriteExpr(n.Pattern, fn)
+		n.Body = rewriteExpr(n.Body, fn)
+	case *Try:
+		n.Body = rewriteBlockStmt(n.Body, fn)
+		n.Variable = rewriteVariable(n.Variable, fn)
+		n.Handler = rewriteBlockStmt(n.Handler, fn)
+	case *ConstructorPattern:
+		for index, arg := range n.Args {
+			n.Args[index] = rewriteExpr(arg, fn)
+		}
+	}
+
+	return fn(node)
+}
+
+func rewriteExpr(node Node, fn func(Node) Node) Node {
+	result := Rewrite(node, fn)
+	if result == nil {
+		panic(fmt.Sprintf("rewrite: can not remove expression %s", node))
+	}
+	return result
+}
+
+func rewriteImportDecl(node *ImportDecl, fn func(Node) Node) *ImportDecl {
+	result, ok := Rewrite(node, fn).(*ImportDecl)
+	if !ok {
+		panic(fmt.Sprintf("rewrite: %s must be replaced by an ImportDecl", node))
+	}
+	return result
+}
+
+func rewriteStatementList(node *StatementList, fn func(Node) Node) *StatementList {
+	result, ok := Rewrite(node, fn).(*StatementList)
+	if !ok {
+		panic(fmt.Sprintf("rewrite: %s must be replaced by a StatementList", node))
+	}
+	return result
+}
+
+func rewriteBlockStmt(node *BlockStmt, fn func(Node) Node) *BlockStmt {
+	result, ok := Rewrite(node, fn).(*BlockStmt)
+	if !ok {
+		panic(fmt.Sprintf("rewrite: %s must be replaced by a BlockStmt", node))
+	}
+	return result
+}
+
+func rewriteVariable(node *Variable, fn func(Node) Node) *Variable {
+	result, ok := Rewrite(node, fn).(*Variable)
+	if !ok {
+		panic(fmt.Sprintf("rewrite: %s must be replaced by a Variable", node))
+	}
+	return result
+}
+
+func rewriteTypeId(node *TypeId, fn func(Node) Node) *TypeId {
+	result, ok := Rewrite(node, fn).(*TypeId)
+	if !ok {
+		panic(fmt.Sprintf("rewrite: %s must be replaced by a TypeId", node))
+	}
+	return result
+}
+
+func rewriteParameter(node *Parameter, fn func(Node) Node) *Parameter {
+	result, ok := Rewrite(node, fn).(*Parameter)
+	if !ok {
+		panic(fmt.Sprintf("rewrite: %s must be replaced by a Parameter", node))
+	}
+	return result
+}
+
+func rewriteParameterList(node *ParameterList, fn func(Node) Node) *ParameterList {
+	result, ok := Rewrite(node, fn).(*ParameterList)
+	if !ok {
+		panic(fmt.Sprintf("rewrite: %s must be replaced by a ParameterList", node))
+	}
+	return result
+}
+
+func rewriteFuncDecl(node *FuncDecl, fn func(Node) Node) *FuncDecl {
+	result, ok := Rewrite(node, fn).(*FuncDecl)
+	if !ok {
+		panic(fmt.Sprintf("rewrite: %s must be replaced by a FuncDecl", node))
+	}
+	return result
+}
+
+func rewriteSignature(node *Signature, fn func(Node) Node) *Signature {
+	result, ok := Rewrite(node, fn).(*Signature)
+	if !ok {
+		panic(fmt.Sprintf("rewrite: %s must be replaced by a Signature", node))
+	}
+	return result
+}
+
+func rewriteTypeDecl(node *TypeDecl, fn func(Node) Node) *TypeDecl {
+	result, ok := Rewrite(node, fn).(*TypeDecl)
+	if !ok {
+		panic(fmt.Sprintf("rewrite: %s must be replaced by a TypeDecl", node))
+	}
+	return result
+}
+
+func rewriteConstructor(node *Constructor, fn func(Node) Node) *Constructor {
+	result, ok := Rewrite(node, fn).(*Constructor)
+	if !ok {
+		panic(fmt.Sprintf("rewrite: %s must be replaced by a Constructor", node))
+	}
+	return result
+}
+
+func rewriteMatchArm(node *MatchArm, fn func(Node) Node) *MatchArm {
+	result, ok := Rewrite(node, fn).(*MatchArm)
+	if !ok {
+		panic(fmt.Sprintf("rewrite: %s must be replaced by a MatchArm", node))
+	}
+	return result
+}
@@ -0,0 +1,129 @@
+package ast_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/fchoquet/cairn/tokens"
+	"github.com/stretchr/testify/assert"
+)
+
+func nodeName(node ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
+
+func TestWalk(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("visits every node in depth-first order", func(t *testing.T) {
+		p := parser.Parser{}
+		node, err := p.Parse("test.ca", "func add(a:int, b:int) :int\n    a + b\nfoo := -1")
+		if !assert.Nil(err) {
+			return
+		}
+
+		visited := []string{}
+		ast.Inspect(node, func(n ast.Node) bool {
+			if n != nil {
+				visited = append(visited, nodeName(n))
+			}
+			return true
+		})
+
+		assert.Equal([]string{
+			"SourceFile",
+			"FuncDecl", "Signature", "ParameterList",
+			"Parameter", "TypeId", "Parameter", "TypeId", "TypeId",
+			"BlockStmt", "StatementList", "BinOp", "Variable", "Variable",
+			"StatementList", "Assignment", "Variable", "UnaryOp", "Num",
+		}, visited)
+	})
+
+	t.Run("skips children when the visitor returns false", func(t *testing.T) {
+		p := parser.Parser{}
+		node, err := p.Parse("test.ca", "1 + (2 * 3)")
+		if !assert.Nil(err) {
+			return
+		}
+
+		nums := []string{}
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BinOp:
+				// do not look into multiplications
+				return n.Op.Type != tokens.MULT
+			case *ast.Num:
+				nums = append(nums, n.Value)
+			}
+			return true
+		})
+
+		assert.Equal([]string{"1"}, nums)
+	})
+}
+
+func TestRewrite(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("replaces nodes bottom-up", func(t *testing.T) {
+		p := parser.Parser{}
+		node, err := p.Parse("test.ca", "foo := 1 + 2 * 3")
+		if !assert.Nil(err) {
+			return
+		}
+
+		// repeat the digits of every number
+		node = ast.Rewrite(node, func(n ast.Node) ast.Node {
+			if num, ok := n.(*ast.Num); ok {
+				return &ast.Num{Token: num.Token, Value: num.Value + num.Value}
+			}
+			return n
+		})
+
+		values := []string{}
+		ast.Inspect(node, func(n ast.Node) bool {
+			if num, ok := n.(*ast.Num); ok {
+				values = append(values, num.Value)
+			}
+			return true
+		})
+		assert.Equal([]string{"11", "22", "33"}, values)
+	})
+
+	t.Run("removes statements", func(t *testing.T) {
+		p := parser.Parser{}
+		node, err := p.Parse("test.ca", "1\n\"foo\"\n2")
+		if !assert.Nil(err) {
+			return
+		}
+
+		node = ast.Rewrite(node, func(n ast.Node) ast.Node {
+			if _, ok := n.(*ast.String); ok {
+				return nil
+			}
+			return n
+		})
+
+		assert.Equal("SourceFile( StatementList(Num(1:INTEGER); Num(2:INTEGER)))", node.String())
+	})
+
+	t.Run("panics when a replacement does not fit its parent", func(t *testing.T) {
+		p := parser.Parser{}
+		node, err := p.Parse("test.ca", "foo := 1")
+		if !assert.Nil(err) {
+			return
+		}
+
+		assert.Panics(func() {
+			ast.Rewrite(node, func(n ast.Node) ast.Node {
+				if _, ok := n.(*ast.Variable); ok {
+					return &ast.Num{Value: "1"}
+				}
+				return n
+			})
+		})
+	})
+}
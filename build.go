@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/fchoquet/cairn/checker"
+	"github.com/fchoquet/cairn/gogen"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/modules"
+	"github.com/fchoquet/cairn/watgen"
+)
+
+// build implements the build command
+func build(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	emit := flags.String("emit", "go", "the generated language: go, or wat for the WebAssembly text format")
+	pkg := flags.String("package", "main", "the package of the generated Go file")
+	output := flags.String("o", "", "write the generated code to this file instead of the standard output")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || (*emit != "go" && *emit != "wat") {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	node, err := parseFile(flags.Arg(0))
+	if err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+
+	// the program is checked like before it runs. The generated code keeps the global variables
+	// in typed variables: they can not change their types
+	c := checker.New()
+	c.Builtins = interpreter.Signatures()
+	c.StaticGlobals = true
+	if err := c.Check(&modules.Module{Path: node.Pos().File, File: node}); err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+
+	var code []byte
+	if *emit == "wat" {
+		code, err = watgen.Generate(node, c)
+	} else {
+		code, err = gogen.Generate(node, c, *pkg)
+	}
+	if err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+	if *output == "" {
+		fmt.Print(string(code))
+		return 0
+	}
+	if err := ioutil.WriteFile(*output, code, 0644); err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,164 @@
+// Package cfg builds control flow graphs of cairn function bodies
+package cfg
+
+import (
+	"github.com/fchoquet/cairn/ast"
+)
+
+// BlockKind tells entry and exit blocks apart from the blocks holding statements
+type BlockKind string
+
+// Block kinds
+const (
+	Entry BlockKind = "entry"
+	Exit  BlockKind = "exit"
+	Body  BlockKind = "body"
+)
+
+// Block is a basic block: a sequence of statements always executed one after another
+type Block struct {
+	Index      int
+	Kind       BlockKind
+	Statements []ast.Node
+	Succs      []*Block
+	Preds      []*Block
+}
+
+// Graph is the control flow graph of a function
+type Graph struct {
+	Name   string
+	Entry  *Block
+	Exit   *Block
+	Blocks []*Block
+}
+
+// Build returns the control flow graph of a function
+func Build(f *ast.FuncDecl) *Graph {
+	var body *ast.StatementList
+	if f.Body != nil {
+		body = f.Body.Statements
+	}
+	return BuildStatements(f.Name.Value, body)
+}
+
+// BuildStatements returns the control flow graph of a list of statements
+func BuildStatements(name string, sl *ast.StatementList) *Graph {
+	b := &builder{graph: &Graph{Name: name}}
+	b.graph.Entry = b.newBlock(Entry)
+	b.current = b.newBlock(Body)
+	b.jump(b.graph.Entry, b.current)
+
+	b.statementList(sl)
+
+	b.graph.Exit = b.newBlock(Exit)
+	b.jump(b.current, b.graph.Exit)
+	return b.graph
+}
+
+// BuildFile returns the control flow graphs of every function of a file,
+// followed by the graph of its top level statements, named "main"
+func BuildFile(f *ast.SourceFile) []*Graph {
+	graphs := []*Graph{}
+	for _, fn := range f.Functions {
+		graphs = append(graphs, Build(fn))
+	}
+	return append(graphs, BuildStatements("main", f.Statements))
+}
+
+// Unreachable returns the blocks that can not be reached from the entry block
+func (g *Graph) Unreachable() []*Block {
+	reached := map[*Block]bool{}
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		if reached[b] {
+			return
+		}
+		reached[b] = true
+		for _, succ := range b.Succs {
+			visit(succ)
+		}
+	}
+	visit(g.Entry)
+
+	unreachable := []*Block{}
+	for _, b := range g.Blocks {
+		if !reached[b] {
+			unreachable = append(unreachable, b)
+		}
+	}
+	return unreachable
+}
+
+type builder struct {
+	graph   *Graph
+	current *Block
+}
+
+func (b *builder) newBlock(kind BlockKind) *Block {
+	block := &Block{
+		Index:      len(b.graph.Blocks),
+		Kind:       kind,
+		Statements: []ast.Node{},
+		Succs:      []*Block{},
+		Preds:      []*Block{},
+	}
+	b.graph.Blocks = append(b.graph.Blocks, block)
+	return block
+}
+
+func (b *builder) jump(from, to *Block) {
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+func (b *builder) statementList(sl *ast.StatementList) {
+	if sl == nil {
+		return
+	}
+	for _, st := range sl.Statements {
+		b.statement(st)
+	}
+}
+
+func (b *builder) statement(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.BlockStmt:
+		// blocks only introduce a new scope. They do not change the control flow
+		b.statementList(n.Statements)
+	case *ast.Match:
+		// the subject is evaluated, then the control flows through one of the arms
+		b.current.Statements = append(b.current.Statements, n.Subject)
+		head := b.current
+		ends := []*Block{}
+		for _, arm := range n.Arms {
+			b.current = b.newBlock(Body)
+			b.jump(head, b.current)
+			b.statement(arm.Body)
+			ends = append(ends, b.current)
+		}
+
+		b.current = b.newBlock(Body)
+		for _, end := range ends {
+			b.jump(end, b.current)
+		}
+	case *ast.Try:
+		// any statement of the body may fail: the control flows through the handler
+		// when it does
+		head := b.current
+		b.current = b.newBlock(Body)
+		b.jump(head, b.current)
+		b.statement(n.Body)
+		body := b.current
+
+		b.current = b.newBlock(Body)
+		b.jump(head, b.current)
+		b.statement(n.Handler)
+		handler := b.current
+
+		b.current = b.newBlock(Body)
+		b.jump(body, b.current)
+		b.jump(handler, b.current)
+	default:
+		b.current.Statements = append(b.current.Statements, node)
+	}
+}
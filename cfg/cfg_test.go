@@ -0,0 +1,113 @@
+package cfg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild(t *testing.T) {
+	assert := assert.New(t)
+
+	p := parser.Parser{}
+	node, err := p.Parse("test.ca", "func add(a:int, b:int) :int\n    c := a + b\n        c\nadd")
+	if !assert.Nil(err) {
+		return
+	}
+
+	graphs := BuildFile(node.(*ast.SourceFile))
+	if !assert.Len(graphs, 2) {
+		return
+	}
+
+	t.Run("functions", func(t *testing.T) {
+		g := graphs[0]
+		assert.Equal("add", g.Name)
+		if !assert.Len(g.Blocks, 3) {
+			return
+		}
+
+		assert.Equal(Entry, g.Entry.Kind)
+		assert.Equal(Exit, g.Exit.Kind)
+		assert.Equal([]*Block{g.Blocks[1]}, g.Entry.Succs)
+		assert.Equal([]*Block{g.Exit}, g.Blocks[1].Succs)
+		assert.Equal([]*Block{g.Blocks[1]}, g.Exit.Preds)
+
+		// nested blocks do not change the control flow
+		body := g.Blocks[1]
+		if !assert.Len(body.Statements, 2) {
+			return
+		}
+		assert.Equal("Assign(Variable(c) BinOp(+:PLUS Variable(a) Variable(b)))", body.Statements[0].String())
+		assert.Equal("Variable(c)", body.Statements[1].String())
+		assert.Empty(g.Unreachable())
+	})
+
+	t.Run("top level statements", func(t *testing.T) {
+		g := graphs[1]
+		assert.Equal("main", g.Name)
+		assert.Len(g.Blocks, 3)
+		assert.Equal("Variable(add)", g.Blocks[1].Statements[0].String())
+	})
+
+	t.Run("match arms", func(t *testing.T) {
+		p := parser.Parser{}
+		node, err := p.Parse("test.ca", "x := 1\nmatch x\n    1 -> \"one\"\n    _ ->\n        y := x\n        y\nx")
+		if !assert.Nil(err) {
+			return
+		}
+
+		g := BuildFile(node.(*ast.SourceFile))[0]
+		// entry, head, 2 arms, join, exit
+		if !assert.Len(g.Blocks, 6) {
+			return
+		}
+		head, one, other, join := g.Blocks[1], g.Blocks[2], g.Blocks[3], g.Blocks[4]
+		assert.Equal("Variable(x)", head.Statements[1].String())
+		assert.Equal([]*Block{one, other}, head.Succs)
+		assert.Equal("String(one:STRING)", one.Statements[0].String())
+		assert.Len(other.Statements, 2)
+		assert.Equal([]*Block{one, other}, join.Preds)
+		assert.Equal([]*Block{g.Exit}, join.Succs)
+		assert.Empty(g.Unreachable())
+	})
+
+	t.Run("try", func(t *testing.T) {
+		p := parser.Parser{}
+		node, err := p.Parse("test.ca", "x := 1\ntry\n    x / 0\ncatch e\n    0\nx")
+		if !assert.Nil(err) {
+			return
+		}
+
+		g := BuildFile(node.(*ast.SourceFile))[0]
+		// entry, head, body, handler, join, exit
+		if !assert.Len(g.Blocks, 6) {
+			return
+		}
+		head, body, handler, join := g.Blocks[1], g.Blocks[2], g.Blocks[3], g.Blocks[4]
+		assert.Equal([]*Block{body, handler}, head.Succs)
+		assert.Equal("BinOp(/:DIV Variable(x) Num(0:INTEGER))", body.Statements[0].String())
+		assert.Equal("Num(0:INTEGER)", handler.Statements[0].String())
+		assert.Equal([]*Block{body, handler}, join.Preds)
+		assert.Equal("Variable(x)", join.Statements[0].String())
+		assert.Empty(g.Unreachable())
+	})
+
+	t.Run("unreachable blocks", func(t *testing.T) {
+		g := graphs[0]
+		orphan := &Block{Index: len(g.Blocks), Kind: Body}
+		g.Blocks = append(g.Blocks, orphan)
+		assert.Equal([]*Block{orphan}, g.Unreachable())
+
+		buf := &bytes.Buffer{}
+		if !assert.Nil(WriteDot(buf, g)) {
+			return
+		}
+		assert.Contains(buf.String(), `g0b3 [label="" style=filled fillcolor=lightgrey];`)
+		assert.Contains(buf.String(), `g0b0 -> g0b1;`)
+		assert.Contains(buf.String(), `g0b1 -> g0b2;`)
+	})
+}
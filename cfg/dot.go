@@ -0,0 +1,62 @@
+package cfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+)
+
+// WriteDot writes a Graphviz DOT graph holding one cluster per control flow graph.
+// Unreachable blocks are filled in grey.
+func WriteDot(w io.Writer, graphs ...*Graph) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintln(buf, "digraph CFG {")
+	fmt.Fprintln(buf, "    node [shape=box fontname=monospace];")
+
+	for index, g := range graphs {
+		unreachable := map[*Block]bool{}
+		for _, b := range g.Unreachable() {
+			unreachable[b] = true
+		}
+
+		fmt.Fprintf(buf, "    subgraph cluster_%d {\n", index)
+		fmt.Fprintf(buf, "        label=%s;\n", ast.DotQuote(g.Name))
+		for _, b := range g.Blocks {
+			attrs := ""
+			switch {
+			case b.Kind != Body:
+				attrs = " shape=ellipse"
+			case unreachable[b]:
+				attrs = " style=filled fillcolor=lightgrey"
+			}
+			fmt.Fprintf(buf, "        %s [label=%s%s];\n", blockID(index, b), ast.DotQuote(blockLabel(b)), attrs)
+		}
+		for _, b := range g.Blocks {
+			for _, succ := range b.Succs {
+				fmt.Fprintf(buf, "        %s -> %s;\n", blockID(index, b), blockID(index, succ))
+			}
+		}
+		fmt.Fprintln(buf, "    }")
+	}
+
+	fmt.Fprintln(buf, "}")
+	return buf.Flush()
+}
+
+func blockID(graph int, b *Block) string {
+	return fmt.Sprintf("g%db%d", graph, b.Index)
+}
+
+func blockLabel(b *Block) string {
+	if b.Kind != Body {
+		return string(b.Kind)
+	}
+	lines := []string{}
+	for _, st := range b.Statements {
+		lines = append(lines, st.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,69 @@
+package checker
+
+import (
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+)
+
+// Builtin is the signature of a function of the host.
+// Besides the usual types, a builtin accepts the pseudo types any and number (an int or a float).
+// A number result has the type of its arguments, and a builtin returning nothing has no known result
+type Builtin struct {
+	Params []Param
+	Result string
+}
+
+// Param is a parameter of a builtin function
+type Param struct {
+	Name string
+	Type string
+}
+
+// accepts tells whether a builtin may receive a value of a type
+func accepts(typeName string, t typ) bool {
+	switch {
+	case isAny(t), typeName == "any":
+		return true
+	case typeName == "number":
+		return isNumber(t)
+	case strings.HasPrefix(typeName, "["):
+		return t.name == ast.ListType && accepts(typeName[1:len(typeName)-1], t.args[0])
+	default:
+		return t.sum == nil && !t.param && t.name == typeName
+	}
+}
+
+// builtinResult returns the type of the value returned by a builtin.
+// fail returns nothing, but it is called where a value is expected: its result is not known
+func builtinResult(b Builtin, args []typ) typ {
+	switch {
+	case b.Result == "nothing", b.Result == "any":
+		return anyType
+	case b.Result == "number":
+		return numberResult(args)
+	case strings.HasPrefix(b.Result, "["):
+		return listOf(typ{name: b.Result[1 : len(b.Result)-1]})
+	default:
+		return typ{name: b.Result}
+	}
+}
+
+// numberResult returns the type of an operation on numbers: integers are promoted to floats
+// when they are mixed
+func numberResult(operands []typ) typ {
+	result := typ{name: "int"}
+	for _, t := range operands {
+		switch {
+		case t.name == "float" && t.sum == nil && !t.param:
+			return t
+		case isAny(t):
+			result = anyType
+		}
+	}
+	return result
+}
+
+func isNumber(t typ) bool {
+	return t.sum == nil && !t.param && (t.name == "int" || t.name == "float")
+}
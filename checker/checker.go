@@ -0,0 +1,331 @@
+// Package checker verifies a program before it runs.
+//
+// It checks the declarations of sum types and the match expressions: patterns must use
+// the constructors of a single type with the right number of fields, and the arms of a
+// match must cover every value of the matched type.
+//
+// It also infers the types of the expressions, and checks the calls against the signatures of
+// the functions and the constructors, and the bodies of the functions against their return types.
+// Inside a generic function, a type parameter stands for any type: its values can only be passed
+// where the same type parameter is expected. The values whose types can not be known before the
+// program runs, such as the global variables read by a function, are checked by the interpreter.
+package checker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/modules"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// Errors lists the errors found by a check
+type Errors []*tokens.Error
+
+func (e Errors) Error() string {
+	messages := []string{}
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Checker checks modules. It keeps the types declared by the main module, so that the inputs
+// of a REPL can be checked one after another
+type Checker struct {
+	// Builtins are the functions of the host, called when no function or constructor has their name
+	Builtins map[string]Builtin
+	// StaticGlobals tells that the global variables keep their types, as in compiled programs:
+	// the functions reading them know their types
+	StaticGlobals bool
+
+	main *scope
+	// modules are the imported modules that have been checked, indexed by path
+	modules map[string]*scope
+	// types holds the types inferred for the expressions by the last check
+	types map[ast.Node]typ
+}
+
+// scope holds the names declared by a module
+type scope struct {
+	types        map[string]*sumType
+	constructors map[string]*constructor
+	functions    map[string]*ast.FuncDecl
+	imports      map[string]*scope
+}
+
+func newScope() *scope {
+	return &scope{
+		types:        map[string]*sumType{},
+		constructors: map[string]*constructor{},
+		functions:    map[string]*ast.FuncDecl{},
+		imports:      map[string]*scope{},
+	}
+}
+
+// typ is a type known by the checker. Primitive types have no sum type.
+// The type of the values that can not be known before running the program is any
+type typ struct {
+	name string
+	sum  *sumType
+	// args are the types of the elements of lists and tuples, and the type arguments of sum types
+	args []typ
+	// param is set for the type parameters of the generic function being checked
+	param bool
+}
+
+var anyType = typ{name: "any"}
+
+type sumType struct {
+	name string
+	// params is the number of type parameters of a generic type
+	params       int
+	constructors []*constructor
+	decl         *ast.TypeDecl
+	// scope is the scope of the module declaring the type
+	scope *scope
+}
+
+// constructor builds the values of a sum type. true and false are the constructors of bool
+type constructor struct {
+	name   string
+	sum    *sumType
+	fields []typ
+	decl   *ast.Constructor
+}
+
+var boolConstructors = []*constructor{{name: "true"}, {name: "false"}}
+
+// New creates a checker
+func New() *Checker {
+	return &Checker{
+		main:    newScope(),
+		modules: map[string]*scope{},
+		types:   map[ast.Node]typ{},
+	}
+}
+
+// Check verifies a module and the modules it imports.
+// The errors are returned as Errors
+func (c *Checker) Check(m *modules.Module) error {
+	errs := Errors{}
+	c.types = map[ast.Node]typ{}
+	c.checkModule(c.main, m, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Checker) checkModule(s *scope, m *modules.Module, errs *Errors) {
+	for _, decl := range m.File.Imports {
+		imported := m.Imports[decl.Name]
+		if imported == nil {
+			continue
+		}
+		is, ok := c.modules[imported.Path]
+		if !ok {
+			is = newScope()
+			count := len(*errs)
+			c.checkModule(is, imported, errs)
+			if len(*errs) > count {
+				continue
+			}
+			c.modules[imported.Path] = is
+		}
+		s.imports[decl.Name] = is
+	}
+
+	c.declareTypes(s, m.File, errs)
+	c.checkFunctions(s, m.File, errs)
+
+	ast.Inspect(m.File, func(node ast.Node) bool {
+		if match, ok := node.(*ast.Match); ok {
+			c.checkMatch(s, match, errs)
+		}
+		return true
+	})
+	c.checkBodies(s, m.File, errs)
+}
+
+func errorf(errs *Errors, node ast.Node, format string, args ...interface{}) {
+	errorAt(errs, node.Pos(), format, args...)
+}
+
+func errorAt(errs *Errors, pos tokens.Position, format string, args ...interface{}) {
+	*errs = append(*errs, &tokens.Error{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// declareTypes adds the types declared by a file to a scope.
+// Types are all declared before their fields are resolved, so that they can refer to each other
+func (c *Checker) declareTypes(s *scope, file *ast.SourceFile, errs *Errors) {
+	functions := map[string]bool{}
+	for _, f := range file.Functions {
+		functions[f.Name.Value] = true
+	}
+
+	types := map[string]bool{}
+	constructors := map[string]bool{}
+	for _, decl := range file.Types {
+		if types[decl.Name.Value] {
+			errorf(errs, decl, "type %s is already declared", decl.Name.Value)
+		}
+		types[decl.Name.Value] = true
+
+		t := &sumType{name: decl.Name.Value, params: len(decl.Params), decl: decl, scope: s}
+		s.types[t.name] = t
+		for _, cd := range decl.Constructors {
+			switch {
+			case constructors[cd.Name]:
+				errorf(errs, cd, "constructor %s is already declared", cd.Name)
+			case functions[cd.Name]:
+				errorf(errs, cd, "constructor %s is already declared as a function", cd.Name)
+			}
+			constructors[cd.Name] = true
+
+			k := &constructor{name: cd.Name, sum: t, decl: cd}
+			t.constructors = append(t.constructors, k)
+			s.constructors[k.name] = k
+		}
+	}
+
+	for _, decl := range file.Types {
+		t := s.types[decl.Name.Value]
+		params := c.declareParams(s, decl.Params, errs)
+		for index, cd := range decl.Constructors {
+			k := t.constructors[index]
+			names := map[string]bool{}
+			for _, field := range cd.Fields {
+				if names[field.Name] {
+					errorf(errs, field, "field %s of %s is already declared", field.Name, cd.Name)
+				}
+				names[field.Name] = true
+
+				ft, unknown := c.resolve(s, field.Type, params, errs)
+				if unknown != "" {
+					errorf(errs, field.Type, "unknown type %s", unknown)
+				}
+				k.fields = append(k.fields, ft)
+			}
+		}
+	}
+}
+
+// checkFunctions verifies the type parameters of the functions declared by a file, and adds
+// the functions to the scope. The type arguments of a generic function are inferred from the
+// arguments of its calls, so every type parameter must be used by the parameters of the function.
+// Unknown types are reported by the interpreter, when the function is declared
+func (c *Checker) checkFunctions(s *scope, file *ast.SourceFile, errs *Errors) {
+	for _, f := range file.Functions {
+		s.functions[f.Name.Value] = f
+		params := c.declareParams(s, f.Signature.TypeParams, errs)
+		used := map[string]bool{}
+		for _, p := range f.Signature.Parameters.Parameters {
+			c.resolve(s, p.Type, params, errs)
+			ast.Inspect(p.Type, func(node ast.Node) bool {
+				if t, ok := node.(*ast.TypeId); ok {
+					used[t.Name] = true
+				}
+				return true
+			})
+		}
+		c.resolve(s, f.Signature.ReturnType, params, errs)
+
+		for _, tk := range f.Signature.TypeParams {
+			if !used[tk.Value] {
+				errorAt(errs, tk.Position, "type parameter %s of %s can not be inferred: no parameter uses it", tk.Value, f.Name.Value)
+			}
+		}
+	}
+}
+
+// declareParams returns the type parameters of a generic declaration
+func (c *Checker) declareParams(s *scope, tks []*tokens.Token, errs *Errors) map[string]bool {
+	params := map[string]bool{}
+	for _, tk := range tks {
+		if _, ok := c.resolveName(s, tk.Value); ok {
+			errorAt(errs, tk.Position, "type parameter %s is already declared as a type", tk.Value)
+		} else if params[tk.Value] {
+			errorAt(errs, tk.Position, "type parameter %s is already declared", tk.Value)
+		}
+		params[tk.Value] = true
+	}
+	return params
+}
+
+// resolve returns the type named by a type identifier, in a declaration that has type parameters.
+// Type parameters, lists and tuples are types whose values can not be enumerated, like primitive types.
+// The number of type arguments is checked, and the first unknown type name is returned
+func (c *Checker) resolve(s *scope, t *ast.TypeId, params map[string]bool, errs *Errors) (result typ, unknown string) {
+	for _, arg := range t.Args {
+		if _, u := c.resolve(s, arg, params, errs); unknown == "" {
+			unknown = u
+		}
+	}
+
+	expected := 0
+	switch {
+	case t.Name == ast.ListType, t.Name == ast.TupleType:
+		return typ{name: t.TypeName()}, unknown
+	case params[t.Name]:
+		result = anyType
+	default:
+		named, ok := c.resolveName(s, t.Name)
+		if !ok {
+			return anyType, t.Name
+		}
+		result = typ{name: t.TypeName(), sum: named.sum}
+		if named.sum != nil {
+			expected = named.sum.params
+		}
+	}
+
+	if len(t.Args) != expected {
+		errorf(errs, t, "type %s expects %d type arguments - got %d", t.Name, expected, len(t.Args))
+	}
+	return result, unknown
+}
+
+// resolveName returns the type of a type name
+func (c *Checker) resolveName(s *scope, name string) (typ, bool) {
+	switch name {
+	case "int", "float", "string", "bool", "Error":
+		return typ{name: name}, true
+	}
+
+	if index := strings.IndexByte(name, '.'); index >= 0 {
+		imported, ok := s.imports[name[:index]]
+		if !ok || !modules.IsExported(name[index+1:]) {
+			return anyType, false
+		}
+		t, ok := imported.types[name[index+1:]]
+		if !ok {
+			return anyType, false
+		}
+		return typ{name: name, sum: t}, true
+	}
+
+	t, ok := s.types[name]
+	if !ok {
+		return anyType, false
+	}
+	return typ{name: name, sum: t}, true
+}
+
+// lookupConstructor returns the constructor of a pattern and its type
+func (c *Checker) lookupConstructor(s *scope, p *ast.ConstructorPattern) (*constructor, *sumType, bool) {
+	if p.Module != "" {
+		imported, ok := s.imports[p.Module]
+		if !ok {
+			return nil, nil, false
+		}
+		s = imported
+	}
+
+	k, ok := s.constructors[p.Name]
+	if !ok {
+		return nil, nil, false
+	}
+	return k, k.sum, true
+}
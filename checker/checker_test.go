@@ -0,0 +1,248 @@
+package checker
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/modules"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const shapes = "type Shape = Circle(r:int) | Rect(w:int, h:int) | Empty\n"
+
+const lists = "type List = Nil | Cons(head:int, tail:List)\n"
+
+func check(c *Checker, source string) error {
+	p := parser.Parser{}
+	node, err := p.Parse("test.ca", source)
+	if err != nil {
+		return fmt.Errorf("can not parse %s: %s", source, err)
+	}
+	return c.Check(&modules.Module{Path: "test.ca", File: node.(*ast.SourceFile)})
+}
+
+func TestChecker(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("valid programs", func(t *testing.T) {
+		fixtures := []string{
+			shapes + "match s\n    Circle(r) -> r\n    Rect(w, h) -> w * h\n    Empty -> 0",
+			shapes + "match s\n    Circle(1) -> 1\n    Circle(_) -> 2\n    _ -> 0",
+			shapes + "func area(s:Shape) :int\n    match s\n        Circle(r) -> r\n        other -> 0\n1",
+			lists + "match l\n    Nil -> 0\n    Cons(_, Nil) -> 1\n    Cons(_, Cons(_, _)) -> 2",
+			lists + "match l\n    Cons(1, tail) -> 1\n    Cons(h, tail) -> h\n    Nil -> 0",
+			"type Opt = None | Some(v:bool)\nmatch o\n    Some(true) -> 1\n    Some(false) -> 2\n    None -> 3",
+			"match b\n    true -> 1\n    false -> 0",
+			"match n\n    1 -> 1\n    -1 -> 2\n    _ -> 3",
+			"match s\n    \"a\" -> 1\n    other -> 2",
+			// nested matches are checked too
+			shapes + "match s\n    Circle(r) ->\n        match r\n            0 -> 0\n            _ -> 1\n    _ -> 2",
+			"type A = X(b:B) | Y\ntype B = Z(a:A)\nmatch a\n    X(Z(Y)) -> 1\n    X(Z(X(_))) -> 2\n    Y -> 3",
+			// the fields of generic types can hold any type
+			"type Option[T] = None | Some(value:T)\nmatch o\n    Some(1) -> 1\n    Some(_) -> 2\n    None -> 3",
+			"type List[T] = Nil | Cons(head:T, tail:List[T])\nmatch l\n    Cons(_, Nil) -> 1\n    Cons(_, Cons(_, _)) -> 2\n    Nil -> 0",
+			"type Pair[A, B] = Pair(first:A, second:[B])\nfunc swap[A, B](p:Pair[A, B]) :Pair[[B], A]\n    match p\n        Pair(a, bs) -> Pair(bs, [a])\n1",
+			"func first[T](xs:[T], default:T) :T\n    default\nfunc f(x:Unknown) :int\n    1\n1",
+			"type Result[T] = Ok(value:T) | Err(error:Error)\nmatch r\n    Ok(v) -> v\n    Err(e) -> 0",
+		}
+
+		for _, source := range fixtures {
+			assert.Nil(check(New(), source), source)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			err    string
+		}{
+			{shapes + "match s\n    Circle(r) -> r\n    Empty -> 0", "test.ca:2:1: match is not exhaustive: Rect(_, _) is not covered"},
+			{shapes + "match s\n    Circle(1) -> r\n    Rect(_, _) -> 0\n    Empty -> 0", "test.ca:2:1: match is not exhaustive: Circle(_) is not covered"},
+			{lists + "match l\n    Nil -> 0\n    Cons(_, Nil) -> 1", "test.ca:2:1: match is not exhaustive: Cons(_, Cons(_, _)) is not covered"},
+			{"type Opt = None | Some(v:bool)\nmatch o\n    Some(true) -> 1\n    None -> 3", "test.ca:2:1: match is not exhaustive: Some(false) is not covered"},
+			{"match b\n    true -> 1", "test.ca:1:1: match is not exhaustive: false is not covered"},
+			{"match n\n    1 -> 1", "test.ca:1:1: match is not exhaustive: _ is not covered"},
+			{shapes + "match s\n    Square(r) -> r\n    _ -> 0", "test.ca:3:5: unknown constructor Square"},
+			{shapes + "match s\n    Circle(r, 1) -> r\n    _ -> 0", "test.ca:3:5: Circle expects 1 fields - got 2"},
+			{shapes + "match s\n    Circle(\"a\") -> 1\n    _ -> 0", `test.ca:3:12: Expected a pattern of type int - got "a" of type string`},
+			{shapes + "type Color = Red | Green\nmatch s\n    Circle(r) -> r\n    Red -> 0\n    _ -> 0", "test.ca:5:5: Expected a pattern of type Shape - got Red of type Color"},
+			{"match n\n    1 -> 1\n    1.5 -> 2\n    _ -> 0", "test.ca:3:5: Expected a pattern of type int - got 1.5 of type float"},
+			{"type Shape = Circle(r:int)\ntype Shape = Rect(w:int)\n1", "test.ca:2:1: type Shape is already declared"},
+			{"type Shape = Circle(r:int) | Circle(d:int)\n1", "test.ca:1:30: constructor Circle is already declared"},
+			{"type Shape = Circle(r:int)\nfunc Circle() :int\n    1\n1", "test.ca:1:14: constructor Circle is already declared as a function"},
+			{"type Shape = Rect(w:int, w:int)\n1", "test.ca:1:26: field w of Rect is already declared"},
+			{"type Shape = Circle(r:Radius)\n1", "test.ca:1:22: unknown type Radius"},
+			{"type Option[T] = None | Some(value:T)\nmatch o\n    Some(1) -> 1\n    None -> 3", "test.ca:2:1: match is not exhaustive: Some(_) is not covered"},
+			{"type Option[T] = None | Some(value:T)\nfunc f(o:Option) :int\n    1\n1", "test.ca:2:9: type Option expects 1 type arguments - got 0"},
+			{"type Option[T] = None | Some(value:T)\ntype Box = Box(v:Option[int, int])\n1", "test.ca:2:17: type Option expects 1 type arguments - got 2"},
+			{"type Box[T] = Box(v:T[int])\n1", "test.ca:1:20: type T expects 0 type arguments - got 1"},
+			{"func f(x:[int[bool]]) :int\n    1\n1", "test.ca:1:11: type int expects 0 type arguments - got 1"},
+			{"type Box[T] = Box(v:[Value])\n1", "test.ca:1:20: unknown type Value"},
+			{"func f[T, T](x:T) :T\n    x\n1", "test.ca:1:11: type parameter T is already declared"},
+			{"type Box[string] = Box(v:string)\n1", "test.ca:1:10: type parameter string is already declared as a type"},
+			{"func empty[T]() :[T]\n    []\n1", "test.ca:1:12: type parameter T of empty can not be inferred: no parameter uses it"},
+			{
+				"match b\n    true -> 1\nmatch n\n    1 -> 1",
+				"test.ca:1:1: match is not exhaustive: false is not covered\ntest.ca:3:1: match is not exhaustive: _ is not covered",
+			},
+		}
+
+		for _, f := range fixtures {
+			err := check(New(), f.source)
+			if _, ok := err.(Errors); assert.True(ok, f.source) {
+				assert.Equal(f.err, err.Error(), f.source)
+			}
+		}
+	})
+
+	t.Run("types", func(t *testing.T) {
+		builtins := map[string]Builtin{
+			"len": {Params: []Param{{"s", "string"}}, Result: "int"},
+			"max": {Params: []Param{{"a", "number"}, {"b", "number"}}, Result: "number"},
+			"println": {Params: []Param{{"value", "any"}}, Result: "nothing"},
+		}
+		valid := []string{
+			"func f[T](x:T) :T\n    x\nf(2) + 1",
+			"func first[T](xs:[T]) :T\n    xs[0]\nfirst([\"a\"]) ++ \"b\"",
+			"func f[A, B](a:A, b:B) :(B, A)\n    (b, a)\nx, y := f(1, \"a\")\nx ++ str(y)",
+			"func f[T](x:T, y:T) :bool\n    x == y\nf([], [1])",
+			"type Option[T] = None | Some(value:T)\nfunc get[T](o:Option[T], d:T) :T\n    match o\n        Some(v) -> v\n        None -> d\nget(None, 1) + get(Some(2), 0)",
+			"type Option[T] = None | Some(value:T)\nfunc wrap[T](x:T) :Option[T]\n    Some(x)\nfunc empty[T](x:T) :Option[T]\n    None\n1",
+			// the global variables read by functions are not known
+			"func f() :int\n    x\nx := \"a\"\n1",
+			// variables may be assigned values of another type
+			"x := 1\nx := \"a\"\nx ++ \"b\"",
+			"func f(b:bool) :int\n    match b\n        true ->\n            x := 1\n        false ->\n            x := \"a\"\n    x ++ \"b\"\n    1\n1",
+			"func f(n:int) :string\n    match n\n        0 -> fail(\"zero\")\n        _ -> \"other\"\n1",
+			"max(1, 2.5) + 0.5",
+			"len(\"abc\") + max(1, 2)",
+			"println(1)",
+		}
+		for _, source := range valid {
+			c := New()
+			c.Builtins = builtins
+			assert.Nil(check(c, source), source)
+		}
+
+		fixtures := []struct {
+			source string
+			err    string
+		}{
+			{"func f[T](x:T) :T\n    1\nf(2)", "test.ca:2:5: f must return a T - got int"},
+			{"func f[T](x:T) :int\n    x\n1", "test.ca:2:5: f must return a int - got T"},
+			{"func f[T](x:T) :int\n    x + 1\n1", "test.ca:2:7: operator + is not defined on T and int"},
+			{"func f[T, U](x:T, y:U) :bool\n    x == y\n1", "test.ca:2:7: can not compare T and U"},
+			{"func f[T](x:T, y:T) :T\n    x\nf(1, \"a\")", "test.ca:3:6: argument y of f must be a T = int - got string"},
+			{"func f(x:int) :int\n    x\nf(\"a\")", "test.ca:3:3: argument x of f must be a int - got string"},
+			{"func f(x:int) :int\n    x\nf(1, 2)", "test.ca:3:1: f expects 1 arguments - got 2"},
+			{"func f(x:int) :string\n    x\n1", "test.ca:2:5: f must return a string - got int"},
+			{"func f(x:int) :string\n    y := x * 2\n    y\n1", "test.ca:3:5: f must return a string - got int"},
+			{"func f(xs:[int]) :int\n    xs\n1", "test.ca:2:5: f must return a int - got [int]"},
+			{"func f() :(int, string)\n    (\"a\", 1)\n1", "test.ca:2:5: f must return a (int, string) - got (string, int)"},
+			{"type Option[T] = None | Some(value:T)\nSome(1) == Some(\"a\")", "test.ca:2:9: can not compare Option[int] and Option[string]"},
+			{"type Option[T] = None | Some(value:T)\nfunc f(o:Option[int]) :int\n    1\nf(Some(\"a\"))", "test.ca:4:3: argument o of f must be a Option[int] - got Option[string]"},
+			{"type Box = Box(v:int)\nmatch Box(1)\n    Box(v) -> v ++ \"\"", "test.ca:3:17: operator ++ is not defined on int and string"},
+			{"len(1)", "test.ca:1:5: argument s of len must be a string - got int"},
+			{"len(\"a\") ++ \"b\"", "test.ca:1:10: operator ++ is not defined on int and string"},
+			{"max(1, \"a\")", "test.ca:1:8: argument b of max must be a number - got string"},
+			{"x := 1\nx := \"a\"\nx + 1", "test.ca:3:3: operator + is not defined on string and int"},
+			{
+				"func f(x:int) :string\n    x\nf(\"a\")",
+				"test.ca:2:5: f must return a string - got int\ntest.ca:3:3: argument x of f must be a int - got string",
+			},
+		}
+		for _, f := range fixtures {
+			c := New()
+			c.Builtins = builtins
+			err := check(c, f.source)
+			if _, ok := err.(Errors); assert.True(ok, f.source) {
+				assert.Equal(f.err, err.Error(), f.source)
+			}
+		}
+	})
+
+	t.Run("types of expressions", func(t *testing.T) {
+		source := "func f() :int\n    x + 1\nx := 2\ny := [x, 1]\nf()"
+		fixtures := []struct {
+			static   bool
+			function string
+			list     string
+		}{
+			{false, "", "[int]"},
+			{true, "int", "[int]"},
+		}
+		for _, f := range fixtures {
+			p := parser.Parser{}
+			node, err := p.Parse("test.ca", source)
+			if !assert.Nil(err) {
+				return
+			}
+			file := node.(*ast.SourceFile)
+
+			c := New()
+			c.StaticGlobals = f.static
+			assert.Nil(c.Check(&modules.Module{Path: "test.ca", File: file}))
+			assert.Equal(f.function, c.TypeOf(file.Functions[0].Body.Statements.Statements[0]))
+			assert.Equal(f.list, c.TypeOf(file.Statements.Statements[1].(*ast.Assignment).Right))
+		}
+
+		c := New()
+		c.StaticGlobals = true
+		assert.EqualError(check(c, "func f() :int\n    x\nx := \"a\"\n1"), "test.ca:2:5: f must return a int - got string")
+	})
+
+	t.Run("remembers the types of previous checks", func(t *testing.T) {
+		c := New()
+		assert.Nil(check(c, shapes+"1"))
+		assert.Nil(check(c, "match s\n    Circle(r) -> r\n    _ -> 0"))
+		assert.Error(check(c, "match s\n    Circle(r) -> r"))
+	})
+
+	t.Run("checks imported modules", func(t *testing.T) {
+		files := map[string]string{
+			"geo.cairn": shapes + "type point = Point(x:int, y:int)\n1",
+			"bad.cairn": "match b\n    true -> 1",
+		}
+		loader := modules.NewLoader()
+		loader.ReadFile = func(path string) ([]byte, error) {
+			if source, ok := files[path]; ok {
+				return []byte(source), nil
+			}
+			return nil, os.ErrNotExist
+		}
+
+		fixtures := []struct {
+			source string
+			err    string
+		}{
+			{"import \"geo\"\nmatch s\n    geo.Circle(r) -> r\n    geo.Rect(_, _) -> 0\n    geo.Empty -> 1", ""},
+			{"import \"geo\"\ntype Pair = Pair(a:geo.Shape, b:geo.Shape)\n1", ""},
+			{"import \"geo\"\nmatch s\n    geo.Circle(r) -> r", "test.ca:2:1: match is not exhaustive: Rect(_, _) is not covered"},
+			{"import \"geo\"\nmatch s\n    geo.Square(r) -> r\n    _ -> 0", "test.ca:3:5: unknown constructor geo.Square"},
+			{"import \"geo\"\ntype Pair = Pair(a:geo.point)\n1", "test.ca:2:19: unknown type geo.point"},
+			{"import \"bad\"\n1", "bad.cairn:1:1: match is not exhaustive: false is not covered"},
+		}
+
+		for _, f := range fixtures {
+			p := parser.Parser{}
+			node, err := p.Parse("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			m, err := loader.Link("test.ca", node.(*ast.SourceFile))
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+
+			err = New().Check(m)
+			if f.err == "" {
+				assert.Nil(err, f.source)
+			} else if assert.Error(err, f.source) {
+				assert.Equal(f.err, err.Error(), f.source)
+			}
+		}
+	})
+}
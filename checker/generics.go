@@ -0,0 +1,215 @@
+package checker
+
+import (
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// isAny tells whether a type is not known. It matches any type
+func isAny(t typ) bool {
+	return t.name == anyType.name && t.sum == nil && !t.param
+}
+
+// String formats a type like the interpreter formats the types of values: the parts that are not
+// known are written _
+func (t typ) String() string {
+	switch {
+	case isAny(t):
+		return "_"
+	case t.name == ast.ListType:
+		return "[" + t.args[0].String() + "]"
+	case len(t.args) == 0:
+		return t.name
+	}
+
+	args := []string{}
+	for _, a := range t.args {
+		args = append(args, a.String())
+	}
+	if t.name == ast.TupleType {
+		return "(" + strings.Join(args, ", ") + ")"
+	}
+	return t.name + "[" + strings.Join(args, ", ") + "]"
+}
+
+func listOf(elem typ) typ {
+	return typ{name: ast.ListType, args: []typ{elem}}
+}
+
+// holes returns n types that are not known
+func holes(n int) []typ {
+	types := []typ{}
+	for index := 0; index < n; index++ {
+		types = append(types, anyType)
+	}
+	return types
+}
+
+// merge combines two types of values that must have the same type, filling the parts of one type
+// that are not known with the other. It fails when the types are different
+func merge(a, b typ) (typ, bool) {
+	switch {
+	case isAny(a):
+		return b, true
+	case isAny(b):
+		return a, true
+	case a.name != b.name || a.sum != b.sum || a.param != b.param || len(a.args) != len(b.args):
+		return a, false
+	case len(a.args) == 0:
+		return a, true
+	}
+
+	args := []typ{}
+	for index := range a.args {
+		arg, ok := merge(a.args[index], b.args[index])
+		if !ok {
+			return a, false
+		}
+		args = append(args, arg)
+	}
+	return typ{name: a.name, sum: a.sum, args: args}, true
+}
+
+// join returns the type of a value that comes from one of several expressions. It is any
+// when their types are different, or when one of them is not known
+func join(types []typ) typ {
+	if len(types) == 0 {
+		return anyType
+	}
+	result := types[0]
+	for _, t := range types {
+		merged, ok := merge(result, t)
+		if !ok || isAny(t) {
+			return anyType
+		}
+		result = merged
+	}
+	return result
+}
+
+// bindings holds the types bound to the type parameters of a generic declaration.
+// The parameters that are not bound yet are mapped to any
+type bindings map[string]typ
+
+func newBindings(params []*tokens.Token) bindings {
+	b := bindings{}
+	for _, p := range params {
+		b[p.Value] = anyType
+	}
+	return b
+}
+
+// rigidBindings binds the type parameters of a generic function to themselves, to check its body
+func rigidBindings(params []*tokens.Token) bindings {
+	b := bindings{}
+	for _, p := range params {
+		b[p.Value] = typ{name: p.Value, param: true}
+	}
+	return b
+}
+
+// unify tells whether a value of type actual can be used where a type declared in a scope is expected.
+// The type parameters found in the declared type are bound to the types they stand for,
+// so that a type parameter used twice stands for the same type. The unknown types are reported
+// when they are declared: they match any type
+func (c *Checker) unify(s *scope, declared *ast.TypeId, actual typ, b bindings) bool {
+	if bound, ok := b[declared.Name]; ok && len(declared.Args) == 0 {
+		merged, ok := merge(bound, actual)
+		if ok {
+			b[declared.Name] = merged
+		}
+		return ok
+	}
+
+	switch {
+	case isAny(actual):
+		return true
+	case declared.Name == ast.ListType:
+		return actual.name == ast.ListType && c.unify(s, declared.Args[0], actual.args[0], b)
+	case declared.Name == ast.TupleType:
+		if actual.name != ast.TupleType || len(declared.Args) != len(actual.args) {
+			return false
+		}
+	default:
+		named, ok := c.resolveName(s, declared.Name)
+		switch {
+		case !ok:
+			return true
+		case named.sum == nil:
+			return actual.sum == nil && !actual.param && actual.name == declared.Name
+		case actual.sum != named.sum:
+			return false
+		case len(declared.Args) != named.sum.params:
+			return true
+		}
+	}
+
+	for index, arg := range declared.Args {
+		if !c.unify(s, arg, actual.args[index], b) {
+			return false
+		}
+	}
+	return true
+}
+
+// instantiate returns the type named by a type identifier declared in a scope, replacing the
+// type parameters by the types bound to them
+func (c *Checker) instantiate(s *scope, declared *ast.TypeId, b bindings) typ {
+	if bound, ok := b[declared.Name]; ok && len(declared.Args) == 0 {
+		return bound
+	}
+
+	args := []typ{}
+	for _, arg := range declared.Args {
+		args = append(args, c.instantiate(s, arg, b))
+	}
+	switch declared.Name {
+	case ast.ListType, ast.TupleType:
+		return typ{name: declared.Name, args: args}
+	}
+
+	named, ok := c.resolveName(s, declared.Name)
+	switch {
+	case !ok:
+		return anyType
+	case named.sum == nil:
+		return typ{name: declared.Name}
+	case len(args) != named.sum.params:
+		args = holes(named.sum.params)
+	}
+	return typ{name: named.sum.name, sum: named.sum, args: args}
+}
+
+// expectedType formats a declared type for error messages. When type parameters are bound,
+// the type they stand for is given too: [T] = [int]
+func expectedType(declared *ast.TypeId, b bindings) string {
+	name := declared.TypeName()
+	if s := substitute(declared, b); s != name {
+		return name + " = " + s
+	}
+	return name
+}
+
+// substitute formats a declared type, replacing the bound type parameters by their types
+func substitute(declared *ast.TypeId, b bindings) string {
+	if bound, ok := b[declared.Name]; ok && !isAny(bound) && len(declared.Args) == 0 {
+		return bound.String()
+	}
+	if declared.Name == ast.ListType {
+		return "[" + substitute(declared.Args[0], b) + "]"
+	}
+	if len(declared.Args) == 0 {
+		return declared.Name
+	}
+
+	args := []string{}
+	for _, a := range declared.Args {
+		args = append(args, substitute(a, b))
+	}
+	if declared.Name == ast.TupleType {
+		return "(" + strings.Join(args, ", ") + ")"
+	}
+	return declared.Name + "[" + strings.Join(args, ", ") + "]"
+}
@@ -0,0 +1,452 @@
+package checker
+
+import (
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/modules"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// env holds the types of the variables assigned so far by a function or by the top level statements
+type env map[string]typ
+
+func (e env) copy() env {
+	c := env{}
+	for name, t := range e {
+		c[name] = t
+	}
+	return c
+}
+
+// joinEnvs returns the types of the variables after one of several branches has run.
+// A variable keeps its type only when every branch gives it the same type
+func joinEnvs(envs []env) env {
+	joined := env{}
+	for _, e := range envs {
+		for name := range e {
+			types := []typ{}
+			for _, other := range envs {
+				t, ok := other[name]
+				if !ok {
+					t = anyType
+				}
+				types = append(types, t)
+			}
+			joined[name] = join(types)
+		}
+	}
+	return joined
+}
+
+// inference infers the types of the expressions of a function or of the top level statements
+type inference struct {
+	c    *Checker
+	s    *scope
+	errs *Errors
+	vars env
+}
+
+// checkBodies infers the types of the expressions of a file. The bodies of the functions must give
+// a value of their return types. Inside a generic function, a type parameter only matches itself.
+// Unless they are static, the global variables may be assigned a value of another type before
+// a function reads them: their types are not known, and neither are the types of the variables
+// of previous checks
+func (c *Checker) checkBodies(s *scope, file *ast.SourceFile, errs *Errors) {
+	globals := env{}
+	if c.StaticGlobals {
+		in := &inference{c: c, s: s, errs: errs, vars: env{}}
+		in.expr(file.Statements)
+		globals = in.vars
+	}
+
+	for _, f := range file.Functions {
+		b := rigidBindings(f.Signature.TypeParams)
+		in := &inference{c: c, s: s, errs: errs, vars: globals.copy()}
+		for _, p := range f.Signature.Parameters.Parameters {
+			in.vars[p.Name] = c.instantiate(s, p.Type, b)
+		}
+
+		result := in.expr(f.Body)
+		if !c.unify(s, f.Signature.ReturnType, result, b) {
+			errorf(errs, lastStatement(f.Body), "%s must return a %s - got %s", f.Name.Value, f.Signature.ReturnType.TypeName(), result)
+		}
+	}
+
+	if !c.StaticGlobals {
+		in := &inference{c: c, s: s, errs: errs, vars: env{}}
+		in.expr(file.Statements)
+	}
+}
+
+// TypeOf returns the type inferred for an expression by the last check,
+// formatted like the types of values. It is "" when the type is not known before the program runs
+func (c *Checker) TypeOf(node ast.Node) string {
+	t, ok := c.types[node]
+	if !ok || isAny(t) {
+		return ""
+	}
+	return t.String()
+}
+
+// lastStatement returns the statement that gives its value to a block
+func lastStatement(block *ast.BlockStmt) ast.Node {
+	statements := block.Statements.Statements
+	if len(statements) == 0 {
+		return block
+	}
+	if nested, ok := statements[len(statements)-1].(*ast.BlockStmt); ok {
+		return lastStatement(nested)
+	}
+	return statements[len(statements)-1]
+}
+
+// expr returns the type of the value of an expression, and records it for TypeOf.
+// It is any when an error was found
+func (in *inference) expr(node ast.Node) typ {
+	t := in.infer(node)
+	in.c.types[node] = t
+	return t
+}
+
+func (in *inference) infer(node ast.Node) typ {
+	switch n := node.(type) {
+	case *ast.StatementList:
+		result := anyType
+		for _, st := range n.Statements {
+			result = in.expr(st)
+		}
+		return result
+	case *ast.BlockStmt:
+		return in.expr(n.Statements)
+	case *ast.Num:
+		return typ{name: "int"}
+	case *ast.Float:
+		return typ{name: "float"}
+	case *ast.String:
+		return typ{name: "string"}
+	case *ast.Bool:
+		return typ{name: "bool"}
+	case *ast.Interpolation:
+		for _, part := range n.Parts {
+			in.expr(part)
+		}
+		return typ{name: "string"}
+	case *ast.Variable:
+		return in.variable(n)
+	case *ast.Assignment:
+		t := in.expr(n.Right)
+		in.vars[n.Variable.Name] = t
+		return t
+	case *ast.Destructuring:
+		return in.destructuring(n)
+	case *ast.UnaryOp:
+		return in.unaryOp(n)
+	case *ast.BinOp:
+		return in.binOp(n)
+	case *ast.TupleLit:
+		elements := []typ{}
+		for _, e := range n.Elements {
+			elements = append(elements, in.expr(e))
+		}
+		return typ{name: ast.TupleType, args: elements}
+	case *ast.ListLit:
+		return in.list(n)
+	case *ast.Index:
+		return in.index(n)
+	case *ast.FuncCall:
+		return in.call(n)
+	case *ast.Match:
+		return in.match(n)
+	case *ast.Try:
+		return in.try(n)
+	default:
+		return anyType
+	}
+}
+
+func (in *inference) variable(node *ast.Variable) typ {
+	s := in.s
+	if node.Module != "" {
+		imported, ok := s.imports[node.Module]
+		if !ok {
+			return anyType
+		}
+		s = imported
+	} else if t, ok := in.vars[node.Name]; ok {
+		return t
+	}
+
+	if k, ok := s.constructors[node.Name]; ok && len(k.fields) == 0 {
+		// the type arguments of a generic type can not be known without fields
+		return typ{name: k.sum.name, sum: k.sum, args: holes(k.sum.params)}
+	}
+	return anyType
+}
+
+func (in *inference) destructuring(node *ast.Destructuring) typ {
+	t := in.expr(node.Right)
+	elements := holes(len(node.Variables))
+	switch {
+	case isAny(t):
+	case t.name != ast.TupleType:
+		errorf(in.errs, node.Right, "%d variables expect a tuple - got %s", len(node.Variables), t)
+		t = anyType
+	case len(node.Variables) > len(t.args):
+		errorf(in.errs, node.Variables[len(t.args)], "%d variables for %d values", len(node.Variables), len(t.args))
+		t = anyType
+	case len(node.Variables) < len(t.args):
+		errorf(in.errs, node.Right, "%d variables for %d values", len(node.Variables), len(t.args))
+		t = anyType
+	default:
+		elements = t.args
+	}
+
+	for index, v := range node.Variables {
+		if v.Name != "_" {
+			in.vars[v.Name] = elements[index]
+		}
+	}
+	return t
+}
+
+func (in *inference) unaryOp(node *ast.UnaryOp) typ {
+	t := in.expr(node.Expr)
+	switch {
+	case isAny(t):
+		if node.Op.Type == tokens.NOT {
+			return typ{name: "bool"}
+		}
+		return anyType
+	case node.Op.Type == tokens.NOT:
+		if t.name != "bool" || t.sum != nil || t.param {
+			errorf(in.errs, node, "operator %s expects a bool - got %s", node.Op.Value, t)
+		}
+		return typ{name: "bool"}
+	case !isNumber(t):
+		errorf(in.errs, node, "operator %s expects a number - got %s", node.Op.Value, t)
+		return anyType
+	default:
+		return t
+	}
+}
+
+// binOp checks the types of the operands of an operator. Errors are reported at the position of the operator
+func (in *inference) binOp(node *ast.BinOp) typ {
+	left, right := in.expr(node.Left), in.expr(node.Right)
+	op := node.Op.Type
+
+	if op == tokens.EQ || op == tokens.NEQ {
+		if _, ok := merge(left, right); !ok && !(isNumber(left) && isNumber(right)) {
+			errorAt(in.errs, node.Op.Position, "can not compare %s and %s", left, right)
+		}
+		return typ{name: "bool"}
+	}
+
+	var result typ
+	var valid bool
+	switch op {
+	case tokens.PLUS, tokens.MINUS, tokens.MULT, tokens.DIV, tokens.POW:
+		result = numberResult([]typ{left, right})
+		valid = (isAny(left) || isNumber(left)) && (isAny(right) || isNumber(right))
+	case tokens.CONCAT:
+		result = typ{name: "string"}
+		valid = accepts("string", left) && accepts("string", right)
+	case tokens.AND, tokens.OR:
+		result = typ{name: "bool"}
+		valid = accepts("bool", left) && accepts("bool", right)
+	}
+	if !valid {
+		errorAt(in.errs, node.Op.Position, "operator %s is not defined on %s and %s", node.Op.Value, left, right)
+		return anyType
+	}
+	return result
+}
+
+func (in *inference) list(node *ast.ListLit) typ {
+	elem := anyType
+	for _, e := range node.Elements {
+		t := in.expr(e)
+		merged, ok := merge(elem, t)
+		if !ok {
+			errorf(in.errs, e, "elements of the list must be a %s - got %s", elem, t)
+			return listOf(anyType)
+		}
+		elem = merged
+	}
+	return listOf(elem)
+}
+
+func (in *inference) index(node *ast.Index) typ {
+	t, index := in.expr(node.Expr), in.expr(node.Index)
+	if !accepts("int", index) {
+		errorf(in.errs, node.Index, "index must be a int - got %s", index)
+	}
+	switch {
+	case isAny(t):
+		return anyType
+	case t.name != ast.ListType:
+		errorf(in.errs, node, "operator [] expects a list - got %s", t)
+		return anyType
+	default:
+		return t.args[0]
+	}
+}
+
+// call checks the arguments of a call against the signature of the function, the constructor or the
+// builtin called, in this order. The type arguments of a generic function are inferred from the
+// types of the arguments
+func (in *inference) call(node *ast.FuncCall) typ {
+	args := []typ{}
+	for _, arg := range node.Args {
+		args = append(args, in.expr(arg))
+	}
+
+	s := in.s
+	if node.Module != "" {
+		imported, ok := s.imports[node.Module]
+		if !ok {
+			return anyType
+		}
+		s = imported
+	}
+	name := qualify(node.Module, node.Name)
+
+	if f, ok := s.functions[node.Name]; ok {
+		if node.Module != "" && !modules.IsExported(node.Name) {
+			return anyType
+		}
+		params := []*ast.Parameter{}
+		params = append(params, f.Signature.Parameters.Parameters...)
+		b := newBindings(f.Signature.TypeParams)
+		if !in.arguments(node, name, "argument", s, params, args, b) {
+			return anyType
+		}
+		return in.c.instantiate(s, f.Signature.ReturnType, b)
+	}
+
+	if k, ok := s.constructors[node.Name]; ok {
+		t := k.sum
+		params := []*ast.Parameter{}
+		for _, field := range k.decl.Fields {
+			params = append(params, &ast.Parameter{Name: field.Name, Type: field.Type})
+		}
+		b := newBindings(t.decl.Params)
+		if !in.arguments(node, name, "field", t.scope, params, args, b) {
+			return anyType
+		}
+		result := typ{name: t.name, sum: t}
+		for _, p := range t.decl.Params {
+			result.args = append(result.args, b[p.Value])
+		}
+		return result
+	}
+
+	builtin, ok := in.c.Builtins[node.Name]
+	if !ok || node.Module != "" {
+		return anyType
+	}
+	if len(args) != len(builtin.Params) {
+		errorf(in.errs, node, "%s expects %d arguments - got %d", name, len(builtin.Params), len(args))
+		return anyType
+	}
+	for index, p := range builtin.Params {
+		if !accepts(p.Type, args[index]) {
+			errorf(in.errs, node.Args[index], "argument %s of %s must be a %s - got %s", p.Name, name, p.Type, args[index])
+		}
+	}
+	return builtinResult(builtin, args)
+}
+
+// arguments checks the arguments of a call against the parameters of a function or the fields
+// of a constructor, declared in a scope. It tells whether they are valid
+func (in *inference) arguments(node *ast.FuncCall, name, what string, s *scope, params []*ast.Parameter, args []typ, b bindings) bool {
+	if len(args) != len(params) {
+		errorf(in.errs, node, "%s expects %d arguments - got %d", name, len(params), len(args))
+		return false
+	}
+
+	valid := true
+	for index, p := range params {
+		expected := expectedType(p.Type, b)
+		if !in.c.unify(s, p.Type, args[index], b) {
+			errorf(in.errs, node.Args[index], "%s %s of %s must be a %s - got %s", what, p.Name, name, expected, args[index])
+			valid = false
+		}
+	}
+	return valid
+}
+
+// match returns the type given by the arms of a match. The variables bound by the patterns get the
+// types of the parts of the subject they match
+func (in *inference) match(node *ast.Match) typ {
+	subject := in.expr(node.Subject)
+
+	before := in.vars
+	types := []typ{}
+	envs := []env{}
+	for _, arm := range node.Arms {
+		in.vars = before.copy()
+		in.bind(arm.Pattern, subject)
+		types = append(types, in.expr(arm.Body))
+		envs = append(envs, in.vars)
+	}
+	in.vars = joinEnvs(envs)
+	if len(envs) == 0 {
+		in.vars = before
+	}
+	return join(types)
+}
+
+// bind gives their types to the variables bound by a pattern matching a value of type t
+func (in *inference) bind(pattern ast.Node, t typ) {
+	switch p := pattern.(type) {
+	case *ast.BindingPattern:
+		in.vars[p.Name] = t
+	case *ast.ConstructorPattern:
+		k, sum, ok := in.c.lookupConstructor(in.s, p)
+		if !ok || len(p.Args) != len(k.decl.Fields) {
+			return
+		}
+		b := newBindings(sum.decl.Params)
+		if t.sum == sum {
+			for index, param := range sum.decl.Params {
+				b[param.Value] = t.args[index]
+			}
+		}
+		for index, arg := range p.Args {
+			in.bind(arg, in.c.instantiate(sum.scope, k.decl.Fields[index].Type, b))
+		}
+	}
+}
+
+// try returns the type given by the body or the handler of a try expression. The body may fail
+// before it assigns its variables: their types are not known by the handler
+func (in *inference) try(node *ast.Try) typ {
+	before := in.vars
+	in.vars = before.copy()
+	body := in.expr(node.Body)
+	after := in.vars
+
+	in.vars = before.copy()
+	ast.Inspect(node.Body, func(n ast.Node) bool {
+		switch a := n.(type) {
+		case *ast.Assignment:
+			in.vars[a.Variable.Name] = anyType
+		case *ast.Destructuring:
+			for _, v := range a.Variables {
+				in.vars[v.Name] = anyType
+			}
+		case *ast.BindingPattern:
+			in.vars[a.Name] = anyType
+		case *ast.Try:
+			in.vars[a.Variable.Name] = anyType
+		}
+		return true
+	})
+	if node.Variable.Name != "_" {
+		in.vars[node.Variable.Name] = typ{name: "Error"}
+	}
+	handler := in.expr(node.Handler)
+
+	in.vars = joinEnvs([]env{after, in.vars})
+	return join([]typ{body, handler})
+}
@@ -0,0 +1,232 @@
+package checker
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+)
+
+// checkMatch verifies the patterns of a match, then that they cover every value
+func (c *Checker) checkMatch(s *scope, node *ast.Match, errs *Errors) {
+	subject := c.subjectType(s, node)
+
+	count := len(*errs)
+	rows := [][]ast.Node{}
+	for _, arm := range node.Arms {
+		c.checkPattern(s, arm.Pattern, subject, errs)
+		rows = append(rows, []ast.Node{arm.Pattern})
+	}
+	if len(*errs) > count {
+		// the coverage of invalid patterns does not make sense
+		return
+	}
+
+	if missing := c.uncovered(s, rows, []typ{subject}); missing != nil {
+		errorf(errs, node, "match is not exhaustive: %s is not covered", missing[0])
+	}
+}
+
+// subjectType guesses the type of the matched value from the first pattern that tells it
+func (c *Checker) subjectType(s *scope, node *ast.Match) typ {
+	for _, arm := range node.Arms {
+		switch p := arm.Pattern.(type) {
+		case *ast.ConstructorPattern:
+			if _, t, ok := c.lookupConstructor(s, p); ok {
+				return typ{name: qualify(p.Module, t.name), sum: t}
+			}
+		case *ast.WildcardPattern, *ast.BindingPattern:
+		default:
+			return literalType(p)
+		}
+	}
+	return anyType
+}
+
+// checkPattern verifies that a pattern can match values of a type
+func (c *Checker) checkPattern(s *scope, pattern ast.Node, expected typ, errs *Errors) {
+	switch p := pattern.(type) {
+	case *ast.WildcardPattern, *ast.BindingPattern:
+	case *ast.ConstructorPattern:
+		name := qualify(p.Module, p.Name)
+		k, t, ok := c.lookupConstructor(s, p)
+		if !ok {
+			errorf(errs, p, "unknown constructor %s", name)
+			return
+		}
+		if expected.name != anyType.name && expected.sum != t {
+			errorf(errs, p, "Expected a pattern of type %s - got %s of type %s", expected.name, name, t.name)
+			return
+		}
+		if len(p.Args) != len(k.fields) {
+			errorf(errs, p, "%s expects %d fields - got %d", name, len(k.fields), len(p.Args))
+			return
+		}
+		for index, arg := range p.Args {
+			c.checkPattern(s, arg, k.fields[index], errs)
+		}
+	default:
+		actual := literalType(p)
+		if expected.name != anyType.name && actual.name != expected.name {
+			errorf(errs, p, "Expected a pattern of type %s - got %s of type %s", expected.name, formatLiteral(p), actual.name)
+		}
+	}
+}
+
+// formatLiteral writes a literal pattern as in the source
+func formatLiteral(pattern ast.Node) string {
+	switch p := pattern.(type) {
+	case *ast.Num:
+		return p.Value
+	case *ast.Float:
+		return p.Value
+	case *ast.String:
+		return strconv.Quote(p.Value)
+	case *ast.Bool:
+		return p.Value
+	default:
+		return pattern.String()
+	}
+}
+
+// literalType returns the type of a literal pattern
+func literalType(pattern ast.Node) typ {
+	switch pattern.(type) {
+	case *ast.Num:
+		return typ{name: "int"}
+	case *ast.Float:
+		return typ{name: "float"}
+	case *ast.String:
+		return typ{name: "string"}
+	case *ast.Bool:
+		return typ{name: "bool"}
+	default:
+		return anyType
+	}
+}
+
+// uncovered returns values that no row of patterns matches, one per column, or nil when the rows
+// cover every value. The values are formatted as patterns, _ standing for any value.
+//
+// It follows the usefulness algorithm described by Luc Maranget in "Warnings for pattern matching":
+// the first column is split by constructor when the rows use all the constructors of its type.
+// Otherwise only the rows starting with a wildcard matter for the values built by the missing constructors.
+func (c *Checker) uncovered(s *scope, rows [][]ast.Node, types []typ) []string {
+	if len(types) == 0 {
+		if len(rows) == 0 {
+			return []string{}
+		}
+		return nil
+	}
+
+	constructors := constructorsOf(types[0])
+	used := map[*constructor]bool{}
+	for _, row := range rows {
+		for _, k := range constructors {
+			if _, ok := c.specialize(s, row[0], k); ok && !isWildcard(row[0]) {
+				used[k] = true
+			}
+		}
+	}
+
+	if len(constructors) == 0 || len(used) < len(constructors) {
+		defaults := [][]ast.Node{}
+		for _, row := range rows {
+			if isWildcard(row[0]) {
+				defaults = append(defaults, row[1:])
+			}
+		}
+		missing := c.uncovered(s, defaults, types[1:])
+		if missing == nil {
+			return nil
+		}
+		for _, k := range constructors {
+			if !used[k] && len(used) > 0 {
+				return append([]string{k.format(wildcards(len(k.fields)))}, missing...)
+			}
+		}
+		return append([]string{"_"}, missing...)
+	}
+
+	for _, k := range constructors {
+		specialized := [][]ast.Node{}
+		for _, row := range rows {
+			if args, ok := c.specialize(s, row[0], k); ok {
+				specialized = append(specialized, append(args, row[1:]...))
+			}
+		}
+
+		columns := append(append([]typ{}, k.fields...), types[1:]...)
+		if missing := c.uncovered(s, specialized, columns); missing != nil {
+			n := len(k.fields)
+			return append([]string{k.format(missing[:n])}, missing[n:]...)
+		}
+	}
+	return nil
+}
+
+// specialize returns the sub-patterns of a pattern matching the values built by a constructor
+func (c *Checker) specialize(s *scope, pattern ast.Node, k *constructor) ([]ast.Node, bool) {
+	switch p := pattern.(type) {
+	case *ast.WildcardPattern, *ast.BindingPattern:
+		args := []ast.Node{}
+		for range k.fields {
+			args = append(args, &ast.WildcardPattern{})
+		}
+		return args, true
+	case *ast.ConstructorPattern:
+		if found, _, ok := c.lookupConstructor(s, p); ok && found == k {
+			return append([]ast.Node{}, p.Args...), true
+		}
+	case *ast.Bool:
+		if p.Value == k.name {
+			return []ast.Node{}, true
+		}
+	}
+	return nil, false
+}
+
+// constructorsOf returns the constructors of a type, or nothing when its values can not be enumerated
+func constructorsOf(t typ) []*constructor {
+	switch {
+	case t.sum != nil:
+		return t.sum.constructors
+	case t.name == "bool":
+		return boolConstructors
+	default:
+		return nil
+	}
+}
+
+func isWildcard(pattern ast.Node) bool {
+	switch pattern.(type) {
+	case *ast.WildcardPattern, *ast.BindingPattern:
+		return true
+	default:
+		return false
+	}
+}
+
+func wildcards(n int) []string {
+	patterns := []string{}
+	for index := 0; index < n; index++ {
+		patterns = append(patterns, "_")
+	}
+	return patterns
+}
+
+// format writes the pattern of a constructor applied to sub-patterns
+func (k *constructor) format(args []string) string {
+	if len(args) == 0 {
+		return k.name
+	}
+	return k.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// qualify prefixes a name with the name of its module, if any
+func qualify(module, name string) string {
+	if module == "" {
+		return name
+	}
+	return module + "." + name
+}
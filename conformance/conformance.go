@@ -0,0 +1,234 @@
+// Package conformance holds the programs every cairn implementation must run alike.
+//
+// Each program of testdata ends with the outcome it must give, in directive comments:
+//
+//	println("a")
+//	1 + 1
+//
+//	# stdout: a
+//	# result: 2
+//
+// A stdout directive is a line of the output, and stdout (no newline) its end when the output does
+// not end with a new line. result is the value of the program. The errors are given with their
+// stage: tokenize error, parse error, load error (an import that fails), check error (one directive
+// per error) or runtime error. As the directives follow the program, its positions are kept.
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/checker"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/modules"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/fchoquet/cairn/tokenizer"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// Directive keys
+const (
+	Stdout          = "stdout"
+	StdoutNoNewline = "stdout (no newline)"
+	Result          = "result"
+	TokenizeError   = "tokenize error"
+	ParseError      = "parse error"
+	LoadError       = "load error"
+	CheckError      = "check error"
+	RuntimeError    = "runtime error"
+)
+
+// keys lists the directive keys, longest first so that a key is not read as its prefix
+var keys = []string{StdoutNoNewline, Stdout, Result, TokenizeError, ParseError, LoadError, CheckError, RuntimeError}
+
+// Directive is an expected line of the outcome of a program
+type Directive struct {
+	Key   string
+	Value string
+}
+
+func (d Directive) String() string {
+	if d.Value == "" {
+		return "# " + d.Key + ":"
+	}
+	return "# " + d.Key + ": " + d.Value
+}
+
+// Case is a program of the suite
+type Case struct {
+	// Path is the file of the program, and Name its base name, used as the file name of its positions
+	Path   string
+	Name   string
+	Source string
+	// Expected is the outcome given by the directives of the file
+	Expected []Directive
+}
+
+// Load reads the programs of a directory: its *.cairn files
+func Load(dir string) ([]*Case, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.cairn"))
+	if err != nil {
+		return nil, err
+	}
+	cases := []*Case{}
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		c, err := parseCase(filepath.Base(path), string(content))
+		if err != nil {
+			return nil, err
+		}
+		c.Path = path
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+// parseCase splits a file into its program and its directives: the comments ending the file
+func parseCase(name, content string) (*Case, error) {
+	c := &Case{Name: name, Expected: []Directive{}}
+	lines := strings.Split(content, "\n")
+	start := len(lines)
+	for start > 0 && (strings.TrimSpace(lines[start-1]) == "" || strings.HasPrefix(lines[start-1], "#")) {
+		start--
+	}
+	c.Source = strings.Join(lines[:start], "\n")
+	if start > 0 && start < len(lines) {
+		c.Source += "\n"
+	}
+
+	for index, line := range lines[start:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		d, ok := parseDirective(line)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected a directive - got %q", name, start+index+1, line)
+		}
+		c.Expected = append(c.Expected, d)
+	}
+	return c, nil
+}
+
+func parseDirective(line string) (Directive, bool) {
+	if !strings.HasPrefix(line, "# ") {
+		return Directive{}, false
+	}
+	line = line[2:]
+	for _, key := range keys {
+		if line == key+":" {
+			return Directive{Key: key}, true
+		}
+		if strings.HasPrefix(line, key+": ") {
+			return Directive{Key: key, Value: line[len(key)+2:]}, true
+		}
+	}
+	return Directive{}, false
+}
+
+// Content formats the file of a case ending with directives, such as the outcome of a new implementation
+func (c *Case) Content(directives []Directive) string {
+	lines := []string{strings.TrimRight(c.Source, "\n"), ""}
+	for _, d := range directives {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Outcome formats what a program gave as directives: its output, then its result, or the error
+// that stopped it at a stage. The errors of the checker give a directive each
+func Outcome(output, result, stage string, err error) []Directive {
+	directives := []Directive{}
+	for _, line := range strings.SplitAfter(output, "\n") {
+		switch {
+		case line == "":
+		case strings.HasSuffix(line, "\n"):
+			directives = append(directives, Directive{Stdout, strings.TrimSuffix(line, "\n")})
+		default:
+			directives = append(directives, Directive{StdoutNoNewline, line})
+		}
+	}
+	if err == nil {
+		if result != "" {
+			directives = append(directives, Directive{Result, result})
+		}
+		return directives
+	}
+
+	if errs, ok := err.(checker.Errors); ok {
+		for _, e := range errs {
+			directives = append(directives, Directive{stage, e.Error()})
+		}
+		return directives
+	}
+	// an error spanning lines would be read as several directives
+	return append(directives, Directive{stage, strings.Replace(err.Error(), "\n", " ", -1)})
+}
+
+// Interpret runs a case through the tokenizer, the parser, the checker and the interpreter,
+// and returns its outcome. The interpreter is the reference implementation of the suite.
+// The modules imported by the case are looked for in its directory
+func Interpret(c *Case) []Directive {
+	if err := tokenize(c.Name, c.Source); err != nil {
+		return Outcome("", "", TokenizeError, err)
+	}
+
+	node, err := parse(c.Name, c.Source)
+	if err != nil {
+		return Outcome("", "", ParseError, err)
+	}
+
+	stdout := &bytes.Buffer{}
+	loader := modules.NewLoader(filepath.Dir(c.Path))
+	i := interpreter.New(&parser.Parser{}, interpreter.Stdout(stdout), interpreter.Loader(loader))
+	result, err := i.Exec(node)
+	switch err.(type) {
+	case nil:
+		return Outcome(stdout.String(), result, "", nil)
+	case checker.Errors:
+		return Outcome("", "", CheckError, err)
+	case *tokens.Error:
+		// the loader failed to read an imported module
+		return Outcome("", "", LoadError, err)
+	default:
+		return Outcome(stdout.String(), "", RuntimeError, err)
+	}
+}
+
+// tokenize reads the tokens of a source, and returns the first tokenizer error
+func tokenize(file, source string) error {
+	t := tokenizer.Tokenize(file, source)
+	for {
+		tk, err := t.NextToken()
+		if err != nil {
+			// the tokenizer stops after an error
+			for range t.Channel {
+			}
+			return err
+		}
+		if tk.Type == tokens.EOF {
+			return nil
+		}
+	}
+}
+
+// parse parses a source. The parser panics on bugs: they are reported as parse errors
+func parse(file, source string) (node *ast.SourceFile, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parser panic: %v", r)
+		}
+	}()
+	p := parser.Parser{}
+	n, err := p.Parse(file, source)
+	if err != nil {
+		return nil, err
+	}
+	return n.(*ast.SourceFile), nil
+}
@@ -0,0 +1,88 @@
+package conformance
+
+import (
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the expected outcomes of testdata")
+
+func TestConformance(t *testing.T) {
+	cases, err := Load("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatal("no programs in testdata")
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			actual := Interpret(c)
+			if *update {
+				if err := ioutil.WriteFile(c.Path, []byte(c.Content(actual)), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			assert.Equal(t, c.Content(c.Expected), c.Content(actual))
+		})
+	}
+}
+
+func TestCase(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("splits the program and its directives", func(t *testing.T) {
+		c, err := parseCase("a.cairn", "print(\"a\")\n1\n\n# stdout (no newline): a\n\n# result: 1\n# check error:\n")
+		assert.Nil(err)
+		assert.Equal("print(\"a\")\n1\n", c.Source)
+		assert.Equal([]Directive{
+			{StdoutNoNewline, "a"},
+			{Result, "1"},
+			{CheckError, ""},
+		}, c.Expected)
+		assert.Equal("print(\"a\")\n1\n\n# stdout (no newline): a\n# result: 1\n# check error:\n", c.Content(c.Expected))
+	})
+
+	t.Run("keeps the comments of the program", func(t *testing.T) {
+		c, err := parseCase("a.cairn", "# a comment\n1 # one\n# result: 1")
+		assert.Nil(err)
+		assert.Equal("# a comment\n1 # one\n", c.Source)
+		assert.Equal([]Directive{{Result, "1"}}, c.Expected)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		fixtures := []struct {
+			content  string
+			expected string
+		}{
+			{"1\n#result: 1", `a.cairn:2: expected a directive - got "#result: 1"`},
+			{"1\n\n# a comment\n# result: 1", `a.cairn:3: expected a directive - got "# a comment"`},
+			{"1\n# value: 1", `a.cairn:2: expected a directive - got "# value: 1"`},
+		}
+
+		for _, fixture := range fixtures {
+			t.Run(fixture.expected, func(t *testing.T) {
+				_, err := parseCase("a.cairn", fixture.content)
+				if assert.NotNil(err) {
+					assert.Equal(fixture.expected, err.Error())
+				}
+			})
+		}
+	})
+
+	t.Run("formats outcomes", func(t *testing.T) {
+		assert.Equal([]Directive{
+			{Stdout, "a"},
+			{Stdout, ""},
+			{StdoutNoNewline, "b"},
+			{Result, "2"},
+		}, Outcome("a\n\nb", "2", "", nil))
+		assert.Equal([]Directive{{Stdout, "a"}}, Outcome("a\n", "", "", nil))
+	})
+}
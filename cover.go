@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/fchoquet/cairn/coverage"
+)
+
+// reportCoverage displays the coverage summary on the standard error when display is set,
+// and writes the profile to a file when its name is not empty
+func reportCoverage(blocks []*coverage.Block, display bool, profile string) int {
+	if display {
+		coverage.WriteSummary(os.Stderr, blocks)
+	}
+	if profile == "" {
+		return 0
+	}
+	buf := &bytes.Buffer{}
+	coverage.WriteProfile(buf, blocks)
+	if err := ioutil.WriteFile(profile, buf.Bytes(), 0644); err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+	return 0
+}
+
+// coverReport implements the cover command
+func coverReport(args []string) int {
+	flags := flag.NewFlagSet("cover", flag.ContinueOnError)
+	output := flags.String("html", "", "write an HTML report to this file instead of the summary")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+	defer file.Close()
+	blocks, err := coverage.ReadProfile(file)
+	if err != nil {
+		fmt.Printf("!!! %s: %s\n", flags.Arg(0), err)
+		return 1
+	}
+
+	if *output == "" {
+		coverage.WriteSummary(os.Stdout, blocks)
+		return 0
+	}
+
+	// the sources are read again, so they must not have changed since the profile was written
+	sources := map[string]string{}
+	for _, b := range blocks {
+		if _, ok := sources[b.Pos.File]; ok {
+			continue
+		}
+		source, err := ioutil.ReadFile(b.Pos.File)
+		if err != nil {
+			fmt.Println("!!! " + err.Error())
+			return 1
+		}
+		sources[b.Pos.File] = string(source)
+	}
+	buf := &bytes.Buffer{}
+	if err := coverage.WriteHTML(buf, blocks, sources); err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+	if err := ioutil.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+	return 0
+}
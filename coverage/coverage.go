@@ -0,0 +1,170 @@
+// Package coverage records which statements and branches of cairn programs run.
+//
+// A Profile is attached to an interpreter as its step hook. The source files are added to the
+// profile before the program runs, so that the blocks that never run are reported too.
+// Blocks are statements, and branches: the arms of match expressions, and the body and the
+// handler of try expressions. The profiles can be saved, read back and reported as a summary
+// per function or as an HTML page.
+package coverage
+
+import (
+	"sort"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// Kind tells whether a block is a statement or a branch
+type Kind string
+
+// Block kinds
+const (
+	Statement Kind = "statement"
+	Branch    Kind = "branch"
+)
+
+// Block is a part of a program whose executions are counted
+type Block struct {
+	Kind Kind
+	// Pos is the start of the block, and EndLine the last line it spans
+	Pos     tokens.Position
+	EndLine int
+	// Func is the function holding the block. It is empty for the top level statements
+	Func  string
+	Count int
+}
+
+// Profile counts the executions of the blocks of the files added to it
+type Profile struct {
+	blocks []*Block
+	// nodes maps the nodes reported by the step hook to the blocks they start
+	nodes map[ast.Node][]*Block
+	files map[string]bool
+}
+
+// New creates an empty profile
+func New() *Profile {
+	return &Profile{nodes: map[ast.Node][]*Block{}, files: map[string]bool{}}
+}
+
+// Option returns the interpreter option counting the executions
+func (p *Profile) Option() interpreter.Option {
+	return interpreter.OnStep(p.hook)
+}
+
+func (p *Profile) hook(i *interpreter.Interpreter, node ast.Node) error {
+	for _, b := range p.nodes[node] {
+		b.Count++
+	}
+	return nil
+}
+
+// Add registers the blocks of a source file. A file is only added once
+func (p *Profile) Add(file *ast.SourceFile) {
+	name := file.Pos().File
+	if p.files[name] {
+		return
+	}
+	p.files[name] = true
+
+	for _, f := range file.Functions {
+		p.statements(f.Name.Value, f.Body.Statements)
+	}
+	if file.Statements != nil {
+		p.statements("", file.Statements)
+	}
+}
+
+// Blocks returns the blocks of the profile, sorted by position
+func (p *Profile) Blocks() []*Block {
+	blocks := append([]*Block{}, p.blocks...)
+	Sort(blocks)
+	return blocks
+}
+
+// Sort sorts blocks by file and position. The statements come before the branches they start
+func Sort(blocks []*Block) {
+	sort.SliceStable(blocks, func(a, b int) bool {
+		pa, pb := blocks[a].Pos, blocks[b].Pos
+		switch {
+		case pa.File != pb.File:
+			return pa.File < pb.File
+		case pa.Line != pb.Line:
+			return pa.Line < pb.Line
+		case pa.Col != pb.Col:
+			return pa.Col < pb.Col
+		}
+		return blocks[a].Kind == Statement && blocks[b].Kind == Branch
+	})
+}
+
+func (p *Profile) statements(fn string, sl *ast.StatementList) {
+	if sl == nil {
+		return
+	}
+	for _, st := range sl.Statements {
+		p.add(fn, st)
+		p.branches(fn, st)
+	}
+}
+
+// branches registers the branches nested in a statement, and the statements of their blocks
+func (p *Profile) branches(fn string, node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Match:
+			p.branches(fn, n.Subject)
+			for _, arm := range n.Arms {
+				p.branch(fn, arm, arm, arm.Body)
+			}
+			return false
+		case *ast.Try:
+			// the blocks start on the lines after try and catch
+			p.branch(fn, n, n.Body, n.Body)
+			p.branch(fn, n.Variable, n.Handler, n.Handler)
+			return false
+		}
+		return true
+	})
+}
+
+// branch registers a branch starting at a node and spanning another one, counted with the evaluation
+// of its body. The step hook is not called for blocks but for their first statements
+func (p *Profile) branch(fn string, start, span, body ast.Node) {
+	block, ok := body.(*ast.BlockStmt)
+	if !ok {
+		p.addBlock(Branch, fn, start.Pos(), endLine(span), body)
+		p.branches(fn, body)
+		return
+	}
+	if block.Statements == nil || len(block.Statements.Statements) == 0 {
+		return
+	}
+	p.addBlock(Branch, fn, start.Pos(), endLine(span), block.Statements.Statements[0])
+	p.statements(fn, block.Statements)
+}
+
+// add registers a statement, counted when the step hook reports it
+func (p *Profile) add(fn string, st ast.Node) {
+	p.addBlock(Statement, fn, st.Pos(), endLine(st), st)
+}
+
+// addBlock registers a block, counted when the step hook reports a node
+func (p *Profile) addBlock(kind Kind, fn string, pos tokens.Position, end int, node ast.Node) {
+	b := &Block{Kind: kind, Pos: pos, EndLine: end, Func: fn}
+	p.blocks = append(p.blocks, b)
+	p.nodes[node] = append(p.nodes[node], b)
+}
+
+// endLine returns the last line of the nodes of a tree
+func endLine(node ast.Node) int {
+	line := 0
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n != nil && n.Pos().Line > line {
+			line = n.Pos().Line
+		}
+		return true
+	})
+	return line
+}
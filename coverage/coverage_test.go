@@ -0,0 +1,193 @@
+package coverage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const program = `func sign(n:int) :int
+    match n
+        0 -> 0
+        _ ->
+            match abs(n) == n
+                true -> 1
+                false -> -1
+
+func safe(n:int) :int
+    try
+        100 / n
+    catch e
+        println(message(e))
+        -1
+
+sign(5)
+sign(0)
+safe(4)
+`
+
+// run runs a program with a profile attached
+func run(t *testing.T, source string) *Profile {
+	p := parser.Parser{}
+	node, err := p.Parse("test.ca", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := New()
+	profile.Add(node.(*ast.SourceFile))
+	i := interpreter.New(&parser.Parser{}, interpreter.Stdout(ioutil.Discard), profile.Option())
+	if _, err := i.Exec(node); err != nil {
+		t.Fatal(err)
+	}
+	return profile
+}
+
+// format describes blocks as kind@line:col=count
+func format(blocks []*Block) []string {
+	lines := []string{}
+	for _, b := range blocks {
+		lines = append(lines, fmt.Sprintf("%s %s@%d:%d-%d=%d", b.Func, b.Kind, b.Pos.Line, b.Pos.Col, b.EndLine, b.Count))
+	}
+	return lines
+}
+
+func TestProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("counts statements and branches", func(t *testing.T) {
+		assert.Equal([]string{
+			"sign statement@2:5-7=2",
+			"sign branch@3:9-3=1",
+			"sign branch@4:9-7=1",
+			"sign statement@5:13-7=1",
+			"sign branch@6:17-6=1",
+			"sign branch@7:17-7=0",
+			"safe statement@10:5-14=1",
+			"safe branch@10:5-11=1",
+			"safe statement@11:9-11=1",
+			"safe branch@12:11-14=0",
+			"safe statement@13:9-13=0",
+			"safe statement@14:9-14=0",
+			" statement@16:1-16=1",
+			" statement@17:1-17=1",
+			" statement@18:1-18=1",
+		}, format(run(t, program).Blocks()))
+	})
+
+	t.Run("counts loops", func(t *testing.T) {
+		source := "func down(n:int) :int\n    match n\n        0 -> 0\n        _ -> down(n - 1)\ndown(3)"
+		assert.Equal([]string{
+			"down statement@2:5-4=4",
+			"down branch@3:9-3=1",
+			"down branch@4:9-4=3",
+			" statement@5:1-5=1",
+		}, format(run(t, source).Blocks()))
+	})
+
+	t.Run("adds files once", func(t *testing.T) {
+		p := parser.Parser{}
+		node, _ := p.Parse("test.ca", "1\n2")
+		profile := New()
+		profile.Add(node.(*ast.SourceFile))
+		profile.Add(node.(*ast.SourceFile))
+		assert.Len(profile.Blocks(), 2)
+	})
+}
+
+func TestProfileFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	blocks := run(t, program).Blocks()
+	buf := &bytes.Buffer{}
+	assert.Nil(WriteProfile(buf, blocks))
+	assert.True(strings.HasPrefix(buf.String(), "cairn coverage v1\ntest.ca:2.5-7 statement 2 sign\n"))
+	assert.Contains(buf.String(), "test.ca:16.1-16 statement 1 -\n")
+
+	read, err := ReadProfile(buf)
+	assert.Nil(err)
+	assert.Equal(blocks, read)
+
+	t.Run("file names with spaces", func(t *testing.T) {
+		read, err := ReadProfile(strings.NewReader("cairn coverage v1\nmy rules.ca:3.5-4 branch 7 f\n"))
+		assert.Nil(err)
+		assert.Equal([]string{"f branch@3:5-4=7"}, format(read))
+		assert.Equal("my rules.ca", read[0].Pos.File)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		fixtures := []struct {
+			input    string
+			expected string
+		}{
+			{"mode: set\n", `expected "cairn coverage v1" on line 1 - got "mode: set"`},
+			{"", `expected "cairn coverage v1" on line 1 - got ""`},
+			{"cairn coverage v1\na.ca:1.1-1 statement 1\n", `line 2: expected a position, a kind, a count and a function - got "a.ca:1.1-1 statement 1"`},
+			{"cairn coverage v1\na.ca:1.1-1 loop 1 -\n", "line 2: expected statement or branch - got loop"},
+			{"cairn coverage v1\na.ca:1.1-1 statement x -\n", "line 2: expected a count - got x"},
+			{"cairn coverage v1\na.ca:1-1 statement 1 -\n", "line 2: expected file:line.col-endLine - got a.ca:1-1"},
+		}
+
+		for _, fixture := range fixtures {
+			t.Run(fixture.expected, func(t *testing.T) {
+				_, err := ReadProfile(strings.NewReader(fixture.input))
+				if assert.NotNil(err) {
+					assert.Equal(fixture.expected, err.Error())
+				}
+			})
+		}
+	})
+
+	t.Run("merges profiles", func(t *testing.T) {
+		first := run(t, "func f(b:bool) :int\n    match b\n        true -> 1\n        false -> 0\nf(true)").Blocks()
+		second := run(t, "func f(b:bool) :int\n    match b\n        true -> 1\n        false -> 0\nf(false)").Blocks()
+		assert.Equal([]string{
+			"f statement@2:5-4=2",
+			"f branch@3:9-3=1",
+			"f branch@4:9-4=1",
+			" statement@5:1-5=2",
+		}, format(Merge(first, second)))
+		// the merged profiles are left unchanged
+		assert.Equal(1, first[0].Count)
+	})
+}
+
+func TestReports(t *testing.T) {
+	assert := assert.New(t)
+	blocks := run(t, program).Blocks()
+
+	t.Run("summary", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		assert.Nil(WriteSummary(buf, blocks))
+		assert.Equal(strings.Join([]string{
+			"function                  statements    branches",
+			"test.ca:2:   sign         100.0% (2/2)  75.0% (3/4)",
+			"test.ca:10:  safe         50.0% (2/4)   50.0% (1/2)",
+			"test.ca:16:  (top level)  100.0% (3/3)  -",
+			"total                     77.8% (7/9)   66.7% (4/6)",
+			"",
+		}, "\n"), buf.String())
+	})
+
+	t.Run("html", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		assert.Nil(WriteHTML(buf, blocks, map[string]string{"test.ca": program}))
+		html := buf.String()
+		assert.Contains(html, `<a href="#file0">test.ca</a> 77.8% (7/9)`)
+		assert.Contains(html, `<span class="" title=""><span class="number">1</span>func sign(n:int) :int</span>`)
+		assert.Contains(html, `<span class="covered" title="branch, count 1"><span class="number">6</span>                true -&gt; 1</span>`)
+		assert.Contains(html, `<span class="uncovered" title="branch, count 0"><span class="number">7</span>                false -&gt; -1</span>`)
+		assert.Contains(html, `<span class="uncovered" title="statement, count 0"><span class="number">13</span>        println(message(e))</span>`)
+
+		err := WriteHTML(buf, blocks, map[string]string{})
+		if assert.NotNil(err) {
+			assert.Equal("the source of test.ca is missing", err.Error())
+		}
+	})
+}
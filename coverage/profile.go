@@ -0,0 +1,115 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// header starts the profile files
+const header = "cairn coverage v1"
+
+// topLevel stands for the empty function name of the top level statements in profile files
+const topLevel = "-"
+
+// WriteProfile saves blocks in the profile format: a header line, then a line per block
+//
+//	file:line.col-endLine kind count function
+//
+// where function is - for the top level statements
+func WriteProfile(w io.Writer, blocks []*Block) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, header)
+	for _, b := range blocks {
+		fn := b.Func
+		if fn == "" {
+			fn = topLevel
+		}
+		fmt.Fprintf(bw, "%s:%d.%d-%d %s %d %s\n", b.Pos.File, b.Pos.Line, b.Pos.Col, b.EndLine, b.Kind, b.Count, fn)
+	}
+	return bw.Flush()
+}
+
+// ReadProfile reads blocks saved by WriteProfile
+func ReadProfile(r io.Reader) ([]*Block, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || scanner.Text() != header {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("expected %q on line 1 - got %q", header, scanner.Text())
+	}
+
+	blocks := []*Block{}
+	for n := 2; scanner.Scan(); n++ {
+		if scanner.Text() == "" {
+			continue
+		}
+		b, err := parseBlock(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, scanner.Err()
+}
+
+// parseBlock reads a line of a profile. The file name may hold spaces, and is followed by the last colon
+func parseBlock(line string) (*Block, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("expected a position, a kind, a count and a function - got %q", line)
+	}
+	n := len(fields)
+	pos := strings.Join(fields[:n-3], " ")
+	b := &Block{Kind: Kind(fields[n-3]), Func: fields[n-1]}
+	if b.Func == topLevel {
+		b.Func = ""
+	}
+	if b.Kind != Statement && b.Kind != Branch {
+		return nil, fmt.Errorf("expected statement or branch - got %s", b.Kind)
+	}
+	count, err := strconv.Atoi(fields[n-2])
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("expected a count - got %s", fields[n-2])
+	}
+	b.Count = count
+
+	colon := strings.LastIndex(pos, ":")
+	if colon < 0 {
+		return nil, fmt.Errorf("expected file:line.col-endLine - got %s", pos)
+	}
+	b.Pos.File = pos[:colon]
+	if _, err := fmt.Sscanf(pos[colon+1:], "%d.%d-%d", &b.Pos.Line, &b.Pos.Col, &b.EndLine); err != nil {
+		return nil, fmt.Errorf("expected file:line.col-endLine - got %s", pos)
+	}
+	return b, nil
+}
+
+// Merge adds the counts of the blocks at the same positions, such as the profiles of several runs
+func Merge(profiles ...[]*Block) []*Block {
+	type key struct {
+		kind Kind
+		pos  tokens.Position
+	}
+	merged := []*Block{}
+	index := map[key]*Block{}
+	for _, blocks := range profiles {
+		for _, b := range blocks {
+			k := key{b.Kind, b.Pos}
+			if existing, ok := index[k]; ok {
+				existing.Count += b.Count
+				continue
+			}
+			c := *b
+			index[k] = &c
+			merged = append(merged, &c)
+		}
+	}
+	Sort(merged)
+	return merged
+}
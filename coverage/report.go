@@ -0,0 +1,190 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Function is the coverage of a function, or of the top level statements of a file
+type Function struct {
+	File string
+	// Name is empty for the top level statements
+	Name string
+	// Line is the line of the first block of the function
+	Line              int
+	Statements        int
+	CoveredStatements int
+	Branches          int
+	CoveredBranches   int
+}
+
+func (f *Function) add(b *Block) {
+	covered := 0
+	if b.Count > 0 {
+		covered = 1
+	}
+	if b.Kind == Branch {
+		f.Branches++
+		f.CoveredBranches += covered
+		return
+	}
+	f.Statements++
+	f.CoveredStatements += covered
+}
+
+// Functions groups blocks by function, sorted by file and line
+func Functions(blocks []*Block) []*Function {
+	type key struct{ file, name string }
+	functions := []*Function{}
+	index := map[key]*Function{}
+	for _, b := range blocks {
+		k := key{b.Pos.File, b.Func}
+		f, ok := index[k]
+		if !ok {
+			f = &Function{File: b.Pos.File, Name: b.Func, Line: b.Pos.Line}
+			index[k] = f
+			functions = append(functions, f)
+		}
+		if b.Pos.Line < f.Line {
+			f.Line = b.Pos.Line
+		}
+		f.add(b)
+	}
+	sort.SliceStable(functions, func(a, b int) bool {
+		if functions[a].File != functions[b].File {
+			return functions[a].File < functions[b].File
+		}
+		return functions[a].Line < functions[b].Line
+	})
+	return functions
+}
+
+// Total sums the coverage of all the blocks
+func Total(blocks []*Block) *Function {
+	total := &Function{}
+	for _, b := range blocks {
+		total.add(b)
+	}
+	return total
+}
+
+// percent formats a ratio, or - when there is nothing to cover
+func percent(covered, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%% (%d/%d)", 100*float64(covered)/float64(total), covered, total)
+}
+
+// WriteSummary writes the coverage of the statements and of the branches of each function, then the total
+func WriteSummary(w io.Writer, blocks []*Block) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "function\t\tstatements\tbranches")
+	for _, f := range Functions(blocks) {
+		name := f.Name
+		if name == "" {
+			name = "(top level)"
+		}
+		fmt.Fprintf(tw, "%s:%d:\t%s\t%s\t%s\n", f.File, f.Line, name,
+			percent(f.CoveredStatements, f.Statements), percent(f.CoveredBranches, f.Branches))
+	}
+	total := Total(blocks)
+	fmt.Fprintf(tw, "total\t\t%s\t%s\n",
+		percent(total.CoveredStatements, total.Statements), percent(total.CoveredBranches, total.Branches))
+	return tw.Flush()
+}
+
+// line is a line of source code in the HTML report
+type line struct {
+	Number int
+	Text   string
+	// Class is covered, uncovered, or empty when the line holds no block
+	Class string
+	Title string
+}
+
+type htmlFile struct {
+	Name     string
+	Coverage string
+	Lines    []*line
+}
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>cairn coverage</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; }
+.number { color: #999; display: inline-block; text-align: right; width: 4em; margin-right: 1em; }
+.covered { background: #c8f0c8; }
+.uncovered { background: #f8c8c8; }
+</style>
+</head>
+<body>
+<ul>
+{{range $i, $f := .}}<li><a href="#file{{$i}}">{{$f.Name}}</a> {{$f.Coverage}}</li>
+{{end}}</ul>
+{{range $i, $f := .}}<h2 id="file{{$i}}">{{$f.Name}}</h2>
+<pre>
+{{range $f.Lines}}<span class="{{.Class}}" title="{{.Title}}"><span class="number">{{.Number}}</span>{{.Text}}</span>
+{{end}}</pre>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes a page displaying the source of the files of the blocks, with the lines of the blocks
+// that ran in green and the others in red. sources maps the file names to their contents
+func WriteHTML(w io.Writer, blocks []*Block, sources map[string]string) error {
+	byFile := map[string][]*Block{}
+	names := []string{}
+	for _, b := range blocks {
+		if _, ok := byFile[b.Pos.File]; !ok {
+			names = append(names, b.Pos.File)
+		}
+		byFile[b.Pos.File] = append(byFile[b.Pos.File], b)
+	}
+	sort.Strings(names)
+
+	files := []*htmlFile{}
+	for _, name := range names {
+		source, ok := sources[name]
+		if !ok {
+			return fmt.Errorf("the source of %s is missing", name)
+		}
+		fileBlocks := append([]*Block{}, byFile[name]...)
+		Sort(fileBlocks)
+		total := Total(fileBlocks)
+		files = append(files, &htmlFile{
+			Name:     name,
+			Coverage: percent(total.CoveredStatements, total.Statements),
+			Lines:    annotate(source, fileBlocks),
+		})
+	}
+	return htmlTemplate.Execute(w, files)
+}
+
+// annotate splits a source into lines marked by the blocks spanning them.
+// The blocks are sorted, so that the nested blocks override the blocks holding them
+func annotate(source string, blocks []*Block) []*line {
+	lines := []*line{}
+	for n, text := range strings.Split(strings.TrimSuffix(source, "\n"), "\n") {
+		lines = append(lines, &line{Number: n + 1, Text: text})
+	}
+	for _, b := range blocks {
+		class := "covered"
+		if b.Count == 0 {
+			class = "uncovered"
+		}
+		for n := b.Pos.Line; n <= b.EndLine && n <= len(lines); n++ {
+			lines[n-1].Class = class
+			lines[n-1].Title = fmt.Sprintf("%s, count %d", b.Kind, b.Count)
+		}
+	}
+	return lines
+}
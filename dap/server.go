@@ -0,0 +1,569 @@
+// Package dap implements a Debug Adapter Protocol server for cairn programs.
+//
+// The server reads requests from its input and writes responses and events to its output,
+// as described by https://microsoft.github.io/debug-adapter-protocol/specification.
+// It debugs a single program, launched by the launch request, with the debugger package.
+// Positions are the positions of the tokens: sources are identified by the path of their file.
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/debugger"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// the variables references of the scopes
+const (
+	localsReference  = 1
+	globalsReference = 2
+)
+
+// threadID is the identifier of the only thread of a program
+const threadID = 1
+
+// Server is a Debug Adapter Protocol server
+type Server struct {
+	// Options configure the interpreter running the program. The server adds the debugger,
+	// and sends the standard output of the program to the client
+	Options []interpreter.Option
+
+	reader *bufio.Reader
+	// mu protects the writer and the sequence numbers: the program sends events while
+	// the server answers requests
+	mu     sync.Mutex
+	writer io.Writer
+	seq    int
+
+	linesStartAt1   bool
+	columnsStartAt1 bool
+
+	debugger *debugger.Debugger
+	launch   *launchArguments
+	program  *ast.SourceFile
+	cancel   context.CancelFunc
+	// done is closed when the program ends
+	done chan struct{}
+
+	// paused is set while the program waits for commands, and quitting once the client
+	// stopped the program
+	paused   bool
+	quitting bool
+	commands chan command
+}
+
+// command runs in the paused program. It returns true to resume the program
+type command struct {
+	run  func(stop *debugger.Stop) bool
+	done chan struct{}
+}
+
+// NewServer creates a server reading requests from r and writing to w
+func NewServer(r io.Reader, w io.Writer) *Server {
+	s := &Server{
+		reader:          bufio.NewReader(r),
+		writer:          w,
+		linesStartAt1:   true,
+		columnsStartAt1: true,
+		commands:        make(chan command),
+	}
+	s.debugger = debugger.New(s.pause)
+	return s
+}
+
+// Serve handles requests until the client disconnects or closes the input
+func (s *Server) Serve() error {
+	defer s.stop()
+	for {
+		req, err := readMessage(s.reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if disconnect := s.handle(req); disconnect {
+			return nil
+		}
+	}
+}
+
+// handle answers a request. It returns true when the client disconnects
+func (s *Server) handle(req *message) bool {
+	switch req.Command {
+	case "initialize":
+		args := &initializeArguments{}
+		if !s.decode(req, args) {
+			return false
+		}
+		s.linesStartAt1 = args.LinesStartAt1 == nil || *args.LinesStartAt1
+		s.columnsStartAt1 = args.ColumnsStartAt1 == nil || *args.ColumnsStartAt1
+		s.respond(req, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		})
+		s.event("initialized", nil)
+	case "launch":
+		s.handleLaunch(req)
+	case "setBreakpoints":
+		s.handleSetBreakpoints(req)
+	case "configurationDone":
+		s.handleConfigurationDone(req)
+	case "threads":
+		s.respond(req, map[string]interface{}{"threads": []thread{{ID: threadID, Name: "main"}}})
+	case "stackTrace":
+		s.whilePaused(req, func(stop *debugger.Stop) bool {
+			frames := s.stackTrace(stop)
+			s.respond(req, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)})
+			return false
+		})
+	case "scopes":
+		args := &frameArguments{}
+		if s.decode(req, args) {
+			s.whilePaused(req, func(stop *debugger.Stop) bool {
+				s.respond(req, map[string]interface{}{"scopes": scopes(stop, args.FrameID)})
+				return false
+			})
+		}
+	case "variables":
+		args := &variablesArguments{}
+		if s.decode(req, args) {
+			s.whilePaused(req, func(stop *debugger.Stop) bool {
+				s.respond(req, map[string]interface{}{"variables": variables(stop, args.VariablesReference)})
+				return false
+			})
+		}
+	case "evaluate":
+		args := &evaluateArguments{}
+		if s.decode(req, args) {
+			s.whilePaused(req, func(stop *debugger.Stop) bool {
+				value, err := stop.Interpreter.Evaluate(args.Expression)
+				if err != nil {
+					s.fail(req, err.Error())
+					return false
+				}
+				v := newVariable("", value)
+				s.respond(req, map[string]interface{}{"result": v.Value, "type": v.Type, "variablesReference": 0})
+				return false
+			})
+		}
+	case "continue", "next", "stepIn", "stepOut":
+		s.whilePaused(req, func(stop *debugger.Stop) bool {
+			switch req.Command {
+			case "continue":
+				s.debugger.Continue()
+			case "next":
+				s.debugger.StepOver()
+			case "stepIn":
+				s.debugger.StepInto()
+			case "stepOut":
+				s.debugger.StepOut()
+			}
+			s.respond(req, map[string]interface{}{"allThreadsContinued": true})
+			return true
+		})
+	case "disconnect", "terminate":
+		s.stop()
+		s.respond(req, nil)
+		return req.Command == "disconnect"
+	default:
+		s.fail(req, fmt.Sprintf("unsupported request %s", req.Command))
+	}
+	return false
+}
+
+func (s *Server) handleLaunch(req *message) {
+	args := &launchArguments{}
+	if !s.decode(req, args) {
+		return
+	}
+	if s.launch != nil {
+		s.fail(req, "the program is already launched")
+		return
+	}
+
+	path, err := filepath.Abs(args.Program)
+	if err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+	file, err := parseFile(path)
+	if err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+	s.launch = args
+	s.program = file
+	s.respond(req, nil)
+}
+
+// handleSetBreakpoints replaces the breakpoints of a source. A breakpoint is verified when
+// a statement starts on its line
+func (s *Server) handleSetBreakpoints(req *message) {
+	args := &setBreakpointsArguments{}
+	if !s.decode(req, args) {
+		return
+	}
+	path, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+
+	lines := map[int]bool{}
+	file, err := parseFile(path)
+	if err == nil {
+		lines = statementLines(file)
+	}
+
+	s.whileConfigurable(req, func() {
+		for _, p := range s.debugger.Breakpoints() {
+			if p.File == path {
+				s.debugger.ClearBreakpoint(p.File, p.Line)
+			}
+		}
+
+		breakpoints := []breakpoint{}
+		for _, b := range args.Breakpoints {
+			line := s.fromClientLine(b.Line)
+			bp := breakpoint{Verified: lines[line], Line: b.Line, Source: newSource(path)}
+			switch {
+			case err != nil:
+				bp.Message = err.Error()
+			case !bp.Verified:
+				bp.Message = "no statement starts on this line"
+			default:
+				s.debugger.SetBreakpoint(path, line)
+			}
+			breakpoints = append(breakpoints, bp)
+		}
+		s.respond(req, map[string]interface{}{"breakpoints": breakpoints})
+	})
+}
+
+// handleConfigurationDone starts the launched program
+func (s *Server) handleConfigurationDone(req *message) {
+	if s.launch == nil {
+		s.fail(req, "no program is launched")
+		return
+	}
+	if s.done != nil {
+		s.fail(req, "the program is already running")
+		return
+	}
+	s.respond(req, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	s.debugger.StopOnEntry(s.launch.StopOnEntry)
+	go s.run(ctx)
+}
+
+// run runs the program. It ends with the exited and terminated events
+func (s *Server) run(ctx context.Context) {
+	defer close(s.done)
+
+	options := append([]interpreter.Option{}, s.Options...)
+	options = append(options, interpreter.Stdout(&output{server: s, category: "stdout"}))
+	if !s.launch.NoDebug {
+		options = append(options, s.debugger.Option())
+	}
+	i := interpreter.New(&parser.Parser{}, options...)
+
+	exitCode := 0
+	result, err := i.ExecContext(ctx, s.program)
+	switch {
+	case err == nil:
+		if result != "" {
+			s.event("output", map[string]interface{}{"category": "stdout", "output": result + "\n"})
+		}
+	case err == debugger.ErrQuit || ctx.Err() != nil:
+	default:
+		exitCode = 1
+		text := err.Error()
+		if rerr, ok := err.(*interpreter.RuntimeError); ok {
+			source, _ := ioutil.ReadFile(rerr.Pos.File)
+			text = rerr.Render(string(source))
+		}
+		s.event("output", map[string]interface{}{"category": "stderr", "output": text + "\n"})
+	}
+
+	s.event("exited", map[string]interface{}{"exitCode": exitCode})
+	s.event("terminated", nil)
+}
+
+// stop ends the program, if it runs, and waits for it
+func (s *Server) stop() {
+	if s.done == nil {
+		return
+	}
+	s.mu.Lock()
+	s.quitting = true
+	paused := s.paused
+	s.mu.Unlock()
+	if paused {
+		s.send(func(stop *debugger.Stop) bool {
+			s.debugger.Quit()
+			return true
+		})
+	}
+	s.cancel()
+	<-s.done
+}
+
+// pause is called by the debugger when the program pauses. The program runs the commands
+// sent by the server until one of them resumes it
+func (s *Server) pause(stop *debugger.Stop) {
+	s.mu.Lock()
+	if s.quitting {
+		s.mu.Unlock()
+		s.debugger.Quit()
+		return
+	}
+	s.paused = true
+	s.mu.Unlock()
+	s.event("stopped", map[string]interface{}{"reason": string(stop.Reason), "threadId": threadID, "allThreadsStopped": true})
+
+	for c := range s.commands {
+		resume := c.run(stop)
+		if resume {
+			s.mu.Lock()
+			s.paused = false
+			s.mu.Unlock()
+		}
+		close(c.done)
+		if resume {
+			return
+		}
+	}
+}
+
+// whilePaused runs a command in the paused program, or fails when the program is not paused
+func (s *Server) whilePaused(req *message, run func(stop *debugger.Stop) bool) {
+	s.mu.Lock()
+	paused := s.paused
+	s.mu.Unlock()
+	if !paused {
+		s.fail(req, "the program is not paused")
+		return
+	}
+	s.send(run)
+}
+
+// whileConfigurable runs a function that changes the configuration of the debugger.
+// Once the program runs, the debugger can only be changed while the program is paused
+func (s *Server) whileConfigurable(req *message, fn func()) {
+	if s.done == nil {
+		fn()
+		return
+	}
+	s.whilePaused(req, func(stop *debugger.Stop) bool {
+		fn()
+		return false
+	})
+}
+
+// send runs a command in the paused program and waits for it
+func (s *Server) send(run func(stop *debugger.Stop) bool) {
+	c := command{run: run, done: make(chan struct{})}
+	s.commands <- c
+	<-c.done
+}
+
+func (s *Server) stackTrace(stop *debugger.Stop) []stackFrame {
+	stack := stop.Interpreter.Stack()
+	name := func(depth int) string {
+		if depth < len(stack) {
+			return stack[depth].Function
+		}
+		return "main"
+	}
+
+	frames := []stackFrame{s.newFrame(0, name(0), stop.Pos())}
+	for depth, f := range stack {
+		frames = append(frames, s.newFrame(depth+1, name(depth+1), f.Pos))
+	}
+	return frames
+}
+
+func (s *Server) newFrame(id int, name string, pos tokens.Position) stackFrame {
+	return stackFrame{
+		ID:     id,
+		Name:   name,
+		Source: newSource(pos.File),
+		Line:   s.toClientLine(pos.Line),
+		Column: s.toClientColumn(pos.Col),
+	}
+}
+
+// scopes returns the scopes of a frame. Only the variables of the innermost function call
+// can be inspected: the other frames only show the global variables
+func scopes(stop *debugger.Stop, frameID int) []scope {
+	globals := scope{Name: "Globals", VariablesReference: globalsReference}
+	if frameID != 0 || len(stop.Interpreter.Stack()) == 0 {
+		return []scope{globals}
+	}
+	return []scope{{Name: "Locals", VariablesReference: localsReference}, globals}
+}
+
+func variables(stop *debugger.Stop, reference int) []variable {
+	values := map[string]interpreter.Value{}
+	switch reference {
+	case localsReference:
+		values = stop.Interpreter.Locals()
+	case globalsReference:
+		values = stop.Interpreter.Globals()
+	}
+
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vars := []variable{}
+	for _, name := range names {
+		vars = append(vars, newVariable(name, values[name]))
+	}
+	return vars
+}
+
+func newVariable(name string, value interpreter.Value) variable {
+	if value == nil {
+		return variable{Name: name, Value: "nothing", Type: "nothing"}
+	}
+	text := value.String()
+	if s, ok := value.(interpreter.String); ok {
+		text = strconv.Quote(string(s))
+	}
+	return variable{Name: name, Value: text, Type: value.Type()}
+}
+
+func newSource(path string) source {
+	return source{Name: filepath.Base(path), Path: path}
+}
+
+// statementLines returns the lines where a statement starts
+func statementLines(file *ast.SourceFile) map[int]bool {
+	lines := map[int]bool{}
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.StatementList:
+			for _, st := range n.Statements {
+				if _, ok := st.(*ast.BlockStmt); !ok {
+					lines[st.Pos().Line] = true
+				}
+			}
+		case *ast.MatchArm:
+			if _, ok := n.Body.(*ast.BlockStmt); !ok {
+				lines[n.Body.Pos().Line] = true
+			}
+		}
+		return true
+	})
+	return lines
+}
+
+func (s *Server) toClientLine(line int) int {
+	if s.linesStartAt1 {
+		return line
+	}
+	return line - 1
+}
+
+func (s *Server) fromClientLine(line int) int {
+	if s.linesStartAt1 {
+		return line
+	}
+	return line + 1
+}
+
+func (s *Server) toClientColumn(col int) int {
+	if s.columnsStartAt1 {
+		return col
+	}
+	return col - 1
+}
+
+// decode reads the arguments of a request. It answers the request when they are invalid
+func (s *Server) decode(req *message, args interface{}) bool {
+	if len(req.Arguments) == 0 {
+		return true
+	}
+	if err := json.Unmarshal(req.Arguments, args); err != nil {
+		s.fail(req, fmt.Sprintf("invalid arguments: %s", err))
+		return false
+	}
+	return true
+}
+
+func (s *Server) respond(req *message, body interface{}) {
+	success := true
+	s.write(&message{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &success, Body: body})
+}
+
+func (s *Server) fail(req *message, text string) {
+	success := false
+	s.write(&message{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &success, Message: text})
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.write(&message{Type: "event", Event: name, Body: body})
+}
+
+func (s *Server) write(msg *message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	msg.Seq = s.seq
+	// the client is gone when the output fails: there is nobody to tell
+	writeMessage(s.writer, msg)
+}
+
+// output sends what the program prints to the client
+type output struct {
+	server   *Server
+	category string
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.server.event("output", map[string]interface{}{"category": o.category, "output": string(p)})
+	return len(p), nil
+}
+
+func parseFile(path string) (file *ast.SourceFile, err error) {
+	input, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		// the parser panics on bugs. They must not crash the server
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Parser error: %v", r)
+		}
+	}()
+	p := parser.Parser{}
+	node, err := p.Parse(path, string(input))
+	if err != nil {
+		return nil, fmt.Errorf("Parser error: %s", err)
+	}
+	return node.(*ast.SourceFile), nil
+}
@@ -0,0 +1,289 @@
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const program = `func square(n:int) :int
+    m := n * n
+    m
+
+x := 3
+y := square(x)
+println("y = ${y}")
+y`
+
+// client is a scripted DAP client talking to a server running in the test
+type client struct {
+	t      *testing.T
+	writer io.WriteCloser
+	// messages are read as soon as the server sends them, like a real client does
+	messages chan *message
+	seq      int
+	// output collects the output events
+	output []string
+	// served receives the result of Serve
+	served chan error
+}
+
+func newClient(t *testing.T) *client {
+	requests, requestsWriter := io.Pipe()
+	responsesReader, responses := io.Pipe()
+	c := &client{t: t, writer: requestsWriter, messages: make(chan *message, 100), served: make(chan error, 1)}
+
+	server := NewServer(requests, responses)
+	go func() {
+		c.served <- server.Serve()
+		responses.Close()
+	}()
+	go func() {
+		defer close(c.messages)
+		reader := bufio.NewReader(responsesReader)
+		for {
+			msg, err := readMessage(reader)
+			if err != nil {
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	return c
+}
+
+// request sends a request and returns its response
+func (c *client) request(command string, args interface{}) *message {
+	c.seq++
+	msg := &message{Seq: c.seq, Type: "request", Command: command}
+	if args != nil {
+		encoded, err := json.Marshal(args)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		msg.Arguments = encoded
+	}
+	if err := writeMessage(c.writer, msg); err != nil {
+		c.t.Fatal(err)
+	}
+
+	response := c.next("response", command)
+	if response.RequestSeq != c.seq {
+		c.t.Fatalf("expected the response to request %d - got %d", c.seq, response.RequestSeq)
+	}
+	return response
+}
+
+// next returns the next response or event of a given name. Output events are collected,
+// other messages are skipped
+func (c *client) next(kind, name string) *message {
+	for {
+		msg, ok := <-c.messages
+		if !ok {
+			c.t.Fatalf("expected %s %s - got the end of the output", kind, name)
+		}
+		if msg.Type == "event" && msg.Event == "output" {
+			body := map[string]string{}
+			decode(c.t, msg, &body)
+			c.output = append(c.output, body["category"]+": "+body["output"])
+		}
+		if msg.Type == kind && (msg.Command == name || msg.Event == name) {
+			return msg
+		}
+	}
+}
+
+// decode reads the body of a message
+func decode(t *testing.T, msg *message, body interface{}) {
+	encoded, err := json.Marshal(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(encoded, body); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeProgram(t *testing.T, source string) (string, func()) {
+	dir, err := ioutil.TempDir("", "cairn-dap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "main.ca")
+	if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestServer(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("debugs a program", func(t *testing.T) {
+		path, cleanup := writeProgram(t, program)
+		defer cleanup()
+		c := newClient(t)
+
+		init := c.request("initialize", map[string]interface{}{"adapterID": "cairn"})
+		assert.True(*init.Success)
+		capabilities := map[string]bool{}
+		decode(t, init, &capabilities)
+		assert.True(capabilities["supportsConfigurationDoneRequest"])
+		c.next("event", "initialized")
+
+		assert.True(*c.request("launch", map[string]interface{}{"program": path}).Success)
+
+		bps := c.request("setBreakpoints", map[string]interface{}{
+			"source":      map[string]string{"path": path},
+			"breakpoints": []map[string]int{{"line": 2}, {"line": 4}},
+		})
+		body := struct{ Breakpoints []breakpoint }{}
+		decode(t, bps, &body)
+		if assert.Len(body.Breakpoints, 2) {
+			assert.True(body.Breakpoints[0].Verified)
+			assert.False(body.Breakpoints[1].Verified)
+			assert.Equal("no statement starts on this line", body.Breakpoints[1].Message)
+		}
+
+		assert.True(*c.request("configurationDone", nil).Success)
+		stopped := map[string]interface{}{}
+		decode(t, c.next("event", "stopped"), &stopped)
+		assert.Equal("breakpoint", stopped["reason"])
+
+		threads := struct{ Threads []thread }{}
+		decode(t, c.request("threads", nil), &threads)
+		assert.Equal([]thread{{ID: 1, Name: "main"}}, threads.Threads)
+
+		trace := struct{ StackFrames []stackFrame }{}
+		decode(t, c.request("stackTrace", map[string]int{"threadId": 1}), &trace)
+		assert.Equal([]stackFrame{
+			{ID: 0, Name: "square", Source: newSource(path), Line: 2, Column: 5},
+			{ID: 1, Name: "main", Source: newSource(path), Line: 6, Column: 6},
+		}, trace.StackFrames)
+
+		scopes := struct{ Scopes []scope }{}
+		decode(t, c.request("scopes", map[string]int{"frameId": 0}), &scopes)
+		assert.Equal([]scope{{Name: "Locals", VariablesReference: 1}, {Name: "Globals", VariablesReference: 2}}, scopes.Scopes)
+		decode(t, c.request("scopes", map[string]int{"frameId": 1}), &scopes)
+		assert.Equal([]scope{{Name: "Globals", VariablesReference: 2}}, scopes.Scopes)
+
+		vars := struct{ Variables []variable }{}
+		decode(t, c.request("variables", map[string]int{"variablesReference": 1}), &vars)
+		assert.Equal([]variable{{Name: "n", Value: "3", Type: "int"}}, vars.Variables)
+		decode(t, c.request("variables", map[string]int{"variablesReference": 2}), &vars)
+		assert.Equal([]variable{{Name: "x", Value: "3", Type: "int"}}, vars.Variables)
+
+		result := map[string]interface{}{}
+		decode(t, c.request("evaluate", map[string]interface{}{"expression": `"n = ${n * 10}"`, "frameId": 0}), &result)
+		assert.Equal(`"n = 30"`, result["result"])
+		assert.Equal("string", result["type"])
+		failed := c.request("evaluate", map[string]interface{}{"expression": "foo"})
+		assert.False(*failed.Success)
+		assert.Equal("<debug>:1:1: unknown identifier: foo", failed.Message)
+
+		assert.True(*c.request("next", map[string]int{"threadId": 1}).Success)
+		decode(t, c.next("event", "stopped"), &stopped)
+		assert.Equal("step", stopped["reason"])
+		decode(t, c.request("stackTrace", map[string]int{"threadId": 1}), &trace)
+		assert.Equal(3, trace.StackFrames[0].Line)
+
+		assert.True(*c.request("continue", map[string]int{"threadId": 1}).Success)
+		exited := map[string]int{}
+		decode(t, c.next("event", "exited"), &exited)
+		assert.Equal(0, exited["exitCode"])
+		c.next("event", "terminated")
+		assert.Equal([]string{"stdout: y = 9\n", "stdout: 9\n"}, c.output)
+
+		assert.True(*c.request("disconnect", nil).Success)
+		assert.Nil(<-c.served)
+	})
+
+	t.Run("reports runtime errors", func(t *testing.T) {
+		path, cleanup := writeProgram(t, "x := 1\nx / 0")
+		defer cleanup()
+		c := newClient(t)
+
+		c.request("initialize", nil)
+		c.request("launch", map[string]interface{}{"program": path, "stopOnEntry": true})
+		c.request("configurationDone", nil)
+		stopped := map[string]interface{}{}
+		decode(t, c.next("event", "stopped"), &stopped)
+		assert.Equal("entry", stopped["reason"])
+
+		c.request("continue", nil)
+		exited := map[string]int{}
+		decode(t, c.next("event", "exited"), &exited)
+		assert.Equal(1, exited["exitCode"])
+		if assert.Len(c.output, 1) {
+			assert.True(strings.HasPrefix(c.output[0], "stderr: "+path+":2:3: division by zero: 1 / 0\n"), c.output[0])
+		}
+
+		c.writer.Close()
+		assert.Nil(<-c.served)
+	})
+
+	t.Run("rejects invalid requests", func(t *testing.T) {
+		path, cleanup := writeProgram(t, "x := 1")
+		defer cleanup()
+		c := newClient(t)
+
+		fixtures := []struct {
+			command string
+			args    interface{}
+			message string
+		}{
+			{"configurationDone", nil, "no program is launched"},
+			{"launch", map[string]string{"program": path + ".missing"}, "open " + path + ".missing: no such file or directory"},
+			{"stackTrace", nil, "the program is not paused"},
+			{"next", nil, "the program is not paused"},
+			{"scopes", "frame", "invalid arguments: json: cannot unmarshal string into Go value of type dap.frameArguments"},
+			{"restart", nil, "unsupported request restart"},
+		}
+		for _, f := range fixtures {
+			response := c.request(f.command, f.args)
+			assert.False(*response.Success, f.command)
+			assert.Equal(f.message, response.Message, f.command)
+		}
+
+		c.writer.Close()
+		assert.Nil(<-c.served)
+	})
+
+	t.Run("stops a paused program when the client disconnects", func(t *testing.T) {
+		path, cleanup := writeProgram(t, program)
+		defer cleanup()
+		c := newClient(t)
+
+		c.request("initialize", nil)
+		c.request("launch", map[string]interface{}{"program": path, "stopOnEntry": true})
+		c.request("configurationDone", nil)
+		c.next("event", "stopped")
+		assert.True(*c.request("disconnect", nil).Success)
+		assert.Nil(<-c.served)
+		assert.Empty(c.output)
+	})
+
+	t.Run("frames messages with a Content-Length header", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		assert.Nil(writeMessage(buf, &message{Seq: 1, Type: "event", Event: "initialized"}))
+		assert.Equal("Content-Length: 46\r\n\r\n{\"seq\":1,\"type\":\"event\",\"event\":\"initialized\"}", buf.String())
+
+		msg, err := readMessage(bufio.NewReader(buf))
+		if assert.Nil(err) {
+			assert.Equal("initialized", msg.Event)
+		}
+
+		_, err = readMessage(bufio.NewReader(strings.NewReader("Content-Type: json\r\n\r\n{}")))
+		assert.EqualError(err, "expected a Content-Length header")
+		_, err = readMessage(bufio.NewReader(strings.NewReader("garbage\r\n\r\n")))
+		assert.EqualError(err, `invalid header "garbage"`)
+	})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fchoquet/cairn/dap"
+	"github.com/fchoquet/cairn/debugger"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/modules"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+const debugHelp = `commands:
+    break [file:]line, b     sets a breakpoint
+    clear [file:]line        removes a breakpoint
+    breakpoints              lists the breakpoints
+    continue, c              runs until the next breakpoint
+    step, s                  steps into function calls
+    next, n                  steps over function calls
+    out, o                   steps out of the current function
+    stack, bt                displays the call stack
+    locals                   displays the variables of the current function
+    globals                  displays the global variables
+    print expr, p expr       evaluates an expression
+    quit, q                  stops the program
+`
+
+// debug implements the debug command
+func debug(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	file := flags.Arg(0)
+	node, err := parseFile(file)
+	if err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+
+	// the program reads its input from the same buffer as the debugger
+	reader := bufio.NewReader(os.Stdin)
+	session := &debugSession{main: file, reader: reader, sources: map[string][]string{}}
+	d := debugger.New(session.pause)
+	session.debugger = d
+
+	options := append(hostCapabilities(reader), interpreter.Loader(modules.NewLoader(searchPath()...)), d.Option())
+	i := interpreter.New(&parser.Parser{}, options...)
+	fmt.Print("type help for the list of commands\n")
+	output, err := i.Exec(node)
+	switch {
+	case err == debugger.ErrQuit:
+		return 0
+	case err != nil:
+		source, _ := ioutil.ReadFile(file)
+		printError(err, string(source))
+		return 1
+	}
+	if output != "" {
+		fmt.Println(output)
+	}
+	return 0
+}
+
+// serveDAP implements the dap command. The protocol uses stdin and stdout:
+// the programs can not read the standard input, and their output is sent to the client
+func serveDAP() int {
+	server := dap.NewServer(os.Stdin, os.Stdout)
+	server.Options = []interpreter.Option{
+		interpreter.Loader(modules.NewLoader(searchPath()...)),
+		interpreter.Files(interpreter.Dir(".")),
+		interpreter.Clock(time.Now),
+		interpreter.Random(rand.NewSource(time.Now().UnixNano())),
+	}
+	if err := server.Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, "!!! "+err.Error())
+		return 1
+	}
+	return 0
+}
+
+// debugSession reads the commands of the user while the program is paused
+type debugSession struct {
+	debugger *debugger.Debugger
+	// main is the file being debugged. Breakpoints are set in this file by default
+	main    string
+	reader  *bufio.Reader
+	sources map[string][]string
+}
+
+func (s *debugSession) pause(stop *debugger.Stop) {
+	pos := stop.Pos()
+	fmt.Printf("stopped at %s:%d (%s)\n", pos.File, pos.Line, stop.Reason)
+	s.printLine(pos)
+
+	for {
+		fmt.Print("(debug) ")
+		input, err := s.reader.ReadString('\n')
+		if err != nil && input == "" {
+			// the end of the input stops the program
+			s.debugger.Quit()
+			return
+		}
+
+		command, arg := splitCommand(input)
+		switch command {
+		case "":
+		case "help", "h":
+			fmt.Print(debugHelp)
+		case "break", "b":
+			if file, line, ok := s.parseLine(arg); ok {
+				s.debugger.SetBreakpoint(file, line)
+				fmt.Printf("breakpoint set at %s:%d\n", file, line)
+			}
+		case "clear":
+			if file, line, ok := s.parseLine(arg); ok && !s.debugger.ClearBreakpoint(file, line) {
+				fmt.Printf("!!! no breakpoint at %s:%d\n", file, line)
+			}
+		case "breakpoints":
+			for _, p := range s.debugger.Breakpoints() {
+				fmt.Printf("%s:%d\n", p.File, p.Line)
+			}
+		case "continue", "c":
+			s.debugger.Continue()
+			return
+		case "step", "s":
+			s.debugger.StepInto()
+			return
+		case "next", "n":
+			s.debugger.StepOver()
+			return
+		case "out", "o":
+			s.debugger.StepOut()
+			return
+		case "quit", "q":
+			s.debugger.Quit()
+			return
+		case "stack", "bt":
+			fmt.Printf("  at %s:%d:%d\n", pos.File, pos.Line, pos.Col)
+			for _, f := range stop.Interpreter.Stack() {
+				fmt.Println("  in " + f.String())
+			}
+		case "locals":
+			printVariables(stop.Interpreter.Locals())
+		case "globals":
+			printVariables(stop.Interpreter.Globals())
+		case "print", "p":
+			value, err := stop.Interpreter.Evaluate(arg)
+			switch {
+			case err != nil:
+				fmt.Println("!!! " + err.Error())
+			case value == nil:
+				fmt.Println("--> nothing")
+			default:
+				fmt.Println("--> " + value.String())
+			}
+		default:
+			fmt.Printf("!!! unknown command %s. Type help for the list of commands\n", command)
+		}
+	}
+}
+
+// printLine displays the source line of a position
+func (s *debugSession) printLine(pos tokens.Position) {
+	lines, ok := s.sources[pos.File]
+	if !ok {
+		source, _ := ioutil.ReadFile(pos.File)
+		lines = strings.Split(string(source), "\n")
+		s.sources[pos.File] = lines
+	}
+	if pos.Line >= 1 && pos.Line <= len(lines) {
+		fmt.Printf("%5d | %s\n", pos.Line, strings.TrimRight(lines[pos.Line-1], "\r"))
+	}
+}
+
+// parseLine reads the location of a breakpoint: a line of the main file, or file:line
+func (s *debugSession) parseLine(arg string) (string, int, bool) {
+	file := s.main
+	if index := strings.LastIndexByte(arg, ':'); index >= 0 {
+		file, arg = arg[:index], arg[index+1:]
+	}
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 {
+		fmt.Printf("!!! expected a line number - got %q\n", arg)
+		return "", 0, false
+	}
+	return file, line, true
+}
+
+func splitCommand(input string) (command, arg string) {
+	input = strings.TrimSpace(input)
+	if index := strings.IndexAny(input, " \t"); index >= 0 {
+		return input[:index], strings.TrimSpace(input[index+1:])
+	}
+	return input, ""
+}
+
+func printVariables(variables map[string]interpreter.Value) {
+	names := []string{}
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s = %s\n", name, variables[name])
+	}
+}
@@ -0,0 +1,175 @@
+// Package debugger pauses cairn programs at breakpoints and after steps.
+//
+// A Debugger is attached to an interpreter as its step hook. When the program pauses,
+// the Pause function receives the position of the statement about to run and may inspect
+// the interpreter. The program resumes when Pause returns, as requested by the last
+// call to Continue, StepInto, StepOver, StepOut or Quit.
+package debugger
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// ErrQuit stops the program when the debugger quits
+var ErrQuit = errors.New("debugger: quit")
+
+// Reason tells why a program paused
+type Reason string
+
+// Pause reasons
+const (
+	Entry      Reason = "entry"
+	Breakpoint Reason = "breakpoint"
+	Step       Reason = "step"
+)
+
+// Stop describes a paused program
+type Stop struct {
+	Reason Reason
+	// Node is the statement about to run
+	Node        ast.Node
+	Interpreter *interpreter.Interpreter
+}
+
+// Pos returns the position of the statement about to run
+func (s *Stop) Pos() tokens.Position {
+	return s.Node.Pos()
+}
+
+type action int
+
+const (
+	continueAction action = iota
+	stepIntoAction
+	stepOverAction
+	stepOutAction
+	quitAction
+)
+
+type line struct {
+	file string
+	line int
+}
+
+// Debugger controls the execution of a program
+type Debugger struct {
+	// Pause is called when the program pauses
+	Pause func(stop *Stop)
+
+	breakpoints map[line]bool
+	action      action
+	// depth is the number of active calls when the last step was requested
+	depth int
+	// entry pauses the program before its first statement
+	entry bool
+}
+
+// New creates a debugger pausing the program before its first statement
+func New(pause func(stop *Stop)) *Debugger {
+	return &Debugger{
+		Pause:       pause,
+		breakpoints: map[line]bool{},
+		entry:       true,
+	}
+}
+
+// StopOnEntry tells whether the program pauses before its first statement
+func (d *Debugger) StopOnEntry(stop bool) {
+	d.entry = stop
+}
+
+// Option returns the interpreter option attaching the debugger
+func (d *Debugger) Option() interpreter.Option {
+	return interpreter.OnStep(d.hook)
+}
+
+// SetBreakpoint pauses the program before the statements starting on a line
+func (d *Debugger) SetBreakpoint(file string, n int) {
+	d.breakpoints[line{file, n}] = true
+}
+
+// ClearBreakpoint removes a breakpoint. It returns false if there was none
+func (d *Debugger) ClearBreakpoint(file string, n int) bool {
+	if !d.breakpoints[line{file, n}] {
+		return false
+	}
+	delete(d.breakpoints, line{file, n})
+	return true
+}
+
+// Breakpoints returns the positions of the breakpoints, sorted by file and line
+func (d *Debugger) Breakpoints() []tokens.Position {
+	positions := []tokens.Position{}
+	for l := range d.breakpoints {
+		positions = append(positions, tokens.Position{File: l.file, Line: l.line})
+	}
+	sort.Slice(positions, func(a, b int) bool {
+		if positions[a].File != positions[b].File {
+			return positions[a].File < positions[b].File
+		}
+		return positions[a].Line < positions[b].Line
+	})
+	return positions
+}
+
+// Continue resumes the program until the next breakpoint
+func (d *Debugger) Continue() {
+	d.action = continueAction
+}
+
+// StepInto pauses the program before the next statement, in a called function if any
+func (d *Debugger) StepInto() {
+	d.action = stepIntoAction
+}
+
+// StepOver pauses the program before the next statement of the current function
+func (d *Debugger) StepOver() {
+	d.action = stepOverAction
+}
+
+// StepOut pauses the program before the next statement of the calling function
+func (d *Debugger) StepOut() {
+	d.action = stepOutAction
+}
+
+// Quit stops the program with ErrQuit
+func (d *Debugger) Quit() {
+	d.action = quitAction
+}
+
+func (d *Debugger) hook(i *interpreter.Interpreter, node ast.Node) error {
+	if d.action == quitAction {
+		return ErrQuit
+	}
+
+	depth := len(i.Stack())
+	pos := node.Pos()
+	var reason Reason
+	switch {
+	case d.entry:
+		d.entry = false
+		reason = Entry
+	case d.action == stepIntoAction,
+		d.action == stepOverAction && depth <= d.depth,
+		d.action == stepOutAction && depth < d.depth:
+		reason = Step
+	case d.breakpoints[line{pos.File, pos.Line}]:
+		reason = Breakpoint
+	default:
+		return nil
+	}
+
+	// without any command, the program runs until the next breakpoint
+	d.action = continueAction
+	d.Pause(&Stop{Reason: reason, Node: node, Interpreter: i})
+	d.depth = len(i.Stack())
+	if d.action == quitAction {
+		return ErrQuit
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package debugger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const program = `func square(n:int) :int
+    m := n * n
+    m
+
+func sum(a:int, b:int) :int
+    s := square(a) + square(b)
+    s
+
+x := 3
+y := sum(x, 4)
+y`
+
+// record runs the program and records the pauses. Each pause runs the next command
+func record(d *Debugger, commands []func(*Debugger, *Stop)) ([]string, error) {
+	pauses := []string{}
+	d.Pause = func(stop *Stop) {
+		pauses = append(pauses, fmt.Sprintf("%d %s", stop.Pos().Line, stop.Reason))
+		if len(commands) == 0 {
+			d.Continue()
+			return
+		}
+		commands[0](d, stop)
+		commands = commands[1:]
+	}
+
+	i := interpreter.New(&parser.Parser{}, d.Option())
+	_, err := i.Interpret("test.ca", program)
+	return pauses, err
+}
+
+func TestDebugger(t *testing.T) {
+	assert := assert.New(t)
+
+	stepInto := func(d *Debugger, s *Stop) { d.StepInto() }
+	stepOver := func(d *Debugger, s *Stop) { d.StepOver() }
+	stepOut := func(d *Debugger, s *Stop) { d.StepOut() }
+	cont := func(d *Debugger, s *Stop) { d.Continue() }
+
+	t.Run("steps", func(t *testing.T) {
+		fixtures := []struct {
+			name     string
+			commands []func(*Debugger, *Stop)
+			pauses   []string
+		}{
+			{"continue", nil, []string{"9 entry"}},
+			{"step into", []func(*Debugger, *Stop){stepInto, stepInto, stepInto, stepInto, stepInto, stepInto},
+				[]string{"9 entry", "10 step", "6 step", "2 step", "3 step", "2 step", "3 step"}},
+			{"step over", []func(*Debugger, *Stop){stepOver, stepOver, stepOver},
+				[]string{"9 entry", "10 step", "11 step"}},
+			{"step out", []func(*Debugger, *Stop){stepInto, stepInto, stepInto, stepOut, stepOut},
+				// the second call to square is skipped
+				[]string{"9 entry", "10 step", "6 step", "2 step", "7 step", "11 step"}},
+		}
+
+		for _, f := range fixtures {
+			pauses, err := record(New(nil), f.commands)
+			if assert.Nil(err, f.name) {
+				assert.Equal(f.pauses, pauses, f.name)
+			}
+		}
+	})
+
+	t.Run("breakpoints", func(t *testing.T) {
+		d := New(nil)
+		d.SetBreakpoint("test.ca", 3)
+		d.SetBreakpoint("test.ca", 11)
+		d.SetBreakpoint("other.ca", 1)
+		assert.True(d.ClearBreakpoint("other.ca", 1))
+		assert.False(d.ClearBreakpoint("other.ca", 1))
+		assert.Equal("[Pos(test.ca, 3, 0) Pos(test.ca, 11, 0)]", fmt.Sprint(d.Breakpoints()))
+
+		pauses, err := record(d, []func(*Debugger, *Stop){cont, cont, stepOver})
+		if assert.Nil(err) {
+			assert.Equal([]string{"9 entry", "3 breakpoint", "3 breakpoint", "7 step", "11 breakpoint"}, pauses)
+		}
+	})
+
+	t.Run("inspects the paused program", func(t *testing.T) {
+		d := New(nil)
+		d.SetBreakpoint("test.ca", 3)
+		inspected := false
+		_, err := record(d, []func(*Debugger, *Stop){cont, func(d *Debugger, s *Stop) {
+			inspected = true
+			i := s.Interpreter
+			assert.Equal("[square (test.ca:6:10) sum (test.ca:10:6)]", fmt.Sprint(i.Stack()))
+			assert.Equal(map[string]interpreter.Value{"n": interpreter.Int(3), "m": interpreter.Int(9)}, i.Locals())
+			assert.Equal(map[string]interpreter.Value{"x": interpreter.Int(3)}, i.Globals())
+
+			value, err := i.Evaluate("m + x")
+			if assert.Nil(err) {
+				assert.Equal(interpreter.Int(12), value)
+			}
+			// the program sees the assignments
+			_, err = i.Evaluate("m := 0")
+			assert.Nil(err)
+			_, err = i.Evaluate("func f() :int\n    1")
+			assert.Error(err)
+			d.Continue()
+		}})
+		assert.True(inspected)
+		assert.Nil(err)
+	})
+
+	t.Run("quits", func(t *testing.T) {
+		pauses, err := record(New(nil), []func(*Debugger, *Stop){stepInto, func(d *Debugger, s *Stop) { d.Quit() }})
+		assert.Equal(ErrQuit, err)
+		assert.Equal([]string{"9 entry", "10 step"}, pauses)
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/cfg"
+	"github.com/fchoquet/cairn/optimize"
+	"github.com/fchoquet/cairn/parser"
+)
+
+// dumpAST implements the ast command
+func dumpAST(args []string) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "encode the AST in JSON")
+	asDot := flags.Bool("dot", false, "output a Graphviz DOT graph of the AST")
+	optimized := flags.Bool("O", false, "optimize the AST")
+	tracePasses := flags.Bool("trace-passes", false, "dump the AST before and after each optimization pass")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || (*asJSON && *asDot) {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	node, err := parseFile(flags.Arg(0))
+	if err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+	node = optimizeAST(node, *optimized, *tracePasses)
+
+	switch {
+	case *asJSON:
+		encoded, err := ast.ToJSON(node)
+		if err != nil {
+			fmt.Println("!!! " + err.Error())
+			return 1
+		}
+		indented := &bytes.Buffer{}
+		if err := json.Indent(indented, encoded, "", "  "); err != nil {
+			fmt.Println("!!! " + err.Error())
+			return 1
+		}
+		fmt.Println(indented.String())
+	case *asDot:
+		if err := ast.WriteDot(os.Stdout, node); err != nil {
+			fmt.Println("!!! " + err.Error())
+			return 1
+		}
+	default:
+		fmt.Println(node)
+	}
+	return 0
+}
+
+// dumpCFG implements the cfg command
+func dumpCFG(args []string) int {
+	flags := flag.NewFlagSet("cfg", flag.ContinueOnError)
+	function := flags.String("func", "", "only output the graph of this function")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	node, err := parseFile(flags.Arg(0))
+	if err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+
+	graphs := []*cfg.Graph{}
+	for _, g := range cfg.BuildFile(node) {
+		if *function == "" || g.Name == *function {
+			graphs = append(graphs, g)
+		}
+	}
+	if len(graphs) == 0 {
+		fmt.Println("!!! unknown function: " + *function)
+		return 1
+	}
+
+	if err := cfg.WriteDot(os.Stdout, graphs...); err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+	return 0
+}
+
+// optimizeAST runs the optimization passes when enabled.
+// Traces are written to stderr so that they do not mix with the output.
+func optimizeAST(node *ast.SourceFile, enabled, trace bool) *ast.SourceFile {
+	if !enabled {
+		return node
+	}
+	pipeline := optimize.NewPipeline(nil)
+	if trace {
+		pipeline.Trace = os.Stderr
+	}
+	return pipeline.Run(node)
+}
+
+func parseFile(file string) (*ast.SourceFile, error) {
+	input, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseSource(file, string(input))
+}
+
+func parseSource(file, source string) (node *ast.SourceFile, err error) {
+	defer func() {
+		// the parser panics on bugs. They must not crash the command
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Parser error: %v", r)
+		}
+	}()
+
+	p := parser.Parser{}
+	nd, err := p.Parse(file, source)
+	if err != nil {
+		return nil, fmt.Errorf("Parser error: %s", err)
+	}
+	return nd.(*ast.SourceFile), nil
+}
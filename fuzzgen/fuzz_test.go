@@ -0,0 +1,26 @@
+//go:build go1.18
+// +build go1.18
+
+package fuzzgen
+
+import (
+	"testing"
+)
+
+// FuzzDifferential lets the fuzzer make the choices of the generator, so that the programs
+// it mutates stay well-typed
+func FuzzDifferential(f *testing.F) {
+	seeds := [][]byte{
+		nil,
+		[]byte("cairn"),
+		{1, 4, 2, 0, 5, 3, 1, 4, 0, 2, 5, 5, 1, 3},
+		{0, 0, 3, 2, 1, 4, 4, 4, 4, 1, 2, 0, 0, 5, 5, 5, 5, 3, 2, 1},
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		differential(t, FromBytes(data).Program())
+	})
+}
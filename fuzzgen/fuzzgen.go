@@ -0,0 +1,392 @@
+// Package fuzzgen generates random well-typed cairn programs, to compare the execution strategies
+// of cairn on programs nobody wrote.
+//
+// The programs declare functions and variables of the types int, bool and string, and use the
+// operators, the match and try expressions and the builtins working on these types. Functions only
+// call the functions declared before them, so that every program ends. The programs pass the checker,
+// but they may fail at run time, with divisions by zero for instance: the strategies must fail alike.
+package fuzzgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Type is a type of the generated values
+type Type string
+
+// Types of the generated values
+const (
+	Int    Type = "int"
+	Bool   Type = "bool"
+	String Type = "string"
+)
+
+var types = []Type{Int, Bool, String}
+
+// indentation is the indentation of a block
+const indentation = "    "
+
+// Generator writes random programs. Its choices come from a random number generator,
+// or from the bytes of a fuzzer input
+type Generator struct {
+	// MaxDepth bounds the nesting of the expressions
+	MaxDepth int
+	// MaxFunctions bounds the number of functions of a program
+	MaxFunctions int
+	// MaxStatements bounds the number of statements of a block
+	MaxStatements int
+
+	// choose returns a number in [0, n)
+	choose func(n int) int
+
+	functions []*function
+	// scope lists the variables that can be read
+	scope []variable
+	// errors lists the caught errors that can be read
+	errors []string
+	names  int
+}
+
+type variable struct {
+	name string
+	typ  Type
+}
+
+type function struct {
+	name   string
+	params []variable
+	result Type
+}
+
+// New creates a generator whose choices depend on a seed
+func New(seed int64) *Generator {
+	r := rand.New(rand.NewSource(seed))
+	return newGenerator(r.Intn)
+}
+
+// FromBytes creates a generator whose choices are read from data, so that a fuzzer mutating
+// data mutates the programs. Once data is exhausted, the first alternative of each choice is taken
+func FromBytes(data []byte) *Generator {
+	return newGenerator(func(n int) int {
+		if len(data) == 0 {
+			return 0
+		}
+		b := data[0]
+		data = data[1:]
+		return int(b) % n
+	})
+}
+
+func newGenerator(choose func(n int) int) *Generator {
+	return &Generator{
+		MaxDepth:      4,
+		MaxFunctions:  4,
+		MaxStatements: 4,
+		choose:        choose,
+	}
+}
+
+// Program returns the source of a new program. Its value is the value of its last statement
+func (g *Generator) Program() string {
+	g.functions = nil
+	g.scope = nil
+	g.errors = nil
+	g.names = 0
+
+	lines := []string{}
+	for n := g.choose(g.MaxFunctions + 1); n > 0; n-- {
+		lines = append(lines, g.function(), "")
+	}
+
+	for n := g.choose(g.MaxStatements + 1); n > 0; n-- {
+		if g.choose(3) == 0 {
+			lines = append(lines, "println("+g.expr(g.anyType(), g.MaxDepth)+")")
+			continue
+		}
+		lines = append(lines, g.assignment(0, g.MaxDepth))
+	}
+	lines = append(lines, g.value(g.anyType(), 0, g.MaxDepth))
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// function declares a function returning the value of its last statement
+func (g *Generator) function() string {
+	f := &function{name: g.name("f"), result: g.anyType()}
+	for n := g.choose(4); n > 0; n-- {
+		f.params = append(f.params, variable{g.name("p"), g.anyType()})
+	}
+
+	params := []string{}
+	for _, p := range f.params {
+		params = append(params, p.name+":"+string(p.typ))
+	}
+	// the function can not read the variables of the program, nor call itself
+	g.scope = append([]variable{}, f.params...)
+	source := fmt.Sprintf("func %s(%s) :%s\n%s", f.name, strings.Join(params, ", "), f.result, g.block(f.result, 1, g.MaxDepth))
+	g.scope = nil
+	g.functions = append(g.functions, f)
+	return source
+}
+
+// block writes indented statements ending with a value of type t. The values nested in the block
+// are not as deep as depth
+func (g *Generator) block(t Type, indent, depth int) string {
+	scope := len(g.scope)
+	defer func() { g.scope = g.scope[:scope] }()
+
+	lines := []string{}
+	prefix := strings.Repeat(indentation, indent)
+	for n := g.choose(g.MaxStatements); n > 0; n-- {
+		lines = append(lines, prefix+g.assignment(indent, depth))
+	}
+	return strings.Join(append(lines, prefix+g.value(t, indent, depth)), "\n")
+}
+
+// assignment assigns a value to a new variable. The variable can be read by the following statements
+func (g *Generator) assignment(indent, depth int) string {
+	t := g.anyType()
+	value := g.value(t, indent, depth)
+	v := variable{g.name("v"), t}
+	g.scope = append(g.scope, v)
+	return v.name + " := " + value
+}
+
+// value writes an expression of type t that may span lines: a match or a try expression,
+// whose blocks are indented after the current line
+func (g *Generator) value(t Type, indent, depth int) string {
+	if depth <= 0 {
+		return g.expr(t, 0)
+	}
+	switch g.choose(6) {
+	case 4:
+		return g.match(t, indent, depth)
+	case 5:
+		return g.try(t, indent, depth)
+	default:
+		return g.expr(t, depth)
+	}
+}
+
+// match writes a match expression with a catch-all arm, so that it is exhaustive
+func (g *Generator) match(t Type, indent, depth int) string {
+	subject := g.anyType()
+	prefix := strings.Repeat(indentation, indent+1)
+	lines := []string{"match " + g.expr(subject, depth-1)}
+
+	arm := func(pattern string) {
+		if g.choose(4) == 0 {
+			lines = append(lines, prefix+pattern+" ->\n"+g.block(t, indent+2, depth-1))
+			return
+		}
+		lines = append(lines, prefix+pattern+" -> "+g.value(t, indent+1, depth-1))
+	}
+
+	if subject == Bool {
+		arm("true")
+		arm("false")
+		return strings.Join(lines, "\n")
+	}
+	for n := g.choose(3); n > 0; n-- {
+		arm(g.literal(subject))
+	}
+	if g.choose(2) == 0 {
+		arm("_")
+		return strings.Join(lines, "\n")
+	}
+	// the binding can be read by the arm
+	v := variable{g.name("m"), subject}
+	g.scope = append(g.scope, v)
+	arm(v.name)
+	g.scope = g.scope[:len(g.scope)-1]
+	return strings.Join(lines, "\n")
+}
+
+// try writes a try expression. The handler may read the caught error
+func (g *Generator) try(t Type, indent, depth int) string {
+	body := g.block(t, indent+1, depth-1)
+	e := g.name("e")
+	g.errors = append(g.errors, e)
+	handler := g.block(t, indent+1, depth-1)
+	g.errors = g.errors[:len(g.errors)-1]
+
+	prefix := strings.Repeat(indentation, indent)
+	return "try\n" + body + "\n" + prefix + "catch " + e + "\n" + handler
+}
+
+// expr writes an expression of type t on a single line
+func (g *Generator) expr(t Type, depth int) string {
+	if depth <= 0 || g.choose(4) == 0 {
+		return g.leaf(t)
+	}
+	if call, ok := g.call(t, depth); ok && g.choose(3) == 0 {
+		return call
+	}
+
+	switch t {
+	case Int:
+		switch g.choose(8) {
+		case 0:
+			return g.binOp(Int, []string{"+", "-", "*"}, depth)
+		case 1:
+			return g.binOp(Int, []string{"/"}, depth)
+		case 2:
+			// powers of literals keep the numbers small
+			return "(" + g.literal(Int) + ") ^ " + strconv.Itoa(g.choose(5))
+		case 3:
+			return "-" + g.operand(Int, depth)
+		case 4:
+			return "len(" + g.expr(String, depth-1) + ")"
+		case 5:
+			return g.builtin([]string{"abs", "min", "max"}, Int, depth)
+		case 6:
+			n := 1 + g.choose(3)
+			elements := []string{}
+			for index := 0; index < n; index++ {
+				elements = append(elements, g.expr(Int, depth-1))
+			}
+			// the index may be out of range
+			return "[" + strings.Join(elements, ", ") + "][" + strconv.Itoa(g.choose(n+1)) + "]"
+		default:
+			return "parseInt(str(" + g.expr(Int, depth-1) + "))"
+		}
+	case Bool:
+		switch g.choose(6) {
+		case 0:
+			return g.binOp(Bool, []string{"&&", "||"}, depth)
+		case 1:
+			return "!" + g.operand(Bool, depth)
+		case 2:
+			return g.contains(depth)
+		default:
+			operands := g.anyType()
+			return g.operand(operands, depth) + []string{" == ", " != "}[g.choose(2)] + g.operand(operands, depth)
+		}
+	default:
+		switch g.choose(7) {
+		case 0:
+			return g.binOp(String, []string{"++"}, depth)
+		case 1:
+			return "str(" + g.expr(g.anyType(), depth-1) + ")"
+		case 2:
+			return g.builtin([]string{"upper", "lower", "trim"}, String, depth)
+		case 3:
+			return "substr(" + g.expr(String, depth-1) + ", " + strconv.Itoa(g.choose(2)) + ", " + strconv.Itoa(g.choose(3)) + ")"
+		case 4:
+			// the replacements are not longer than the replaced strings, so that the strings do not grow
+			old := []string{`"a"`, `"a b"`, `"\n"`}[g.choose(3)]
+			return "replace(" + g.expr(String, depth-1) + ", " + old + ", " + []string{`""`, `"-"`}[g.choose(2)] + ")"
+		case 5:
+			return `join(split(` + g.expr(String, depth-1) + `, " "), "-")`
+		default:
+			return g.interpolation(depth)
+		}
+	}
+}
+
+// leaf writes a literal, a variable or a caught error
+func (g *Generator) leaf(t Type) string {
+	candidates := []string{}
+	for _, v := range g.scope {
+		if v.typ == t {
+			candidates = append(candidates, v.name)
+		}
+	}
+	if t == String {
+		for _, e := range g.errors {
+			candidates = append(candidates, "message("+e+")", "kind("+e+")")
+		}
+	}
+	if len(candidates) == 0 || g.choose(3) == 0 {
+		return g.literal(t)
+	}
+	return candidates[g.choose(len(candidates))]
+}
+
+// literal writes a literal, also used as a pattern
+func (g *Generator) literal(t Type) string {
+	switch t {
+	case Int:
+		switch g.choose(6) {
+		case 4:
+			return "-" + strconv.Itoa(g.choose(10))
+		case 5:
+			// the integers overflowing 64 bits are promoted
+			return []string{"4611686018427387904", "9223372036854775807", "100000000000000000000"}[g.choose(3)]
+		default:
+			return strconv.Itoa(g.choose(10))
+		}
+	case Bool:
+		return []string{"true", "false"}[g.choose(2)]
+	default:
+		return []string{`""`, `"a"`, `"cairn"`, `"a b"`, `"é\n"`, `"\$"`, `"1"`}[g.choose(7)]
+	}
+}
+
+// operand writes the operand of an operator between parentheses, so that the precedence
+// of the operators does not matter. The printer drops the parentheses that are not needed
+func (g *Generator) operand(t Type, depth int) string {
+	return "(" + g.expr(t, depth-1) + ")"
+}
+
+func (g *Generator) binOp(t Type, ops []string, depth int) string {
+	return g.operand(t, depth) + " " + ops[g.choose(len(ops))] + " " + g.operand(t, depth)
+}
+
+// builtin calls a builtin taking and returning values of type t
+func (g *Generator) builtin(names []string, t Type, depth int) string {
+	name := names[g.choose(len(names))]
+	args := []string{g.expr(t, depth-1)}
+	if name == "min" || name == "max" {
+		args = append(args, g.expr(t, depth-1))
+	}
+	return name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (g *Generator) contains(depth int) string {
+	return "contains(" + g.expr(String, depth-1) + ", " + g.expr(String, depth-1) + ")"
+}
+
+func (g *Generator) interpolation(depth int) string {
+	parts := []string{"text ${", g.expr(g.anyType(), depth-1), "}"}
+	if g.choose(2) == 0 {
+		parts = append(parts, " and ${", g.expr(g.anyType(), depth-1), "}")
+	}
+	return `"` + strings.Join(parts, "") + `"`
+}
+
+// call calls a declared function returning a value of type t
+func (g *Generator) call(t Type, depth int) (string, bool) {
+	candidates := []*function{}
+	for _, f := range g.functions {
+		if f.result == t {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	f := candidates[g.choose(len(candidates))]
+	args := []string{}
+	for _, p := range f.params {
+		args = append(args, g.expr(p.typ, depth-1))
+	}
+	return f.name + "(" + strings.Join(args, ", ") + ")", true
+}
+
+func (g *Generator) anyType() Type {
+	return types[g.choose(len(types))]
+}
+
+// name returns a new identifier. Identifiers are made of letters: the counter is written with
+// upper case letters, so that the names are neither keywords nor builtins
+func (g *Generator) name(prefix string) string {
+	g.names++
+	suffix := ""
+	for n := g.names; n > 0; n /= 26 {
+		suffix = string('A'+rune(n%26)) + suffix
+	}
+	return prefix + suffix
+}
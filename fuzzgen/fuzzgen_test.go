@@ -0,0 +1,109 @@
+package fuzzgen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/optimize"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/fchoquet/cairn/printer"
+	"github.com/stretchr/testify/assert"
+)
+
+// outcome is what a program gave
+type outcome struct {
+	Output string
+	Result string
+	// Kind and Message describe the runtime error that stopped the program
+	Kind    interpreter.ErrorKind
+	Message string
+}
+
+func parse(t *testing.T, source string) *ast.SourceFile {
+	p := parser.Parser{}
+	node, err := p.Parse("fuzz.ca", source)
+	if err != nil {
+		t.Fatalf("%s in\n%s", err, source)
+	}
+	return node.(*ast.SourceFile)
+}
+
+// Limits of the programs. The strategies may use different resources: the programs exceeding
+// the limits are not compared
+const (
+	maxSteps       = 1000000
+	maxAllocations = 1 << 24
+)
+
+// run runs a program with the interpreter. The generated programs must pass the checker
+func run(t *testing.T, source string, node *ast.SourceFile, options ...interpreter.Option) outcome {
+	stdout := &bytes.Buffer{}
+	options = append(options, interpreter.Stdout(stdout), interpreter.MaxSteps(maxSteps), interpreter.MaxAllocations(maxAllocations))
+	i := interpreter.New(&parser.Parser{}, options...)
+	result, err := i.Exec(node)
+	if err == nil {
+		return outcome{Output: stdout.String(), Result: result}
+	}
+	e, ok := err.(*interpreter.RuntimeError)
+	if !ok {
+		t.Fatalf("%s in\n%s", err, source)
+	}
+	return outcome{Output: stdout.String(), Kind: e.Kind, Message: e.Message}
+}
+
+// differential runs a program with the execution strategies, and checks that they agree
+// with the interpreter
+func differential(t *testing.T, source string) {
+	expected := run(t, source, parse(t, source))
+	if expected.Kind == interpreter.LimitExceeded {
+		return
+	}
+
+	optimized := optimize.Optimize(parse(t, source))
+	assert.Equal(t, expected, run(t, source, optimized), "optimized\n%s", source)
+
+	formatted := printer.Format(parse(t, source))
+	assert.Equal(t, expected, run(t, formatted, parse(t, formatted)), "formatted\n%s", formatted)
+
+	// with checked arithmetic, an overflow fails instead of promoting the integer. The programs
+	// catching errors may then take other paths
+	if !strings.Contains(source, "try") {
+		checked := run(t, source, parse(t, source), interpreter.CheckedArithmetic())
+		if checked.Kind != interpreter.Overflow {
+			assert.Equal(t, expected, checked, "checked\n%s", source)
+		}
+	}
+}
+
+func TestProgram(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("the programs depend on the seed", func(t *testing.T) {
+		assert.Equal(New(1).Program(), New(1).Program())
+		assert.NotEqual(New(1).Program(), New(2).Program())
+	})
+
+	t.Run("the programs depend on the bytes", func(t *testing.T) {
+		assert.Equal("0\n", FromBytes(nil).Program())
+		assert.Equal(FromBytes([]byte{1, 2, 3}).Program(), FromBytes([]byte{1, 2, 3}).Program())
+		assert.NotEqual(FromBytes([]byte{1, 2, 3}).Program(), FromBytes([]byte{3, 2, 1}).Program())
+	})
+
+	t.Run("a generator can write several programs", func(t *testing.T) {
+		g := New(3)
+		assert.NotEqual(g.Program(), g.Program())
+	})
+}
+
+func TestDifferential(t *testing.T) {
+	seeds := 1000
+	if testing.Short() {
+		seeds = 100
+	}
+	for seed := 0; seed < seeds; seed++ {
+		differential(t, New(int64(seed)).Program())
+	}
+}
@@ -0,0 +1,124 @@
+package gogen
+
+import (
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+)
+
+// builtin translates the calls to a builtin function of the interpreter. The checker verified
+// the arguments
+type builtin func(g *generator, args []value) value
+
+// callTo formats a call to a function of Go or of the runtime package
+func callTo(fn string, typ string, args []value) value {
+	codes := []string{}
+	pure := true
+	for _, arg := range args {
+		codes = append(codes, arg.code)
+		pure = pure && arg.pure
+	}
+	return value{code: fn + "(" + strings.Join(codes, ", ") + ")", typ: typ, call: true, pure: pure}
+}
+
+// runtimeCall formats a call to a function of the runtime package, that may fail
+func runtimeCall(name, typ string) func(*generator, []value) value {
+	return func(g *generator, args []value) value {
+		v := callTo(g.rt(name), typ, args)
+		v.pure = false
+		return v
+	}
+}
+
+// stringsCall formats a call to a function of the strings package
+func stringsCall(name, typ string, extra ...string) func(*generator, []value) value {
+	return func(g *generator, args []value) value {
+		g.imports["strings"] = true
+		for _, code := range extra {
+			args = append(args, value{code: code, pure: true})
+		}
+		return callTo("strings."+name, typ, args)
+	}
+}
+
+// numberCall formats a call to a function taking numbers: the runtime function for the integers,
+// or the math function for the floats
+func numberCall(intFn, floatFn string) func(*generator, []value) value {
+	return func(g *generator, args []value) value {
+		for _, arg := range args {
+			if arg.typ == "float" {
+				for index := range args {
+					args[index] = g.float(args[index])
+				}
+				return callTo(g.math(floatFn), "float", args)
+			}
+		}
+		return runtimeCall(intFn, "int")(g, args)
+	}
+}
+
+var builtins = map[string]builtin{
+	"print":   printCall("Print"),
+	"println": printCall("Println"),
+	"str": func(g *generator, args []value) value {
+		return g.str(args[0])
+	},
+	"int": func(g *generator, args []value) value {
+		if args[0].typ == "int" {
+			return args[0]
+		}
+		return runtimeCall("Truncate", "int")(g, args)
+	},
+	"float": func(g *generator, args []value) value {
+		return g.float(args[0])
+	},
+	"parseInt": runtimeCall("ParseInt", "int"),
+	"len":      runtimeCall("Len", "int"),
+	"upper":    stringsCall("ToUpper", "string"),
+	"lower":    stringsCall("ToLower", "string"),
+	"trim":     stringsCall("TrimSpace", "string"),
+	"contains": stringsCall("Contains", "bool"),
+	"replace":  stringsCall("Replace", "string", "-1"),
+	"substr":   runtimeCall("Substr", "string"),
+	"abs":      numberCall("Abs", "Abs"),
+	"min":      numberCall("Min", "Min"),
+	"max":      numberCall("Max", "Max"),
+	"pow": func(g *generator, args []value) value {
+		// the powers of floats overflow like in cairn
+		if args[0].typ == "float" || args[1].typ == "float" {
+			return callTo(g.rt("PowFloat"), "float", []value{g.float(args[0]), g.float(args[1])})
+		}
+		return runtimeCall("Pow", "int")(g, args)
+	},
+	"fail":      runtimeCall("Fail", nothing),
+	"readLine":  nil,
+	"readFile":  nil,
+	"writeFile": nil,
+	"now":       nil,
+	"random":    nil,
+	"split":     nil,
+	"join":      nil,
+	"message":   nil,
+	"kind":      nil,
+	"position":  nil,
+	// tests are run by the interpreter
+	"assert":      nil,
+	"assertEqual": nil,
+}
+
+func printCall(name string) func(*generator, []value) value {
+	return func(g *generator, args []value) value {
+		return runtimeCall(name, nothing)(g, []value{g.str(args[0])})
+	}
+}
+
+func (g *generator) builtinCall(node *ast.FuncCall, args []value) (value, error) {
+	b, ok := builtins[node.Name]
+	if !ok {
+		return value{}, errorf(node, "unknown function %s", node.Name)
+	}
+	if b == nil {
+		return value{}, errorf(node, "the builtin %s is not supported by the Go backend", node.Name)
+	}
+	return b(g, args), nil
+}
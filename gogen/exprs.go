@@ -0,0 +1,339 @@
+package gogen
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// value is a translated expression
+type value struct {
+	code string
+	typ  string
+	// call tells whether the code is a function call, that may be used as a statement
+	call bool
+	// prec is the precedence of the operator of an operation in Go. It is 0 for the other expressions
+	prec int
+	// pure tells whether the evaluation of the code can neither fail nor have side effects
+	pure bool
+	// literal tells whether the code is a number literal
+	literal bool
+	// integer is the value of an integer literal
+	integer *big.Int
+}
+
+// precedences gives the precedences of the binary operators of Go
+var precedences = map[string]int{"||": 1, "&&": 2, "==": 3, "!=": 3, "+": 4, "-": 4, "*": 5}
+
+// operand returns the code of a value used as an operand of an operator of precedence prec.
+// The operations binding less tightly are parenthesized, as are the right operands of the same precedence
+func (v value) operand(prec int, right bool) string {
+	if v.prec > 0 && (v.prec < prec || (right && v.prec == prec)) {
+		return "(" + v.code + ")"
+	}
+	return v.code
+}
+
+// unaryOperand returns the code of a value used as the operand of a unary operator
+func (v value) unaryOperand() string {
+	if v.prec > 0 || strings.HasPrefix(v.code, "-") {
+		return "(" + v.code + ")"
+	}
+	return v.code
+}
+
+// rt returns the qualified name of a function of the runtime package
+func (g *generator) rt(name string) string {
+	g.imports[RuntimePackage] = true
+	return "rt." + name
+}
+
+// math returns the qualified name of a function of the math package
+func (g *generator) math(name string) string {
+	g.imports["math"] = true
+	return "math." + name
+}
+
+// str converts a value to its cairn string representation
+func (g *generator) str(v value) value {
+	switch v.typ {
+	case "int":
+		return value{code: g.rt("FormatInt") + "(" + v.code + ")", typ: "string", call: true, pure: v.pure}
+	case "float":
+		return value{code: g.rt("FormatFloat") + "(" + v.code + ")", typ: "string", call: true, pure: v.pure}
+	case "bool":
+		return value{code: g.rt("FormatBool") + "(" + v.code + ")", typ: "string", call: true, pure: v.pure}
+	default:
+		return v
+	}
+}
+
+// float converts a number to a float
+func (g *generator) float(v value) value {
+	switch {
+	case v.typ == "float":
+		return v
+	case v.literal:
+		f, _ := new(big.Float).SetInt(v.integer).Float64()
+		return g.floatLiteral(f)
+	default:
+		return value{code: g.rt("Float") + "(" + v.code + ")", typ: "float", call: true, pure: v.pure}
+	}
+}
+
+// intLiteral translates an integer known by the generator. The integers too large
+// for an int64 are given in full
+func (g *generator) intLiteral(n *big.Int) value {
+	code := fmt.Sprintf("%s(%s)", g.rt("NewInt"), n)
+	if !n.IsInt64() {
+		code = fmt.Sprintf("%s(%s)", g.rt("IntLiteral"), strconv.Quote(n.String()))
+	}
+	return value{code: code, typ: "int", pure: true, literal: true, integer: n}
+}
+
+// floatConstant formats a float as a literal. The value is given in full, as Go computes the
+// operations on constants exactly, when cairn rounds each operation like the operations on variables
+func floatConstant(f float64) value {
+	code := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(code, ".e") {
+		code += ".0"
+	}
+	return value{code: code, typ: "float", pure: true, literal: true}
+}
+
+// fold computes an operation on float literals, rounding its result like cairn does
+func (g *generator) fold(op tokens.TokenType, left, right value) value {
+	x, _ := strconv.ParseFloat(left.code, 64)
+	y, _ := strconv.ParseFloat(right.code, 64)
+	var f float64
+	switch op {
+	case tokens.PLUS:
+		f = x + y
+	case tokens.MINUS:
+		f = x - y
+	default:
+		f = x * y
+	}
+	return g.floatLiteral(f)
+}
+
+// floatLiteral formats a float computed by the generator. Go constants have neither
+// infinities nor negative zero: these floats are computed at runtime
+func (g *generator) floatLiteral(f float64) value {
+	switch {
+	case math.IsInf(f, 0):
+		return value{code: fmt.Sprintf("%s(%d)", g.math("Inf"), int(math.Copysign(1, f))), typ: "float", call: true, pure: true}
+	case f == 0 && math.Signbit(f):
+		return value{code: g.math("Copysign") + "(0, -1)", typ: "float", call: true, pure: true}
+	default:
+		return floatConstant(f)
+	}
+}
+
+func (g *generator) expr(node ast.Node) (value, error) {
+	switch n := node.(type) {
+	case *ast.Num:
+		i, ok := new(big.Int).SetString(n.Value, 10)
+		if !ok {
+			return value{}, errorf(n, "invalid integer literal %s", n.Value)
+		}
+		return g.intLiteral(i), nil
+	case *ast.Float:
+		f, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil {
+			return value{}, errorf(n, "float literal %s is out of range", n.Value)
+		}
+		return floatConstant(f), nil
+	case *ast.String:
+		return value{code: strconv.Quote(n.Value), typ: "string", pure: true}, nil
+	case *ast.Bool:
+		return value{code: n.Value, typ: "bool", pure: true}, nil
+	case *ast.Interpolation:
+		return g.interpolation(n)
+	case *ast.Variable:
+		return g.read(n)
+	case *ast.UnaryOp:
+		return g.unaryOp(n)
+	case *ast.BinOp:
+		return g.binOp(n)
+	case *ast.FuncCall:
+		return g.funcCall(n)
+	case *ast.Match:
+		return g.matchExpr(n)
+	default:
+		return value{}, unsupported(node)
+	}
+}
+
+func (g *generator) interpolation(node *ast.Interpolation) (value, error) {
+	parts := []string{}
+	pure := true
+	for _, part := range node.Parts {
+		v, err := g.expr(part)
+		if err != nil {
+			return value{}, err
+		}
+		if v.typ == nothing {
+			return value{}, errorf(part, "%s has no value", part)
+		}
+		parts = append(parts, g.str(v).code)
+		pure = pure && v.pure
+	}
+	if len(parts) == 0 {
+		return value{code: `""`, typ: "string", pure: true}, nil
+	}
+	v := value{code: strings.Join(parts, " + "), typ: "string", pure: pure}
+	if len(parts) > 1 {
+		v.prec = precedences["+"]
+	}
+	return v, nil
+}
+
+func (g *generator) unaryOp(node *ast.UnaryOp) (value, error) {
+	v, err := g.expr(node.Expr)
+	if err != nil {
+		return value{}, err
+	}
+
+	// the checker verified the type of the operand
+	switch {
+	case node.Op.Type == tokens.NOT:
+		return value{code: "!" + v.unaryOperand(), typ: "bool", pure: v.pure}, nil
+	case node.Op.Type == tokens.PLUS:
+		return v, nil
+	case v.literal && v.typ == "int":
+		// a literal is negated as it is translated
+		return g.intLiteral(new(big.Int).Neg(v.integer)), nil
+	case v.literal:
+		f, _ := strconv.ParseFloat(v.code, 64)
+		return g.floatLiteral(-f), nil
+	case v.typ == "float":
+		return value{code: "-" + v.unaryOperand(), typ: "float", pure: v.pure}, nil
+	default:
+		return value{code: g.rt("Neg") + "(" + v.code + ")", typ: "int", call: true}, nil
+	}
+}
+
+// intOperators maps the arithmetic operators to the functions of the runtime package, that promote
+// the integers overflowing an int64
+var intOperators = map[tokens.TokenType]string{
+	tokens.PLUS:  "Add",
+	tokens.MINUS: "Sub",
+	tokens.MULT:  "Mul",
+	tokens.DIV:   "Div",
+	tokens.POW:   "Pow",
+}
+
+func (g *generator) binOp(node *ast.BinOp) (value, error) {
+	left, err := g.expr(node.Left)
+	if err != nil {
+		return value{}, err
+	}
+	right, err := g.expr(node.Right)
+	if err != nil {
+		return value{}, err
+	}
+	if left.typ == nothing {
+		return value{}, errorf(node.Left, "%s has no value", node.Left)
+	}
+	if right.typ == nothing {
+		return value{}, errorf(node.Right, "%s has no value", node.Right)
+	}
+	// the checker verified the types of the operands, and gives the type of the result
+	typ, err := g.typeOf(node)
+	if err != nil {
+		return value{}, err
+	}
+
+	infix := func(op string, typ string) value {
+		prec := precedences[op]
+		code := left.operand(prec, false) + " " + op + " " + right.operand(prec, true)
+		return value{code: code, typ: typ, prec: prec, pure: left.pure && right.pure}
+	}
+	call := func(fn string, typ string) value {
+		return value{code: fn + "(" + left.code + ", " + right.code + ")", typ: typ, call: true}
+	}
+
+	switch op := node.Op.Type; op {
+	case tokens.EQ, tokens.NEQ:
+		var v value
+		switch {
+		case left.typ == "int" && right.typ == "int":
+			// the big integers are compared by value
+			v = call(g.rt("Equal"), "bool")
+		case left.typ == right.typ:
+			return infix(node.Op.Value, "bool"), nil
+		case left.typ == "int":
+			v = call(g.rt("EqualIntFloat"), "bool")
+		default:
+			v = call(g.rt("EqualFloatInt"), "bool")
+		}
+		v.pure = left.pure && right.pure
+		if op == tokens.NEQ {
+			v = value{code: "!" + v.code, typ: "bool", pure: v.pure}
+		}
+		return v, nil
+	case tokens.AND, tokens.OR:
+		// cairn evaluates both operands: && and || only short-circuit operands without effects
+		if !right.pure {
+			return call(g.rt(map[tokens.TokenType]string{tokens.AND: "And", tokens.OR: "Or"}[op]), "bool"), nil
+		}
+		return infix(node.Op.Value, "bool"), nil
+	case tokens.CONCAT:
+		return infix("+", "string"), nil
+	default:
+		if typ == "int" {
+			return call(g.rt(intOperators[op]), "int"), nil
+		}
+
+		// integers are promoted to floats
+		left, right = g.float(left), g.float(right)
+		switch op {
+		case tokens.DIV:
+			return call(g.rt("DivFloat"), "float"), nil
+		case tokens.POW:
+			return call(g.rt("PowFloat"), "float"), nil
+		default:
+			if left.literal && right.literal {
+				return g.fold(op, left, right), nil
+			}
+			return infix(node.Op.Value, "float"), nil
+		}
+	}
+}
+
+func (g *generator) funcCall(node *ast.FuncCall) (value, error) {
+	if node.Module != "" {
+		return value{}, errorf(node, "imports are not supported by the Go backend")
+	}
+
+	args := []value{}
+	for _, arg := range node.Args {
+		v, err := g.expr(arg)
+		if err != nil {
+			return value{}, err
+		}
+		if v.typ == nothing {
+			return value{}, errorf(arg, "%s has no value", arg)
+		}
+		args = append(args, v)
+	}
+
+	f, ok := g.functions[node.Name]
+	if !ok {
+		return g.builtinCall(node, args)
+	}
+
+	// the checker verified the arguments
+	codes := []string{}
+	for _, arg := range args {
+		codes = append(codes, arg.code)
+	}
+	code := goName(node.Name) + "(" + strings.Join(codes, ", ") + ")"
+	return value{code: code, typ: f.Signature.ReturnType.Name, call: true}, nil
+}
@@ -0,0 +1,120 @@
+package gogen
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/fchoquet/cairn/ast"
+)
+
+// function is a Go function being generated
+type function struct {
+	// name is the cairn name of the function
+	name string
+	decl *ast.FuncDecl
+	// global is set for the top level statements, whose variables are global
+	global bool
+	// result is the type of the returned value
+	result string
+	params map[string]bool
+	// locals holds the Go types the parameters and the local variables are declared with
+	locals map[string]string
+	order  []string
+	reads  map[string]int
+	// previous is the state of the function after the first pass. It is nil during the first pass
+	previous *function
+	buf      *bytes.Buffer
+}
+
+// reset prepares a function for a new pass
+func (fn *function) reset(previous *function) {
+	fn.previous = previous
+	fn.result = ""
+	fn.params = map[string]bool{}
+	fn.locals = map[string]string{}
+	fn.order = nil
+	fn.reads = map[string]int{}
+	fn.buf = &bytes.Buffer{}
+}
+
+func (fn *function) copy() *function {
+	c := *fn
+	return &c
+}
+
+// unused tells whether a local variable is never read. It is only known during the second pass
+func (fn *function) unused(name string) bool {
+	return fn.previous != nil && !fn.global && !fn.params[name] && fn.previous.reads[name] == 0
+}
+
+// writeLocals declares the local variables at the start of the function. As cairn blocks
+// do not open scopes, a variable assigned in a match arm may be read after the match
+func (g *generator) writeLocals(buf *bytes.Buffer, fn *function) {
+	for _, name := range fn.order {
+		if !fn.unused(name) {
+			fmt.Fprintf(buf, "var %s %s\n", goName(name), g.goType(fn.locals[name]))
+		}
+	}
+}
+
+// write adds a line of code to the function
+func (g *generator) write(format string, args ...interface{}) {
+	fmt.Fprintf(g.fn.buf, format+"\n", args...)
+}
+
+// read translates a variable read
+func (g *generator) read(node *ast.Variable) (value, error) {
+	if node.Module != "" {
+		return value{}, errorf(node, "imports are not supported by the Go backend")
+	}
+
+	fn := g.fn
+	_, local := fn.locals[node.Name]
+	_, global := g.globals[node.Name]
+	switch {
+	case local:
+		fn.reads[node.Name]++
+	case fn.previous != nil && fn.previous.locals[node.Name] != "":
+		// the local variable declared at the start of the function would hide the global
+		return value{}, errorf(node, "%s is read before it is assigned in %s", node.Name, fn.name)
+	case !global:
+		return value{}, errorf(node, "unknown identifier %s", node.Name)
+	}
+
+	typ, err := g.typeOf(node)
+	if err != nil {
+		return value{}, err
+	}
+	return value{code: goName(node.Name), typ: typ, pure: true}, nil
+}
+
+// typeOf returns the type the checker inferred for an expression
+func (g *generator) typeOf(node ast.Node) (string, error) {
+	typ := g.types.TypeOf(node)
+	if typ == "" {
+		return "", errorf(node, "the type of %s is not known before the program runs", node)
+	}
+	return typ, nil
+}
+
+// varType returns the type of a variable of the current scope, or "" when it is not assigned yet
+func (g *generator) varType(name string) string {
+	if g.fn.global {
+		return g.globals[name]
+	}
+	return g.fn.locals[name]
+}
+
+// declare adds a variable to the current scope
+func (g *generator) declare(name, typ string) {
+	if g.varType(name) != "" {
+		return
+	}
+	if g.fn.global {
+		g.globals[name] = typ
+		g.globalOrder = append(g.globalOrder, name)
+		return
+	}
+	g.fn.locals[name] = typ
+	g.fn.order = append(g.fn.order, name)
+}
@@ -0,0 +1,289 @@
+// Package gogen translates cairn programs to Go source code.
+//
+// The generated code is plain Go: cairn functions become Go functions, and the top level
+// statements become the function Main. Integers are values of the runtime package rt, and the
+// operations that differ from Go's, such as the integer arithmetic or the exact powers, call it.
+// The types of the expressions are inferred by the checker, whose global variables are static:
+// only the programs whose types are known without running them are translated. Sum types,
+// lists, tuples, generic functions, try expressions and imports are not supported yet.
+//
+// Like in the interpreter, an integer is stored in an int64 and promoted to an arbitrary-precision
+// integer when an operation overflows.
+package gogen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/checker"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// RuntimePackage is the import path of the runtime of the generated programs
+const RuntimePackage = "github.com/fchoquet/cairn/gogen/rt"
+
+// goTypes maps the cairn types supported by the generator to Go types
+var goTypes = map[string]string{
+	"int":    "rt.Int",
+	"float":  "float64",
+	"string": "string",
+	"bool":   "bool",
+}
+
+// nothing is the type of the expressions without a value, such as a call to println
+const nothing = "nothing"
+
+// reserved holds the names a cairn identifier can not keep in Go: the keywords and the
+// predeclared identifiers of Go, and the names used by the generated code
+var reserved = map[string]bool{}
+
+func init() {
+	for _, name := range []string{
+		"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough",
+		"for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range",
+		"return", "select", "struct", "switch", "type", "var",
+		"bool", "byte", "complex64", "complex128", "error", "float32", "float64", "int", "int8",
+		"int16", "int32", "int64", "rune", "string", "uint", "uint8", "uint16", "uint32", "uint64",
+		"uintptr", "true", "false", "iota", "nil", "append", "cap", "close", "complex", "copy",
+		"delete", "imag", "len", "make", "new", "panic", "print", "println", "real", "recover",
+		"rt", "math", "strings", "main", "Main",
+	} {
+		reserved[name] = true
+	}
+}
+
+// goName returns the Go name of a cairn identifier
+func goName(name string) string {
+	if reserved[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// generator holds the declarations of the program being translated
+type generator struct {
+	// types gives the types of the expressions
+	types     *checker.Checker
+	functions map[string]*ast.FuncDecl
+	// globals holds the types of the variables assigned by the top level statements
+	globals     map[string]string
+	globalOrder []string
+	imports     map[string]bool
+	// fn is the function being generated
+	fn *function
+}
+
+// Generate translates a cairn program to a Go source file of the package pkg. The program must
+// have been checked by types, a checker knowing the builtins and whose global variables are static.
+// A main package gets a main function running the program like the cairn command does
+func Generate(file *ast.SourceFile, types *checker.Checker, pkg string) ([]byte, error) {
+	g := &generator{types: types, functions: map[string]*ast.FuncDecl{}, imports: map[string]bool{}}
+	if len(file.Imports) > 0 {
+		return nil, unsupported(file.Imports[0])
+	}
+	if len(file.Types) > 0 {
+		return nil, unsupported(file.Types[0])
+	}
+	for _, f := range file.Functions {
+		if err := checkSignature(f); err != nil {
+			return nil, err
+		}
+		g.functions[f.Name.Value] = f
+	}
+
+	// the top level statements are generated first, as they give the types of the globals
+	program := &function{name: "the program", global: true}
+	if err := g.generate(program, file.Statements); err != nil {
+		return nil, err
+	}
+	functions := []*function{}
+	for _, f := range file.Functions {
+		fn := &function{name: f.Name.Value, decl: f}
+		if err := g.generate(fn, f.Body.Statements); err != nil {
+			return nil, err
+		}
+		functions = append(functions, fn)
+	}
+
+	if pkg == "main" {
+		g.imports[RuntimePackage] = true
+	}
+	// the declarations are written first, as they tell which packages are imported
+	body := &bytes.Buffer{}
+	if len(g.globalOrder) == 1 {
+		name := g.globalOrder[0]
+		fmt.Fprintf(body, "var %s %s\n\n", goName(name), g.goType(g.globals[name]))
+	}
+	if len(g.globalOrder) > 1 {
+		body.WriteString("var (\n")
+		for _, name := range g.globalOrder {
+			fmt.Fprintf(body, "%s %s\n", goName(name), g.goType(g.globals[name]))
+		}
+		body.WriteString(")\n\n")
+	}
+	for _, fn := range functions {
+		g.writeFunction(body, fn)
+	}
+	g.writeMain(body, program, pkg)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "// Code generated by cairn from %s. DO NOT EDIT.\n\npackage %s\n\n", file.Pos().File, pkg)
+	g.writeImports(buf)
+	buf.Write(body.Bytes())
+	return format.Source(buf.Bytes())
+}
+
+// goType returns the Go type of a cairn type
+func (g *generator) goType(typ string) string {
+	if typ == "int" {
+		g.imports[RuntimePackage] = true
+	}
+	return goTypes[typ]
+}
+
+// checkSignature tells whether the signature of a function can be translated
+func checkSignature(f *ast.FuncDecl) error {
+	if len(f.Signature.TypeParams) > 0 {
+		return errorf(f, "generic functions are not supported by the Go backend")
+	}
+	for _, p := range f.Signature.Parameters.Parameters {
+		if err := checkType(p.Type); err != nil {
+			return err
+		}
+	}
+	return checkType(f.Signature.ReturnType)
+}
+
+func checkType(t *ast.TypeId) error {
+	if _, ok := goTypes[t.Name]; !ok || len(t.Args) > 0 {
+		return errorf(t, "the type %s is not supported by the Go backend", t.TypeName())
+	}
+	return nil
+}
+
+// generate generates the body of a function. It runs twice: the first pass gives the types
+// of the local variables and tells which ones are read, as Go rejects the unused variables
+func (g *generator) generate(fn *function, statements *ast.StatementList) error {
+	var previous *function
+	for pass := 0; pass < 2; pass++ {
+		fn.reset(previous)
+		if fn.global {
+			g.globals = map[string]string{}
+			g.globalOrder = nil
+		}
+		if fn.decl != nil {
+			for _, p := range fn.decl.Signature.Parameters.Parameters {
+				fn.params[p.Name] = true
+				fn.locals[p.Name] = p.Type.Name
+			}
+			fn.result = fn.decl.Signature.ReturnType.Name
+		}
+
+		g.fn = fn
+		err := g.statementList(statements, destination{kind: returned, typ: &fn.result, subject: fn.name, program: fn.global})
+		g.fn = nil
+		if err != nil {
+			return err
+		}
+		previous = fn.copy()
+	}
+	return nil
+}
+
+func (g *generator) writeImports(buf *bytes.Buffer) {
+	if len(g.imports) == 0 {
+		return
+	}
+	paths := []string{}
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	if len(paths) == 1 {
+		fmt.Fprintf(buf, "import %q\n\n", paths[0])
+		return
+	}
+
+	// the standard packages come first, separated from the runtime package
+	buf.WriteString("import (\n")
+	for _, path := range paths {
+		if path == RuntimePackage {
+			continue
+		}
+		fmt.Fprintf(buf, "%q\n", path)
+	}
+	if g.imports[RuntimePackage] {
+		fmt.Fprintf(buf, "\n%q\n", RuntimePackage)
+	}
+	buf.WriteString(")\n\n")
+}
+
+func (g *generator) writeFunction(buf *bytes.Buffer, fn *function) {
+	params := []string{}
+	for _, p := range fn.decl.Signature.Parameters.Parameters {
+		params = append(params, goName(p.Name)+" "+g.goType(p.Type.Name))
+	}
+	fmt.Fprintf(buf, "func %s(", goName(fn.name))
+	for index, p := range params {
+		if index > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(p)
+	}
+	fmt.Fprintf(buf, ") %s {\n", g.goType(fn.result))
+	g.writeLocals(buf, fn)
+	buf.Write(fn.buf.Bytes())
+	buf.WriteString("}\n\n")
+}
+
+// writeMain writes the function Main running the top level statements and, in a main package,
+// the main function printing the value of the program
+func (g *generator) writeMain(buf *bytes.Buffer, program *function, pkg string) {
+	result := program.result
+	buf.WriteString("// Main runs the top level statements of the program\n")
+	fmt.Fprintf(buf, "func Main() %s {\n", g.goType(result))
+	buf.Write(program.buf.Bytes())
+	buf.WriteString("}\n")
+
+	if pkg != "main" {
+		return
+	}
+	buf.WriteString("\nfunc main() {\n")
+	switch result {
+	case nothing, "":
+		buf.WriteString("rt.Run(func() string {\nMain()\nreturn \"\"\n})\n")
+	default:
+		fmt.Fprintf(buf, "rt.Run(func() string {\nreturn %s\n})\n", g.str(value{code: "Main()", typ: result, call: true}).code)
+	}
+	buf.WriteString("}\n")
+}
+
+// errorf creates an error located at a node
+func errorf(node ast.Node, format string, args ...interface{}) error {
+	return &tokens.Error{Pos: node.Pos(), Message: fmt.Sprintf(format, args...)}
+}
+
+// unsupported creates the error returned for the constructs the Go backend does not translate
+func unsupported(node ast.Node) error {
+	var what string
+	switch node.(type) {
+	case *ast.ImportDecl:
+		what = "imports are"
+	case *ast.TypeDecl:
+		what = "type declarations are"
+	case *ast.ListLit, *ast.Index:
+		what = "lists are"
+	case *ast.TupleLit, *ast.Destructuring:
+		what = "tuples are"
+	case *ast.Try:
+		what = "try expressions are"
+	case *ast.ConstructorPattern:
+		what = "constructor patterns are"
+	default:
+		what = fmt.Sprintf("%s is", node)
+	}
+	return errorf(node, "%s not supported by the Go backend", what)
+}
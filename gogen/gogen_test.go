@@ -0,0 +1,223 @@
+package gogen
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/checker"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/modules"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+func parse(t *testing.T, file, source string) *ast.SourceFile {
+	p := parser.Parser{}
+	node, err := p.Parse(file, source)
+	if err != nil {
+		t.Fatalf("can not parse %s: %s", file, err)
+	}
+	return node.(*ast.SourceFile)
+}
+
+// generate checks a program like the build command does, then translates it
+func generate(node *ast.SourceFile, pkg string) ([]byte, error) {
+	c := checker.New()
+	c.Builtins = interpreter.Signatures()
+	c.StaticGlobals = true
+	if err := c.Check(&modules.Module{Path: node.Pos().File, File: node}); err != nil {
+		return nil, err
+	}
+	return Generate(node, c, pkg)
+}
+
+// interpret runs a program with the interpreter, and returns what the cairn command would output.
+// Runtime errors are only reported with their kinds and messages, as the positions are lost in Go
+func interpret(t *testing.T, node *ast.SourceFile) string {
+	stdout := &bytes.Buffer{}
+	i := interpreter.New(&parser.Parser{}, interpreter.Stdout(stdout))
+	output, err := i.Exec(node)
+	if output != "" {
+		stdout.WriteString(output + "\n")
+	}
+	if err != nil {
+		rerr, ok := err.(*interpreter.RuntimeError)
+		if !ok {
+			t.Fatalf("can not run %s: %s", node.Pos().File, err)
+		}
+		stdout.WriteString("!!! " + string(rerr.Kind) + ": " + rerr.Message + "\n")
+	}
+	return stdout.String()
+}
+
+// run compiles and runs a generated program, and returns its output
+func run(t *testing.T, goBin string, code []byte) string {
+	dir, err := ioutil.TempDir("", "gogen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(file, code, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(goBin, "run", file)
+	// the runtime package is found in the GOPATH, like the other packages of cairn
+	cmd.Env = append(os.Environ(), "GO111MODULE=off")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		t.Fatal(err)
+	}
+	if strings.Contains(stderr.String(), "# command-line-arguments") {
+		t.Fatalf("can not compile the generated code:\n%s", stderr)
+	}
+	return string(output)
+}
+
+// TestGolden translates the programs of testdata, and compares the generated code with the golden files.
+// The generated programs must give the same output as the interpreter
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goBin, goErr := exec.LookPath("go")
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			assert := assert.New(t)
+
+			source, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			node := parse(t, file, string(source))
+			code, err := generate(node, "main")
+			if !assert.Nil(err) {
+				return
+			}
+
+			golden := strings.TrimSuffix(file, ".ca") + ".golden"
+			if *update {
+				if err := ioutil.WriteFile(golden, code, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(string(expected), string(code))
+
+			if testing.Short() || goErr != nil {
+				t.Skip("the generated code is only run with the go command")
+			}
+			assert.Equal(interpret(t, node), run(t, goBin, code))
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("globals", func(t *testing.T) {
+		code, err := generate(parse(t, "test.ca", "func half() :float\n    x / 2\nx := 3.0\nhalf()"), "lib")
+		assert.Nil(err)
+		assert.Contains(string(code), "var x float64\n")
+		assert.Contains(string(code), "\treturn rt.DivFloat(x, 2.0)\n")
+	})
+
+	t.Run("library packages", func(t *testing.T) {
+		code, err := generate(parse(t, "lib.ca", "func twice(n:int) :int\n    n * 2\ntwice(21)"), "lib")
+		assert.Nil(err)
+		assert.Contains(string(code), "package lib\n")
+		assert.Contains(string(code), "func Main() rt.Int {\n\treturn twice(rt.NewInt(21))\n}\n")
+		assert.NotContains(string(code), "func main()")
+	})
+
+	t.Run("expressions", func(t *testing.T) {
+		fixtures := []struct {
+			input    string
+			expected string
+		}{
+			{"1 + 2 * 3", "rt.Add(rt.NewInt(1), rt.Mul(rt.NewInt(2), rt.NewInt(3)))"},
+			{"1.5 - (2.5 - x)", "1.5 - (2.5 - x)"},
+			{"(x - 1.5) - 2.5", "x - 1.5 - 2.5"},
+			{"0.1 + 0.2", "0.30000000000000004"},
+			{"-0.0", "math.Copysign(0, -1)"},
+			{"-(-3)", "rt.NewInt(3)"},
+			{"-9223372036854775808", "rt.NewInt(-9223372036854775808)"},
+			{"99999999999999999999", `rt.IntLiteral("99999999999999999999")`},
+			{"float(99999999999999999999)", "1e+20"},
+			{"1 == 2", "rt.Equal(rt.NewInt(1), rt.NewInt(2))"},
+			{"x * 2", "x * 2.0"},
+			{"1 == 1.0", "rt.EqualIntFloat(rt.NewInt(1), 1.0)"},
+			{"!(true && false)", "!(true && false)"},
+			{"true && !false", "true && !false"},
+			{"false && f()", "rt.And(false, f())"},
+			{"\"a\" ++ \"b\" ++ \"c\"", `"a" + "b" + "c"`},
+			{"\"${1.5}!\"", `rt.FormatFloat(1.5) + "!"`},
+		}
+
+		for _, fixture := range fixtures {
+			t.Run(fixture.input, func(t *testing.T) {
+				source := "func f() :bool\n    true\nx := 0.5\n" + fixture.input
+				code, err := generate(parse(t, "test.ca", source), "lib")
+				if assert.Nil(err) {
+					assert.Contains(string(code), "\treturn "+fixture.expected+"\n")
+				}
+			})
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		fixtures := []struct {
+			input    string
+			expected string
+		}{
+			{"[1, 2]", "test.ca:1:1: lists are not supported by the Go backend"},
+			{"(1, true)", "test.ca:1:1: tuples are not supported by the Go backend"},
+			{"type Box = Box(v:int)\n1", "test.ca:1:1: type declarations are not supported by the Go backend"},
+			{"func id[T](x:T) :T\n    x\n1", "test.ca:1:1: generic functions are not supported by the Go backend"},
+			{"func f(l:[int]) :int\n    1\n1", "test.ca:1:9: the type [int] is not supported by the Go backend"},
+			{"x := try\n    1\ncatch e\n    2", "test.ca:1:6: try expressions are not supported by the Go backend"},
+			{"now()", "test.ca:1:1: the builtin now is not supported by the Go backend"},
+			{"x := 1\nx := \"one\"", "test.ca:2:6: x is a int - it can not be assigned a string"},
+			{"func f(n:int) :string\n    n\n1", "test.ca:2:5: f must return a string - got int"},
+			{"func f(n:int) :int\n    n\nf(1.5)", "test.ca:3:3: argument n of f must be a int - got float"},
+			{"len(1)", "test.ca:1:5: argument s of len must be a string - got int"},
+			{"1 ++ \"a\"", "test.ca:1:3: operator ++ is not defined on int and string"},
+			{"1 == \"a\"", "test.ca:1:3: can not compare int and string"},
+			{"y", "test.ca:1:1: unknown identifier y"},
+			{"x := println(1)", "test.ca:1:6: FuncCall(println Num(1:INTEGER)) has no value"},
+			{"println(println(1))", "test.ca:1:9: FuncCall(println Num(1:INTEGER)) has no value"},
+			{"x := 1\nmatch x\n    1 ->\n        y := 2\n        y\n    _ -> 0\ny", "test.ca:7:1: the type of Variable(y) is not known before the program runs"},
+			{"match 1\n    1 -> 2", "test.ca:1:1: match is not exhaustive: _ is not covered"},
+			{
+				"func f(n:int) :int\n    y := x\n    x := n\n    x + y\nx := 1\nf(1)",
+				"test.ca:2:10: x is read before it is assigned in f",
+			},
+		}
+
+		for _, fixture := range fixtures {
+			t.Run(fixture.input, func(t *testing.T) {
+				_, err := generate(parse(t, "test.ca", fixture.input), "main")
+				if assert.NotNil(err) {
+					assert.Equal(fixture.expected, err.Error())
+				}
+			})
+		}
+	})
+}
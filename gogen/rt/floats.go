@@ -0,0 +1,56 @@
+package rt
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DivFloat computes a / b. Unlike Go, cairn reports divisions of floats by zero
+func DivFloat(a, b float64) float64 {
+	if b == 0 {
+		raise(DivisionByZero, "%s / %s", FormatFloat(a), FormatFloat(b))
+	}
+	return a / b
+}
+
+// PowFloat computes base ^ exp. Unlike Go, cairn reports the powers too large for a float,
+// and the powers of zero by negative exponents as divisions by zero
+func PowFloat(base, exp float64) float64 {
+	result := math.Pow(base, exp)
+	if math.IsInf(result, 0) && !math.IsInf(base, 0) && !math.IsInf(exp, 0) {
+		if base == 0 {
+			raise(DivisionByZero, "%s ^ %s", FormatFloat(base), FormatFloat(exp))
+		}
+		raise(Overflow, "%s ^ %s does not fit in a float", FormatFloat(base), FormatFloat(exp))
+	}
+	return result
+}
+
+// EqualIntFloat compares an integer and a float by value. A large integer is not rounded
+func EqualIntFloat(a Int, b float64) bool {
+	if math.IsNaN(b) || math.IsInf(b, 0) {
+		return false
+	}
+	return new(big.Float).SetInt(a.toBig()).Cmp(big.NewFloat(b)) == 0
+}
+
+// FormatFloat formats a float like cairn does: 2.0, 0.5 or 1e+21
+func FormatFloat(f float64) string {
+	abs := math.Abs(f)
+	if abs != 0 && (abs < 1e-4 || abs >= 1e21) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.ContainsAny(s, ".IN") {
+		s += ".0"
+	}
+	return s
+}
+
+// EqualFloatInt compares a float and an integer by value
+func EqualFloatInt(a float64, b Int) bool {
+	return EqualIntFloat(b, a)
+}
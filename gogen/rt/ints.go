@@ -0,0 +1,229 @@
+package rt
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Int is a cairn integer. Like in the interpreter, an integer is stored in an int64, promoted
+// to a big integer when an operation overflows, and demoted back as soon as it fits again.
+// As the big integers never fit in an int64, == tells whether two small integers are equal
+type Int struct {
+	small int64
+	// big is nil for the integers fitting in an int64
+	big *big.Int
+}
+
+// NewInt returns the integer n
+func NewInt(n int64) Int {
+	return Int{small: n}
+}
+
+// IntLiteral returns the integer of a literal too large for an int64
+func IntLiteral(s string) Int {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid integer literal " + s)
+	}
+	return normalize(n)
+}
+
+func (n Int) String() string {
+	return FormatInt(n)
+}
+
+// toBig converts an integer to a big.Int, that must not be modified
+func (n Int) toBig() *big.Int {
+	if n.big != nil {
+		return n.big
+	}
+	return big.NewInt(n.small)
+}
+
+// normalize returns a small integer when a big integer fits in an int64
+func normalize(n *big.Int) Int {
+	if n.IsInt64() {
+		return Int{small: n.Int64()}
+	}
+	return Int{big: n}
+}
+
+// Add computes a + b
+func Add(a, b Int) Int {
+	if a.big == nil && b.big == nil {
+		x, y := a.small, b.small
+		r := x + y
+		if (x >= 0) != (y >= 0) || (r >= 0) == (x >= 0) {
+			return Int{small: r}
+		}
+	}
+	return normalize(new(big.Int).Add(a.toBig(), b.toBig()))
+}
+
+// Sub computes a - b
+func Sub(a, b Int) Int {
+	if a.big == nil && b.big == nil {
+		x, y := a.small, b.small
+		r := x - y
+		if (x >= 0) == (y >= 0) || (r >= 0) == (x >= 0) {
+			return Int{small: r}
+		}
+	}
+	return normalize(new(big.Int).Sub(a.toBig(), b.toBig()))
+}
+
+// Mul computes a * b
+func Mul(a, b Int) Int {
+	if a.big == nil && b.big == nil {
+		x, y := a.small, b.small
+		if x == 0 || y == 0 {
+			return Int{}
+		}
+		r := x * y
+		if r/y == x && !(x == -1 && y == math.MinInt64) && !(y == -1 && x == math.MinInt64) {
+			return Int{small: r}
+		}
+	}
+	return normalize(new(big.Int).Mul(a.toBig(), b.toBig()))
+}
+
+// Div computes a / b, truncated toward zero
+func Div(a, b Int) Int {
+	if b.big == nil && b.small == 0 {
+		raise(DivisionByZero, "%s / %s", a, b)
+	}
+	if a.big == nil && b.big == nil && !(a.small == math.MinInt64 && b.small == -1) {
+		return Int{small: a.small / b.small}
+	}
+	// Quo truncates toward zero like Go's native division
+	return normalize(new(big.Int).Quo(a.toBig(), b.toBig()))
+}
+
+// maxPowerBits bounds the size of the powers, like in the interpreter
+const maxPowerBits = 1 << 22
+
+// Pow computes base ^ exp exactly.
+// A negative exponent gives 1 / base ^ -exp, truncated toward zero like the division
+func Pow(base, exp Int) Int {
+	b, e := base.toBig(), exp.toBig()
+	one := big.NewInt(1)
+
+	if e.Sign() < 0 {
+		switch {
+		case b.Sign() == 0:
+			raise(DivisionByZero, "%s ^ %s", base, exp)
+		case b.CmpAbs(one) != 0:
+			return Int{}
+		case b.Sign() < 0 && e.Bit(0) == 1:
+			return Int{small: -1}
+		default:
+			return Int{small: 1}
+		}
+	}
+
+	if b.CmpAbs(one) <= 0 {
+		// 0, 1 and -1 to any power do not grow
+		switch {
+		case e.Sign() == 0, b.Sign() < 0 && e.Bit(0) == 0:
+			return Int{small: 1}
+		default:
+			return base
+		}
+	}
+
+	if !e.IsInt64() || e.Int64() > maxPowerBits || int64(b.BitLen())*e.Int64() > maxPowerBits {
+		raise(Overflow, "%s ^ %s: exponent too large", base, exp)
+	}
+	return normalize(new(big.Int).Exp(b, e, nil))
+}
+
+// Neg computes -a
+func Neg(a Int) Int {
+	if a.big == nil && a.small != math.MinInt64 {
+		return Int{small: -a.small}
+	}
+	return normalize(new(big.Int).Neg(a.toBig()))
+}
+
+// Equal compares two integers
+func Equal(a, b Int) bool {
+	if a.big == nil || b.big == nil {
+		return a == b
+	}
+	return a.big.Cmp(b.big) == 0
+}
+
+// compare returns -1, 0 or 1 as a is less than, equal to or greater than b
+func compare(a, b Int) int {
+	if a.big == nil && b.big == nil {
+		switch {
+		case a.small < b.small:
+			return -1
+		case a.small > b.small:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return a.toBig().Cmp(b.toBig())
+}
+
+// Abs implements the abs builtin for integers
+func Abs(a Int) Int {
+	if compare(a, Int{}) < 0 {
+		return Neg(a)
+	}
+	return a
+}
+
+// Min implements the min builtin for integers
+func Min(a, b Int) Int {
+	if compare(a, b) < 0 {
+		return a
+	}
+	return b
+}
+
+// Max implements the max builtin for integers
+func Max(a, b Int) Int {
+	if compare(a, b) > 0 {
+		return a
+	}
+	return b
+}
+
+// ParseInt implements the parseInt builtin
+func ParseInt(s string) Int {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		raise(ValueError, "%q is not an integer", s)
+	}
+	return normalize(n)
+}
+
+// Truncate implements the int builtin for floats: the float is truncated toward zero
+func Truncate(f float64) Int {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		raise(ValueError, "%s can not be converted to an int", FormatFloat(f))
+	}
+	n, _ := big.NewFloat(f).Int(nil)
+	return normalize(n)
+}
+
+// Float implements the float builtin for integers, and the promotion of integers to floats
+func Float(n Int) float64 {
+	if n.big == nil {
+		return float64(n.small)
+	}
+	f, _ := new(big.Float).SetInt(n.big).Float64()
+	return f
+}
+
+// FormatInt formats an integer like cairn does
+func FormatInt(n Int) string {
+	if n.big == nil {
+		return strconv.FormatInt(n.small, 10)
+	}
+	return n.big.String()
+}
@@ -0,0 +1,85 @@
+// Package rt is the runtime of the Go programs generated from cairn programs.
+// It gives them the semantics of cairn where they differ from Go's
+package rt
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Kinds of the runtime errors, named like the errors of the interpreter
+const (
+	DivisionByZero = "division by zero"
+	Overflow       = "overflow"
+	ValueError     = "invalid value"
+	IndexError     = "index out of range"
+	MatchError     = "no match"
+	Failure        = "failure"
+)
+
+// Error is a cairn runtime error. It is raised with panic
+type Error struct {
+	Kind    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Kind + ": " + e.Message
+}
+
+func raise(kind, format string, args ...interface{}) {
+	panic(&Error{Kind: kind, Message: fmt.Sprintf(format, args...)})
+}
+
+// Stdout receives the output of print and println
+var Stdout io.Writer = os.Stdout
+
+// Print implements the print builtin
+func Print(s string) {
+	fmt.Fprint(Stdout, s)
+}
+
+// Println implements the println builtin
+func Println(s string) {
+	fmt.Fprintln(Stdout, s)
+}
+
+// Fail implements the fail builtin
+func Fail(message string) {
+	panic(&Error{Kind: Failure, Message: message})
+}
+
+// NoMatch returns the error raised when no pattern of a match expression matches its subject
+func NoMatch(subject string) *Error {
+	return &Error{Kind: MatchError, Message: "no pattern matches " + subject}
+}
+
+// And computes a && b once both operands are evaluated, as cairn does not short-circuit
+func And(a, b bool) bool {
+	return a && b
+}
+
+// Or computes a || b once both operands are evaluated
+func Or(a, b bool) bool {
+	return a || b
+}
+
+// Run runs the main function of a program like the cairn command does: the value of the program
+// is printed, and a runtime error is reported and ends the program with the status 1
+func Run(main func() string) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			fmt.Fprintln(Stdout, "!!! "+err.Error())
+			os.Exit(1)
+		}
+	}()
+
+	if output := main(); output != "" {
+		fmt.Fprintln(Stdout, output)
+	}
+}
@@ -0,0 +1,106 @@
+package rt
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failure returns the error raised by a function, if any
+func failure(fn func()) (err *Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(*Error)
+		}
+	}()
+	fn()
+	return nil
+}
+
+func TestIntegers(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("powers", func(t *testing.T) {
+		fixtures := []struct {
+			base, exp int64
+			expected  string
+		}{
+			{2, 10, "1024"},
+			{-2, 3, "-8"},
+			{0, 0, "1"},
+			{-1, 63, "-1"},
+			{-1, -2, "1"},
+			{2, -1, "0"},
+			{3, 39, "4052555153018976267"},
+			{2, 64, "18446744073709551616"},
+		}
+		for _, fixture := range fixtures {
+			assert.Equal(fixture.expected, FormatInt(Pow(NewInt(fixture.base), NewInt(fixture.exp))))
+		}
+	})
+
+	t.Run("promotions", func(t *testing.T) {
+		max, min := NewInt(math.MaxInt64), NewInt(math.MinInt64)
+		fixtures := []struct {
+			n        Int
+			expected string
+		}{
+			{Add(max, NewInt(1)), "9223372036854775808"},
+			{Sub(min, NewInt(1)), "-9223372036854775809"},
+			{Mul(min, NewInt(-1)), "9223372036854775808"},
+			{Div(min, NewInt(-1)), "9223372036854775808"},
+			{Neg(min), "9223372036854775808"},
+			{Abs(min), "9223372036854775808"},
+			{Max(IntLiteral("99999999999999999999"), max), "99999999999999999999"},
+			{ParseInt("-99999999999999999999"), "-99999999999999999999"},
+			{Truncate(1e20), "100000000000000000000"},
+		}
+		for _, fixture := range fixtures {
+			assert.Equal(fixture.expected, FormatInt(fixture.n))
+		}
+
+		// the integers are demoted as soon as they fit in an int64
+		assert.Equal(max, Sub(Add(max, NewInt(1)), NewInt(1)))
+		assert.True(Equal(Add(max, NewInt(1)), IntLiteral("9223372036854775808")))
+		assert.False(Equal(Add(max, NewInt(1)), max))
+		assert.Equal(1e20, Float(IntLiteral("100000000000000000000")))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		fixtures := []struct {
+			fn       func()
+			expected string
+		}{
+			{func() { Div(NewInt(1), NewInt(0)) }, "division by zero: 1 / 0"},
+			{func() { Pow(NewInt(0), NewInt(-1)) }, "division by zero: 0 ^ -1"},
+			{func() { Pow(NewInt(3), NewInt(1000000000)) }, "overflow: 3 ^ 1000000000: exponent too large"},
+			{func() { ParseInt("1.5") }, `invalid value: "1.5" is not an integer`},
+			{func() { Truncate(math.NaN()) }, "invalid value: NaN can not be converted to an int"},
+			{func() { Substr("héllo", NewInt(3), NewInt(3)) }, "index out of range: substr(3, 3) of a string of 5 characters"},
+			{func() { DivFloat(1, 0) }, "division by zero: 1.0 / 0.0"},
+			{func() { PowFloat(2, 1024) }, "overflow: 2.0 ^ 1024.0 does not fit in a float"},
+			{func() { PowFloat(0, -1) }, "division by zero: 0.0 ^ -1.0"},
+		}
+		for _, fixture := range fixtures {
+			err := failure(fixture.fn)
+			if assert.NotNil(err) {
+				assert.Equal(fixture.expected, err.Error())
+			}
+		}
+	})
+}
+
+func TestFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("2.0", FormatFloat(2))
+	assert.Equal("0.5", FormatFloat(0.5))
+	assert.Equal("1e+21", FormatFloat(1e21))
+	assert.Equal("1e-05", FormatFloat(0.00001))
+	assert.Equal("-0.0", FormatFloat(math.Copysign(0, -1)))
+	assert.Equal("+Inf", FormatFloat(math.Inf(1)))
+	assert.Equal("-42", FormatInt(NewInt(-42)))
+	assert.False(EqualIntFloat(NewInt(1<<53+1), 1<<53))
+	assert.True(EqualFloatInt(2, NewInt(2)))
+}
@@ -0,0 +1,27 @@
+package rt
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// FormatBool formats a boolean like cairn does
+func FormatBool(b bool) string {
+	return strconv.FormatBool(b)
+}
+
+// Len implements the len builtin: the length of a string is counted in characters
+func Len(s string) Int {
+	return NewInt(int64(utf8.RuneCountInString(s)))
+}
+
+// Substr implements the substr builtin. Positions are counted in characters, not bytes
+func Substr(s string, start, length Int) string {
+	runes := []rune(s)
+	// the big integers are out of range
+	from, n := start.small, length.small
+	if start.big != nil || length.big != nil || from < 0 || n < 0 || from > int64(len(runes))-n {
+		raise(IndexError, "substr(%s, %s) of a string of %d characters", start, length, len(runes))
+	}
+	return string(runes[from : from+n])
+}
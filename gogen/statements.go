@@ -0,0 +1,236 @@
+package gogen
+
+import (
+	"bytes"
+
+	"github.com/fchoquet/cairn/ast"
+)
+
+// destKind tells what becomes of the value of a statement
+type destKind int
+
+const (
+	discarded destKind = iota
+	returned
+	assigned
+)
+
+// destination receives the value of a statement. Match expressions pass their destination
+// to their arms, so that a match is translated to a switch statement
+type destination struct {
+	kind destKind
+	// name is the assigned variable
+	name string
+	// typ is the type of the values already received. It is "" before the first one
+	typ *string
+	// subject names the function or the expression returning the value, for the error messages
+	subject string
+	// program is set for the value of the program, that may have none
+	program bool
+}
+
+func (g *generator) statementList(sl *ast.StatementList, d destination) error {
+	for index, st := range sl.Statements {
+		dest := destination{kind: discarded}
+		if index == len(sl.Statements)-1 {
+			dest = d
+		}
+		if err := g.statement(st, dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) statement(node ast.Node, d destination) error {
+	switch n := node.(type) {
+	case *ast.BlockStmt:
+		// blocks do not open scopes: their statements are generated inline
+		return g.statementList(n.Statements, d)
+	case *ast.Assignment:
+		return g.assignment(n, d)
+	case *ast.Match:
+		return g.match(n, d)
+	default:
+		v, err := g.expr(node)
+		if err != nil {
+			return err
+		}
+		return g.deliver(d, v, node)
+	}
+}
+
+func (g *generator) assignment(node *ast.Assignment, d destination) error {
+	name := node.Variable.Name
+	typ := g.varType(name)
+	if err := g.statement(node.Right, destination{kind: assigned, name: name, typ: &typ}); err != nil {
+		return err
+	}
+	g.declare(name, typ)
+
+	if d.kind == discarded {
+		return nil
+	}
+	v, err := g.read(&node.Variable)
+	if err != nil {
+		return err
+	}
+	return g.deliver(d, v, node)
+}
+
+// deliver writes the statement giving a value to its destination
+func (g *generator) deliver(d destination, v value, node ast.Node) error {
+	switch d.kind {
+	case discarded:
+		if v.typ == nothing || v.call {
+			g.write("%s", v.code)
+		} else {
+			g.write("_ = %s", v.code)
+		}
+		return nil
+	case returned:
+		if v.typ == nothing && d.program && (*d.typ == "" || *d.typ == nothing) {
+			*d.typ = nothing
+			g.write("%s", v.code)
+			return nil
+		}
+		if v.typ == nothing {
+			return errorf(node, "%s has no value", node)
+		}
+		if *d.typ == "" {
+			*d.typ = v.typ
+		}
+		if *d.typ != v.typ {
+			return errorf(node, "%s must return a %s - got %s", d.subject, *d.typ, v.typ)
+		}
+		g.write("return %s", v.code)
+		return nil
+	default:
+		if v.typ == nothing {
+			return errorf(node, "%s has no value", node)
+		}
+		if *d.typ == "" {
+			*d.typ = v.typ
+		}
+		if *d.typ != v.typ {
+			return errorf(node, "%s is a %s - it can not be assigned a %s", d.name, *d.typ, v.typ)
+		}
+		if g.fn.unused(d.name) {
+			g.write("_ = %s", v.code)
+		} else {
+			g.write("%s = %s", goName(d.name), v.code)
+		}
+		return nil
+	}
+}
+
+// match translates a match expression to a switch statement. Its arms give their values
+// to the destination of the match
+func (g *generator) match(node *ast.Match, d destination) error {
+	subject, err := g.expr(node.Subject)
+	if err != nil {
+		return err
+	}
+	if subject.typ == nothing {
+		return errorf(node.Subject, "%s has no value", node.Subject)
+	}
+
+	// Go rejects duplicate cases and a second default: the arms that can never be selected are dropped
+	arms := []*ast.MatchArm{}
+	cases := map[*ast.MatchArm]string{}
+	seen := map[string]bool{}
+	hasDefault := false
+	binds := false
+	// a big integer is only equal to a case of a switch statement by value
+	byValue := false
+	for _, arm := range node.Arms {
+		switch p := arm.Pattern.(type) {
+		case *ast.WildcardPattern:
+			hasDefault = true
+		case *ast.BindingPattern:
+			hasDefault = true
+			binds = true
+		case *ast.ConstructorPattern:
+			return unsupported(p)
+		default:
+			literal, err := g.expr(p)
+			if err != nil {
+				return err
+			}
+			// a literal only matches the values of its type
+			if literal.typ != subject.typ || seen[literal.code] {
+				continue
+			}
+			seen[literal.code] = true
+			cases[arm] = literal.code
+			byValue = byValue || (literal.integer != nil && !literal.integer.IsInt64())
+		}
+		arms = append(arms, arm)
+		if hasDefault {
+			break
+		}
+	}
+
+	// the subject is evaluated once. match is a keyword of cairn: it can not hide a variable
+	name := subject.code
+	_, isVariable := node.Subject.(*ast.Variable)
+	switch {
+	case !isVariable && byValue:
+		name = "match"
+		g.write("switch match := %s; {", subject.code)
+	case !isVariable && (binds || !hasDefault):
+		name = "match"
+		g.write("switch match := %s; match {", subject.code)
+	case byValue:
+		g.write("switch {")
+	default:
+		g.write("switch %s {", subject.code)
+	}
+
+	for _, arm := range arms {
+		code, ok := cases[arm]
+		switch {
+		case ok && byValue:
+			g.write("case %s(%s, %s):", g.rt("Equal"), name, code)
+		case ok:
+			g.write("case %s:", code)
+		default:
+			g.write("default:")
+		}
+		if binding, ok := arm.Pattern.(*ast.BindingPattern); ok && goName(binding.Name) != name {
+			err := g.deliver(destination{kind: assigned, name: binding.Name, typ: typeSlot(g.varType(binding.Name))},
+				value{code: name, typ: subject.typ}, binding)
+			if err != nil {
+				return err
+			}
+			g.declare(binding.Name, subject.typ)
+		}
+		if err := g.statement(arm.Body, d); err != nil {
+			return err
+		}
+	}
+	if !hasDefault {
+		g.write("default:")
+		g.write("panic(%s(%s))", g.rt("NoMatch"), g.str(value{code: name, typ: subject.typ}).code)
+	}
+	g.write("}")
+	return nil
+}
+
+func typeSlot(typ string) *string {
+	return &typ
+}
+
+// matchExpr translates a match used as an operand to a function literal called at once
+func (g *generator) matchExpr(node *ast.Match) (value, error) {
+	outer := g.fn.buf
+	g.fn.buf = &bytes.Buffer{}
+	typ := ""
+	err := g.match(node, destination{kind: returned, typ: &typ, subject: "the match"})
+	body := g.fn.buf.String()
+	g.fn.buf = outer
+	if err != nil {
+		return value{}, err
+	}
+	return value{code: "func() " + g.goType(typ) + " {\n" + body + "}()", typ: typ, call: true}, nil
+}
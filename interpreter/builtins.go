@@ -0,0 +1,323 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fchoquet/cairn/checker"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// Builtin is a function implemented in Go
+type Builtin struct {
+	Name   string
+	Params []Param
+	// Result is the type of the returned value
+	Result string
+	// Fn computes the result. Arguments have already been checked against the parameter types.
+	// A *RuntimeError returned by Fn is located at the call
+	Fn func(i *Interpreter, args []Value) (Value, error)
+}
+
+// Param is a parameter of a builtin function.
+// Besides the usual types, a builtin accepts the pseudo types any and number (an int or a float).
+// A number result has the type of its arguments: integers are promoted to floats when they are mixed.
+type Param struct {
+	Name string
+	Type string
+}
+
+// Signature formats the type signature of a builtin, as it would be declared
+func (b *Builtin) Signature() string {
+	params := []string{}
+	for _, p := range b.Params {
+		params = append(params, p.Name+":"+p.Type)
+	}
+	return fmt.Sprintf("func %s(%s) :%s", b.Name, strings.Join(params, ", "), b.Result)
+}
+
+// Signatures returns the signatures of the builtins available without host capabilities,
+// for the checkers of the programs that do not run in an interpreter
+func Signatures() map[string]checker.Builtin {
+	return signatures(defaultBuiltins())
+}
+
+// signatures returns the signatures of builtins, for the checker
+func signatures(builtins map[string]*Builtin) map[string]checker.Builtin {
+	signatures := map[string]checker.Builtin{}
+	for name, b := range builtins {
+		params := []checker.Param{}
+		for _, p := range b.Params {
+			params = append(params, checker.Param{Name: p.Name, Type: p.Type})
+		}
+		signatures[name] = checker.Builtin{Params: params, Result: b.Result}
+	}
+	return signatures
+}
+
+// accepts tells whether a value matches a parameter type
+func accepts(typeName string, value Value) bool {
+	switch {
+	case value == nil:
+		return false
+	case typeName == "any":
+		return true
+	case typeName == "number":
+		return isNumber(value)
+	case strings.HasPrefix(typeName, "["):
+		list, ok := value.(*List)
+		if !ok {
+			return false
+		}
+		for _, v := range list.Values {
+			if !accepts(typeName[1:len(typeName)-1], v) {
+				return false
+			}
+		}
+		return true
+	default:
+		return value.Type() == typeName
+	}
+}
+
+// valueErrorf creates the error returned by a builtin receiving an invalid value
+func valueErrorf(format string, args ...interface{}) error {
+	return &RuntimeError{Kind: ValueError, Message: fmt.Sprintf(format, args...)}
+}
+
+// defaultBuiltins returns the builtins registered by New
+func defaultBuiltins() map[string]*Builtin {
+	builtins := map[string]*Builtin{}
+	for _, b := range []*Builtin{
+		// output
+		{"print", []Param{{"value", "any"}}, "nothing", builtinPrint("")},
+		{"println", []Param{{"value", "any"}}, "nothing", builtinPrint("\n")},
+		// conversions
+		{"str", []Param{{"value", "any"}}, "string", builtinStr},
+		{"int", []Param{{"x", "number"}}, "int", builtinInt},
+		{"float", []Param{{"x", "number"}}, "float", builtinFloat},
+		{"parseInt", []Param{{"s", "string"}}, "int", builtinParseInt},
+		// strings
+		{"len", []Param{{"s", "string"}}, "int", builtinLen},
+		{"upper", []Param{{"s", "string"}}, "string", stringFunc(strings.ToUpper)},
+		{"lower", []Param{{"s", "string"}}, "string", stringFunc(strings.ToLower)},
+		{"trim", []Param{{"s", "string"}}, "string", stringFunc(strings.TrimSpace)},
+		{"split", []Param{{"s", "string"}, {"sep", "string"}}, "[string]", builtinSplit},
+		{"join", []Param{{"parts", "[string]"}, {"sep", "string"}}, "string", builtinJoin},
+		{"contains", []Param{{"s", "string"}, {"substr", "string"}}, "bool", builtinContains},
+		{"replace", []Param{{"s", "string"}, {"old", "string"}, {"new", "string"}}, "string", builtinReplace},
+		{"substr", []Param{{"s", "string"}, {"start", "int"}, {"length", "int"}}, "string", builtinSubstr},
+		// math
+		{"abs", []Param{{"x", "number"}}, "number", builtinAbs},
+		{"min", []Param{{"a", "number"}, {"b", "number"}}, "number", builtinMinMax(-1)},
+		{"max", []Param{{"a", "number"}, {"b", "number"}}, "number", builtinMinMax(1)},
+		{"pow", []Param{{"base", "number"}, {"exp", "number"}}, "number", builtinPow},
+		// capabilities granted by the host
+		{"readLine", []Param{}, "string", builtinReadLine},
+		{"readFile", []Param{{"path", "string"}}, "string", builtinReadFile},
+		{"writeFile", []Param{{"path", "string"}, {"content", "string"}}, "nothing", builtinWriteFile},
+		{"now", []Param{}, "int", builtinNow},
+		{"random", []Param{{"n", "int"}}, "int", builtinRandom},
+		// errors
+		{"fail", []Param{{"message", "string"}}, "nothing", builtinFail},
+		{"message", []Param{{"e", "Error"}}, "string", errorFunc(func(e Error) string { return e.Message })},
+		{"kind", []Param{{"e", "Error"}}, "string", errorFunc(func(e Error) string { return string(e.Kind) })},
+		{"position", []Param{{"e", "Error"}}, "string", errorFunc(func(e Error) string { return formatPos(e.Pos) })},
+		// tests
+		{"assert", []Param{{"condition", "bool"}}, "bool", builtinAssert},
+		{"assertEqual", []Param{{"expected", "any"}, {"actual", "any"}}, "bool", builtinAssertEqual},
+	} {
+		builtins[b.Name] = b
+	}
+	return builtins
+}
+
+func builtinPrint(suffix string) func(*Interpreter, []Value) (Value, error) {
+	return func(i *Interpreter, args []Value) (Value, error) {
+		if i.caps.stdout == nil {
+			return nil, notGranted("stdout", "Stdout")
+		}
+		if _, err := fmt.Fprint(i.caps.stdout, args[0].String()+suffix); err != nil {
+			return nil, valueErrorf("can not print: %s", err)
+		}
+		return nil, nil
+	}
+}
+
+func builtinStr(i *Interpreter, args []Value) (Value, error) {
+	return String(args[0].String()), nil
+}
+
+func builtinInt(i *Interpreter, args []Value) (Value, error) {
+	f, ok := args[0].(Float)
+	if !ok {
+		return args[0], nil
+	}
+	if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+		return nil, valueErrorf("%s can not be converted to an int", f)
+	}
+	// truncate toward zero, like the integer division
+	n, _ := big.NewFloat(float64(f)).Int(nil)
+	return promote(n, i.checked)
+}
+
+func builtinFloat(i *Interpreter, args []Value) (Value, error) {
+	return Float(toFloat(args[0])), nil
+}
+
+func builtinParseInt(i *Interpreter, args []Value) (Value, error) {
+	s := string(args[0].(String))
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, valueErrorf("%q is not an integer", s)
+	}
+	return promote(n, i.checked)
+}
+
+func builtinLen(i *Interpreter, args []Value) (Value, error) {
+	return Int(utf8.RuneCountInString(string(args[0].(String)))), nil
+}
+
+func stringFunc(fn func(string) string) func(*Interpreter, []Value) (Value, error) {
+	return func(i *Interpreter, args []Value) (Value, error) {
+		return String(fn(string(args[0].(String)))), nil
+	}
+}
+
+func builtinSplit(i *Interpreter, args []Value) (Value, error) {
+	s, sep := string(args[0].(String)), string(args[1].(String))
+	n := strings.Count(s, sep) + 1
+	if sep == "" {
+		n = utf8.RuneCountInString(s)
+	}
+	if err := i.reserveList(n); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(s, sep)
+	list := &List{Values: []Value{}}
+	for _, p := range parts {
+		list.Values = append(list.Values, String(p))
+	}
+	return list, nil
+}
+
+func builtinJoin(i *Interpreter, args []Value) (Value, error) {
+	parts := []string{}
+	sep := string(args[1].(String))
+	size := 0
+	for index, v := range args[0].(*List).Values {
+		if index > 0 {
+			size += len(sep)
+		}
+		size += len(v.(String))
+		parts = append(parts, string(v.(String)))
+	}
+	if err := i.reserveString(size); err != nil {
+		return nil, err
+	}
+	return String(strings.Join(parts, sep)), nil
+}
+
+func builtinContains(i *Interpreter, args []Value) (Value, error) {
+	return Bool(strings.Contains(string(args[0].(String)), string(args[1].(String)))), nil
+}
+
+func builtinReplace(i *Interpreter, args []Value) (Value, error) {
+	s, old, new := string(args[0].(String)), string(args[1].(String)), string(args[2].(String))
+	// the size of the result is known before it is built. An empty old string matches around each character
+	if err := i.reserveString(len(s) + strings.Count(s, old)*(len(new)-len(old))); err != nil {
+		return nil, err
+	}
+	return String(strings.Replace(s, old, new, -1)), nil
+}
+
+// builtinSubstr extracts length characters from start. Positions are counted in characters, not bytes
+func builtinSubstr(i *Interpreter, args []Value) (Value, error) {
+	runes := []rune(string(args[0].(String)))
+	start, startOk := args[1].(Int)
+	length, lengthOk := args[2].(Int)
+	if !startOk || !lengthOk || start < 0 || length < 0 || int64(start)+int64(length) > int64(len(runes)) {
+		return nil, &RuntimeError{
+			Kind:    IndexError,
+			Message: fmt.Sprintf("substr(%d, %d) of a string of %d characters", args[1], args[2], len(runes)),
+		}
+	}
+	return String(runes[start : start+length]), nil
+}
+
+func builtinAbs(i *Interpreter, args []Value) (Value, error) {
+	if f, ok := args[0].(Float); ok {
+		return Float(math.Abs(float64(f))), nil
+	}
+	if toBig(args[0]).Sign() < 0 {
+		return negate(args[0], i.checked)
+	}
+	return args[0], nil
+}
+
+// builtinMinMax returns min when sign is -1 and max when sign is 1
+func builtinMinMax(sign int) func(*Interpreter, []Value) (Value, error) {
+	return func(i *Interpreter, args []Value) (Value, error) {
+		a, b := args[0], args[1]
+		if isInt(a) && isInt(b) {
+			if toBig(a).Cmp(toBig(b)) == sign {
+				return a, nil
+			}
+			return b, nil
+		}
+
+		x, y := toFloat(a), toFloat(b)
+		if sign < 0 {
+			return Float(math.Min(x, y)), nil
+		}
+		return Float(math.Max(x, y)), nil
+	}
+}
+
+// builtinPow computes exact integer powers, like the ^ operator
+func builtinPow(i *Interpreter, args []Value) (Value, error) {
+	if isInt(args[0]) && isInt(args[1]) {
+		if err := i.reserveInt(powSize(args[0], args[1])); err != nil {
+			return nil, err
+		}
+		return intOp(tokens.POW, args[0], args[1], i.checked)
+	}
+	return floatOp(tokens.POW, args[0], args[1])
+}
+
+func builtinFail(i *Interpreter, args []Value) (Value, error) {
+	return nil, &RuntimeError{Kind: Failure, Message: string(args[0].(String))}
+}
+
+// errorFunc adapts a function describing an error to a builtin
+func errorFunc(fn func(Error) string) func(*Interpreter, []Value) (Value, error) {
+	return func(i *Interpreter, args []Value) (Value, error) {
+		return String(fn(args[0].(Error))), nil
+	}
+}
+
+// builtinAssert returns true, so that a test function returning a bool can end with an assertion
+func builtinAssert(i *Interpreter, args []Value) (Value, error) {
+	if !args[0].(Bool) {
+		return nil, &RuntimeError{Kind: AssertionFailed, Message: "expected true - got false"}
+	}
+	return Bool(true), nil
+}
+
+// builtinAssertEqual compares values like ==. Values that == can not compare are never equal
+func builtinAssertEqual(i *Interpreter, args []Value) (Value, error) {
+	expected, actual := args[0], args[1]
+	_, sameType := merge(valueType(expected), valueType(actual))
+	sameType = sameType || isNumber(expected) && isNumber(actual)
+	if sameType && equals(expected, actual) {
+		return Bool(true), nil
+	}
+	message := fmt.Sprintf("expected %s - got %s", formatElement(expected), formatElement(actual))
+	if !sameType {
+		message = fmt.Sprintf("expected %s %s - got %s %s", expected.Type(), formatElement(expected), actual.Type(), formatElement(actual))
+	}
+	return nil, &RuntimeError{Kind: AssertionFailed, Message: message}
+}
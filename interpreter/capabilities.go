@@ -0,0 +1,202 @@
+package interpreter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// capabilities are the resources of the host that a program may use.
+// A new interpreter has none of them: they are granted by options
+type capabilities struct {
+	// stdout receives the output of print and println
+	stdout io.Writer
+	// stdin is read by readLine
+	stdin *bufio.Reader
+	// files are read and written by readFile and writeFile
+	files FileSystem
+	// clock gives the current time to now
+	clock func() time.Time
+	// random draws the numbers of random
+	random *rand.Rand
+}
+
+// Stdout grants the writer receiving the output of print and println
+func Stdout(w io.Writer) Option {
+	return func(i *Interpreter) {
+		i.caps.stdout = w
+	}
+}
+
+// Stdin grants the reader read by readLine
+func Stdin(r io.Reader) Option {
+	return func(i *Interpreter) {
+		if buffered, ok := r.(*bufio.Reader); ok {
+			i.caps.stdin = buffered
+			return
+		}
+		i.caps.stdin = bufio.NewReader(r)
+	}
+}
+
+// Files grants the file system read and written by readFile and writeFile
+func Files(fs FileSystem) Option {
+	return func(i *Interpreter) {
+		i.caps.files = fs
+	}
+}
+
+// Clock grants the source of the current time returned by now
+func Clock(now func() time.Time) Option {
+	return func(i *Interpreter) {
+		i.caps.clock = now
+	}
+}
+
+// Random grants the source of the numbers drawn by random
+func Random(source rand.Source) Option {
+	return func(i *Interpreter) {
+		i.caps.random = rand.New(source)
+	}
+}
+
+// FileSystem gives access to files. Paths are slash-separated and relative to the root of the file system
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+}
+
+// Dir returns the file system rooted at a directory. Paths can not go above the root,
+// and the symbolic links inside the directory are followed only when they stay under the root
+func Dir(root string) FileSystem {
+	return dir(root)
+}
+
+type dir string
+
+// errOutsideRoot is returned when a path leads out of the root of a file system
+var errOutsideRoot = errors.New("outside of the root directory")
+
+// ReadFile implements FileSystem
+func (d dir) ReadFile(name string) ([]byte, error) {
+	p, err := d.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(p)
+}
+
+// WriteFile implements FileSystem
+func (d dir) WriteFile(name string, data []byte) error {
+	p, err := d.resolve(name)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, data, 0644)
+}
+
+// resolve returns the host path of a file, once its symbolic links are resolved.
+// Cleaning a rooted path removes the .. going above the root
+func (d dir) resolve(name string) (string, error) {
+	root, err := filepath.EvalSymlinks(string(d))
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(root, filepath.FromSlash(path.Clean("/"+name)))
+
+	resolved, err := filepath.EvalSymlinks(p)
+	if os.IsNotExist(err) {
+		if _, err := os.Lstat(p); err == nil {
+			// a link to a missing file would be created wherever it leads
+			return "", errOutsideRoot
+		}
+		// a new file is created in a directory that exists
+		var parent string
+		parent, err = filepath.EvalSymlinks(filepath.Dir(p))
+		resolved = filepath.Join(parent, filepath.Base(p))
+	}
+	if err != nil {
+		return "", err
+	}
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return "", errOutsideRoot
+	}
+	return resolved, nil
+}
+
+// notGranted creates the error returned by a builtin using a capability that was not granted
+func notGranted(capability, option string) error {
+	return &RuntimeError{Kind: CapabilityError, Message: fmt.Sprintf("%s must be granted with interpreter.%s", capability, option)}
+}
+
+// fileError creates the error returned by a builtin failing to access a file.
+// The host path of the file is not disclosed
+func fileError(action, name string, err error) error {
+	if e, ok := err.(*os.PathError); ok {
+		err = e.Err
+	}
+	return valueErrorf("can not %s %s: %s", action, name, err)
+}
+
+func builtinReadLine(i *Interpreter, args []Value) (Value, error) {
+	if i.caps.stdin == nil {
+		return nil, notGranted("stdin", "Stdin")
+	}
+	line, err := i.caps.stdin.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return nil, valueErrorf("end of input")
+	}
+	if err != nil && err != io.EOF {
+		return nil, valueErrorf("can not read stdin: %s", err)
+	}
+	return String(strings.TrimRight(line, "\r\n")), nil
+}
+
+func builtinReadFile(i *Interpreter, args []Value) (Value, error) {
+	if i.caps.files == nil {
+		return nil, notGranted("the file system", "Files")
+	}
+	name := string(args[0].(String))
+	data, err := i.caps.files.ReadFile(name)
+	if err != nil {
+		return nil, fileError("read", name, err)
+	}
+	return String(data), nil
+}
+
+func builtinWriteFile(i *Interpreter, args []Value) (Value, error) {
+	if i.caps.files == nil {
+		return nil, notGranted("the file system", "Files")
+	}
+	name := string(args[0].(String))
+	if err := i.caps.files.WriteFile(name, []byte(args[1].(String))); err != nil {
+		return nil, fileError("write", name, err)
+	}
+	return nil, nil
+}
+
+func builtinNow(i *Interpreter, args []Value) (Value, error) {
+	if i.caps.clock == nil {
+		return nil, notGranted("the clock", "Clock")
+	}
+	return Int(i.caps.clock().UnixNano() / int64(time.Millisecond)), nil
+}
+
+func builtinRandom(i *Interpreter, args []Value) (Value, error) {
+	if i.caps.random == nil {
+		return nil, notGranted("the random source", "Random")
+	}
+	n, ok := args[0].(Int)
+	if !ok || n <= 0 {
+		return nil, valueErrorf("%s is not a positive int", args[0])
+	}
+	return Int(i.caps.random.Int63n(int64(n))), nil
+}
@@ -0,0 +1,88 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/fchoquet/cairn/ast"
+)
+
+// StepHook is called before the evaluation of each statement, and of the expression of
+// the selected match arm. The program waits for the hook to return, so a debugger can pause
+// it and inspect its state. An error returned by the hook stops the program.
+type StepHook func(i *Interpreter, node ast.Node) error
+
+// OnStep sets the hook called before each statement
+func OnStep(hook StepHook) Option {
+	return func(i *Interpreter) {
+		i.hook = hook
+	}
+}
+
+// onStep calls the step hook, unless the hook itself is evaluating an expression
+func (i *Interpreter) onStep(node ast.Node) error {
+	if i.hook == nil || i.inHook {
+		return nil
+	}
+	if _, ok := node.(*ast.BlockStmt); ok {
+		// blocks only group statements: their statements are hooked
+		return nil
+	}
+
+	i.inHook = true
+	defer func() { i.inHook = false }()
+	return i.hook(i, node)
+}
+
+// Stack returns the active function calls, innermost first
+func (i *Interpreter) Stack() []Frame {
+	stack := []Frame{}
+	for index := len(i.stack) - 1; index >= 0; index-- {
+		stack = append(stack, i.stack[index])
+	}
+	return stack
+}
+
+// Locals returns the variables of the innermost function call. At the top level of a module,
+// they are the global variables of the module
+func (i *Interpreter) Locals() map[string]Value {
+	return i.variables(i.currentScope())
+}
+
+// Globals returns the global variables of the running module
+func (i *Interpreter) Globals() map[string]Value {
+	return i.variables(i.current.scope)
+}
+
+func (i *Interpreter) variables(scope string) map[string]Value {
+	variables := map[string]Value{}
+	for _, name := range i.locals[scope] {
+		variables[name] = i.SymbolTable[Symbol{Scope: scope, Identifier: name}]
+	}
+	return variables
+}
+
+// Evaluate runs statements in the scope of the running program, usually from a step hook.
+// The statements may read and assign the variables of the innermost function call, but can
+// not declare functions, types or imports.
+func (i *Interpreter) Evaluate(text string) (value Value, err error) {
+	node, err := i.Parser.Parse("<debug>", text)
+	if err != nil {
+		return nil, fmt.Errorf("Parser error: %s", err)
+	}
+	file, ok := node.(*ast.SourceFile)
+	if !ok || len(file.Imports) > 0 || len(file.Types) > 0 || len(file.Functions) > 0 {
+		return nil, fmt.Errorf("only statements can be evaluated")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = i.errorf(node, InternalError, "%v", r)
+		}
+	}()
+
+	// the evaluated statements are not hooked
+	hooked := i.inHook
+	i.inHook = true
+	defer func() { i.inHook = hooked }()
+	return i.visitStatementList(file.Statements)
+}
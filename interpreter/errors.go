@@ -0,0 +1,142 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// ErrorKind classifies runtime errors
+type ErrorKind string
+
+// Runtime error kinds
+const (
+	TypeError         ErrorKind = "type error"
+	DivisionByZero    ErrorKind = "division by zero"
+	UnknownIdentifier ErrorKind = "unknown identifier"
+	UnknownFunction   ErrorKind = "unknown function"
+	ArityError        ErrorKind = "wrong number of arguments"
+	UnpackError       ErrorKind = "wrong number of values"
+	Overflow          ErrorKind = "overflow"
+	ValueError        ErrorKind = "invalid value"
+	IndexError        ErrorKind = "index out of range"
+	MatchError        ErrorKind = "no match"
+	Failure           ErrorKind = "failure"
+	AssertionFailed   ErrorKind = "assertion failed"
+	CapabilityError   ErrorKind = "capability not granted"
+	LimitExceeded     ErrorKind = "limit exceeded"
+	Canceled          ErrorKind = "canceled"
+	InternalError     ErrorKind = "internal error"
+)
+
+// Frame is an entry of the cairn call stack
+type Frame struct {
+	// Function is the name of the called function
+	Function string
+	// Pos is the position of the call
+	Pos tokens.Position
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s (%s)", f.Function, formatPos(f.Pos))
+}
+
+// RuntimeError is returned when the evaluation of a program fails
+type RuntimeError struct {
+	Kind    ErrorKind
+	Message string
+	// Pos is the position of the node that failed
+	Pos tokens.Position
+	// Stack holds the active function calls, innermost first
+	Stack []Frame
+}
+
+// catchable tells whether a try expression may handle the error.
+// Internal errors are bugs of the interpreter, and a program must not escape its limits:
+// these errors always abort the program
+func (e *RuntimeError) catchable() bool {
+	return e.Kind != InternalError && e.Kind != LimitExceeded && e.Kind != Canceled
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", formatPos(e.Pos), e.Kind, e.Message)
+}
+
+// maxTraceFrames is the number of distinct frames shown by the trace of an error. The frames of
+// deeper stacks are shown from both ends
+const maxTraceFrames = 20
+
+// Render formats the error with the faulty source line and the call stack.
+// A frame repeated in a row, as in a recursion, is shown once with the number of its repetitions.
+// source is the text the error comes from
+func (e *RuntimeError) Render(source string) string {
+	lines := []string{e.Error()}
+
+	sourceLines := strings.Split(source, "\n")
+	if e.Pos.Line >= 1 && e.Pos.Line <= len(sourceLines) {
+		line := strings.TrimRight(sourceLines[e.Pos.Line-1], "\r")
+		lines = append(lines, "    "+line)
+		if e.Pos.Col >= 1 {
+			lines = append(lines, "    "+caretIndent(line, e.Pos.Col)+"^")
+		}
+	}
+
+	return strings.Join(append(lines, trace(e.Stack)...), "\n")
+}
+
+// trace formats a call stack, collapsing the repeated frames
+func trace(stack []Frame) []string {
+	// runs holds the first frame of each run of identical frames, and counts their lengths
+	runs := []Frame{}
+	counts := []int{}
+	for index, f := range stack {
+		if index > 0 && f == stack[index-1] {
+			counts[len(counts)-1]++
+			continue
+		}
+		runs = append(runs, f)
+		counts = append(counts, 1)
+	}
+
+	lines := []string{}
+	for index := 0; index < len(runs); index++ {
+		if len(runs) > maxTraceFrames && index == maxTraceFrames/2 {
+			// the middle of the stack is left out
+			last := len(runs) - maxTraceFrames/2
+			skipped := 0
+			for _, count := range counts[index:last] {
+				skipped += count
+			}
+			lines = append(lines, fmt.Sprintf("    ... %d more frames", skipped))
+			index = last
+		}
+
+		lines = append(lines, "    at "+runs[index].String())
+		if counts[index] > 1 {
+			lines = append(lines, fmt.Sprintf("    ... %d more frames of %s", counts[index]-1, runs[index].Function))
+		}
+	}
+	return lines
+}
+
+// caretIndent returns the white spaces to put before a caret pointing at a column.
+// Tabs are kept so that the caret is aligned whatever the tab width.
+func caretIndent(line string, col int) string {
+	indent := []rune{}
+	for index, r := range []rune(line) {
+		if index >= col-1 {
+			break
+		}
+		if r == '\t' {
+			indent = append(indent, '\t')
+		} else {
+			indent = append(indent, ' ')
+		}
+	}
+	return string(indent)
+}
+
+func formatPos(pos tokens.Position) string {
+	return fmt.Sprintf("%s:%d:%d", pos.File, pos.Line, pos.Col)
+}
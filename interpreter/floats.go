@@ -0,0 +1,129 @@
+package interpreter
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// Float is a 64-bit floating point value.
+// Arithmetic mixing integers and floats promotes the integers to floats.
+type Float float64
+
+// Type implements Value
+func (f Float) Type() string {
+	return "float"
+}
+
+// String formats a float so that it can not be mistaken for an integer:
+// 3.0 is displayed as 3.0, and very large or very small numbers use an exponent
+func (f Float) String() string {
+	val := float64(f)
+	abs := math.Abs(val)
+
+	if abs != 0 && (abs < 1e-4 || abs >= 1e21) {
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	}
+
+	s := strconv.FormatFloat(val, 'f', -1, 64)
+	if !strings.ContainsAny(s, ".IN") {
+		s += ".0"
+	}
+	return s
+}
+
+// errFloatRange is returned when a float literal is too large
+var errFloatRange = errors.New("float out of range")
+
+// errFloatOverflow is returned by the powers of floats that are too large to be represented
+var errFloatOverflow = errors.New("float overflow")
+
+// parseFloat reads a float literal
+func parseFloat(literal string) (Value, error) {
+	val, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return nil, errFloatRange
+		}
+		return nil, err
+	}
+	return Float(val), nil
+}
+
+// isNumber tells whether a value is an integer or a float
+func isNumber(v Value) bool {
+	_, isFloat := v.(Float)
+	return isFloat || isInt(v)
+}
+
+// toFloat converts a number to a float
+func toFloat(v Value) float64 {
+	switch n := v.(type) {
+	case Float:
+		return float64(n)
+	case Int:
+		return float64(n)
+	case BigInt:
+		val, _ := new(big.Float).SetInt(n.Int).Float64()
+		return val
+	default:
+		return math.NaN()
+	}
+}
+
+// floatOp applies an arithmetic operator to two numbers, at least one of them being a float
+func floatOp(op tokens.TokenType, a, b Value) (Value, error) {
+	x, y := toFloat(a), toFloat(b)
+
+	switch op {
+	case tokens.PLUS:
+		return Float(x + y), nil
+	case tokens.MINUS:
+		return Float(x - y), nil
+	case tokens.MULT:
+		return Float(x * y), nil
+	case tokens.DIV:
+		if y == 0 {
+			return nil, errDivisionByZero
+		}
+		return Float(x / y), nil
+	case tokens.POW:
+		// like divisions, the powers that would give an infinity fail
+		result := math.Pow(x, y)
+		if math.IsInf(result, 0) && !math.IsInf(x, 0) && !math.IsInf(y, 0) {
+			if x == 0 {
+				return nil, errDivisionByZero
+			}
+			return nil, errFloatOverflow
+		}
+		return Float(result), nil
+	default:
+		return nil, errors.New("unexpected float operator " + string(op))
+	}
+}
+
+// numberEquals compares two numbers by value, whatever their types
+func numberEquals(a, b Value) bool {
+	if isInt(a) && isInt(b) {
+		return toBig(a).Cmp(toBig(b)) == 0
+	}
+
+	x, y := toFloat(a), toFloat(b)
+	if math.IsNaN(x) || math.IsNaN(y) || math.IsInf(x, 0) || math.IsInf(y, 0) {
+		return x == y
+	}
+
+	// compare exactly, so that a big integer is not rounded
+	return bigFloat(a).Cmp(bigFloat(b)) == 0
+}
+
+func bigFloat(v Value) *big.Float {
+	if isInt(v) {
+		return new(big.Float).SetInt(toBig(v))
+	}
+	return big.NewFloat(toFloat(v))
+}
@@ -0,0 +1,190 @@
+package interpreter
+
+import (
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// rtype is the type of a value at runtime, such as [int] or Option[string].
+// A nil *rtype is a hole: a type that can not be known from a value, such as the type
+// of the elements of an empty list. A hole matches any type
+type rtype struct {
+	// name is the name of a primitive type, ast.ListType, ast.TupleType or the name of a sum type
+	name string
+	sum  *SumType
+	args []*rtype
+}
+
+func (t *rtype) String() string {
+	switch {
+	case t == nil:
+		return "_"
+	case t.name == ast.ListType:
+		return "[" + t.args[0].String() + "]"
+	case len(t.args) == 0:
+		return t.name
+	}
+
+	args := []string{}
+	for _, a := range t.args {
+		args = append(args, a.String())
+	}
+	if t.name == ast.TupleType {
+		return "(" + strings.Join(args, ", ") + ")"
+	}
+	return t.name + "[" + strings.Join(args, ", ") + "]"
+}
+
+// valueType returns the type of a value
+func valueType(value Value) *rtype {
+	switch v := value.(type) {
+	case *List:
+		var elem *rtype
+		for _, e := range v.Values {
+			elem, _ = merge(elem, valueType(e))
+		}
+		return &rtype{name: ast.ListType, args: []*rtype{elem}}
+	case *Tuple:
+		args := []*rtype{}
+		for _, e := range v.Values {
+			args = append(args, valueType(e))
+		}
+		return &rtype{name: ast.TupleType, args: args}
+	case *Variant:
+		return &rtype{name: v.Sum.Name, sum: v.Sum, args: v.Args}
+	default:
+		return &rtype{name: value.Type()}
+	}
+}
+
+// merge combines two types of values that must have the same type, filling the holes
+// of one type with the other. It fails when the types are different
+func merge(a, b *rtype) (*rtype, bool) {
+	switch {
+	case a == nil:
+		return b, true
+	case b == nil:
+		return a, true
+	case a.name != b.name || a.sum != b.sum || len(a.args) != len(b.args):
+		return a, false
+	case len(a.args) == 0:
+		return a, true
+	}
+
+	args := []*rtype{}
+	for index := range a.args {
+		arg, ok := merge(a.args[index], b.args[index])
+		if !ok {
+			return a, false
+		}
+		args = append(args, arg)
+	}
+	return &rtype{name: a.name, sum: a.sum, args: args}, true
+}
+
+// bindings holds the types bound to the type parameters of a generic declaration.
+// The parameters that are not bound yet are mapped to nil
+type bindings map[string]*rtype
+
+func newBindings(params []*tokens.Token) bindings {
+	b := bindings{}
+	for _, p := range params {
+		b[p.Value] = nil
+	}
+	return b
+}
+
+// unify tells whether a value of type actual can be used where a type declared in a module is expected.
+// The type parameters found in the declared type are bound to the types they stand for,
+// so that a type parameter used twice stands for the same type
+func (i *Interpreter) unify(m *module, declared *ast.TypeId, actual *rtype, b bindings) bool {
+	if bound, ok := b[declared.Name]; ok && len(declared.Args) == 0 {
+		merged, ok := merge(bound, actual)
+		if ok {
+			b[declared.Name] = merged
+		}
+		return ok
+	}
+
+	switch {
+	case actual == nil:
+		return true
+	case declared.Name == ast.ListType:
+		return actual.name == ast.ListType && i.unify(m, declared.Args[0], actual.args[0], b)
+	case declared.Name == ast.TupleType:
+		if actual.name != ast.TupleType || len(declared.Args) != len(actual.args) {
+			return false
+		}
+	case isType(declared.Name):
+		return actual.sum == nil && actual.name == declared.Name
+	default:
+		t, ok := i.lookupType(m, declared.Name)
+		if !ok || actual.sum != t || len(declared.Args) != len(actual.args) {
+			return false
+		}
+	}
+
+	for index, arg := range declared.Args {
+		if !i.unify(m, arg, actual.args[index], b) {
+			return false
+		}
+	}
+	return true
+}
+
+// conforms unifies a value with a declared type. It also returns the expected type, as it
+// was known before the value was unified, for the error messages
+func (i *Interpreter) conforms(m *module, declared *ast.TypeId, value Value, b bindings) (string, bool) {
+	expected := expectedType(declared, b)
+	return expected, value != nil && i.unify(m, declared, valueType(value), b)
+}
+
+// expectedType formats a declared type for error messages. When type parameters are bound,
+// the type they stand for is given too: [T] = [int]
+func expectedType(declared *ast.TypeId, b bindings) string {
+	name := declared.TypeName()
+	if s := substitute(declared, b); s != name {
+		return name + " = " + s
+	}
+	return name
+}
+
+// substitute formats a declared type, replacing the bound type parameters by their types
+func substitute(declared *ast.TypeId, b bindings) string {
+	if bound, ok := b[declared.Name]; ok && bound != nil && len(declared.Args) == 0 {
+		return bound.String()
+	}
+	if declared.Name == ast.ListType {
+		return "[" + substitute(declared.Args[0], b) + "]"
+	}
+	if len(declared.Args) == 0 {
+		return declared.Name
+	}
+
+	args := []string{}
+	for _, a := range declared.Args {
+		args = append(args, substitute(a, b))
+	}
+	if declared.Name == ast.TupleType {
+		return "(" + strings.Join(args, ", ") + ")"
+	}
+	return declared.Name + "[" + strings.Join(args, ", ") + "]"
+}
+
+// unknownType returns the first type named by a type identifier that can not be used in a module, if any.
+// The type parameters of the declaration are known types
+func (i *Interpreter) unknownType(m *module, t *ast.TypeId, b bindings) (string, bool) {
+	if _, param := b[t.Name]; !param && t.Name != ast.ListType && t.Name != ast.TupleType && !isType(t.Name) {
+		if _, ok := i.lookupType(m, t.Name); !ok {
+			return t.Name, true
+		}
+	}
+	for _, arg := range t.Args {
+		if name, ok := i.unknownType(m, arg, b); ok {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -1,11 +1,13 @@
 package interpreter
 
 import (
+	"context"
 	"fmt"
-	"math"
-	"strconv"
+	"strings"
 
 	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/checker"
+	"github.com/fchoquet/cairn/modules"
 	"github.com/fchoquet/cairn/parser"
 	"github.com/fchoquet/cairn/tokens"
 )
@@ -14,14 +16,86 @@ import (
 type Interpreter struct {
 	Parser      *parser.Parser
 	SymbolTable SymbolTable
+	Functions   map[string]*ast.FuncDecl
+	// Builtins are the functions implemented in Go. Functions declared in cairn take precedence
+	Builtins map[string]*Builtin
+
+	// scopes is the stack of the active scopes. The last one is the current scope
+	scopes []string
+	// locals lists the identifiers defined in each scope, so that the variables of a scope
+	// are found without scanning the symbol table
+	locals map[string][]string
+	// calls counts function calls so that each call gets its own scope
+	calls int
+	// stack is the cairn call stack. The last frame is the innermost call
+	stack []Frame
+	// checked makes integer overflows fail instead of promoting integers to big integers
+	checked bool
+	// caps are the resources of the host granted to programs
+	caps capabilities
+
+	// main is the module of the program. Its functions are the Functions of the interpreter
+	main *module
+	// current is the module whose code is running
+	current *module
+	// modules are the imported modules, indexed by path
+	modules map[string]*module
+	// loader loads the imported modules
+	loader *modules.Loader
+	// checker verifies the programs before they run
+	checker *checker.Checker
+
+	// ctx stops the running program when it is done
+	ctx context.Context
+	// limits bound the resources used by a program, and usage counts them
+	limits limits
+	usage  usage
+
+	// hook is called before each statement
+	hook StepHook
+	// inHook disables the hook while it runs
+	inHook bool
+}
+
+// Option configures an interpreter
+type Option func(*Interpreter)
+
+// CheckedArithmetic makes integer overflows fail with an Overflow error.
+// By default integers are promoted to arbitrary-precision integers when they overflow.
+func CheckedArithmetic() Option {
+	return func(i *Interpreter) {
+		i.checked = true
+	}
+}
+
+// Loader grants the loader of imported modules. Without it, programs can not import modules:
+// the loader reads the files of the host
+func Loader(loader *modules.Loader) Option {
+	return func(i *Interpreter) {
+		i.loader = loader
+	}
 }
 
 // New creates a new interpreter
-func New(parser *parser.Parser) *Interpreter {
-	return &Interpreter{
+func New(parser *parser.Parser, options ...Option) *Interpreter {
+	i := &Interpreter{
 		Parser:      parser,
 		SymbolTable: SymbolTable{},
+		Functions:   map[string]*ast.FuncDecl{},
+		Builtins:    defaultBuiltins(),
+		scopes:      []string{"global"},
+		locals:      map[string][]string{},
+		modules:     map[string]*module{},
+		checker:     checker.New(),
+		ctx:         context.Background(),
+		limits:      limits{depth: DefaultMaxDepth},
+	}
+	i.main = newModule(i.Functions, "global")
+	i.current = i.main
+	for _, option := range options {
+		option(i)
 	}
+	return i
 }
 
 type Symbol struct {
@@ -29,39 +103,157 @@ type Symbol struct {
 	Identifier string
 }
 
-type SymbolTable map[Symbol]string
+type SymbolTable map[Symbol]Value
 
-func (i *Interpreter) Interpret(fileName, text string) (string, error) {
-	ast, err := i.Parser.Parse(fileName, text)
+// define assigns a variable of a scope
+func (i *Interpreter) define(scope, name string, value Value) {
+	symbol := Symbol{Scope: scope, Identifier: name}
+	if _, ok := i.SymbolTable[symbol]; !ok {
+		i.locals[scope] = append(i.locals[scope], name)
+	}
+	i.SymbolTable[symbol] = value
+}
+
+// dropScope deletes the variables of a scope once its function call returns
+func (i *Interpreter) dropScope(scope string) {
+	for _, name := range i.locals[scope] {
+		delete(i.SymbolTable, Symbol{Scope: scope, Identifier: name})
+	}
+	delete(i.locals, scope)
+}
+
+func (i *Interpreter) Interpret(fileName, text string) (output string, err error) {
+	return i.InterpretContext(context.Background(), fileName, text)
+}
 
-	// DEBUG CODE
-	// display all the tokens
-	fmt.Println("--- AST: ---")
-	fmt.Println(ast)
-	fmt.Println("------------")
-	// END DEBUG CODE
+// InterpretContext parses and runs a program. The program stops with a Canceled error
+// when ctx is done
+func (i *Interpreter) InterpretContext(ctx context.Context, fileName, text string) (output string, err error) {
+	defer func() {
+		// the parser panics on bugs. They must not crash the host
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Parser error: %v", r)
+		}
+	}()
 
+	ast, err := i.Parser.Parse(fileName, text)
 	if err != nil {
 		return "", fmt.Errorf("Parser error: %s", err)
 	}
 
-	return i.visit(ast)
+	return i.ExecContext(ctx, ast)
 }
 
-func (i *Interpreter) visit(node ast.Node) (string, error) {
+// Exec runs an AST that has already been parsed.
+// Evaluation errors and denied imports are returned as *RuntimeError, import errors as *tokens.Error
+// and the errors found by the checker as checker.Errors
+func (i *Interpreter) Exec(node ast.Node) (output string, err error) {
+	return i.ExecContext(context.Background(), node)
+}
+
+// ExecContext runs an AST that has already been parsed, like Exec.
+// The program stops with a Canceled error when ctx is done
+func (i *Interpreter) ExecContext(ctx context.Context, node ast.Node) (output string, err error) {
+	i.start(ctx)
+	defer i.start(context.Background())
+
+	if file, ok := node.(*ast.SourceFile); ok {
+		m := &modules.Module{Path: file.Pos().File, File: file}
+		if len(file.Imports) > 0 {
+			if i.loader == nil {
+				return "", i.errorf(file.Imports[0], CapabilityError, "import: modules must be granted with interpreter.Loader")
+			}
+			if m, err = i.loader.Link(file.Pos().File, file); err != nil {
+				return "", err
+			}
+		}
+		i.checker.Builtins = signatures(i.Builtins)
+		if err := i.checker.Check(m); err != nil {
+			return "", err
+		}
+		if err := i.importModules(i.main, m); err != nil {
+			return "", err
+		}
+	}
+
+	value, err := i.eval(node)
+	if err != nil || value == nil {
+		return "", err
+	}
+	return value.String(), nil
+}
+
+// eval runs an AST and returns the value of its last statement
+func (i *Interpreter) eval(node ast.Node) (value Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = i.errorf(node, InternalError, "%v", r)
+		}
+		// an error interrupts function calls
+		i.scopes = i.scopes[:1]
+		i.stack = nil
+	}()
+
+	return i.visit(node)
+}
+
+// errorf creates a runtime error located at a node
+func (i *Interpreter) errorf(node ast.Node, kind ErrorKind, format string, args ...interface{}) *RuntimeError {
+	return &RuntimeError{
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+		Pos:     node.Pos(),
+		Stack:   i.Stack(),
+	}
+}
+
+func (i *Interpreter) visit(node ast.Node) (Value, error) {
+	if err := i.step(node); err != nil {
+		return nil, err
+	}
+
+	value, err := i.dispatch(node)
+	if err != nil {
+		return nil, err
+	}
+	switch node.(type) {
+	case *ast.BinOp, *ast.Interpolation, *ast.ListLit, *ast.TupleLit:
+		// these nodes create new values
+		if err := i.allocate(node, value); err != nil {
+			if op, ok := node.(*ast.BinOp); ok {
+				err.Pos = op.Op.Position
+			}
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// dispatch evaluates a node with the visitor of its type
+func (i *Interpreter) dispatch(node ast.Node) (Value, error) {
 	switch n := node.(type) {
 	case *ast.SourceFile:
 		return i.visitSourceFile(n)
 	case *ast.FuncDecl:
 		return i.visitFuncDecl(n)
+	case *ast.TypeDecl:
+		return i.visitTypeDecl(n)
+	case *ast.Match:
+		return i.visitMatch(n)
+	case *ast.Try:
+		return i.visitTry(n)
 	case *ast.StatementList:
 		return i.visitStatementList(n)
 	case *ast.BlockStmt:
 		return i.visitBlockStmt(n)
 	case *ast.Num:
 		return i.visitNum(n)
+	case *ast.Float:
+		return i.visitFloat(n)
 	case *ast.String:
 		return i.visitString(n)
+	case *ast.Interpolation:
+		return i.visitInterpolation(n)
 	case *ast.Bool:
 		return i.visitBool(n)
 	case *ast.UnaryOp:
@@ -70,179 +262,515 @@ func (i *Interpreter) visit(node ast.Node) (string, error) {
 		return i.visitBinOp(n)
 	case *ast.Assignment:
 		return i.visitAssignment(n)
+	case *ast.Destructuring:
+		return i.visitDestructuring(n)
+	case *ast.TupleLit:
+		return i.visitTupleLit(n)
 	case *ast.Variable:
 		return i.visitVariable(n)
+	case *ast.FuncCall:
+		return i.visitFuncCall(n)
+	case *ast.ListLit:
+		return i.visitListLit(n)
+	case *ast.Index:
+		return i.visitIndex(n)
 	default:
-		return "", fmt.Errorf("unexpected node type: %v", node)
+		return nil, i.errorf(node, InternalError, "unexpected node type: %v", node)
 	}
 }
 
-func (i *Interpreter) visitSourceFile(node *ast.SourceFile) (string, error) {
+func (i *Interpreter) visitSourceFile(node *ast.SourceFile) (Value, error) {
+	for _, t := range node.Types {
+		if _, err := i.visit(t); err != nil {
+			return nil, err
+		}
+	}
 	for _, f := range node.Functions {
 		if _, err := i.visit(f); err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 	return i.visitStatementList(node.Statements)
 }
 
-func (i *Interpreter) visitFuncDecl(node *ast.FuncDecl) (string, error) {
-	// TODO implement
-	return "", nil
+func (i *Interpreter) visitFuncDecl(node *ast.FuncDecl) (Value, error) {
+	params := newBindings(node.Signature.TypeParams)
+	for _, param := range node.Signature.Parameters.Parameters {
+		if name, ok := i.unknownType(i.current, param.Type, params); ok {
+			return nil, i.errorf(param.Type, TypeError, "unknown type %s", name)
+		}
+	}
+	if name, ok := i.unknownType(i.current, node.Signature.ReturnType, params); ok {
+		return nil, i.errorf(node.Signature.ReturnType, TypeError, "unknown type %s", name)
+	}
+
+	i.current.functions[node.Name.Value] = node
+	return nil, nil
 }
 
-func (i *Interpreter) visitStatementList(node *ast.StatementList) (string, error) {
-	output := ""
+func (i *Interpreter) visitStatementList(node *ast.StatementList) (Value, error) {
+	var output Value
 	for _, st := range node.Statements {
-		s, err := i.visit(st)
+		if err := i.onStep(st); err != nil {
+			return nil, err
+		}
+		value, err := i.visit(st)
 		if err != nil {
-			return output, err
+			return nil, err
 		}
 		// the output is the output of the last statement
-		output = s
+		output = value
 	}
 
 	return output, nil
 }
 
-func (i *Interpreter) visitBlockStmt(node *ast.BlockStmt) (string, error) {
+func (i *Interpreter) visitBlockStmt(node *ast.BlockStmt) (Value, error) {
 	return i.visitStatementList(node.Statements)
 }
 
-func (i *Interpreter) visitNum(node *ast.Num) (string, error) {
-	return node.Value, nil
+func (i *Interpreter) visitNum(node *ast.Num) (Value, error) {
+	val, err := parseInt(node.Value, i.checked)
+	if err == errOverflow {
+		return nil, i.errorf(node, Overflow, "integer literal %s is too large", node.Value)
+	}
+	if err != nil {
+		return nil, i.errorf(node, InternalError, "%s", err)
+	}
+	return val, nil
+}
+
+func (i *Interpreter) visitFloat(node *ast.Float) (Value, error) {
+	val, err := parseFloat(node.Value)
+	if err == errFloatRange {
+		return nil, i.errorf(node, Overflow, "float literal %s is too large", node.Value)
+	}
+	if err != nil {
+		return nil, i.errorf(node, InternalError, "%s", err)
+	}
+	return val, nil
+}
+
+func (i *Interpreter) visitString(node *ast.String) (Value, error) {
+	return String(node.Value), nil
 }
 
-func (i *Interpreter) visitString(node *ast.String) (string, error) {
-	return node.Value, nil
+func (i *Interpreter) visitInterpolation(node *ast.Interpolation) (Value, error) {
+	buf := &strings.Builder{}
+	for _, part := range node.Parts {
+		value, err := i.visit(part)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, i.errorf(part, TypeError, "%s has no value", part)
+		}
+		buf.WriteString(value.String())
+	}
+	return String(buf.String()), nil
 }
 
-func (i *Interpreter) visitBool(node *ast.Bool) (string, error) {
-	return node.Value, nil
+func (i *Interpreter) visitBool(node *ast.Bool) (Value, error) {
+	return Bool(node.Value == "true"), nil
 }
 
-func (i *Interpreter) visitUnaryOp(node *ast.UnaryOp) (string, error) {
+func (i *Interpreter) visitUnaryOp(node *ast.UnaryOp) (Value, error) {
 	expr, err := i.visit(node.Expr)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	switch node.Op.Type {
 	case tokens.NOT:
-		val, err := strconv.ParseBool(expr)
-		if err != nil {
-			return "", err
+		val, ok := expr.(Bool)
+		if !ok {
+			return nil, i.errorf(node, TypeError, "operator %s expects a bool - got %s", node.Op.Value, expr.Type())
 		}
-		return strconv.FormatBool(!val), err
-	default:
-		val, err := strconv.Atoi(expr)
-		if err != nil {
-			return "", err
+		return !val, nil
+	case tokens.PLUS, tokens.MINUS:
+		if !isNumber(expr) {
+			return nil, i.errorf(node, TypeError, "operator %s expects a number - got %s", node.Op.Value, expr.Type())
 		}
-		switch node.Op.Type {
-		case tokens.PLUS:
-			return strconv.Itoa(+val), nil
-		case tokens.MINUS:
-			return strconv.Itoa(-val), nil
-		default:
-			return "", fmt.Errorf("unexpected binary operator: %s", node.Op)
+		if node.Op.Type == tokens.PLUS {
+			return expr, nil
+		}
+		if f, ok := expr.(Float); ok {
+			return -f, nil
 		}
+		val, err := negate(expr, i.checked)
+		if err != nil {
+			return nil, i.errorf(node, Overflow, "-%s does not fit in 64 bits", expr)
+		}
+		return val, nil
+	default:
+		return nil, i.errorf(node, InternalError, "unexpected unary operator: %s", node.Op)
 	}
 }
 
-func (i *Interpreter) visitBinOp(node *ast.BinOp) (string, error) {
+func (i *Interpreter) visitBinOp(node *ast.BinOp) (Value, error) {
 	left, err := i.visit(node.Left)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	right, err := i.visit(node.Right)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	switch node.Op.Type {
-	case tokens.CONCAT:
-		return (left + right), nil
-	case tokens.EQ:
-		return strconv.FormatBool(left == right), nil
-	case tokens.NEQ:
-		return strconv.FormatBool(left != right), nil
-	case tokens.POW:
-		// we need floats to use math.Pow but we expect ints only for now
-		leftVal, err := strconv.ParseFloat(left, 64)
-		if err != nil {
-			return "", err
+	// errors are reported at the position of the operator
+	opError := func(kind ErrorKind, format string, args ...interface{}) error {
+		err := i.errorf(node, kind, format, args...)
+		err.Pos = node.Op.Position
+		return err
+	}
+
+	if node.Op.Type == tokens.EQ || node.Op.Type == tokens.NEQ {
+		if _, ok := merge(valueType(left), valueType(right)); !ok && !(isNumber(left) && isNumber(right)) {
+			return nil, opError(TypeError, "can not compare %s and %s", left.Type(), right.Type())
 		}
-		rightVal, err := strconv.ParseFloat(right, 64)
-		if err != nil {
-			return "", err
+		return Bool(equals(left, right) == (node.Op.Type == tokens.EQ)), nil
+	}
+
+	_, leftFloat := left.(Float)
+	_, rightFloat := right.(Float)
+	if (leftFloat || rightFloat) && isNumber(left) && isNumber(right) {
+		// integers are promoted to floats
+		switch node.Op.Type {
+		case tokens.PLUS, tokens.MINUS, tokens.MULT, tokens.DIV, tokens.POW:
+			result, err := floatOp(node.Op.Type, left, right)
+			switch err {
+			case nil:
+				return result, nil
+			case errDivisionByZero:
+				return nil, opError(DivisionByZero, "%s %s %s", left, node.Op.Value, right)
+			case errFloatOverflow:
+				return nil, opError(Overflow, "%s %s %s does not fit in a float", left, node.Op.Value, right)
+			default:
+				return nil, opError(InternalError, "%s", err)
+			}
 		}
-		// watch the int conversion here
-		return strconv.Itoa(int(math.Pow(leftVal, rightVal))), nil
-	case tokens.AND, tokens.OR:
-		leftVal, err := strconv.ParseBool(left)
-		if err != nil {
-			return "", err
+	}
+
+	switch leftVal := left.(type) {
+	case String:
+		rightVal, ok := right.(String)
+		if !ok || node.Op.Type != tokens.CONCAT {
+			break
 		}
-		rightVal, err := strconv.ParseBool(right)
-		if err != nil {
-			return "", err
+		if err := i.reserveString(len(leftVal) + len(rightVal)); err != nil {
+			return nil, opError(err.Kind, "%s", err.Message)
+		}
+		return leftVal + rightVal, nil
+	case Bool:
+		rightVal, ok := right.(Bool)
+		if !ok {
+			break
 		}
 		switch node.Op.Type {
 		case tokens.AND:
-			return strconv.FormatBool(leftVal && rightVal), nil
+			return leftVal && rightVal, nil
 		case tokens.OR:
-			return strconv.FormatBool(leftVal || rightVal), nil
-		default:
-			return "", fmt.Errorf("unexpected binary operator: %s", node.Op)
+			return leftVal || rightVal, nil
 		}
-	default:
-		// string to int conversions
-		leftVal, err := strconv.Atoi(left)
+	case Int, BigInt:
+		if !isInt(right) {
+			break
+		}
+		switch node.Op.Type {
+		case tokens.PLUS, tokens.MINUS, tokens.MULT, tokens.DIV, tokens.POW:
+			if node.Op.Type == tokens.POW {
+				if err := i.reserveInt(powSize(left, right)); err != nil {
+					return nil, opError(err.Kind, "%s", err.Message)
+				}
+			}
+			result, err := intOp(node.Op.Type, left, right, i.checked)
+			switch err {
+			case nil:
+				return result, nil
+			case errDivisionByZero:
+				return nil, opError(DivisionByZero, "%s %s %s", left, node.Op.Value, right)
+			case errOverflow:
+				return nil, opError(Overflow, "%s %s %s does not fit in 64 bits", left, node.Op.Value, right)
+			default:
+				return nil, opError(Overflow, "%s %s %s: %s", left, node.Op.Value, right, err)
+			}
+		}
+	}
+
+	return nil, opError(TypeError, "operator %s is not defined on %s and %s", node.Op.Value, left.Type(), right.Type())
+}
+
+func (i *Interpreter) visitAssignment(node *ast.Assignment) (Value, error) {
+	right, err := i.visit(node.Right)
+	if err != nil {
+		return nil, err
+	}
+	if right == nil {
+		return nil, i.errorf(node.Right, TypeError, "%s has no value", node.Right)
+	}
+
+	i.define(i.currentScope(), node.Variable.Name, right)
+
+	return right, nil
+}
+
+func (i *Interpreter) visitVariable(node *ast.Variable) (Value, error) {
+	if node.Module != "" {
+		m, ok := i.current.imports[node.Module]
+		if !ok {
+			return nil, i.errorf(node, UnknownIdentifier, "unknown module %s", node.Module)
+		}
+		if !modules.IsExported(node.Name) {
+			return nil, i.errorf(node, UnknownIdentifier, "%s.%s is not exported", node.Module, node.Name)
+		}
+		if value, ok := i.SymbolTable[Symbol{Scope: m.scope, Identifier: node.Name}]; ok {
+			return value, nil
+		}
+		if t, ok := m.constructors[node.Name]; ok {
+			return i.constant(node, t)
+		}
+		return nil, i.errorf(node, UnknownIdentifier, "%s.%s", node.Module, node.Name)
+	}
+
+	// look into the current scope first, then in the global scope of the module
+	for _, scope := range []string{i.currentScope(), i.current.scope} {
+		if value, ok := i.SymbolTable[Symbol{Scope: scope, Identifier: node.Name}]; ok {
+			return value, nil
+		}
+	}
+	if t, ok := i.current.constructors[node.Name]; ok {
+		return i.constant(node, t)
+	}
+	return nil, i.errorf(node, UnknownIdentifier, "%s", node.Name)
+}
+
+func (i *Interpreter) visitFuncCall(node *ast.FuncCall) (Value, error) {
+	if node.Module != "" {
+		m, ok := i.current.imports[node.Module]
+		if !ok {
+			return nil, i.errorf(node, UnknownIdentifier, "unknown module %s", node.Module)
+		}
+		f, ok := m.functions[node.Name]
+		if !ok {
+			if t, ok := m.constructors[node.Name]; ok {
+				return i.construct(node, m, t)
+			}
+			return nil, i.errorf(node, UnknownFunction, "%s.%s", node.Module, node.Name)
+		}
+		if !modules.IsExported(node.Name) {
+			return nil, i.errorf(node, UnknownFunction, "%s.%s is not exported", node.Module, node.Name)
+		}
+		return i.callFunction(node, f, m)
+	}
+
+	f, ok := i.current.functions[node.Name]
+	if !ok {
+		if t, ok := i.current.constructors[node.Name]; ok {
+			return i.construct(node, i.current, t)
+		}
+		if b, ok := i.Builtins[node.Name]; ok {
+			return i.callBuiltin(node, b)
+		}
+		return nil, i.errorf(node, UnknownFunction, "%s", node.Name)
+	}
+	return i.callFunction(node, f, i.current)
+}
+
+// callFunction calls a function declared in cairn. Its body runs in the module declaring it
+func (i *Interpreter) callFunction(node *ast.FuncCall, f *ast.FuncDecl, m *module) (Value, error) {
+	name := qualify(node.Module, node.Name)
+	params := f.Signature.Parameters.Parameters
+	if len(node.Args) != len(params) {
+		return nil, i.errorf(node, ArityError, "%s expects %d arguments - got %d", name, len(params), len(node.Args))
+	}
+
+	// arguments are evaluated in the caller's scope. The type arguments of a generic function
+	// are inferred from their types
+	b := newBindings(f.Signature.TypeParams)
+	args := []Value{}
+	for index, arg := range node.Args {
+		value, err := i.visit(arg)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		if expected, ok := i.conforms(m, params[index].Type, value, b); !ok {
+			return nil, i.errorf(arg, TypeError, "argument %s of %s must be a %s - got %s", params[index].Name, name, expected, typeOf(value))
 		}
+		args = append(args, value)
+	}
+
+	if err := i.enter(node); err != nil {
+		return nil, err
+	}
+	i.calls++
+	scope := fmt.Sprintf("%s#%d", node.Name, i.calls)
+	for index, param := range params {
+		i.define(scope, param.Name, args[index])
+	}
+
+	caller := i.current
+	i.current = m
+	i.scopes = append(i.scopes, scope)
+	i.stack = append(i.stack, Frame{Function: name, Pos: node.Pos()})
+	defer func() {
+		i.current = caller
+		i.scopes = i.scopes[:len(i.scopes)-1]
+		i.stack = i.stack[:len(i.stack)-1]
+		i.dropScope(scope)
+	}()
+
+	result, err := i.visit(f.Body)
+	if err != nil {
+		return nil, err
+	}
+	if expected, ok := i.conforms(m, f.Signature.ReturnType, result, b); !ok {
+		return nil, i.errorf(lastStatement(f.Body), TypeError, "%s must return a %s - got %s", name, expected, typeOf(result))
+	}
+	return result, nil
+}
 
-		rightVal, err := strconv.Atoi(right)
+func (i *Interpreter) callBuiltin(node *ast.FuncCall, b *Builtin) (Value, error) {
+	if len(node.Args) != len(b.Params) {
+		return nil, i.errorf(node, ArityError, "%s expects %d arguments - got %d", node.Name, len(b.Params), len(node.Args))
+	}
+
+	args := []Value{}
+	for index, arg := range node.Args {
+		value, err := i.visit(arg)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
+		if !accepts(b.Params[index].Type, value) {
+			return nil, i.errorf(arg, TypeError, "argument %s of %s must be a %s - got %s", b.Params[index].Name, node.Name, b.Params[index].Type, typeOf(value))
+		}
+		args = append(args, value)
+	}
 
-		switch node.Op.Type {
-		case tokens.PLUS:
-			return strconv.Itoa(leftVal + rightVal), nil
-		case tokens.MINUS:
-			return strconv.Itoa(leftVal - rightVal), nil
-		case tokens.MULT:
-			return strconv.Itoa(leftVal * rightVal), nil
-		case tokens.DIV:
-			return strconv.Itoa(leftVal / rightVal), nil
-		default:
-			return "", fmt.Errorf("unexpected binary operator: %s", node.Op)
+	result, err := b.Fn(i, args)
+	switch e := err.(type) {
+	case nil:
+		if result == nil {
+			return nil, nil
 		}
+		if err := i.allocate(node, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	case *RuntimeError:
+		switch e.Kind {
+		case Failure, LimitExceeded, Canceled:
+			// the message comes from the program, or from its limits, not from the builtin
+			return nil, i.errorf(node, e.Kind, "%s", e.Message)
+		}
+		return nil, i.errorf(node, e.Kind, "%s: %s", node.Name, e.Message)
+	}
+	switch err {
+	case errDivisionByZero:
+		return nil, i.errorf(node, DivisionByZero, "%s", node)
+	case errOverflow, errExponentTooLarge, errFloatOverflow:
+		return nil, i.errorf(node, Overflow, "%s: %s", node.Name, err)
+	default:
+		return nil, i.errorf(node, InternalError, "%s: %s", node.Name, err)
 	}
 }
 
-func (i *Interpreter) visitAssignment(node *ast.Assignment) (string, error) {
-	right, err := i.visit(node.Right)
+// TypeOf returns the type of an expression. Functions are described by their signatures.
+// Other expressions are evaluated.
+func (i *Interpreter) TypeOf(fileName, text string) (string, error) {
+	node, err := i.Parser.Parse(fileName, text)
+	if err != nil {
+		return "", fmt.Errorf("Parser error: %s", err)
+	}
+
+	i.start(context.Background())
+	if file, ok := node.(*ast.SourceFile); ok && len(file.Statements.Statements) == 1 {
+		for _, t := range file.Types {
+			if _, err := i.eval(t); err != nil {
+				return "", err
+			}
+		}
+		for _, f := range file.Functions {
+			if _, err := i.eval(f); err != nil {
+				return "", err
+			}
+		}
+		if v, ok := file.Statements.Statements[0].(*ast.Variable); ok {
+			if v.Module != "" {
+				if m, ok := i.current.imports[v.Module]; ok && modules.IsExported(v.Name) {
+					if f, ok := m.functions[v.Name]; ok {
+						return signature(f), nil
+					}
+				}
+			} else if f, ok := i.current.functions[v.Name]; ok {
+				return signature(f), nil
+			} else if t, ok := i.current.constructors[v.Name]; ok && len(t.constructor(v.Name).Fields) > 0 {
+				return constructorSignature(t, t.constructor(v.Name)), nil
+			} else if b, ok := i.Builtins[v.Name]; ok {
+				return b.Signature(), nil
+			}
+		}
+	}
+
+	value, err := i.eval(node)
 	if err != nil {
 		return "", err
 	}
+	return typeOf(value), nil
+}
+
+// signature formats the signature of a function declared in cairn
+func signature(f *ast.FuncDecl) string {
+	params := []string{}
+	for _, p := range f.Signature.Parameters.Parameters {
+		params = append(params, p.Name+":"+p.Type.TypeName())
+	}
+	name := f.Name.Value + formatTypeParams(f.Signature.TypeParams)
+	return fmt.Sprintf("func %s(%s) :%s", name, strings.Join(params, ", "), f.Signature.ReturnType.TypeName())
+}
+
+// constructorSignature formats the signature of a constructor, as if it were a function
+func constructorSignature(t *SumType, c *ast.Constructor) string {
+	fields := []string{}
+	for _, f := range c.Fields {
+		fields = append(fields, f.Name+":"+f.Type.TypeName())
+	}
+	params := formatTypeParams(t.Decl.Params)
+	return fmt.Sprintf("func %s%s(%s) :%s%s", c.Name, params, strings.Join(fields, ", "), t.Name, params)
+}
 
-	i.SymbolTable[Symbol{Scope: "global", Identifier: node.Variable.Name}] = right
+// formatTypeParams formats the type parameters of a generic declaration
+func formatTypeParams(params []*tokens.Token) string {
+	if len(params) == 0 {
+		return ""
+	}
+	names := []string{}
+	for _, p := range params {
+		names = append(names, p.Value)
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
 
-	// DEBUG code
-	fmt.Printf("%+v\n", i.SymbolTable)
-	// END DEBUG code
+func (i *Interpreter) currentScope() string {
+	return i.scopes[len(i.scopes)-1]
+}
 
-	return right, nil
+// typeOf returns the type of a value that may be missing
+func typeOf(value Value) string {
+	if value == nil {
+		return "nothing"
+	}
+	return value.Type()
 }
 
-func (i *Interpreter) visitVariable(node *ast.Variable) (string, error) {
-	value, ok := i.SymbolTable[Symbol{Scope: "global", Identifier: node.Name}]
-	if !ok {
-		return "", fmt.Errorf("unknown identifier: %s", node.Name)
+// lastStatement returns the statement that gives its value to a block
+func lastStatement(block *ast.BlockStmt) ast.Node {
+	statements := block.Statements.Statements
+	if len(statements) == 0 {
+		return block
 	}
-	return value, nil
+	if nested, ok := statements[len(statements)-1].(*ast.BlockStmt); ok {
+		return lastStatement(nested)
+	}
+	return statements[len(statements)-1]
 }
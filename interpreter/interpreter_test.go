@@ -1,13 +1,41 @@
 package interpreter
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/checker"
+	"github.com/fchoquet/cairn/modules"
 	"github.com/fchoquet/cairn/parser"
+	"github.com/fchoquet/cairn/tokens"
 	"github.com/stretchr/testify/assert"
 )
 
+// shapes declares a sum type and a function matching its values
+const shapes = "type Shape = Circle(r:int) | Rect(w:int, h:int) | Empty\n" +
+	"func area(s:Shape) :int\n" +
+	"    match s\n" +
+	"        Circle(r) -> 3 * r * r\n" +
+	"        Rect(w, h) -> w * h\n" +
+	"        Empty -> 0\n"
+
+// divmod declares functions returning and destructuring tuples
+const divmod = "func divmod(a:int, b:int) :(int, int)\n" +
+	"    (a / b, a - b * (a / b))\n" +
+	"func swap[A, B](p:(A, B)) :(B, A)\n" +
+	"    a, b := p\n" +
+	"    (b, a)\n"
+
 func TestInterpreter(t *testing.T) {
 	assert := assert.New(t)
 	t.Run("expressions", func(t *testing.T) {
@@ -92,4 +120,1132 @@ func TestInterpreter(t *testing.T) {
 			assert.Equal(f.result, result, strings.Join(f.source, "\n"))
 		}
 	})
+
+	t.Run("functions", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			result string
+		}{
+			{"func add(a:int, b:int) :int\n    a + b\nadd(1, 2)", `3`},
+			{"func add(a:int, b:int) :int\n    a + b\nadd(add(1, 2), add(3, 4))", `10`},
+			{"func greet(name:string) :string\n    \"hello \" ++ name\ngreet(\"Fred\")", `hello Fred`},
+			// parameters shadow global variables
+			{"func double(a:int) :int\n    a * 2\na := 10\ndouble(3) + a", `16`},
+			// local variables do not leak
+			{"func foo() :int\n    a := 1\n    a + 1\na := 10\nfoo() + a", `12`},
+		}
+
+		for _, f := range fixtures {
+			i := New(&parser.Parser{})
+			result, err := i.Interpret("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.result, result, f.source)
+		}
+
+		errors := []string{
+			`foo()`,
+			"func add(a:int, b:int) :int\n    a + b\nadd(1)",
+			"func foo() :int\n    a := 1\n    a\nfoo()\na",
+		}
+		for _, source := range errors {
+			i := New(&parser.Parser{})
+			_, err := i.Interpret("test.ca", source)
+			assert.Error(err, source)
+		}
+
+		// the variables of a call are dropped when it returns, from the list of the variables of its scope
+		i := New(&parser.Parser{})
+		result, err := i.Interpret("test.ca", "func sum(n:int) :int\n    match n\n        0 -> 0\n        _ ->\n            m := n - 1\n            n + sum(m)\nx := sum(9000)\nx")
+		if assert.Nil(err) {
+			assert.Equal("40504500", result)
+		}
+		assert.Equal(map[string]Value{"x": Int(40504500)}, i.Globals())
+		assert.Len(i.SymbolTable, 1)
+		assert.Equal(map[string][]string{"global": {"x"}}, i.locals)
+	})
+
+	t.Run("runtime errors", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			kind   ErrorKind
+			pos    string
+			stack  []string
+		}{
+			{`1 / 0`, DivisionByZero, `test.ca:1:3`, []string{}},
+			{`"x = ${1 / 0}"`, DivisionByZero, `test.ca:1:10`, []string{}},
+			{"a := 1\n\"${a} ${\"${b}\"}\"", UnknownIdentifier, `test.ca:2:12`, []string{}},
+			{`1 + foo`, UnknownIdentifier, `test.ca:1:5`, []string{}},
+			{`foo(1)`, UnknownFunction, `test.ca:1:1`, []string{}},
+			{"func foo(a:foo) :int\n    1", TypeError, `test.ca:1:11`, []string{}},
+			{
+				"func div(a:int, b:int) :int\n    a / b\nfunc f(x:int) :int\n    div(x, x - 1)\nf(1)",
+				DivisionByZero,
+				`test.ca:2:7`,
+				[]string{`div (test.ca:4:5)`, `f (test.ca:5:1)`},
+			},
+		}
+
+		for _, f := range fixtures {
+			i := New(&parser.Parser{})
+			_, err := i.Interpret("test.ca", f.source)
+			rerr, ok := err.(*RuntimeError)
+			if !assert.True(ok, f.source) {
+				continue
+			}
+			assert.Equal(f.kind, rerr.Kind, f.source)
+			assert.Equal(f.pos, formatPos(rerr.Pos), f.source)
+
+			stack := []string{}
+			for _, frame := range rerr.Stack {
+				stack = append(stack, frame.String())
+			}
+			assert.Equal(f.stack, stack, f.source)
+
+			// the interpreter can still be used after an error
+			result, err := i.Interpret("test.ca", `1 + 1`)
+			assert.Nil(err)
+			assert.Equal("2", result)
+		}
+
+		// the checker does not know the types of the variables of previous programs
+		i := New(&parser.Parser{})
+		_, err := i.Interpret("test.ca", `x := "foo"`)
+		assert.Nil(err)
+		_, err = i.Interpret("test.ca", `1 + x`)
+		if rerr, ok := err.(*RuntimeError); assert.True(ok) {
+			assert.Equal(TypeError, rerr.Kind)
+			assert.Equal(`test.ca:1:3`, formatPos(rerr.Pos))
+		}
+	})
+
+	t.Run("type errors are found by the checker, before the program runs", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			err    string
+		}{
+			{`1 + "foo"`, `test.ca:1:3: operator + is not defined on int and string`},
+			{`"foo" ++ 1`, `test.ca:1:7: operator ++ is not defined on string and int`},
+			{`"f\u00f6\t" ++ 1`, `test.ca:1:13: operator ++ is not defined on string and int`},
+			{"\"\"\"\n    föö\n    \"\"\" ++ 1", `test.ca:3:9: operator ++ is not defined on string and int`},
+			{`1 == "1"`, `test.ca:1:3: can not compare int and string`},
+			{`!1`, `test.ca:1:1: operator ! expects a bool - got int`},
+			{`-true`, `test.ca:1:1: operator - expects a number - got bool`},
+			{"func add(a:int, b:int) :int\n    a + b\nadd(1)", `test.ca:3:1: add expects 2 arguments - got 1`},
+			{"func add(a:int, b:int) :int\n    a + b\nadd(1, \"2\")", `test.ca:3:8: argument b of add must be a int - got string`},
+			{"func foo() :string\n    1\nfoo()", `test.ca:2:5: foo must return a string - got int`},
+			{"func foo(n:int) :int\n    match n\n        0 -> \"zero\"\n        _ -> \"other\"\n1", `test.ca:2:5: foo must return a int - got string`},
+			{"func foo(n:int) :int\n    s := \"a\"\n    s := n\n    s ++ \"b\"\n1", `test.ca:4:7: operator ++ is not defined on int and string`},
+			{`len(1)`, `test.ca:1:5: argument s of len must be a string - got int`},
+			{`len("a", "b")`, `test.ca:1:1: len expects 1 arguments - got 2`},
+			{`assert(1)`, `test.ca:1:8: argument condition of assert must be a bool - got int`},
+			{`join([1], ",")`, `test.ca:1:6: argument parts of join must be a [string] - got [int]`},
+			{`len(min(1, 2.5))`, `test.ca:1:5: argument s of len must be a string - got float`},
+			{`1.5 ++ "a"`, `test.ca:1:5: operator ++ is not defined on float and string`},
+			{`-"a"`, `test.ca:1:1: operator - expects a number - got string`},
+			{`1.5 == "1.5"`, `test.ca:1:5: can not compare float and string`},
+			{"func half(x:float) :float\n    x / 2\nhalf(3)", `test.ca:3:6: argument x of half must be a float - got int`},
+			{"func half(x:int) :int\n    x / 2.0\n1", `test.ca:2:5: half must return a int - got float`},
+			{shapes + "Circle(1, 2)", "test.ca:7:1: Circle expects 1 arguments - got 2"},
+			{shapes + "Circle(\"a\")", `test.ca:7:8: field r of Circle must be a int - got string`},
+			{shapes + "area(1)", "test.ca:7:6: argument s of area must be a Shape - got int"},
+			{shapes + "area(Circle(1)) ++ \"cm\"", "test.ca:7:17: operator ++ is not defined on int and string"},
+			{shapes + "match Circle(1)\n    Circle(r) -> r ++ \"cm\"\n    _ -> \"\"", "test.ca:8:20: operator ++ is not defined on int and string"},
+			{`[1, "a"]`, `test.ca:1:5: elements of the list must be a int - got string`},
+			{`[[1], ["a"]]`, `test.ca:1:7: elements of the list must be a [int] - got [string]`},
+			{`[1][true]`, `test.ca:1:5: index must be a int - got bool`},
+			{`"abc"[0]`, `test.ca:1:6: operator [] expects a list - got string`},
+			{`[1] == ["a"]`, `test.ca:1:5: can not compare [int] and [string]`},
+			{"func f(xs:[int]) :int\n    1\nf([\"a\"])", `test.ca:3:3: argument xs of f must be a [int] - got [string]`},
+			{"xs := [[1], []]\nxs[1] ++ \"a\"", `test.ca:2:7: operator ++ is not defined on [int] and string`},
+			// too many variables: the first one without a value
+			{divmod + "q, r, s := divmod(7, 2)", "test.ca:6:7: 3 variables for 2 values"},
+			// too many values: the tuple
+			{"a, b := (1, 2, 3)", "test.ca:1:9: 2 variables for 3 values"},
+			{"a, b := 1", "test.ca:1:9: 2 variables expect a tuple - got int"},
+			{divmod + "swap(1)", "test.ca:6:6: argument p of swap must be a (A, B) - got int"},
+			{"func f() :(int, int)\n    (1, \"a\")\nf()", "test.ca:2:5: f must return a (int, int) - got (int, string)"},
+			{`(1, 2) == (1, 2, 3)`, "test.ca:1:8: can not compare (int, int) and (int, int, int)"},
+			{divmod + "q, r := swap((1, \"a\"))\nq + r", "test.ca:7:3: operator + is not defined on string and int"},
+		}
+		for _, f := range fixtures {
+			_, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			assertRejected(assert, err, f.source, f.err)
+		}
+	})
+
+	t.Run("type errors on the globals of earlier inputs are found at runtime", func(t *testing.T) {
+		// like in the REPL, the checker does not know the types of the values of earlier inputs
+		i := New(&parser.Parser{})
+		inputs := []string{
+			`x := "a"`,
+			`xs := [1]`,
+			`t := (1, 2)`,
+			"func f(n:int) :int\n    n + 1",
+			"func g() :int\n    x",
+			"e := try\n    1 / 0\ncatch e\n    e",
+		}
+		for _, input := range inputs {
+			_, err := i.Interpret("test.ca", input)
+			if !assert.Nil(err, input) {
+				return
+			}
+		}
+
+		fixtures := []struct {
+			source  string
+			kind    ErrorKind
+			message string
+		}{
+			{`x + 1`, TypeError, `test.ca:1:3: type error: operator + is not defined on string and int`},
+			{`len(x) + x`, TypeError, `test.ca:1:8: type error: operator + is not defined on int and string`},
+			{`-x`, TypeError, `test.ca:1:1: type error: operator - expects a number - got string`},
+			{`!x`, TypeError, `test.ca:1:1: type error: operator ! expects a bool - got string`},
+			{`x == 1`, TypeError, `test.ca:1:3: type error: can not compare string and int`},
+			{`e + 1`, TypeError, `test.ca:1:3: type error: operator + is not defined on Error and int`},
+			{`xs[x]`, TypeError, `test.ca:1:4: type error: index must be a int - got string`},
+			{`x[0]`, TypeError, `test.ca:1:2: type error: operator [] expects a list - got string`},
+			{`[1, x]`, TypeError, `test.ca:1:5: type error: elements of the list must be a int - got string`},
+			{`a, b, c := t`, UnpackError, `test.ca:1:7: wrong number of values: 3 variables for 2 values`},
+			{`a, b := x`, TypeError, `test.ca:1:9: type error: 2 variables expect a tuple - got string`},
+			{`f(x)`, TypeError, `test.ca:1:3: type error: argument n of f must be a int - got string`},
+			{`g()`, TypeError, `test.ca:2:5: type error: g must return a int - got string`},
+		}
+		for _, f := range fixtures {
+			_, err := i.Interpret("test.ca", f.source)
+			if rerr, ok := err.(*RuntimeError); assert.True(ok, f.source) {
+				assert.Equal(f.kind, rerr.Kind, f.source)
+				assert.Equal(f.message, rerr.Error(), f.source)
+			}
+		}
+	})
+
+	t.Run("renders runtime errors with the source", func(t *testing.T) {
+		source := "func div(a:int, b:int) :int\n\ta / b\ndiv(1, 0)"
+		_, err := New(&parser.Parser{}).Interpret("test.ca", source)
+		rerr, ok := err.(*RuntimeError)
+		if !assert.True(ok) {
+			return
+		}
+
+		assert.Equal("test.ca:2:4: division by zero: 1 / 0\n"+
+			"    \ta / b\n"+
+			"    \t  ^\n"+
+			"    at div (test.ca:3:1)", rerr.Render(source))
+	})
+
+	t.Run("collapses the repeated frames of the traces", func(t *testing.T) {
+		source := "func loop(n:int) :int\n    loop(n + 1)\nloop(0)"
+		_, err := New(&parser.Parser{}).Interpret("test.ca", source)
+		rerr, ok := err.(*RuntimeError)
+		if !assert.True(ok) {
+			return
+		}
+		assert.Equal("test.ca:2:5: limit exceeded: more than 10000 nested calls\n"+
+			"        loop(n + 1)\n"+
+			"        ^\n"+
+			"    at loop (test.ca:2:5)\n"+
+			"    ... 9998 more frames of loop\n"+
+			"    at loop (test.ca:3:1)", rerr.Render(source))
+
+		// the frames of mutual recursions differ: only both ends of the stack are shown
+		source = "func ping(n:int) :int\n    pong(n)\nfunc pong(n:int) :int\n    ping(n)\nping(0)"
+		_, err = New(&parser.Parser{}, MaxDepth(100)).Interpret("test.ca", source)
+		rerr, ok = err.(*RuntimeError)
+		if !assert.True(ok) {
+			return
+		}
+		lines := strings.Split(rerr.Render(source), "\n")
+		if assert.Len(lines, 3+maxTraceFrames+1) {
+			assert.Equal("    at pong (test.ca:2:5)", lines[3])
+			assert.Equal("    ... 80 more frames", lines[3+maxTraceFrames/2])
+			assert.Equal("    at ping (test.ca:5:1)", lines[len(lines)-1])
+		}
+	})
+
+	t.Run("integers", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			result string
+		}{
+			// promotion to big integers
+			{`9223372036854775807 + 1`, `9223372036854775808`},
+			{`-9223372036854775807 - 2`, `-9223372036854775809`},
+			{`4294967296 * 4294967296`, `18446744073709551616`},
+			{`-(-9223372036854775807 - 1)`, `9223372036854775808`},
+			{`(-9223372036854775807 - 1) / -1`, `9223372036854775808`},
+			{`99999999999999999999999 - 99999999999999999998999`, `1000`},
+			{`99999999999999999999999 / 99999999999999999999999`, `1`},
+			{`99999999999999999999 == 99999999999999999999`, `true`},
+			{`99999999999999999999 == 99999999999999999998`, `false`},
+			{`(9223372036854775807 + 1) - 1 == 9223372036854775807`, `true`},
+			// exact powers
+			{`2^64`, `18446744073709551616`},
+			{`3^40`, `12157665459056928801`},
+			{`2^53 + 1`, `9007199254740993`},
+			{`(-2)^3`, `-8`},
+			{`2^0`, `1`},
+			{`0^0`, `1`},
+			// negative exponents truncate toward zero, like divisions
+			{`2^-1`, `0`},
+			{`1^-5`, `1`},
+			{`(-1)^-3`, `-1`},
+			{`(-1)^-4`, `1`},
+			{`(-1)^99999999999999999999`, `-1`},
+			{`7 / -2`, `-3`},
+		}
+
+		for _, f := range fixtures {
+			result, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.result, result, f.source)
+		}
+
+		errors := []struct {
+			source string
+			kind   ErrorKind
+		}{
+			{`0^-1`, DivisionByZero},
+			{`99999999999999999999 / 0`, DivisionByZero},
+			{`2^99999999999999999999`, Overflow},
+			// the powers too large to be computed in a reasonable time fail fast
+			{`3 ^ 1000000000`, Overflow},
+			{`pow(3, 100000000)`, Overflow},
+		}
+		for _, f := range errors {
+			// a program that does not fail fast is canceled instead
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			_, err := New(&parser.Parser{}).InterpretContext(ctx, "test.ca", f.source)
+			cancel()
+			if rerr, ok := err.(*RuntimeError); assert.True(ok, f.source) {
+				assert.Equal(f.kind, rerr.Kind, f.source)
+			}
+		}
+	})
+
+	t.Run("checked arithmetic", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			pos    string
+		}{
+			{`9223372036854775807 + 1`, `test.ca:1:21`},
+			{`-9223372036854775807 - 2`, `test.ca:1:22`},
+			{`4294967296 * 4294967296`, `test.ca:1:12`},
+			{`-(-9223372036854775807 - 1)`, `test.ca:1:1`},
+			{`2^64`, `test.ca:1:2`},
+			{`99999999999999999999`, `test.ca:1:1`},
+		}
+
+		for _, f := range fixtures {
+			_, err := New(&parser.Parser{}, CheckedArithmetic()).Interpret("test.ca", f.source)
+			rerr, ok := err.(*RuntimeError)
+			if !assert.True(ok, f.source) {
+				continue
+			}
+			assert.Equal(Overflow, rerr.Kind, f.source)
+			assert.Equal(f.pos, formatPos(rerr.Pos), f.source)
+		}
+
+		result, err := New(&parser.Parser{}, CheckedArithmetic()).Interpret("test.ca", `9223372036854775806 + 1`)
+		assert.Nil(err)
+		assert.Equal("9223372036854775807", result)
+	})
+
+	t.Run("interpolations", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			result string
+		}{
+			{"name := \"Bob\"\nage := 41\n\"hello ${name}, you are ${age + 1}\"", `hello Bob, you are 42`},
+			{`"${1.5 * 2} ${true} ${"nested ${1}"}"`, `3.0 true nested 1`},
+			{`"${2^64}"`, `18446744073709551616`},
+			{`"\${x}"`, `${x}`},
+			{"func greet(name:string) :string\n    \"hello ${name}\"\ngreet(\"you\") ++ \"!\"", `hello you!`},
+		}
+
+		for _, f := range fixtures {
+			result, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.result, result, f.source)
+		}
+	})
+
+	t.Run("builtins", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			result string
+		}{
+			{`str(12) ++ str(1.5) ++ str(true)`, `121.5true`},
+			{`int(-2.7)`, `-2`},
+			{`int(1e20)`, `100000000000000000000`},
+			{`int(3)`, `3`},
+			{`float(3)`, `3.0`},
+			{`parseInt("-42") + 1`, `-41`},
+			{`parseInt("99999999999999999999")`, `99999999999999999999`},
+			{`len("héllo")`, `5`},
+			{`upper("abc") ++ lower("DEF")`, `ABCdef`},
+			{`trim("  a b  ")`, `a b`},
+			{`split("a,b,c", ",")`, `["a", "b", "c"]`},
+			{`join(split("a,b,c", ","), "-")`, `a-b-c`},
+			{`split("a,b", ",") == split("a,b", ",")`, `true`},
+			{`contains("hello", "ell")`, `true`},
+			{`replace("a-b-c", "-", "+")`, `a+b+c`},
+			{`substr("héllo", 1, 3)`, `éll`},
+			{`abs(-3) + abs(3)`, `6`},
+			{`abs(-9223372036854775807 - 1)`, `9223372036854775808`},
+			{`abs(-1.5)`, `1.5`},
+			{`min(3, 2)`, `2`},
+			{`max(3, 2.5)`, `3.0`},
+			{`pow(2, 64)`, `18446744073709551616`},
+			{`pow(2, -1)`, `0`},
+			{`pow(4, 0.5)`, `2.0`},
+			{`assert(1 + 1 == 2) && assertEqual([1, 2], [1, 2]) && assertEqual(1, 1.0)`, `true`},
+			// cairn functions take precedence over builtins
+			{"func len(s:string) :int\n    42\nlen(\"a\")", `42`},
+		}
+
+		for _, f := range fixtures {
+			result, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.result, result, f.source)
+		}
+
+		errors := []struct {
+			source string
+			kind   ErrorKind
+			pos    string
+		}{
+			{`1 + parseInt("abc")`, ValueError, `test.ca:1:5`},
+			{`substr("abc", 2, 2)`, IndexError, `test.ca:1:1`},
+			{`int(1e308 * 10)`, ValueError, `test.ca:1:1`},
+			{`pow(0, -1)`, DivisionByZero, `test.ca:1:1`},
+			{`pow(2.0, 1000000)`, Overflow, `test.ca:1:1`},
+			{`pow(0.0, -1)`, DivisionByZero, `test.ca:1:1`},
+			{`1 + 2.0 ^ 1024`, Overflow, `test.ca:1:9`},
+			{`a := println("a")`, TypeError, `test.ca:1:6`},
+			{"x := 1\nassert(x == 2)", AssertionFailed, `test.ca:2:1`},
+		}
+		for _, f := range errors {
+			_, err := New(&parser.Parser{}, Stdout(&bytes.Buffer{})).Interpret("test.ca", f.source)
+			if rerr, ok := err.(*RuntimeError); assert.True(ok, f.source) {
+				assert.Equal(f.kind, rerr.Kind, f.source)
+				assert.Equal(f.pos, formatPos(rerr.Pos), f.source)
+			}
+		}
+
+		assertions := []struct {
+			source  string
+			message string
+		}{
+			{`assert(false)`, `assert: expected true - got false`},
+			{`assertEqual(3, 1 + 1)`, `assertEqual: expected 3 - got 2`},
+			{`assertEqual("a", "b")`, `assertEqual: expected "a" - got "b"`},
+			{`assertEqual(["a"], [])`, `assertEqual: expected ["a"] - got []`},
+			{`assertEqual(1, "1")`, `assertEqual: expected int 1 - got string "1"`},
+		}
+		for _, f := range assertions {
+			_, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if rerr, ok := err.(*RuntimeError); assert.True(ok, f.source) {
+				assert.Equal(AssertionFailed, rerr.Kind, f.source)
+				assert.Equal(f.message, rerr.Message, f.source)
+			}
+		}
+
+		_, err := New(&parser.Parser{}, CheckedArithmetic()).Interpret("test.ca", `pow(2, 64)`)
+		if rerr, ok := err.(*RuntimeError); assert.True(ok) {
+			assert.Equal(Overflow, rerr.Kind)
+		}
+	})
+
+	t.Run("prints to the configured writer", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		result, err := New(&parser.Parser{}, Stdout(out)).Interpret("test.ca", "print(\"a\")\nprintln(1.5)\nprintln(split(\"b c\", \" \"))")
+		assert.Nil(err)
+		assert.Equal("", result)
+		assert.Equal("a1.5\n[\"b\", \"c\"]\n", out.String())
+	})
+
+	t.Run("types", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			typ    string
+		}{
+			{`len`, `func len(s:string) :int`},
+			{`replace`, `func replace(s:string, old:string, new:string) :string`},
+			{`min`, `func min(a:number, b:number) :number`},
+			{"func add(a:int, b:int) :int\n    a + b\nadd", `func add(a:int, b:int) :int`},
+			{`1 + 2.5`, `float`},
+			{`split("a", ",")`, `[string]`},
+			{`println`, `func println(value:any) :nothing`},
+			{"func first[T](xs:[T]) :T\n    xs[0]\nfirst", `func first[T](xs:[T]) :T`},
+			{"type Pair[A, B] = Pair(first:A, second:[B])\nPair", `func Pair[A, B](first:A, second:[B]) :Pair[A, B]`},
+			{`[[1], []]`, `[[int]]`},
+			{`[]`, `[_]`},
+		}
+
+		for _, f := range fixtures {
+			i := New(&parser.Parser{})
+			typ, err := i.TypeOf("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.typ, typ, f.source)
+		}
+	})
+
+	t.Run("floats", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			result string
+		}{
+			{`3.14`, `3.14`},
+			{`1_000.5`, `1000.5`},
+			{`1e9`, `1000000000.0`},
+			{`1e21`, `1e+21`},
+			{`2.5e-5`, `2.5e-05`},
+			{`0.1 + 0.2`, `0.30000000000000004`},
+			{`-1.5`, `-1.5`},
+			{`+1.5`, `1.5`},
+			{`1.5 * 2.0`, `3.0`},
+			{`2.0 ^ 0.5`, `1.4142135623730951`},
+			{`1e308 * 10`, `+Inf`},
+			// integers are promoted to floats
+			{`1 + 0.5`, `1.5`},
+			{`7 / 2.0`, `3.5`},
+			{`7 / 2`, `3`},
+			{`2 ^ -1.0`, `0.5`},
+			{`9223372036854775807 * 2 + 0.5`, `18446744073709552000.0`},
+			{`1 == 1.0`, `true`},
+			{`1.5 != 1`, `true`},
+			{`9007199254740993 == 9007199254740992.0`, `false`},
+			{"func half(x:float) :float\n    x / 2\nhalf(3.0)", `1.5`},
+		}
+
+		for _, f := range fixtures {
+			result, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.result, result, f.source)
+		}
+
+		errors := []struct {
+			source string
+			kind   ErrorKind
+		}{
+			{`1.5 / 0`, DivisionByZero},
+			{`1 / 0.0`, DivisionByZero},
+			{`1e400`, Overflow},
+		}
+		for _, f := range errors {
+			_, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if rerr, ok := err.(*RuntimeError); assert.True(ok, f.source) {
+				assert.Equal(f.kind, rerr.Kind, f.source)
+			}
+		}
+	})
+
+	t.Run("modules", func(t *testing.T) {
+		files := map[string]string{
+			"util.cairn":        "import \"lib/counter\"\nfunc Greet(name:string) :string\n    Prefix ++ name ++ suffix\nfunc Count() :int\n    counter.Next()\nPrefix := \"> \"\nsuffix := \"!\"\nprintln(\"util loaded\")",
+			"lib/counter.cairn": "func Next() :int\n    Start + 1\nfunc hidden() :int\n    0\nfunc Fail() :int\n    1 / 0\nStart := 41",
+		}
+		newInterpreter := func(out *bytes.Buffer) *Interpreter {
+			loader := modules.NewLoader()
+			loader.ReadFile = func(path string) ([]byte, error) {
+				source, ok := files[path]
+				if !ok {
+					return nil, os.ErrNotExist
+				}
+				return []byte(source), nil
+			}
+			return New(&parser.Parser{}, Stdout(out), Loader(loader))
+		}
+
+		fixtures := []struct {
+			source string
+			result string
+		}{
+			{"import \"util\"\nutil.Greet(\"bob\")", `> bob!`},
+			{"import \"util\"\nutil.Prefix", `> `},
+			{"import \"util\"\nutil.Count()", `42`},
+			{"import \"lib/counter\"\nStart := 1\ncounter.Start + Start", `42`},
+			// functions of the importing file do not leak into modules
+			{"import \"lib/counter\"\nfunc Next() :int\n    0\ncounter.Next() + Next()", `42`},
+		}
+
+		for _, f := range fixtures {
+			out := &bytes.Buffer{}
+			result, err := newInterpreter(out).Interpret("main.cairn", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.result, result, f.source)
+		}
+
+		t.Run("initializes modules once", func(t *testing.T) {
+			out := &bytes.Buffer{}
+			i := newInterpreter(out)
+			for _, source := range []string{"import \"util\"\n1", "import \"util\"\nimport \"lib/counter\"\n2"} {
+				_, err := i.Interpret("main.cairn", source)
+				assert.Nil(err)
+			}
+			assert.Equal("util loaded\n", out.String())
+		})
+
+		errors := []struct {
+			source string
+			kind   ErrorKind
+			pos    string
+		}{
+			{"import \"util\"\nutil.suffix", UnknownIdentifier, "main.cairn:2:1"},
+			{"import \"util\"\nutil.Missing", UnknownIdentifier, "main.cairn:2:1"},
+			{"import \"util\"\ncounter.Start", UnknownIdentifier, "main.cairn:2:1"},
+			{"import \"lib/counter\"\ncounter.hidden()", UnknownFunction, "main.cairn:2:1"},
+			{"import \"lib/counter\"\ncounter.Missing()", UnknownFunction, "main.cairn:2:1"},
+			{"import \"lib/counter\"\nNext()", UnknownFunction, "main.cairn:2:1"},
+			{"import \"lib/counter\"\ncounter.Fail()", DivisionByZero, "lib/counter.cairn:6:7"},
+		}
+		for _, f := range errors {
+			_, err := newInterpreter(&bytes.Buffer{}).Interpret("main.cairn", f.source)
+			if rerr, ok := err.(*RuntimeError); assert.True(ok, f.source) {
+				assert.Equal(f.kind, rerr.Kind, f.source)
+				assert.Equal(f.pos, formatPos(rerr.Pos), f.source)
+			}
+		}
+
+		_, err := newInterpreter(&bytes.Buffer{}).Interpret("main.cairn", "import \"missing\"\n1")
+		assert.IsType(&tokens.Error{}, err)
+
+		// the calls of imported functions are checked before running
+		_, err = newInterpreter(&bytes.Buffer{}).Interpret("main.cairn", "import \"lib/counter\"\ncounter.Next(1)")
+		assertRejected(assert, err, "counter.Next(1)", "main.cairn:2:1: counter.Next expects 0 arguments - got 1")
+	})
+
+	t.Run("sum types", func(t *testing.T) {
+		const lists = "type List = Nil | Cons(head:int, tail:List)\n" +
+			"func sum(l:List) :int\n" +
+			"    match l\n" +
+			"        Nil -> 0\n" +
+			"        Cons(h, t) -> h + sum(t)\n"
+
+		fixtures := []struct {
+			source string
+			result string
+		}{
+			{shapes + "area(Circle(2)) + area(Rect(2, 5))", `22`},
+			{shapes + "area(Empty)", `0`},
+			{shapes + "Rect(1, 2)", `Rect(1, 2)`},
+			{shapes + "Empty", `Empty`},
+			{lists + "sum(Cons(1, Cons(2, Cons(3, Nil))))", `6`},
+			{"type Opt = None | Some(v:string)\nSome(\"a\")", `Some("a")`},
+			{"type Color = Red | Green\nRed == Green", `false`},
+			{"type Color = Red | Green\nRed == Red", `true`},
+			{"match 3\n    1 -> \"one\"\n    n -> \"many ${n}\"", `many 3`},
+			{"match \"b\"\n    \"a\" -> 1\n    _ -> 2", `2`},
+			{"match -1\n    -1 -> \"minus one\"\n    _ -> \"other\"", `minus one`},
+			{"match !false\n    true -> \"yes\"\n    false -> \"no\"", `yes`},
+			{"match 1.5\n    1 -> \"int\"\n    _ -> \"other\"", `other`},
+			{"type Opt = None | Some(v:int)\nmatch Some(2)\n    Some(1) -> 1\n    Some(x) ->\n        y := x * 10\n        y + 1\n    None -> 0", `21`},
+		}
+
+		for _, f := range fixtures {
+			result, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.result, result, f.source)
+		}
+
+		errors := []struct {
+			source string
+			kind   ErrorKind
+			pos    string
+		}{
+			{shapes + "Circle", ArityError, "test.ca:7:1"},
+		}
+		for _, f := range errors {
+			_, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if rerr, ok := err.(*RuntimeError); assert.True(ok, f.source) {
+				assert.Equal(f.kind, rerr.Kind, f.source)
+				assert.Equal(f.pos, formatPos(rerr.Pos), f.source)
+			}
+		}
+
+		// matches that are not exhaustive are rejected before running
+		_, err := New(&parser.Parser{}).Interpret("test.ca", shapes+"match Empty\n    Empty -> 0")
+		if assert.IsType(checker.Errors{}, err) {
+			assert.Equal("test.ca:7:1: match is not exhaustive: Circle(_) is not covered", err.Error())
+		}
+
+		typ, err := New(&parser.Parser{}).TypeOf("test.ca", shapes+"Rect")
+		if assert.Nil(err) {
+			assert.Equal("func Rect(w:int, h:int) :Shape", typ)
+		}
+	})
+
+	t.Run("lists", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			result string
+		}{
+			{`[1, 2, 3]`, `[1, 2, 3]`},
+			{`["a", "b"][1]`, `b`},
+			{`[[1, 2], [3]][0][1]`, `2`},
+			{`[]`, `[]`},
+			{`[[], [1]]`, `[[], [1]]`},
+			{`[1, 2] == [1, 2]`, `true`},
+			{`[] == [1]`, `false`},
+			{`join([], ",")`, ``},
+			{`join(split("a,b", ","), "-")`, `a-b`},
+			{"func second(xs:[int]) :int\n    xs[1]\nsecond([4, 5])", `5`},
+		}
+
+		for _, f := range fixtures {
+			result, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.result, result, f.source)
+		}
+
+		errors := []struct {
+			source string
+			kind   ErrorKind
+			pos    string
+		}{
+			{`[1, 2][2]`, IndexError, "test.ca:1:8"},
+			{`[1, 2][-1]`, IndexError, "test.ca:1:8"},
+		}
+		for _, f := range errors {
+			_, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if rerr, ok := err.(*RuntimeError); assert.True(ok, f.source) {
+				assert.Equal(f.kind, rerr.Kind, f.source)
+				assert.Equal(f.pos, formatPos(rerr.Pos), f.source)
+			}
+		}
+	})
+
+	t.Run("generics", func(t *testing.T) {
+		const decls = "type Option[T] = None | Some(value:T)\n" +
+			"type List[T] = Nil | Cons(head:T, tail:List[T])\n" +
+			"type Pair[A, B] = Pair(first:A, second:B)\n" +
+			"func first[T](xs:[T]) :T\n" +
+			"    xs[0]\n" +
+			"func same[T](a:T, b:T) :bool\n" +
+			"    a == b\n" +
+			"func unwrap[T](o:Option[T], default:T) :T\n" +
+			"    match o\n" +
+			"        Some(v) -> v\n" +
+			"        None -> default\n" +
+			"func length[T](l:List[T]) :int\n" +
+			"    match l\n" +
+			"        Nil -> 0\n" +
+			"        Cons(_, tail) -> 1 + length(tail)\n" +
+			"func swap[A, B](p:Pair[A, B]) :Pair[B, A]\n" +
+			"    match p\n" +
+			"        Pair(a, b) -> Pair(b, a)\n"
+
+		fixtures := []struct {
+			source string
+			result string
+		}{
+			{decls + `first([1, 2, 3])`, `1`},
+			{decls + `first(["a"]) ++ "b"`, `ab`},
+			{decls + `first([[1], []])`, `[1]`},
+			{decls + `same(1, 2)`, `false`},
+			{decls + `same([], [1])`, `false`},
+			{decls + `unwrap(Some(3), 0)`, `3`},
+			{decls + `unwrap(None, "none")`, `none`},
+			{decls + `length(Cons("a", Cons("b", Nil)))`, `2`},
+			{decls + `swap(Pair(1, "one"))`, `Pair("one", 1)`},
+			{decls + `Some([])`, `Some([])`},
+			{decls + `Some(None) == Some(Some(1))`, `false`},
+		}
+
+		for _, f := range fixtures {
+			result, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.result, result, f.source)
+		}
+
+		typeFixtures := []struct {
+			source string
+			typ    string
+		}{
+			{decls + `Some(1)`, `Option[int]`},
+			{decls + `None`, `Option[_]`},
+			{decls + `Cons([], Nil)`, `List[[_]]`},
+			{decls + `swap(Pair(1, "one"))`, `Pair[string, int]`},
+		}
+		for _, f := range typeFixtures {
+			typ, err := New(&parser.Parser{}).TypeOf("test.ca", f.source)
+			if assert.Nil(err, f.source) {
+				assert.Equal(f.typ, typ, f.source)
+			}
+		}
+
+		_, err := New(&parser.Parser{}).Interpret("test.ca", "func f[T](x:T) :Box[T]\n    x\n1")
+		if rerr, ok := err.(*RuntimeError); assert.True(ok) {
+			assert.Equal(TypeError, rerr.Kind)
+			assert.Equal(`unknown type Box`, rerr.Message)
+		}
+
+		// the type arguments are inferred by the checker, and a type parameter only matches itself
+		// in the body of its function
+		rejected := []struct {
+			source string
+			err    string
+		}{
+			{decls + `same(1, "a")`, `test.ca:19:9: argument b of same must be a T = int - got string`},
+			{decls + `same([1], ["a"])`, `test.ca:19:11: argument b of same must be a T = [int] - got [string]`},
+			{decls + `first(1)`, `test.ca:19:7: argument xs of first must be a [T] - got int`},
+			{decls + `unwrap(Some(1), "x")`, `test.ca:19:17: argument default of unwrap must be a T = int - got string`},
+			{decls + `length(Some(1))`, `test.ca:19:8: argument l of length must be a List[T] - got Option[int]`},
+			{decls + `Cons(1, Cons("a", Nil))`, `test.ca:19:9: field tail of Cons must be a List[T] = List[int] - got List[string]`},
+			{decls + `first(["a"]) + 1`, `test.ca:19:14: operator + is not defined on string and int`},
+			{decls + `unwrap(Some(1), 0) ++ "a"`, `test.ca:19:20: operator ++ is not defined on int and string`},
+			{"func wrong[T](x:T) :T\n    1\nwrong(1)", `test.ca:2:5: wrong must return a T - got int`},
+			{"func add[T](x:T, y:T) :T\n    x + y\nadd(1, 2)", `test.ca:2:7: operator + is not defined on T and T`},
+			{"func pair[A, B](a:A, b:B) :(A, B)\n    (b, a)\n1", `test.ca:2:5: pair must return a (A, B) - got (B, A)`},
+			{"func f[T](x:T) :[T]\n    [x, 1]\n1", `test.ca:2:9: elements of the list must be a T - got int`},
+			{"func f[T](x:T) :int\n    g(x)\nfunc g(n:int) :int\n    n\n1", `test.ca:2:7: argument n of g must be a int - got T`},
+		}
+		for _, f := range rejected {
+			_, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			assertRejected(assert, err, f.source, f.err)
+		}
+
+		// type parameters that can not be inferred are rejected before running
+		_, err = New(&parser.Parser{}).Interpret("test.ca", "func empty[T]() :[T]\n    []\nempty()")
+		assert.IsType(checker.Errors{}, err)
+	})
+
+	t.Run("tuples", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			result string
+		}{
+			{`(1, "a")`, `(1, "a")`},
+			{`((1, 2), [3])`, `((1, 2), [3])`},
+			{`(1 + 2)`, `3`},
+			{divmod + "q, r := divmod(7, 2)\nq * 10 + r", `31`},
+			{divmod + "_, r := divmod(7, 2)\nr", `1`},
+			{divmod + "swap((1, \"a\"))", `("a", 1)`},
+			{"a, b := (1, (2, 3))\nc, d := b\na + c + d", `6`},
+			{`(1, "a") == (1, "a")`, `true`},
+			{`(1, []) != (1, [2])`, `true`},
+		}
+
+		for _, f := range fixtures {
+			result, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.result, result, f.source)
+		}
+
+		typ, err := New(&parser.Parser{}).TypeOf("test.ca", divmod+"divmod")
+		if assert.Nil(err) {
+			assert.Equal("func divmod(a:int, b:int) :(int, int)", typ)
+		}
+	})
+
+	t.Run("try", func(t *testing.T) {
+		const check = "func check(n:int) :int\n" +
+			"    match n == 0\n" +
+			"        true -> fail(\"zero\")\n" +
+			"        false -> n\n"
+
+		fixtures := []struct {
+			source string
+			result string
+		}{
+			{"try\n    1 + 1\ncatch e\n    0", `2`},
+			{"try\n    1 / 0\ncatch e\n    message(e)", `1 / 0`},
+			{"try\n    [1][3]\ncatch e\n    kind(e)", `index out of range`},
+			{"try\n    parseInt(\"a\")\ncatch e\n    message(e)", `parseInt: "a" is not an integer`},
+			{"try\n    parseInt(\"a\")\ncatch e\n    e", `Error(test.ca:2:5: invalid value: parseInt: "a" is not an integer)`},
+			{"try\n    foo\ncatch _\n    -1", `-1`},
+			// errors raised by called functions are caught, and the call stack is unwound
+			{check + "try\n    check(0)\ncatch e\n    kind(e) ++ \" \" ++ message(e) ++ \" at \" ++ position(e)", `failure zero at test.ca:3:17`},
+			{check + "x := try\n    check(0)\ncatch e\n    0\nx + check(2)", `2`},
+			// nested try expressions
+			{"try\n    try\n        1 / 0\n    catch e\n        fail(\"again\")\ncatch e\n    message(e)", `again`},
+			// errors can be passed to functions
+			{"func describe(e:Error) :string\n    kind(e)\ntry\n    1 / 0\ncatch e\n    describe(e)", `division by zero`},
+			// the body may fail after it assigned a variable
+			{"x := \"a\"\ntry\n    x := 1\n    1 / 0\ncatch e\n    x + 1", `2`},
+		}
+
+		for _, f := range fixtures {
+			result, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.result, result, f.source)
+		}
+
+		// errors of the handler and uncaught failures abort the program
+		errors := []struct {
+			source string
+			kind   ErrorKind
+			pos    string
+		}{
+			{check + "check(0)", Failure, "test.ca:3:17"},
+		}
+		for _, f := range errors {
+			_, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if rerr, ok := err.(*RuntimeError); assert.True(ok, f.source) {
+				assert.Equal(f.kind, rerr.Kind, f.source)
+				assert.Equal(f.pos, formatPos(rerr.Pos), f.source)
+			}
+		}
+
+		// the handler gets an Error
+		_, err := New(&parser.Parser{}).Interpret("test.ca", "try\n    1 / 0\ncatch e\n    e / 2")
+		assertRejected(assert, err, "e / 2", "test.ca:4:7: operator / is not defined on Error and int")
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		const loop = "func loop(n:int) :int\n    loop(n + 1)\n"
+		const double = "func double(s:string) :string\n    double(s ++ s)\n"
+
+		fixtures := []struct {
+			options []Option
+			source  string
+			pos     string
+			message string
+		}{
+			{[]Option{MaxSteps(100)}, loop + "loop(0)", "test.ca:2:5", "more than 100 evaluation steps"},
+			{nil, loop + "loop(0)", "test.ca:2:5", "more than 10000 nested calls"},
+			{[]Option{MaxDepth(10)}, loop + "loop(0)", "test.ca:2:5", "more than 10 nested calls"},
+			{[]Option{MaxSize(100)}, double + "double(\"ab\")", "test.ca:2:14", "string of 128 bytes is larger than 100 bytes"},
+			{[]Option{MaxSize(2)}, `[1, 2, 3]`, "test.ca:1:1", "list of 3 elements is larger than 2 elements"},
+			{[]Option{MaxSize(2)}, `split("a b c", " ")`, "test.ca:1:1", "list of 3 elements is larger than 2 elements"},
+			{[]Option{MaxAllocations(1000)}, double + "double(\"ab\")", "test.ca:2:14", "more than 1000 bytes allocated"},
+			{[]Option{MaxSize(1000)}, "2 ^ 100000", "test.ca:1:3", "integer of 25000 bytes is larger than 1000 bytes"},
+			{[]Option{MaxAllocations(1000)}, "pow(3, 10000)", "test.ca:1:1", "more than 1000 bytes allocated"},
+			{[]Option{MaxSize(10)}, `replace("abc", "b", "0123456789")`, "test.ca:1:1", "string of 12 bytes is larger than 10 bytes"},
+			{[]Option{MaxSize(10)}, `join(["abc", "def"], "0123456789")`, "test.ca:1:1", "string of 16 bytes is larger than 10 bytes"},
+			{[]Option{MaxSize(2)}, `split("abc", "")`, "test.ca:1:1", "list of 3 elements is larger than 2 elements"},
+			// limits can not be caught
+			{[]Option{MaxDepth(10)}, loop + "try\n    loop(0)\ncatch e\n    0", "test.ca:2:5", "more than 10 nested calls"},
+		}
+
+		for _, f := range fixtures {
+			_, err := New(&parser.Parser{}, f.options...).Interpret("test.ca", f.source)
+			if rerr, ok := err.(*RuntimeError); assert.True(ok, f.source) {
+				assert.Equal(LimitExceeded, rerr.Kind, f.source)
+				assert.Equal(f.pos, formatPos(rerr.Pos), f.source)
+				assert.Equal(f.message, rerr.Message, f.source)
+			}
+		}
+
+		// the values exceeding the limits are not built: the programs fail fast
+		s := "s := \"" + strings.Repeat("a", 1<<15) + "\"\n"
+		for _, source := range []string{`replace(s, "a", s)`, `join(split(s, ""), s)`, "3 ^ 1000000", "pow(3, 1000000)"} {
+			// a program that does not fail fast is canceled instead
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			_, err := New(&parser.Parser{}, MaxSize(1<<16), MaxAllocations(1<<20)).InterpretContext(ctx, "test.ca", s+source)
+			cancel()
+			if rerr, ok := err.(*RuntimeError); assert.True(ok, source) {
+				assert.Equal(LimitExceeded, rerr.Kind, source)
+			}
+		}
+
+		// each program has its own budget
+		i := New(&parser.Parser{}, MaxSteps(10))
+		for n := 0; n < 3; n++ {
+			result, err := i.Interpret("test.ca", "1 + 2 * 3")
+			assert.Nil(err)
+			assert.Equal("7", result)
+		}
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := New(&parser.Parser{}).InterpretContext(ctx, "test.ca", "func loop(n:int) :int\n    1 + loop(n + 1)\nloop(0)")
+		if rerr, ok := err.(*RuntimeError); assert.True(ok) {
+			assert.Equal(Canceled, rerr.Kind)
+			assert.Equal("context canceled", rerr.Message)
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		// a long computation that does not nest deeply
+		fib := "func fib(n:int) :int\n    match n\n        0 -> 0\n        1 -> 1\n        _ -> fib(n - 1) + fib(n - 2)\nfib(40)"
+		_, err = New(&parser.Parser{}).InterpretContext(ctx, "test.ca", fib)
+		if rerr, ok := err.(*RuntimeError); assert.True(ok) {
+			assert.Equal(Canceled, rerr.Kind)
+			assert.Equal("context deadline exceeded", rerr.Message)
+		}
+	})
+
+	t.Run("capabilities", func(t *testing.T) {
+		denied := []struct {
+			source  string
+			message string
+		}{
+			{`print(1)`, "print: stdout must be granted with interpreter.Stdout"},
+			{`readLine()`, "readLine: stdin must be granted with interpreter.Stdin"},
+			{`readFile("a.txt")`, "readFile: the file system must be granted with interpreter.Files"},
+			{`writeFile("a.txt", "a")`, "writeFile: the file system must be granted with interpreter.Files"},
+			{`now()`, "now: the clock must be granted with interpreter.Clock"},
+			{`random(6)`, "random: the random source must be granted with interpreter.Random"},
+			{"import \"../../secrets\"\n1", "import: modules must be granted with interpreter.Loader"},
+		}
+		for _, f := range denied {
+			_, err := New(&parser.Parser{}).Interpret("test.ca", f.source)
+			if rerr, ok := err.(*RuntimeError); assert.True(ok, f.source) {
+				assert.Equal(CapabilityError, rerr.Kind, f.source)
+				assert.Equal(f.message, rerr.Message, f.source)
+			}
+		}
+
+		files := fakeFiles{"in.txt": "hello"}
+		clock := func() time.Time { return time.Unix(1500000000, 0) }
+		expected := rand.New(rand.NewSource(1)).Int63n(6)
+		i := New(&parser.Parser{},
+			Stdin(strings.NewReader("first\r\nsecond")),
+			Files(files),
+			Clock(clock),
+			Random(rand.NewSource(1)),
+		)
+
+		fixtures := []struct {
+			source string
+			result string
+		}{
+			{`readLine() ++ "/" ++ readLine()`, `first/second`},
+			{"try\n    readLine()\ncatch e\n    message(e)", `readLine: end of input`},
+			{`writeFile("out.txt", upper(readFile("in.txt")))`, ``},
+			{`readFile("out.txt")`, `HELLO`},
+			{"try\n    readFile(\"missing.txt\")\ncatch e\n    message(e)", `readFile: can not read missing.txt: not found`},
+			{`now()`, `1500000000000`},
+			{`random(6)`, strconv.FormatInt(expected, 10)},
+			{"try\n    random(0)\ncatch e\n    message(e)", `random: 0 is not a positive int`},
+		}
+		for _, f := range fixtures {
+			result, err := i.Interpret("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.result, result, f.source)
+		}
+	})
+
+	t.Run("files are rooted at a directory", func(t *testing.T) {
+		root, err := ioutil.TempDir("", "cairn")
+		if !assert.Nil(err) {
+			return
+		}
+		defer os.RemoveAll(root)
+
+		fs := Dir(filepath.Join(root, "sandbox"))
+		if !assert.Nil(os.Mkdir(filepath.Join(root, "sandbox"), 0755)) {
+			return
+		}
+		// .. can not go above the root
+		assert.Nil(fs.WriteFile("../../escaped.txt", []byte("a")))
+		_, err = os.Stat(filepath.Join(root, "sandbox", "escaped.txt"))
+		assert.Nil(err)
+		_, err = os.Stat(filepath.Join(root, "escaped.txt"))
+		assert.True(os.IsNotExist(err))
+
+		data, err := fs.ReadFile("/escaped.txt")
+		assert.Nil(err)
+		assert.Equal("a", string(data))
+
+		// symbolic links are followed while they stay under the root
+		if !assert.Nil(ioutil.WriteFile(filepath.Join(root, "secret.txt"), []byte("s"), 0644)) {
+			return
+		}
+		links := map[string]string{
+			"inside.txt":   "escaped.txt",
+			"secret.txt":   filepath.Join(root, "secret.txt"),
+			"parent":       root,
+			"dangling":     filepath.Join(root, "created.txt"),
+			"relative.txt": "../secret.txt",
+		}
+		for name, target := range links {
+			if !assert.Nil(os.Symlink(target, filepath.Join(root, "sandbox", name))) {
+				return
+			}
+		}
+		data, err = fs.ReadFile("inside.txt")
+		assert.Nil(err)
+		assert.Equal("a", string(data))
+
+		for _, name := range []string{"secret.txt", "parent/secret.txt", "relative.txt"} {
+			_, err = fs.ReadFile(name)
+			assert.Equal(errOutsideRoot, err, name)
+		}
+		for _, name := range []string{"secret.txt", "parent/created.txt", "dangling"} {
+			assert.Equal(errOutsideRoot, fs.WriteFile(name, []byte("b")), name)
+		}
+		_, err = os.Stat(filepath.Join(root, "created.txt"))
+		assert.True(os.IsNotExist(err))
+		data, err = ioutil.ReadFile(filepath.Join(root, "secret.txt"))
+		assert.Nil(err)
+		assert.Equal("s", string(data))
+	})
+
+	t.Run("step hook", func(t *testing.T) {
+		lines := []int{}
+		stop := errors.New("stop")
+		hook := func(i *Interpreter, node ast.Node) error {
+			lines = append(lines, node.Pos().Line)
+			if node.Pos().Line == 5 {
+				return stop
+			}
+			return nil
+		}
+
+		source := "x := 1\nmatch x\n    1 ->\n        x + 1\n    _ -> 0\n"
+		result, err := New(&parser.Parser{}, OnStep(hook)).Interpret("test.ca", source)
+		if assert.Nil(err) {
+			assert.Equal("2", result)
+			assert.Equal([]int{1, 2, 4}, lines)
+		}
+
+		// an error of the hook stops the program
+		lines = []int{}
+		_, err = New(&parser.Parser{}, OnStep(hook)).Interpret("test.ca", "x := 2\nmatch x\n    1 -> 1\n    _ ->\n        0")
+		assert.Equal(stop, err)
+		assert.Equal([]int{1, 2, 5}, lines)
+	})
+}
+
+// fakeFiles is a file system held in memory
+type fakeFiles map[string]string
+
+func (f fakeFiles) ReadFile(name string) ([]byte, error) {
+	data, ok := f[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return []byte(data), nil
+}
+
+func (f fakeFiles) WriteFile(name string, data []byte) error {
+	f[name] = string(data)
+	return nil
+}
+
+// assertRejected asserts that the checker rejected a program before it ran
+func assertRejected(assert *assert.Assertions, err error, source, expected string) {
+	if assert.IsType(checker.Errors{}, err, source) {
+		assert.Equal(expected, err.Error(), source)
+	}
 }
@@ -0,0 +1,216 @@
+package interpreter
+
+import (
+	"errors"
+	"math"
+	"math/big"
+
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// BigInt is an integer too large to be stored in an Int.
+// Integers are promoted to BigInt when an operation overflows, and demoted back
+// to Int as soon as they fit again, so both share the int type.
+type BigInt struct {
+	*big.Int
+}
+
+// Type implements Value
+func (b BigInt) Type() string {
+	return "int"
+}
+
+// errOverflow is returned by integer operations in checked mode
+var errOverflow = errors.New("integer overflow")
+
+// errDivisionByZero is returned by integer operations dividing by zero
+var errDivisionByZero = errors.New("division by zero")
+
+// errExponentTooLarge is returned when a power can not be computed
+var errExponentTooLarge = errors.New("exponent too large")
+
+// toBig converts an integer value to a big.Int
+func toBig(v Value) *big.Int {
+	switch n := v.(type) {
+	case Int:
+		return big.NewInt(int64(n))
+	case BigInt:
+		return n.Int
+	default:
+		return nil
+	}
+}
+
+// normalize returns an Int when a big integer is small enough
+func normalize(n *big.Int) Value {
+	if n.IsInt64() {
+		return Int(n.Int64())
+	}
+	return BigInt{n}
+}
+
+// isInt tells whether a value is an integer, small or big
+func isInt(v Value) bool {
+	switch v.(type) {
+	case Int, BigInt:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseInt reads an integer literal
+func parseInt(literal string, checked bool) (Value, error) {
+	n, ok := new(big.Int).SetString(literal, 10)
+	if !ok {
+		return nil, errors.New("invalid integer literal " + literal)
+	}
+	return promote(n, checked)
+}
+
+// negate computes -a
+func negate(a Value, checked bool) (Value, error) {
+	if n, ok := a.(Int); ok && n != math.MinInt64 {
+		return -n, nil
+	}
+	return promote(new(big.Int).Neg(toBig(a)), checked)
+}
+
+// intOp applies an arithmetic operator to two integers.
+// Small integers are computed natively, and only promoted when the result overflows.
+func intOp(op tokens.TokenType, a, b Value, checked bool) (Value, error) {
+	x, xSmall := a.(Int)
+	y, ySmall := b.(Int)
+
+	if ySmall && y == 0 && op == tokens.DIV {
+		return nil, errDivisionByZero
+	}
+
+	if xSmall && ySmall {
+		switch op {
+		case tokens.PLUS:
+			r := x + y
+			if (x >= 0) == (y >= 0) && (r >= 0) != (x >= 0) {
+				break
+			}
+			return r, nil
+		case tokens.MINUS:
+			r := x - y
+			if (x >= 0) != (y >= 0) && (r >= 0) != (x >= 0) {
+				break
+			}
+			return r, nil
+		case tokens.MULT:
+			if x == 0 || y == 0 {
+				return Int(0), nil
+			}
+			r := x * y
+			if r/y != x || (x == -1 && y == math.MinInt64) || (y == -1 && x == math.MinInt64) {
+				break
+			}
+			return r, nil
+		case tokens.DIV:
+			if x == math.MinInt64 && y == -1 {
+				break
+			}
+			return x / y, nil
+		}
+	}
+
+	switch op {
+	case tokens.PLUS:
+		return promote(new(big.Int).Add(toBig(a), toBig(b)), checked)
+	case tokens.MINUS:
+		return promote(new(big.Int).Sub(toBig(a), toBig(b)), checked)
+	case tokens.MULT:
+		return promote(new(big.Int).Mul(toBig(a), toBig(b)), checked)
+	case tokens.DIV:
+		if toBig(b).Sign() == 0 {
+			return nil, errDivisionByZero
+		}
+		// Quo truncates toward zero like Go's native division
+		return promote(new(big.Int).Quo(toBig(a), toBig(b)), checked)
+	case tokens.POW:
+		return pow(toBig(a), toBig(b), checked)
+	default:
+		return nil, errors.New("unexpected integer operator " + string(op))
+	}
+}
+
+// pow computes base^exp exactly.
+// A negative exponent gives 1 / base^-exp, truncated toward zero like the division.
+func pow(base, exp *big.Int, checked bool) (Value, error) {
+	one := big.NewInt(1)
+
+	if exp.Sign() < 0 {
+		switch {
+		case base.Sign() == 0:
+			return nil, errDivisionByZero
+		case base.CmpAbs(one) != 0:
+			return Int(0), nil
+		case base.Sign() < 0 && exp.Bit(0) == 1:
+			// (-1)^odd
+			return Int(-1), nil
+		default:
+			return Int(1), nil
+		}
+	}
+
+	if base.CmpAbs(one) <= 0 {
+		// 0, 1 and -1 to any power do not grow
+		if exp.Sign() == 0 {
+			return Int(1), nil
+		}
+		if base.Sign() < 0 && exp.Bit(0) == 0 {
+			return Int(1), nil
+		}
+		return normalize(new(big.Int).Set(base)), nil
+	}
+
+	if _, ok := powBits(base, exp); !ok {
+		if checked {
+			return nil, errOverflow
+		}
+		return nil, errExponentTooLarge
+	}
+
+	// exponentiation by squaring
+	return promote(new(big.Int).Exp(base, exp, nil), checked)
+}
+
+// maxPowerBits bounds the size of the powers. big.Int.Exp can not be interrupted: a larger power
+// would run for seconds whatever the limits of the program
+const maxPowerBits = 1 << 22
+
+// powBits estimates the number of bits of base^exp, for a positive exponent.
+// It fails when the power would have more than maxPowerBits bits
+func powBits(base, exp *big.Int) (int, bool) {
+	if !exp.IsInt64() || exp.Int64() > maxPowerBits {
+		return 0, false
+	}
+	bits := int64(base.BitLen()) * exp.Int64()
+	return int(bits), bits <= maxPowerBits
+}
+
+// powSize estimates the size in bytes of the power of two integers, before it is computed.
+// It is 0 for the powers that do not grow, or that pow rejects
+func powSize(base, exp Value) int {
+	b, e := toBig(base), toBig(exp)
+	if e.Sign() <= 0 || b.CmpAbs(big.NewInt(1)) <= 0 {
+		return 0
+	}
+	bits, ok := powBits(b, e)
+	if !ok {
+		return 0
+	}
+	return bits / 8
+}
+
+// promote normalizes the result of an operation, or reports an overflow in checked mode
+func promote(n *big.Int, checked bool) (Value, error) {
+	result := normalize(n)
+	if _, isBig := result.(BigInt); isBig && checked {
+		return nil, errOverflow
+	}
+	return result, nil
+}
@@ -0,0 +1,181 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fchoquet/cairn/ast"
+)
+
+// DefaultMaxDepth is the number of nested function calls allowed by default.
+// It keeps deep recursions from exhausting the Go stack
+const DefaultMaxDepth = 10000
+
+// contextCheckInterval is the number of steps between two checks of the context
+const contextCheckInterval = 256
+
+// limits bound the resources used by a program. Zero means no limit
+type limits struct {
+	steps       int
+	depth       int
+	size        int
+	allocations int
+}
+
+// usage counts the resources used by the running program
+type usage struct {
+	steps       int
+	allocations int
+}
+
+// MaxSteps limits the number of evaluated nodes
+func MaxSteps(n int) Option {
+	return func(i *Interpreter) {
+		i.limits.steps = n
+	}
+}
+
+// MaxDepth limits the number of nested function calls. It defaults to DefaultMaxDepth.
+// Zero removes the limit: a deep recursion then crashes the host
+func MaxDepth(n int) Option {
+	return func(i *Interpreter) {
+		i.limits.depth = n
+	}
+}
+
+// MaxSize limits the length of strings and the size of integers in bytes, and the number of elements
+// of lists and tuples
+func MaxSize(n int) Option {
+	return func(i *Interpreter) {
+		i.limits.size = n
+	}
+}
+
+// MaxAllocations limits the total size of the values created by a program, roughly in bytes
+func MaxAllocations(n int) Option {
+	return func(i *Interpreter) {
+		i.limits.allocations = n
+	}
+}
+
+// start resets the budget of the program about to run
+func (i *Interpreter) start(ctx context.Context) {
+	i.ctx = ctx
+	i.usage = usage{}
+}
+
+// step counts the evaluation of a node. It stops the program when it runs out of steps,
+// or when its context is done
+func (i *Interpreter) step(node ast.Node) error {
+	i.usage.steps++
+	if i.limits.steps > 0 && i.usage.steps > i.limits.steps {
+		return i.errorf(node, LimitExceeded, "more than %d evaluation steps", i.limits.steps)
+	}
+	if i.usage.steps%contextCheckInterval == 0 {
+		if err := i.ctx.Err(); err != nil {
+			return i.errorf(node, Canceled, "%s", err)
+		}
+	}
+	return nil
+}
+
+// enter checks that a function call does not nest too deeply
+func (i *Interpreter) enter(node ast.Node) error {
+	if i.limits.depth > 0 && len(i.stack) >= i.limits.depth {
+		return i.errorf(node, LimitExceeded, "more than %d nested calls", i.limits.depth)
+	}
+	return nil
+}
+
+// allocate counts a value created by a node. It fails when the value is too large,
+// or when the program has created too many values
+func (i *Interpreter) allocate(node ast.Node, value Value) *RuntimeError {
+	if i.limits.size > 0 {
+		switch v := value.(type) {
+		case String:
+			if len(v) > i.limits.size {
+				return i.errorf(node, LimitExceeded, "string of %d bytes is larger than %d bytes", len(v), i.limits.size)
+			}
+		case *List:
+			if len(v.Values) > i.limits.size {
+				return i.errorf(node, LimitExceeded, "list of %d elements is larger than %d elements", len(v.Values), i.limits.size)
+			}
+		case *Tuple:
+			if len(v.Values) > i.limits.size {
+				return i.errorf(node, LimitExceeded, "tuple of %d elements is larger than %d elements", len(v.Values), i.limits.size)
+			}
+		case BigInt:
+			if size := sizeOf(v); size > i.limits.size {
+				return i.errorf(node, LimitExceeded, "integer of %d bytes is larger than %d bytes", size, i.limits.size)
+			}
+		}
+	}
+
+	i.usage.allocations += sizeOf(value)
+	if i.limits.allocations > 0 && i.usage.allocations > i.limits.allocations {
+		return i.errorf(node, LimitExceeded, "more than %d bytes allocated", i.limits.allocations)
+	}
+	return nil
+}
+
+// limitErrorf creates the error returned when a value would exceed the limits. It is located
+// by the caller
+func limitErrorf(format string, args ...interface{}) *RuntimeError {
+	return &RuntimeError{Kind: LimitExceeded, Message: fmt.Sprintf(format, args...)}
+}
+
+// reserveString checks that a string of n bytes can be created, before it is built
+func (i *Interpreter) reserveString(n int) *RuntimeError {
+	if i.limits.size > 0 && n > i.limits.size {
+		return limitErrorf("string of %d bytes is larger than %d bytes", n, i.limits.size)
+	}
+	return i.reserve(n)
+}
+
+// reserveList checks that a list of n elements can be created, before it is built
+func (i *Interpreter) reserveList(n int) *RuntimeError {
+	if i.limits.size > 0 && n > i.limits.size {
+		return limitErrorf("list of %d elements is larger than %d elements", n, i.limits.size)
+	}
+	return i.reserve(n * 8)
+}
+
+// reserveInt checks that an integer of n bytes can be created, before it is computed
+func (i *Interpreter) reserveInt(n int) *RuntimeError {
+	if i.limits.size > 0 && n > i.limits.size {
+		return limitErrorf("integer of %d bytes is larger than %d bytes", n, i.limits.size)
+	}
+	return i.reserve(n)
+}
+
+// reserve checks that a value of n bytes can be created without exceeding the allocation limit.
+// The value is counted by allocate once it is built. As building a large value takes time,
+// reserve also stops the program when its context is done
+func (i *Interpreter) reserve(n int) *RuntimeError {
+	if i.limits.allocations > 0 && i.usage.allocations+n > i.limits.allocations {
+		return limitErrorf("more than %d bytes allocated", i.limits.allocations)
+	}
+	if err := i.ctx.Err(); err != nil {
+		return &RuntimeError{Kind: Canceled, Message: err.Error()}
+	}
+	return nil
+}
+
+// sizeOf estimates the memory used by a new value. The values it holds already exist:
+// a list or a tuple only adds a reference per element
+func sizeOf(value Value) int {
+	switch v := value.(type) {
+	case String:
+		return len(v)
+	case BigInt:
+		return len(v.Int.Bits()) * 8
+	case *List:
+		return len(v.Values) * 8
+	case *Tuple:
+		return len(v.Values) * 8
+	case *Variant:
+		return len(v.Fields) * 8
+	default:
+		return 8
+	}
+}
@@ -0,0 +1,50 @@
+package interpreter
+
+import "github.com/fchoquet/cairn/ast"
+
+func (i *Interpreter) visitListLit(node *ast.ListLit) (Value, error) {
+	list := &List{Values: []Value{}}
+	var elem *rtype
+	for _, e := range node.Elements {
+		value, err := i.visit(e)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, i.errorf(e, TypeError, "%s has no value", e)
+		}
+
+		merged, ok := merge(elem, valueType(value))
+		if !ok {
+			return nil, i.errorf(e, TypeError, "elements of the list must be a %s - got %s", elem, value.Type())
+		}
+		elem = merged
+		list.Values = append(list.Values, value)
+	}
+	return list, nil
+}
+
+func (i *Interpreter) visitIndex(node *ast.Index) (Value, error) {
+	expr, err := i.visit(node.Expr)
+	if err != nil {
+		return nil, err
+	}
+	index, err := i.visit(node.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := expr.(*List)
+	if !ok {
+		return nil, i.errorf(node, TypeError, "operator [] expects a list - got %s", typeOf(expr))
+	}
+	if index == nil || !isInt(index) {
+		return nil, i.errorf(node.Index, TypeError, "index must be a int - got %s", typeOf(index))
+	}
+
+	n, ok := index.(Int)
+	if !ok || n < 0 || int64(n) >= int64(len(list.Values)) {
+		return nil, i.errorf(node.Index, IndexError, "index %s of a list of %d elements", index, len(list.Values))
+	}
+	return list.Values[n], nil
+}
@@ -0,0 +1,73 @@
+package interpreter
+
+import (
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/modules"
+)
+
+// module is the runtime state of a module
+type module struct {
+	functions map[string]*ast.FuncDecl
+	// scope is the name of the scope of the global variables of the module
+	scope string
+	// imports are the imported modules, indexed by name
+	imports map[string]*module
+	// types are the declared sum types, indexed by name
+	types map[string]*SumType
+	// constructors are the constructors of the sum types, indexed by name
+	constructors map[string]*SumType
+}
+
+func newModule(functions map[string]*ast.FuncDecl, scope string) *module {
+	return &module{
+		functions:    functions,
+		scope:        scope,
+		imports:      map[string]*module{},
+		types:        map[string]*SumType{},
+		constructors: map[string]*SumType{},
+	}
+}
+
+// importModules initializes the modules imported by a module, and makes them available to the importer
+func (i *Interpreter) importModules(importer *module, m *modules.Module) error {
+	for _, decl := range m.File.Imports {
+		imported, err := i.initModule(m.Imports[decl.Name])
+		if err != nil {
+			return err
+		}
+		importer.imports[decl.Name] = imported
+	}
+	return nil
+}
+
+// initModule runs the top level code of a module the first time it is imported
+func (i *Interpreter) initModule(m *modules.Module) (*module, error) {
+	if state, ok := i.modules[m.Path]; ok {
+		return state, nil
+	}
+
+	state := newModule(map[string]*ast.FuncDecl{}, "global:"+m.Path)
+	if err := i.importModules(state, m); err != nil {
+		return nil, err
+	}
+
+	importer := i.current
+	i.current = state
+	i.scopes = append(i.scopes, state.scope)
+	_, err := i.eval(m.File)
+	i.current = importer
+	if err != nil {
+		return nil, err
+	}
+
+	i.modules[m.Path] = state
+	return state, nil
+}
+
+// qualify prefixes a name with the name of its module, if any
+func qualify(module, name string) string {
+	if module == "" {
+		return name
+	}
+	return module + "." + name
+}
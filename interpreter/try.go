@@ -0,0 +1,22 @@
+package interpreter
+
+import "github.com/fchoquet/cairn/ast"
+
+// visitTry evaluates the body of a try expression. A runtime error raised by the body,
+// or by the functions it calls, is bound to the catch variable and the handler is evaluated instead
+func (i *Interpreter) visitTry(node *ast.Try) (Value, error) {
+	value, err := i.visit(node.Body)
+	rerr, ok := err.(*RuntimeError)
+	if !ok || !rerr.catchable() {
+		return value, err
+	}
+
+	if node.Variable.Name != "_" {
+		i.define(i.currentScope(), node.Variable.Name, Error{
+			Kind:    rerr.Kind,
+			Message: rerr.Message,
+			Pos:     rerr.Pos,
+		})
+	}
+	return i.visit(node.Handler)
+}
@@ -0,0 +1,48 @@
+package interpreter
+
+import "github.com/fchoquet/cairn/ast"
+
+func (i *Interpreter) visitTupleLit(node *ast.TupleLit) (Value, error) {
+	tuple := &Tuple{Values: []Value{}}
+	for _, e := range node.Elements {
+		value, err := i.visit(e)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, i.errorf(e, TypeError, "%s has no value", e)
+		}
+		tuple.Values = append(tuple.Values, value)
+	}
+	return tuple, nil
+}
+
+// visitDestructuring assigns the elements of a tuple to variables. When the numbers of
+// variables and values differ, the error is located at the side that has too many of them
+func (i *Interpreter) visitDestructuring(node *ast.Destructuring) (Value, error) {
+	right, err := i.visit(node.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	tuple, ok := right.(*Tuple)
+	if !ok {
+		return nil, i.errorf(node.Right, TypeError, "%d variables expect a tuple - got %s", len(node.Variables), typeOf(right))
+	}
+
+	variables, values := len(node.Variables), len(tuple.Values)
+	switch {
+	case variables > values:
+		return nil, i.errorf(node.Variables[values], UnpackError, "%d variables for %d values", variables, values)
+	case variables < values:
+		return nil, i.errorf(node.Right, UnpackError, "%d variables for %d values", variables, values)
+	}
+
+	for index, v := range node.Variables {
+		if v.Name == "_" {
+			continue
+		}
+		i.define(i.currentScope(), v.Name, tuple.Values[index])
+	}
+	return tuple, nil
+}
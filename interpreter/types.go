@@ -0,0 +1,214 @@
+package interpreter
+
+import (
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/modules"
+)
+
+// SumType is a type declared with its constructors, such as type Shape = Circle(r:int) | Rect(w:int, h:int)
+type SumType struct {
+	Name string
+	Decl *ast.TypeDecl
+}
+
+// constructor returns the declaration of a constructor of the type
+func (t *SumType) constructor(name string) *ast.Constructor {
+	for _, c := range t.Decl.Constructors {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Variant is a value of a sum type, built by one of its constructors
+type Variant struct {
+	Sum *SumType
+	// Args are the types bound to the type parameters of a generic type
+	Args        []*rtype
+	Constructor string
+	Fields      []Value
+}
+
+// Type implements Value
+func (v *Variant) Type() string {
+	return valueType(v).String()
+}
+
+func (v *Variant) String() string {
+	if len(v.Fields) == 0 {
+		return v.Constructor
+	}
+	fields := []string{}
+	for _, f := range v.Fields {
+		fields = append(fields, formatElement(f))
+	}
+	return v.Constructor + "(" + strings.Join(fields, ", ") + ")"
+}
+
+func (i *Interpreter) visitTypeDecl(node *ast.TypeDecl) (Value, error) {
+	// the type is declared first, so that its constructors may hold values of the type itself
+	t := &SumType{Name: node.Name.Value, Decl: node}
+	i.current.types[t.Name] = t
+	for _, c := range node.Constructors {
+		i.current.constructors[c.Name] = t
+	}
+
+	params := newBindings(node.Params)
+	for _, c := range node.Constructors {
+		for _, field := range c.Fields {
+			if name, ok := i.unknownType(i.current, field.Type, params); ok {
+				return nil, i.errorf(field.Type, TypeError, "unknown type %s", name)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// lookupType finds a sum type declared in a module, or exported by a module it imports
+func (i *Interpreter) lookupType(m *module, name string) (*SumType, bool) {
+	if index := strings.IndexByte(name, '.'); index >= 0 {
+		imported, ok := m.imports[name[:index]]
+		if !ok || !modules.IsExported(name[index+1:]) {
+			return nil, false
+		}
+		t, ok := imported.types[name[index+1:]]
+		return t, ok
+	}
+	t, ok := m.types[name]
+	return t, ok
+}
+
+// construct builds a variant by calling a constructor
+func (i *Interpreter) construct(node *ast.FuncCall, m *module, t *SumType) (Value, error) {
+	c := t.constructor(node.Name)
+	name := qualify(node.Module, node.Name)
+	if len(node.Args) != len(c.Fields) {
+		return nil, i.errorf(node, ArityError, "%s expects %d arguments - got %d", name, len(c.Fields), len(node.Args))
+	}
+
+	b := newBindings(t.Decl.Params)
+	fields := []Value{}
+	for index, arg := range node.Args {
+		value, err := i.visit(arg)
+		if err != nil {
+			return nil, err
+		}
+		if expected, ok := i.conforms(m, c.Fields[index].Type, value, b); !ok {
+			return nil, i.errorf(arg, TypeError, "field %s of %s must be a %s - got %s", c.Fields[index].Name, name, expected, typeOf(value))
+		}
+		fields = append(fields, value)
+	}
+
+	args := []*rtype{}
+	for _, p := range t.Decl.Params {
+		args = append(args, b[p.Value])
+	}
+	variant := &Variant{Sum: t, Args: args, Constructor: c.Name, Fields: fields}
+	if err := i.allocate(node, variant); err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// constant returns the variant built by a constructor without fields, used as a variable
+func (i *Interpreter) constant(node *ast.Variable, t *SumType) (Value, error) {
+	c := t.constructor(node.Name)
+	if len(c.Fields) > 0 {
+		return nil, i.errorf(node, ArityError, "%s expects %d arguments", qualify(node.Module, node.Name), len(c.Fields))
+	}
+	// the type arguments of a generic type can not be known without fields
+	args := make([]*rtype, len(t.Decl.Params))
+	return &Variant{Sum: t, Args: args, Constructor: c.Name, Fields: []Value{}}, nil
+}
+
+func (i *Interpreter) visitMatch(node *ast.Match) (Value, error) {
+	subject, err := i.visit(node.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if subject == nil {
+		return nil, i.errorf(node.Subject, TypeError, "%s has no value", node.Subject)
+	}
+
+	for _, arm := range node.Arms {
+		bindings := map[string]Value{}
+		matched, err := i.matchPattern(arm.Pattern, subject, bindings)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+
+		for name, value := range bindings {
+			i.define(i.currentScope(), name, value)
+		}
+		if err := i.onStep(arm.Body); err != nil {
+			return nil, err
+		}
+		return i.visit(arm.Body)
+	}
+
+	return nil, i.errorf(node, MatchError, "no pattern matches %s", subject)
+}
+
+// matchPattern tells whether a value matches a pattern.
+// The variables bound by the pattern are only assigned when the whole pattern matches
+func (i *Interpreter) matchPattern(pattern ast.Node, value Value, bindings map[string]Value) (bool, error) {
+	switch p := pattern.(type) {
+	case *ast.WildcardPattern:
+		return true, nil
+	case *ast.BindingPattern:
+		bindings[p.Name] = value
+		return true, nil
+	case *ast.ConstructorPattern:
+		t, err := i.lookupConstructor(p)
+		if err != nil {
+			return false, err
+		}
+		c := t.constructor(p.Name)
+		if len(p.Args) != len(c.Fields) {
+			return false, i.errorf(p, ArityError, "%s expects %d fields - got %d", qualify(p.Module, p.Name), len(c.Fields), len(p.Args))
+		}
+
+		v, ok := value.(*Variant)
+		if !ok || v.Sum != t || v.Constructor != p.Name {
+			return false, nil
+		}
+		for index, arg := range p.Args {
+			matched, err := i.matchPattern(arg, v.Fields[index], bindings)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	default:
+		// literals match the values they are equal to
+		literal, err := i.visit(pattern)
+		if err != nil {
+			return false, err
+		}
+		return literal.Type() == value.Type() && equals(literal, value), nil
+	}
+}
+
+// lookupConstructor returns the type of the constructor of a pattern
+func (i *Interpreter) lookupConstructor(p *ast.ConstructorPattern) (*SumType, error) {
+	m := i.current
+	if p.Module != "" {
+		imported, ok := i.current.imports[p.Module]
+		if !ok {
+			return nil, i.errorf(p, UnknownIdentifier, "unknown module %s", p.Module)
+		}
+		m = imported
+	}
+
+	t, ok := m.constructors[p.Name]
+	if !ok {
+		return nil, i.errorf(p, UnknownIdentifier, "unknown constructor %s", qualify(p.Module, p.Name))
+	}
+	return t, nil
+}
@@ -0,0 +1,166 @@
+package interpreter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// Value is the result of the evaluation of an expression
+type Value interface {
+	// Type returns the name of the type of the value, as written in type identifiers
+	Type() string
+	String() string
+}
+
+// Int is an integer value
+type Int int64
+
+// Type implements Value
+func (i Int) Type() string {
+	return "int"
+}
+
+func (i Int) String() string {
+	return strconv.FormatInt(int64(i), 10)
+}
+
+// String is a string value
+type String string
+
+// Type implements Value
+func (s String) Type() string {
+	return "string"
+}
+
+func (s String) String() string {
+	return string(s)
+}
+
+// Bool is a boolean value
+type Bool bool
+
+// Type implements Value
+func (b Bool) Type() string {
+	return "bool"
+}
+
+func (b Bool) String() string {
+	return strconv.FormatBool(bool(b))
+}
+
+// List is a list of values of the same type
+type List struct {
+	Values []Value
+}
+
+// Type implements Value. The type of the elements of an empty list is written _
+func (l *List) Type() string {
+	return valueType(l).String()
+}
+
+func (l *List) String() string {
+	values := []string{}
+	for _, v := range l.Values {
+		values = append(values, formatElement(v))
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+// Tuple groups a fixed number of values, of any types
+type Tuple struct {
+	Values []Value
+}
+
+// Type implements Value
+func (t *Tuple) Type() string {
+	return valueType(t).String()
+}
+
+func (t *Tuple) String() string {
+	values := []string{}
+	for _, v := range t.Values {
+		values = append(values, formatElement(v))
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
+// formatElement formats a value held by another one. Strings are quoted
+func formatElement(v Value) string {
+	if s, ok := v.(String); ok {
+		return strconv.Quote(string(s))
+	}
+	return v.String()
+}
+
+// isType tells whether a type name is known by the interpreter
+func isType(name string) bool {
+	switch name {
+	case "int", "float", "string", "bool", "Error":
+		return true
+	default:
+		return false
+	}
+}
+
+// Error is a runtime error caught by a try expression
+type Error struct {
+	Kind    ErrorKind
+	Message string
+	Pos     tokens.Position
+}
+
+// Type implements Value
+func (e Error) Type() string {
+	return "Error"
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("Error(%s: %s: %s)", formatPos(e.Pos), e.Kind, e.Message)
+}
+
+// equals compares two values of the same type, or two numbers
+func equals(a, b Value) bool {
+	if isNumber(a) && isNumber(b) {
+		return numberEquals(a, b)
+	}
+	if left, ok := a.(*List); ok {
+		right, ok := b.(*List)
+		if !ok || len(left.Values) != len(right.Values) {
+			return false
+		}
+		for index := range left.Values {
+			if !equals(left.Values[index], right.Values[index]) {
+				return false
+			}
+		}
+		return true
+	}
+	if left, ok := a.(*Tuple); ok {
+		right, ok := b.(*Tuple)
+		if !ok || len(left.Values) != len(right.Values) {
+			return false
+		}
+		for index := range left.Values {
+			if !equals(left.Values[index], right.Values[index]) {
+				return false
+			}
+		}
+		return true
+	}
+	if left, ok := a.(*Variant); ok {
+		right, ok := b.(*Variant)
+		if !ok || left.Sum != right.Sum || left.Constructor != right.Constructor {
+			return false
+		}
+		for index := range left.Fields {
+			if !equals(left.Fields[index], right.Fields[index]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -2,48 +2,208 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/coverage"
 	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/modules"
 	"github.com/fchoquet/cairn/parser"
 )
 
-func main() {
-	i := interpreter.New(&parser.Parser{})
+const usage = `usage:
+    cairn                      starts the REPL. :type expr displays the type of an expression
+    cairn [run] [-O [--trace-passes]] [--checked] [--cover] [--coverprofile profile] file
+                               runs a file, optionally optimized
+    cairn test [--format=text|tap|json] [--checked] [--cover] [--coverprofile profile] [path...]
+                               runs the test functions of the *_test.cairn files of the paths
+    cairn cover [--html output] profile
+                               displays the coverage of each function, or writes an HTML report
+    cairn ast [-O [--trace-passes]] [--json|--dot] file
+                               displays the AST of a file
+    cairn cfg [--func name] file
+                               outputs the control flow graphs of a file in DOT format
+    cairn build [--emit=go|wat] [--package name] [-o output] file
+                               translates a file to Go source code or to WebAssembly text
+    cairn debug file           runs a file in the debugger. help lists its commands
+    cairn dap                  serves the Debug Adapter Protocol on stdin and stdout
+
+imported modules are looked for next to the importing file, then in the directories of $CAIRNPATH
+`
 
+func main() {
 	args := os.Args[1:]
-	if len(args) > 0 {
-		file := os.Args[1]
-		input, err := ioutil.ReadFile(file)
-		if err != nil {
-			fmt.Println("!!! " + err.Error())
-			return
+	if len(args) == 0 {
+		repl()
+		return
+	}
+
+	switch args[0] {
+	case "run":
+		os.Exit(run(args[1:]))
+	case "ast":
+		os.Exit(dumpAST(args[1:]))
+	case "cfg":
+		os.Exit(dumpCFG(args[1:]))
+	case "test":
+		os.Exit(test(args[1:]))
+	case "cover":
+		os.Exit(coverReport(args[1:]))
+	case "build":
+		os.Exit(build(args[1:]))
+	case "debug":
+		os.Exit(debug(args[1:]))
+	case "dap":
+		os.Exit(serveDAP())
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		os.Exit(run(args))
+	}
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	optimized := flags.Bool("O", false, "optimize the AST before running it")
+	tracePasses := flags.Bool("trace-passes", false, "dump the AST before and after each optimization pass")
+	checked := flags.Bool("checked", false, "report integer overflows instead of promoting to big integers")
+	cover := flags.Bool("cover", false, "display the coverage of the statements and branches of each function")
+	coverProfile := flags.String("coverprofile", "", "write the coverage profile to this file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	file := flags.Arg(0)
+	input, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+	source := string(input)
+
+	node, err := parseSource(file, source)
+	if err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+	node = optimizeAST(node, *optimized, *tracePasses)
+
+	var profile *coverage.Profile
+	if *cover || *coverProfile != "" {
+		profile = coverage.New()
+		profile.Add(node)
+	}
+
+	loader := modules.NewLoader(searchPath()...)
+	loader.Transform = func(module *ast.SourceFile) *ast.SourceFile {
+		module = optimizeAST(module, *optimized, *tracePasses)
+		if profile != nil {
+			profile.Add(module)
 		}
-		output, err := i.Interpret("stdin", string(input))
-		if err != nil {
-			fmt.Println("!!! " + err.Error())
-			return
+		return module
+	}
+
+	options := append(hostCapabilities(os.Stdin), interpreter.Loader(loader))
+	if *checked {
+		options = append(options, interpreter.CheckedArithmetic())
+	}
+	if profile != nil {
+		options = append(options, profile.Option())
+	}
+	i := interpreter.New(&parser.Parser{}, options...)
+	output, err := i.Exec(node)
+	if profile != nil {
+		// the coverage of a failing program is reported too
+		if status := reportCoverage(profile.Blocks(), *cover, *coverProfile); status != 0 {
+			return status
 		}
+	}
+	if err != nil {
+		printError(err, source)
+		return 1
+	}
+	if output != "" {
 		fmt.Println(output)
-		return
 	}
+	return 0
+}
+
+// searchPath returns the directories listed in $CAIRNPATH
+func searchPath() []string {
+	if os.Getenv("CAIRNPATH") == "" {
+		return nil
+	}
+	return filepath.SplitList(os.Getenv("CAIRNPATH"))
+}
+
+// hostCapabilities grants the resources of the host to the programs run from the command line.
+// The file system is rooted at the working directory
+func hostCapabilities(stdin io.Reader) []interpreter.Option {
+	return []interpreter.Option{
+		interpreter.Stdout(os.Stdout),
+		interpreter.Stdin(stdin),
+		interpreter.Files(interpreter.Dir(".")),
+		interpreter.Clock(time.Now),
+		interpreter.Random(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func repl() {
+	// the programs read their input from the same buffer as the REPL
+	reader := bufio.NewReader(os.Stdin)
+	options := append(hostCapabilities(reader), interpreter.Loader(modules.NewLoader(searchPath()...)))
+	i := interpreter.New(&parser.Parser{}, options...)
 
 	for {
 		fmt.Print("cairn> ")
 
-		reader := bufio.NewReader(os.Stdin)
 		input, _ := reader.ReadString('\n')
 
 		if input == "" {
 			continue
 		}
+		if strings.HasPrefix(input, ":type ") {
+			input = strings.TrimPrefix(input, ":type ")
+			typ, err := i.TypeOf("stdin", input)
+			if err != nil {
+				printError(err, input)
+				continue
+			}
+			fmt.Println("--> " + typ)
+			continue
+		}
 		output, err := i.Interpret("stdin", input)
 		if err != nil {
-			fmt.Println("!!! " + err.Error())
+			printError(err, input)
 			continue
 		}
 		fmt.Println("--> " + output)
 	}
 }
+
+// printError displays an error. Runtime errors come with the faulty line and the call stack
+func printError(err error, source string) {
+	if rerr, ok := err.(*interpreter.RuntimeError); ok {
+		// the error may come from an imported module
+		if rerr.Pos.File != "" && rerr.Pos.File != "stdin" {
+			if input, err := ioutil.ReadFile(rerr.Pos.File); err == nil {
+				source = string(input)
+			}
+		}
+		fmt.Println("!!! " + rerr.Render(source))
+		return
+	}
+	fmt.Println("!!! " + err.Error())
+}
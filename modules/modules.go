@@ -0,0 +1,171 @@
+// Package modules loads cairn source files and the modules they import.
+//
+// An import path is resolved relative to the directory of the importing file first,
+// then relative to each directory of the search path. The .cairn extension is optional.
+// Every module is parsed once, however many files import it, and import cycles are reported.
+package modules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// Extension is the extension of cairn source files
+const Extension = ".cairn"
+
+// Module is a parsed source file and the modules it imports
+type Module struct {
+	// Name is the name the module is referred to by importing files
+	Name string
+	// Path is the path of the source file
+	Path string
+	File *ast.SourceFile
+	// Imports are the imported modules, indexed by name
+	Imports map[string]*Module
+}
+
+// Loader loads modules and caches them
+type Loader struct {
+	// SearchPath lists the directories where modules are looked for when they
+	// are not found next to the importing file
+	SearchPath []string
+	// ReadFile reads a source file. It defaults to ioutil.ReadFile
+	ReadFile func(path string) ([]byte, error)
+	// Transform is applied to each module once it is parsed, when it is not nil
+	Transform func(file *ast.SourceFile) *ast.SourceFile
+
+	// modules are the loaded modules, indexed by path
+	modules map[string]*Module
+	// loading is the chain of imports being loaded, used to detect cycles
+	loading []string
+}
+
+// NewLoader creates a loader reading files from the file system
+func NewLoader(searchPath ...string) *Loader {
+	return &Loader{
+		SearchPath: searchPath,
+		ReadFile:   ioutil.ReadFile,
+		modules:    map[string]*Module{},
+	}
+}
+
+// IsExported tells whether a name declared in a module can be used by the modules importing it.
+// Exported names start with a capital letter
+func IsExported(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+// Load reads and parses a source file, and loads the modules it imports
+func (l *Loader) Load(path string) (*Module, error) {
+	path = filepath.Clean(path)
+	if m, ok := l.modules[path]; ok {
+		return m, nil
+	}
+
+	source, err := l.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.Parser{}
+	node, err := p.Parse(path, string(source))
+	if err != nil {
+		return nil, err
+	}
+	file := node.(*ast.SourceFile)
+	if l.Transform != nil {
+		file = l.Transform(file)
+	}
+
+	m, err := l.Link(path, file)
+	if err != nil {
+		return nil, err
+	}
+	l.modules[path] = m
+	return m, nil
+}
+
+// Link creates the module of a file that has already been parsed, and loads the modules it imports.
+// The module itself is not cached, so that a REPL can link each of its inputs
+func (l *Loader) Link(path string, file *ast.SourceFile) (*Module, error) {
+	path = filepath.Clean(path)
+	l.loading = append(l.loading, path)
+	defer func() {
+		l.loading = l.loading[:len(l.loading)-1]
+	}()
+
+	m := &Module{
+		Name:    parser.ModuleName(path),
+		Path:    path,
+		File:    file,
+		Imports: map[string]*Module{},
+	}
+
+	for _, decl := range file.Imports {
+		if _, ok := m.Imports[decl.Name]; ok {
+			return nil, errorf(decl.Path, "module %s is already imported", decl.Name)
+		}
+
+		importPath, err := l.resolve(path, decl)
+		if err != nil {
+			return nil, err
+		}
+
+		for index, loading := range l.loading {
+			if loading == importPath {
+				cycle := append(append([]string{}, l.loading[index:]...), importPath)
+				return nil, errorf(decl.Path, "import cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+
+		imported, err := l.Load(importPath)
+		if err != nil {
+			return nil, err
+		}
+		m.Imports[decl.Name] = imported
+	}
+
+	return m, nil
+}
+
+// resolve returns the path of the file of an imported module
+func (l *Loader) resolve(from string, decl *ast.ImportDecl) (string, error) {
+	importPath := decl.Path.Value
+	if filepath.Ext(importPath) != Extension {
+		importPath += Extension
+	}
+
+	candidates := []string{}
+	if filepath.IsAbs(importPath) {
+		candidates = append(candidates, importPath)
+	} else {
+		candidates = append(candidates, filepath.Join(filepath.Dir(from), importPath))
+		for _, dir := range l.SearchPath {
+			candidates = append(candidates, filepath.Join(dir, importPath))
+		}
+	}
+
+	for _, candidate := range candidates {
+		candidate = filepath.Clean(candidate)
+		if _, ok := l.modules[candidate]; ok {
+			return candidate, nil
+		}
+		if _, err := l.ReadFile(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", errorf(decl.Path, "can not find module %q in %s", decl.Path.Value, strings.Join(candidates, ", "))
+}
+
+func errorf(tk *tokens.Token, format string, args ...interface{}) error {
+	return &tokens.Error{Pos: tk.Position, Message: fmt.Sprintf(format, args...)}
+}
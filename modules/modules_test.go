@@ -0,0 +1,126 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLoader returns a loader reading files from a map
+func fakeLoader(files map[string]string, searchPath ...string) (*Loader, map[string]int) {
+	reads := map[string]int{}
+	loader := NewLoader(searchPath...)
+	loader.ReadFile = func(path string) ([]byte, error) {
+		source, ok := files[path]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		reads[path]++
+		return []byte(source), nil
+	}
+	return loader, reads
+}
+
+func TestLoader(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("resolves imports", func(t *testing.T) {
+		loader, _ := fakeLoader(map[string]string{
+			"app/main.cairn":       "import \"lib/util\"\nimport \"strings.cairn\"\n1",
+			"app/lib/util.cairn":   "import \"../helpers\"\n2",
+			"app/helpers.cairn":    "3",
+			"vendor/strings.cairn": "4",
+		}, "vendor")
+
+		m, err := loader.Load("app/main.cairn")
+		if !assert.Nil(err) {
+			return
+		}
+		assert.Equal("main", m.Name)
+		assert.Equal("app/lib/util.cairn", m.Imports["util"].Path)
+		assert.Equal("vendor/strings.cairn", m.Imports["strings"].Path)
+		assert.Equal("app/helpers.cairn", m.Imports["util"].Imports["helpers"].Path)
+	})
+
+	t.Run("parses each module once", func(t *testing.T) {
+		loader, reads := fakeLoader(map[string]string{
+			"main.cairn": "import \"a\"\nimport \"b\"\n1",
+			"a.cairn":    "import \"c\"\n1",
+			"b.cairn":    "import \"c\"\n1",
+			"c.cairn":    "1",
+		})
+
+		m, err := loader.Load("main.cairn")
+		if !assert.Nil(err) {
+			return
+		}
+		assert.True(m.Imports["a"].Imports["c"] == m.Imports["b"].Imports["c"])
+		assert.Equal(2, reads["c.cairn"], "read once to resolve it, once to parse it")
+	})
+
+	t.Run("transforms modules", func(t *testing.T) {
+		loader, _ := fakeLoader(map[string]string{"util.cairn": "1"})
+		transformed := []string{}
+		loader.Transform = func(file *ast.SourceFile) *ast.SourceFile {
+			transformed = append(transformed, file.Pos().File)
+			return file
+		}
+
+		_, err := loader.Load("util.cairn")
+		assert.Nil(err)
+		assert.Equal([]string{"util.cairn"}, transformed)
+	})
+
+	t.Run("reports errors at the import", func(t *testing.T) {
+		fixtures := []struct {
+			files   map[string]string
+			message string
+		}{
+			{
+				map[string]string{"main.cairn": "1\nimport \"missing\""},
+				"main.cairn:2:1: expected a literal - got import",
+			},
+			{
+				map[string]string{"main.cairn": "import \"missing\"\n1"},
+				`main.cairn:1:8: can not find module "missing" in missing.cairn`,
+			},
+			{
+				map[string]string{"main.cairn": "import \"a\"\nimport \"lib/a\"\n1", "a.cairn": "1", "lib/a.cairn": "1"},
+				"main.cairn:2:8: module a is already imported",
+			},
+			{
+				map[string]string{"main.cairn": "import \"a\"\n1", "a.cairn": "import \"b\"\n1", "b.cairn": "import \"a\"\n1"},
+				"b.cairn:1:8: import cycle: a.cairn -> b.cairn -> a.cairn",
+			},
+			{
+				map[string]string{"main.cairn": "import \"main\"\n1"},
+				"main.cairn:1:8: import cycle: main.cairn -> main.cairn",
+			},
+			{
+				map[string]string{"main.cairn": "import \"a\"\n1", "a.cairn": "1 +"},
+				"a.cairn:1:4: expected a literal - got end of file",
+			},
+		}
+
+		for _, f := range fixtures {
+			loader, _ := fakeLoader(f.files)
+			_, err := loader.Load("main.cairn")
+			if _, ok := err.(*tokens.Error); assert.True(ok, fmt.Sprint(f.files)) {
+				assert.Equal(f.message, err.Error())
+			}
+		}
+	})
+}
+
+func TestIsExported(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsExported("Add"))
+	assert.True(IsExported("Été"))
+	assert.False(IsExported("add"))
+	assert.False(IsExported("_Add"))
+	assert.False(IsExported(""))
+}
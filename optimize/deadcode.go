@@ -0,0 +1,112 @@
+package optimize
+
+import (
+	"math/big"
+	"strconv"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// DeadCodeElimination removes code that can not change the result of a program:
+//   - the value of a statement list is the value of its last statement, so a literal
+//     anywhere else is useless
+//   - the arms of a match on a literal that can not match it are removed, and so are the arms
+//     following the first one that surely matches. A match left with a wildcard arm whose
+//     body is an expression is replaced by this expression
+type DeadCodeElimination struct{}
+
+// Name implements Pass
+func (DeadCodeElimination) Name() string {
+	return "dead-code-elimination"
+}
+
+// Run implements Pass
+func (DeadCodeElimination) Run(file *ast.SourceFile) *ast.SourceFile {
+	return ast.Rewrite(file, func(node ast.Node) ast.Node {
+		switch n := node.(type) {
+		case *ast.StatementList:
+			return removeLiterals(n)
+		case *ast.Match:
+			return pruneArms(n)
+		default:
+			return node
+		}
+	}).(*ast.SourceFile)
+}
+
+func removeLiterals(sl *ast.StatementList) ast.Node {
+	statements := []ast.Statement{}
+	for index, st := range sl.Statements {
+		if index < len(sl.Statements)-1 && isLiteral(st) {
+			continue
+		}
+		statements = append(statements, st)
+	}
+	sl.Statements = statements
+	return sl
+}
+
+// pruneArms removes the arms of a match on a literal that are never taken
+func pruneArms(m *ast.Match) ast.Node {
+	if !isLiteral(m.Subject) {
+		return m
+	}
+
+	arms := []*ast.MatchArm{}
+	for _, arm := range m.Arms {
+		matches, known := patternMatches(arm.Pattern, m.Subject)
+		if !known {
+			arms = append(arms, arm)
+			continue
+		}
+		if !matches {
+			continue
+		}
+
+		if isLiteral(arm.Pattern) {
+			// the arm is the last one: it must match every value, or the match would not be exhaustive
+			arm.Pattern = &ast.WildcardPattern{Token: newToken(tokens.IDENTIFIER, "_", arm.Pattern.Pos())}
+		}
+		m.Arms = append(arms, arm)
+		if _, isBlock := arm.Body.(*ast.BlockStmt); len(m.Arms) == 1 && !isBlock {
+			if _, isWildcard := arm.Pattern.(*ast.WildcardPattern); isWildcard {
+				return arm.Body
+			}
+		}
+		return m
+	}
+	// no arm surely matches: the match may fail at runtime
+	m.Arms = arms
+	return m
+}
+
+// patternMatches tells whether a pattern matches a literal. known is false when it can not
+// be told before the program runs
+func patternMatches(pattern, literal ast.Node) (matches, known bool) {
+	switch pattern.(type) {
+	case *ast.WildcardPattern, *ast.BindingPattern:
+		return true, true
+	}
+	if !isLiteral(pattern) {
+		return false, false
+	}
+	// a literal pattern only matches the values of its own type
+	if literalType(pattern) != literalType(literal) {
+		return false, true
+	}
+
+	p, l := literalValue(pattern), literalValue(literal)
+	switch literal.(type) {
+	case *ast.Num:
+		x, _ := new(big.Int).SetString(p, 10)
+		y, _ := new(big.Int).SetString(l, 10)
+		return x.Cmp(y) == 0, true
+	case *ast.Float:
+		x, _ := strconv.ParseFloat(p, 64)
+		y, _ := strconv.ParseFloat(l, 64)
+		return x == y, true
+	default:
+		return p == l, true
+	}
+}
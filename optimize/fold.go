@@ -0,0 +1,199 @@
+package optimize
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// ConstantFolding evaluates operators whose operands are all literals.
+// Operations that would fail at runtime are left untouched.
+type ConstantFolding struct{}
+
+// Name implements Pass
+func (ConstantFolding) Name() string {
+	return "constant-folding"
+}
+
+// Run implements Pass
+func (ConstantFolding) Run(file *ast.SourceFile) *ast.SourceFile {
+	return ast.Rewrite(file, fold).(*ast.SourceFile)
+}
+
+func fold(node ast.Node) ast.Node {
+	switch n := node.(type) {
+	case *ast.UnaryOp:
+		if folded := foldUnaryOp(n); folded != nil {
+			return folded
+		}
+	case *ast.BinOp:
+		if folded := foldBinOp(n); folded != nil {
+			return folded
+		}
+	}
+	return node
+}
+
+func foldUnaryOp(node *ast.UnaryOp) ast.Node {
+	switch expr := node.Expr.(type) {
+	case *ast.Bool:
+		if node.Op.Type != tokens.NOT {
+			return nil
+		}
+		return newBool(expr.Value != "true", node.Pos())
+	case *ast.Num:
+		val, ok := new(big.Int).SetString(expr.Value, 10)
+		if !ok {
+			return nil
+		}
+		switch node.Op.Type {
+		case tokens.PLUS:
+			return newInt(val, node.Pos())
+		case tokens.MINUS:
+			return newInt(val.Neg(val), node.Pos())
+		}
+	case *ast.Float:
+		val, err := strconv.ParseFloat(expr.Value, 64)
+		if err != nil {
+			return nil
+		}
+		switch node.Op.Type {
+		case tokens.PLUS:
+			return newFloat(val, node.Pos())
+		case tokens.MINUS:
+			return newFloat(-val, node.Pos())
+		}
+	}
+	return nil
+}
+
+func foldBinOp(node *ast.BinOp) ast.Node {
+	if !isLiteral(node.Left) || !isLiteral(node.Right) {
+		return nil
+	}
+
+	left, right := literalValue(node.Left), literalValue(node.Right)
+	pos := node.Pos()
+	leftType, rightType := literalType(node.Left), literalType(node.Right)
+	if numberType(leftType, rightType) == "float" {
+		return foldFloat(node.Op.Type, left, right, pos)
+	}
+	if leftType != rightType {
+		// must fail at runtime
+		return nil
+	}
+
+	switch node.Op.Type {
+	case tokens.EQ, tokens.NEQ:
+		equal := left == right
+		if leftType == "int" {
+			leftVal, ok := new(big.Int).SetString(left, 10)
+			if !ok {
+				return nil
+			}
+			rightVal, ok := new(big.Int).SetString(right, 10)
+			if !ok {
+				return nil
+			}
+			equal = leftVal.Cmp(rightVal) == 0
+		}
+		return newBool(equal == (node.Op.Type == tokens.EQ), pos)
+	case tokens.CONCAT:
+		if leftType != "string" {
+			return nil
+		}
+		return newString(left+right, pos)
+	case tokens.AND, tokens.OR:
+		if leftType != "bool" {
+			return nil
+		}
+		leftVal, rightVal := left == "true", right == "true"
+		if node.Op.Type == tokens.AND {
+			return newBool(leftVal && rightVal, pos)
+		}
+		return newBool(leftVal || rightVal, pos)
+	}
+
+	if leftType != "int" {
+		return nil
+	}
+	leftVal, ok := new(big.Int).SetString(left, 10)
+	if !ok {
+		return nil
+	}
+	rightVal, ok := new(big.Int).SetString(right, 10)
+	if !ok {
+		return nil
+	}
+
+	result := new(big.Int)
+	switch node.Op.Type {
+	case tokens.PLUS:
+		result.Add(leftVal, rightVal)
+	case tokens.MINUS:
+		result.Sub(leftVal, rightVal)
+	case tokens.MULT:
+		result.Mul(leftVal, rightVal)
+	case tokens.DIV:
+		if rightVal.Sign() == 0 {
+			// must fail at runtime
+			return nil
+		}
+		result.Quo(leftVal, rightVal)
+	case tokens.POW:
+		if rightVal.Sign() < 0 || (rightVal.Cmp(big.NewInt(64)) > 0 && leftVal.CmpAbs(big.NewInt(1)) > 0) {
+			// negative exponents are left to the interpreter, and large ones
+			// would not fit in 64 bits anyway
+			return nil
+		}
+		result.Exp(leftVal, rightVal, nil)
+	default:
+		return nil
+	}
+	return newInt(result, pos)
+}
+
+// foldFloat folds an operation on two numbers, one of them at least being a float
+func foldFloat(op tokens.TokenType, left, right string, pos tokens.Position) ast.Node {
+	// integer literals are converted the way the interpreter promotes them
+	leftVal, err := strconv.ParseFloat(left, 64)
+	if err != nil {
+		return nil
+	}
+	rightVal, err := strconv.ParseFloat(right, 64)
+	if err != nil {
+		return nil
+	}
+
+	switch op {
+	case tokens.PLUS:
+		return newFloat(leftVal+rightVal, pos)
+	case tokens.MINUS:
+		return newFloat(leftVal-rightVal, pos)
+	case tokens.MULT:
+		return newFloat(leftVal*rightVal, pos)
+	case tokens.DIV:
+		if rightVal == 0 {
+			// must fail at runtime
+			return nil
+		}
+		return newFloat(leftVal/rightVal, pos)
+	case tokens.POW:
+		return newFloat(math.Pow(leftVal, rightVal), pos)
+	default:
+		// comparisons of floats are left to the interpreter
+		return nil
+	}
+}
+
+// newInt creates an integer literal, unless the value does not fit in 64 bits:
+// the interpreter may be configured to fail on overflows
+func newInt(value *big.Int, pos tokens.Position) ast.Node {
+	if !value.IsInt64() {
+		return nil
+	}
+	return newNum(value.String(), pos)
+}
@@ -0,0 +1,183 @@
+package optimize
+
+import (
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// maxInlinedNodes is the size above which a function is not considered small
+const maxInlinedNodes = 16
+
+// Inlining replaces calls to small pure functions by their results.
+//
+// A function is inlined when its body is a single expression that only reads
+// its parameters and calls no function, and when every argument is a literal of
+// the declared parameter type. This way no type error can be hidden by the inlining.
+// The call is only replaced when its body folds to a literal: a call that fails at
+// runtime is kept, so that its error is still reported with the frame of the function.
+type Inlining struct{}
+
+// Name implements Pass
+func (Inlining) Name() string {
+	return "inlining"
+}
+
+// Run implements Pass
+func (Inlining) Run(file *ast.SourceFile) *ast.SourceFile {
+	candidates := map[string]*ast.FuncDecl{}
+	for _, f := range file.Functions {
+		if isInlinable(f) {
+			candidates[f.Name.Value] = f
+		}
+	}
+
+	return ast.Rewrite(file, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.FuncCall)
+		if !ok || call.Module != "" {
+			return node
+		}
+		f, ok := candidates[call.Name]
+		if !ok {
+			return node
+		}
+
+		params := f.Signature.Parameters.Parameters
+		if len(params) != len(call.Args) {
+			// must fail at runtime
+			return node
+		}
+		args := map[string]ast.Node{}
+		for index, param := range params {
+			if literalType(call.Args[index]) != param.Type.Name {
+				return node
+			}
+			args[param.Name] = call.Args[index]
+		}
+
+		result := ast.Rewrite(substitute(f.Body.Statements.Statements[0], args), fold)
+		if !isLiteral(result) {
+			return node
+		}
+		return result
+	}).(*ast.SourceFile)
+}
+
+func isInlinable(f *ast.FuncDecl) bool {
+	if f.Body == nil || f.Body.Statements == nil || len(f.Body.Statements.Statements) != 1 {
+		return false
+	}
+
+	params := map[string]string{}
+	for _, p := range f.Signature.Parameters.Parameters {
+		params[p.Name] = p.Type.Name
+	}
+
+	body := f.Body.Statements.Statements[0]
+	if expressionType(body, params) != f.Signature.ReturnType.Name {
+		// the interpreter would complain about the returned value
+		return false
+	}
+
+	size := 0
+	pure := true
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case nil:
+			return false
+		case *ast.Variable:
+			if _, ok := params[n.Name]; !ok {
+				pure = false
+			}
+		case *ast.UnaryOp, *ast.BinOp, *ast.Num, *ast.Float, *ast.String, *ast.Bool:
+		default:
+			pure = false
+		}
+		size++
+		return pure
+	})
+	return pure && size <= maxInlinedNodes
+}
+
+// literalType returns the type of a literal, or an empty string
+func literalType(node ast.Node) string {
+	switch node.(type) {
+	case *ast.Num:
+		return "int"
+	case *ast.Float:
+		return "float"
+	case *ast.String:
+		return "string"
+	case *ast.Bool:
+		return "bool"
+	default:
+		return ""
+	}
+}
+
+// expressionType returns the type of an expression built with operators, literals
+// and typed variables, or an empty string when it can not be determined
+func expressionType(node ast.Node, variables map[string]string) string {
+	switch n := node.(type) {
+	case *ast.Variable:
+		return variables[n.Name]
+	case *ast.UnaryOp:
+		if n.Op.Type == tokens.NOT {
+			return "bool"
+		}
+		return numberType(expressionType(n.Expr, variables), "int")
+	case *ast.BinOp:
+		switch n.Op.Type {
+		case tokens.CONCAT:
+			return "string"
+		case tokens.AND, tokens.OR, tokens.EQ, tokens.NEQ:
+			return "bool"
+		default:
+			return numberType(expressionType(n.Left, variables), expressionType(n.Right, variables))
+		}
+	default:
+		return literalType(node)
+	}
+}
+
+// numberType returns the type of an arithmetic operation: integers are promoted to floats.
+// It returns an empty string when an operand is not a number
+func numberType(left, right string) string {
+	switch {
+	case left == "int" && right == "int":
+		return "int"
+	case (left == "int" || left == "float") && (right == "int" || right == "float"):
+		return "float"
+	default:
+		return ""
+	}
+}
+
+// substitute returns a copy of an expression where parameters are replaced by arguments
+func substitute(node ast.Node, args map[string]ast.Node) ast.Node {
+	switch n := node.(type) {
+	case *ast.Variable:
+		if arg, ok := args[n.Name]; ok {
+			return substitute(arg, nil)
+		}
+		clone := *n
+		return &clone
+	case *ast.UnaryOp:
+		return &ast.UnaryOp{Op: n.Op, Expr: substitute(n.Expr, args)}
+	case *ast.BinOp:
+		return &ast.BinOp{Left: substitute(n.Left, args), Op: n.Op, Right: substitute(n.Right, args)}
+	case *ast.Num:
+		clone := *n
+		return &clone
+	case *ast.Float:
+		clone := *n
+		return &clone
+	case *ast.String:
+		clone := *n
+		return &clone
+	case *ast.Bool:
+		clone := *n
+		return &clone
+	default:
+		return node
+	}
+}
@@ -0,0 +1,132 @@
+// Package optimize rewrites ASTs into cheaper trees that evaluate to the same results.
+// Every pass preserves the semantics of the program, errors included: an expression
+// such as 1 / 0 is never folded, so that it still fails at runtime.
+package optimize
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// Pass is an optimization pass
+type Pass interface {
+	// Name identifies the pass in traces
+	Name() string
+	// Run optimizes a file. The tree is updated in place
+	Run(file *ast.SourceFile) *ast.SourceFile
+}
+
+// Pipeline runs optimization passes one after another
+type Pipeline struct {
+	Passes []Pass
+	// Trace receives a dump of the tree before and after each pass when it is not nil
+	Trace io.Writer
+}
+
+// DefaultPasses returns the passes run by Optimize, in order
+func DefaultPasses() []Pass {
+	return []Pass{
+		Inlining{},
+		ConstantFolding{},
+		AlgebraicSimplification{},
+		// simplifications may uncover new constants
+		ConstantFolding{},
+		DeadCodeElimination{},
+	}
+}
+
+// NewPipeline creates a pipeline running the default passes
+func NewPipeline(trace io.Writer) *Pipeline {
+	return &Pipeline{
+		Passes: DefaultPasses(),
+		Trace:  trace,
+	}
+}
+
+// Run runs every pass of the pipeline on a file
+func (p *Pipeline) Run(file *ast.SourceFile) *ast.SourceFile {
+	for _, pass := range p.Passes {
+		if p.Trace != nil {
+			fmt.Fprintf(p.Trace, "--- before %s ---\n%s\n", pass.Name(), file)
+		}
+		file = pass.Run(file)
+		if p.Trace != nil {
+			fmt.Fprintf(p.Trace, "--- after %s ---\n%s\n", pass.Name(), file)
+		}
+	}
+	return file
+}
+
+// Optimize runs the default passes on a file
+func Optimize(file *ast.SourceFile) *ast.SourceFile {
+	return NewPipeline(nil).Run(file)
+}
+
+// isLiteral tells whether a node is a literal that can not fail at runtime.
+// Integers that do not fit in 64 bits fail when the interpreter checks overflows.
+func isLiteral(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.Num:
+		val, ok := new(big.Int).SetString(n.Value, 10)
+		return ok && val.IsInt64()
+	case *ast.Float:
+		_, err := strconv.ParseFloat(n.Value, 64)
+		return err == nil
+	case *ast.String, *ast.Bool:
+		return true
+	default:
+		return false
+	}
+}
+
+// literalValue returns the value of a literal as the interpreter sees it
+func literalValue(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.Num:
+		return n.Value
+	case *ast.Float:
+		return n.Value
+	case *ast.String:
+		return n.Value
+	case *ast.Bool:
+		return n.Value
+	default:
+		panic(fmt.Sprintf("%s is not a literal", node))
+	}
+}
+
+// newToken creates the token of a node built by an optimization
+func newToken(tkType tokens.TokenType, value string, pos tokens.Position) *tokens.Token {
+	return &tokens.Token{
+		Type:     tkType,
+		Value:    value,
+		Position: pos,
+	}
+}
+
+func newNum(value string, pos tokens.Position) *ast.Num {
+	return &ast.Num{Token: newToken(tokens.INTEGER, value, pos), Value: value}
+}
+
+// newFloat creates a float literal, unless the value can not be written as a literal
+func newFloat(value float64, pos tokens.Position) ast.Node {
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return nil
+	}
+	literal := strconv.FormatFloat(value, 'g', -1, 64)
+	return &ast.Float{Token: newToken(tokens.FLOAT, literal, pos), Value: literal}
+}
+
+func newString(value string, pos tokens.Position) *ast.String {
+	return &ast.String{Token: newToken(tokens.STRING, value, pos), Value: value}
+}
+
+func newBool(value bool, pos tokens.Position) *ast.Bool {
+	return &ast.Bool{Token: newToken(tokens.BOOL, fmt.Sprint(value), pos), Value: fmt.Sprint(value)}
+}
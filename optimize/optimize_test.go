@@ -0,0 +1,190 @@
+package optimize
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, source string) *ast.SourceFile {
+	p := parser.Parser{}
+	node, err := p.Parse("test.ca", source)
+	if err != nil {
+		t.Fatalf("can not parse %s: %s", source, err)
+	}
+	return node.(*ast.SourceFile)
+}
+
+func TestPasses(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		pass   Pass
+		source string
+		ast    string
+	}{
+		// constant folding
+		{ConstantFolding{}, `2^4 + 2 * (3^2 - 1)`, `Num(32:INTEGER)`},
+		{ConstantFolding{}, `-(1 - 3)`, `Num(2:INTEGER)`},
+		{ConstantFolding{}, `"foo" ++ "bar"`, `String(foobar:STRING)`},
+		{ConstantFolding{}, `!true || (1 == 1 && "a" != "b")`, `Bool(true:BOOL)`},
+		{ConstantFolding{}, `a + 2 * 3`, `BinOp(+:PLUS Variable(a) Num(6:INTEGER))`},
+		// operations that fail at runtime are kept
+		{ConstantFolding{}, `1 / (2 - 2)`, `BinOp(/:DIV Num(1:INTEGER) Num(0:INTEGER))`},
+		{ConstantFolding{}, `1 + true`, `BinOp(+:PLUS Num(1:INTEGER) Bool(true:BOOL))`},
+		{ConstantFolding{}, `2^-1`, `BinOp(^:POW Num(2:INTEGER) Num(-1:INTEGER))`},
+		{ConstantFolding{}, `10^20`, `BinOp(^:POW Num(10:INTEGER) Num(20:INTEGER))`},
+		{ConstantFolding{}, `9223372036854775807 + 1`, `BinOp(+:PLUS Num(9223372036854775807:INTEGER) Num(1:INTEGER))`},
+		{ConstantFolding{}, `99999999999999999999 == 1`, `BinOp(==:EQ Num(99999999999999999999:INTEGER) Num(1:INTEGER))`},
+		{ConstantFolding{}, `1.5 * 2 + 0.25`, `Float(3.25:FLOAT)`},
+		{ConstantFolding{}, `-2.5e-3`, `Float(-0.0025:FLOAT)`},
+		{ConstantFolding{}, `1 / 0.0`, `BinOp(/:DIV Num(1:INTEGER) Float(0.0:FLOAT))`},
+		{ConstantFolding{}, `1e308 * 10`, `BinOp(*:MULT Float(1e308:FLOAT) Num(10:INTEGER))`},
+		{ConstantFolding{}, `1.5 == 1.5`, `BinOp(==:EQ Float(1.5:FLOAT) Float(1.5:FLOAT))`},
+		{ConstantFolding{}, `2^62 + (2^62 - 1)`, `Num(9223372036854775807:INTEGER)`},
+		// algebraic simplification
+		// neutral elements are kept when the other operand may not be a number, so that it fails alike
+		{AlgebraicSimplification{}, `a - 0`, `BinOp(-:MINUS Variable(a) Num(0:INTEGER))`},
+		{AlgebraicSimplification{}, `(a + b) * 1`, `BinOp(+:PLUS Variable(a) Variable(b))`},
+		{AlgebraicSimplification{}, `1 * -a`, `UnaryOp(-:MINUS Variable(a))`},
+		{AlgebraicSimplification{}, `0 + 2 * 3`, `BinOp(*:MULT Num(2:INTEGER) Num(3:INTEGER))`},
+		{AlgebraicSimplification{}, `(1 + 2) - 0`, `BinOp(+:PLUS Num(1:INTEGER) Num(2:INTEGER))`},
+		{AlgebraicSimplification{}, `0 - (1 + 2)`, `BinOp(-:MINUS Num(0:INTEGER) BinOp(+:PLUS Num(1:INTEGER) Num(2:INTEGER)))`},
+		// a may be -0.0, and -0.0 + 0 is 0.0
+		{AlgebraicSimplification{}, `a + 0`, `BinOp(+:PLUS Variable(a) Num(0:INTEGER))`},
+		{AlgebraicSimplification{}, `0 - a`, `BinOp(-:MINUS Num(0:INTEGER) Variable(a))`},
+		{AlgebraicSimplification{}, `a * 1.0`, `BinOp(*:MULT Variable(a) Float(1.0:FLOAT))`},
+		{AlgebraicSimplification{}, `1 * a / 1`, `BinOp(*:MULT Num(1:INTEGER) Variable(a))`},
+		{AlgebraicSimplification{}, `1 * +a / 1`, `UnaryOp(+:PLUS Variable(a))`},
+		// --a overflows when a is the smallest int and overflows are checked
+		{AlgebraicSimplification{}, `--a`, `UnaryOp(-:MINUS UnaryOp(-:MINUS Variable(a)))`},
+		{AlgebraicSimplification{}, `!!!a`, `UnaryOp(!:NOT Variable(a))`},
+		{AlgebraicSimplification{}, `!!a`, `UnaryOp(!:NOT UnaryOp(!:NOT Variable(a)))`},
+		// dead code elimination
+		{DeadCodeElimination{}, "1\n\"foo\"\na := 1\ntrue\na", `Assign(Variable(a) Num(1:INTEGER)); Variable(a)`},
+		{DeadCodeElimination{}, "1\n2", `Num(2:INTEGER)`},
+		{DeadCodeElimination{}, "match 2\n    1 -> a\n    2 -> b\n    _ -> c", `Variable(b)`},
+		{DeadCodeElimination{}, "match \"b\"\n    \"a\" -> 1\n    x -> x", `Match(String(b:STRING) Arm(Binding(x) -> Variable(x)))`},
+		{DeadCodeElimination{}, "match 1.0\n    1 -> a\n    1.0 -> b\n    _ -> c", `Variable(b)`},
+		{DeadCodeElimination{}, "match true\n    false -> a\n    true ->\n        b", `Match(Bool(true:BOOL) Arm(Wildcard -> BlockStmt(BEGIN2:BEGIN StatementList(Variable(b)) :EOF)))`},
+		// constructor patterns are only known at runtime
+		{DeadCodeElimination{}, "match 1\n    0 -> a\n    None -> b\n    1 -> c\n    _ -> d", `Match(Num(1:INTEGER) Arm(Pattern(None ) -> Variable(b)) Arm(Wildcard -> Variable(c)))`},
+		{DeadCodeElimination{}, "match x\n    1 -> a\n    _ -> b", `Match(Variable(x) Arm(Num(1:INTEGER) -> Variable(a)) Arm(Wildcard -> Variable(b)))`},
+		// inlining
+		{
+			Inlining{},
+			"func add(a:int, b:int) :int\n    a + b\nadd(1, 2) * add(3, 4)",
+			`BinOp(*:MULT Num(3:INTEGER) Num(7:INTEGER))`,
+		},
+		{
+			Inlining{},
+			"func add(a:int, b:int) :int\n    a + b\nadd(x, 2)",
+			`FuncCall(add Variable(x) Num(2:INTEGER))`,
+		},
+		{
+			Inlining{},
+			"func add(a:int, b:int) :int\n    a + b\nadd(\"1\", 2)",
+			`FuncCall(add String(1:STRING) Num(2:INTEGER))`,
+		},
+		{
+			Inlining{},
+			"func foo(a:int) :string\n    a + 1\nfoo(1)",
+			`FuncCall(foo Num(1:INTEGER))`,
+		},
+		{
+			Inlining{},
+			"func foo(a:int) :int\n    a + b\nfoo(1)",
+			`FuncCall(foo Num(1:INTEGER))`,
+		},
+		// the calls that fail are kept, so that the error is reported in the function
+		{
+			Inlining{},
+			"func div(a:int, b:int) :int\n    a / b\ndiv(1, 0)",
+			`FuncCall(div Num(1:INTEGER) Num(0:INTEGER))`,
+		},
+	}
+
+	for _, f := range fixtures {
+		file := f.pass.Run(parse(t, f.source))
+		assert.Equal(fmt.Sprintf("StatementList(%s)", f.ast), file.Statements.String(), f.source)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("preserves semantics", func(t *testing.T) {
+		fixtures := []string{
+			`2^4 + 2 * (3^2 - 1)`,
+			`+007`,
+			`007 + 0`,
+			`(-1)^101`,
+			"a := 12\na * 1 - 0",
+			"func add(a:int, b:int) :int\n    a + b\nfunc twice(s:string) :string\n    s ++ s\nx := twice(\"ab\") ++ \"c\"\nx ++ x",
+			"func add(a:int, b:int) :int\n    a + b\nb := 2\nadd(b, add(1, 3))",
+			"func f() :int\n    1\n    2\nf()",
+			`2^64 - 2^64`,
+			`2^62 + (2^62 - 1) * 2`,
+			"a := -9223372036854775807 - 1\n--a",
+			"99999999999999999999\n1",
+			`99999999999999999999 == 1`,
+			`1.5 * 2 + 0.25`,
+			`1 / 3.0`,
+			`2 ^ 0.5 - 1_000.25e-2`,
+			"a := -0.0\na + 0",
+			"a := 0.0\n0 - a",
+			"a := -1.5\n(a * 1) - 0",
+			`1e308 * 10`,
+			`-(1e308 * 10)`,
+			`99999999999999999999 + 0.5`,
+			`1 == 1.0`,
+			"func half(x:float) :float\n    x / 2\nhalf(3.0)",
+			"func half(x:float) :int\n    x / 2\nhalf(3.0)",
+			"func twice(x:int) :int\n    x * 2.0\ntwice(3)",
+			// errors
+			`"foo" ++ 1 ++ true`,
+			`1 == "1"`,
+			`1 / (1 - 1)`,
+			"a := \"foo\"\na + 0",
+			"a := \"foo\"\n--a",
+			`1 / 0.0`,
+			`1.5 ++ 1`,
+			"func add(a:int, b:int) :int\n    a + b\nadd(1)",
+			"a := \"foo\"\na * 1",
+			"a := \"foo\"\n1 * a / 1",
+			"a := -9223372036854775807 - 1\n0 - a",
+			"func div(a:int, b:int) :int\n    a / b\ndiv(1, 0)",
+			"func div(a:int, b:int) :int\n    a / b\ndiv(6, 2) + div(1, 1 - 1)",
+			"match 2\n    1 -> 1 / 0\n    2 -> 2\n    _ -> 3",
+			"match 2\n    1 -> 1\n    x -> x / 0",
+			"match \"a\"\n    \"a\" ->\n        x := 1\n        x + 1\n    _ -> 0",
+		}
+
+		for _, source := range fixtures {
+			for _, options := range [][]interpreter.Option{{}, {interpreter.CheckedArithmetic()}} {
+				expected, expectedErr := interpreter.New(&parser.Parser{}, options...).Interpret("test.ca", source)
+				result, err := interpreter.New(&parser.Parser{}, options...).Exec(Optimize(parse(t, source)))
+				assert.Equal(expected, result, source)
+				// errors are reported with the same kind, message, position and stack
+				assert.Equal(expectedErr, err, source)
+			}
+		}
+	})
+
+	t.Run("dumps the tree around each pass", func(t *testing.T) {
+		trace := &bytes.Buffer{}
+		pipeline := &Pipeline{Passes: []Pass{ConstantFolding{}}, Trace: trace}
+		pipeline.Run(parse(t, `1 + 2`))
+
+		assert.Equal(`--- before constant-folding ---
+SourceFile( StatementList(BinOp(+:PLUS Num(1:INTEGER) Num(2:INTEGER))))
+--- after constant-folding ---
+SourceFile( StatementList(Num(3:INTEGER)))
+`, trace.String())
+	})
+}
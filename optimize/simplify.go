@@ -0,0 +1,124 @@
+package optimize
+
+import (
+	"strconv"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// AlgebraicSimplification removes neutral elements and redundant unary operators.
+//
+// The type of variables is only known at runtime, so neutral elements are only
+// dropped when the other operand is known to be a number: x * 1 fails when x is a string,
+// and must fail with the same error once optimized. Adding 0 is only removed from
+// integer expressions, since -0.0 + 0 is 0.0.
+type AlgebraicSimplification struct{}
+
+// Name implements Pass
+func (AlgebraicSimplification) Name() string {
+	return "algebraic-simplification"
+}
+
+// Run implements Pass
+func (AlgebraicSimplification) Run(file *ast.SourceFile) *ast.SourceFile {
+	return ast.Rewrite(file, simplify).(*ast.SourceFile)
+}
+
+func simplify(node ast.Node) ast.Node {
+	switch n := node.(type) {
+	case *ast.BinOp:
+		return simplifyBinOp(n)
+	case *ast.UnaryOp:
+		return simplifyUnaryOp(n)
+	default:
+		return node
+	}
+}
+
+func simplifyBinOp(node *ast.BinOp) ast.Node {
+	switch node.Op.Type {
+	case tokens.PLUS:
+		if isInt(node.Right, 0) && returnsInt(node.Left) {
+			return node.Left
+		}
+		if isInt(node.Left, 0) && returnsInt(node.Right) {
+			return node.Right
+		}
+	case tokens.MINUS:
+		// 0 - x is not -x: the overflows of the smallest int are not reported alike
+		if isInt(node.Right, 0) && returnsNumber(node.Left) {
+			return node.Left
+		}
+	case tokens.MULT:
+		if isInt(node.Right, 1) && returnsNumber(node.Left) {
+			return node.Left
+		}
+		if isInt(node.Left, 1) && returnsNumber(node.Right) {
+			return node.Right
+		}
+	case tokens.DIV:
+		if isInt(node.Right, 1) && returnsNumber(node.Left) {
+			return node.Left
+		}
+	}
+	return node
+}
+
+func simplifyUnaryOp(node *ast.UnaryOp) ast.Node {
+	inner, ok := node.Expr.(*ast.UnaryOp)
+
+	switch node.Op.Type {
+	case tokens.PLUS:
+		if returnsNumber(node.Expr) {
+			// +x is only useful to make sure x is a number
+			return node.Expr
+		}
+	case tokens.NOT:
+		// !!!x is the same as !x. We can not simplify !!x since ! fails on non booleans
+		if ok && inner.Op.Type == tokens.NOT {
+			if innermost, ok := inner.Expr.(*ast.UnaryOp); ok && innermost.Op.Type == tokens.NOT {
+				return innermost
+			}
+		}
+	}
+	return node
+}
+
+// returnsNumber tells whether an expression always evaluates to a number, or fails
+func returnsNumber(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.Num, *ast.Float:
+		return true
+	case *ast.UnaryOp:
+		return n.Op.Type == tokens.PLUS || n.Op.Type == tokens.MINUS
+	case *ast.BinOp:
+		switch n.Op.Type {
+		case tokens.PLUS, tokens.MINUS, tokens.MULT, tokens.DIV, tokens.POW:
+			return true
+		}
+	}
+	return false
+}
+
+// returnsInt tells whether an expression always evaluates to an integer, or fails
+func returnsInt(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.Num:
+		return true
+	case *ast.UnaryOp:
+		return (n.Op.Type == tokens.PLUS || n.Op.Type == tokens.MINUS) && returnsInt(n.Expr)
+	case *ast.BinOp:
+		return returnsNumber(n) && returnsInt(n.Left) && returnsInt(n.Right)
+	}
+	return false
+}
+
+func isInt(node ast.Node, value int) bool {
+	num, ok := node.(*ast.Num)
+	if !ok {
+		return false
+	}
+	val, err := strconv.Atoi(num.Value)
+	return err == nil && val == value
+}
@@ -9,7 +9,8 @@ import (
 
 // TokenBuffer allows implementation of a LL(n) Recusive Descent Parser
 type TokenBuffer interface {
-	// LookAhead returns the nth token (or an error if trying to read after end of file)
+	// LookAhead returns the nth token (or an error if trying to read after end of file,
+	// or further than the size of the buffer)
 	LookAhead(n int) (*tokens.Token, error)
 
 	// Consume a token and returns the new buffer (or a syntax error)
@@ -53,9 +54,9 @@ func (b *buffer) load(n int) (*tokens.Token, error) {
 }
 
 func (b *buffer) LookAhead(n int) (*tokens.Token, error) {
-	if n >= b.size {
-		// We do not return an error. The code has to be fixed so a panic is fine
-		panic(fmt.Sprintf("parser buffer overflow"))
+	if n < 0 || n >= b.size {
+		// a bug of the parser, but it must not crash the programs parsing untrusted input
+		return nil, fmt.Errorf("parser buffer overflow: can not look %d tokens ahead with a buffer of %d", n, b.size)
 	}
 	return b.load(n)
 }
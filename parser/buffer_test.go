@@ -100,4 +100,20 @@ func TestBuffer(t *testing.T) {
 		assert.Error(err)
 	})
 
+	t.Run("look ahead further than the buffer", func(t *testing.T) {
+		buffer := NewTokenBuffer(tokenizer.Tokenize("test.ca", "1 + 2"), 2)
+
+		_, err := buffer.LookAhead(2)
+		if assert.Error(err) {
+			assert.Equal("parser buffer overflow: can not look 2 tokens ahead with a buffer of 2", err.Error())
+		}
+		_, err = buffer.LookAhead(-1)
+		assert.Error(err)
+
+		// the buffer is still usable
+		tk, err := buffer.LookAhead(0)
+		if assert.Nil(err) {
+			assert.Equal(tokens.INTEGER, tk.Type)
+		}
+	})
 }
@@ -20,10 +20,16 @@ func (p *Parser) functionDecl() (*ast.FuncDecl, error) {
 		return nil, err
 	}
 
+	params, err := p.typeParams()
+	if err != nil {
+		return nil, err
+	}
+
 	sign, err := p.signature()
 	if err != nil {
 		return nil, err
 	}
+	sign.TypeParams = params
 
 	body, err := p.block()
 	if err != nil {
@@ -51,6 +57,7 @@ func (p *Parser) signature() (*ast.Signature, error) {
 
 	return &ast.Signature{
 		Token:      pl.Token,
+		TypeParams: []*tokens.Token{},
 		Parameters: pl,
 		ReturnType: returnType,
 	}, nil
@@ -81,13 +88,15 @@ func (p *Parser) parameterList() (*ast.ParameterList, error) {
 		index++
 	}
 
-	if _, err := p.consume(tokens.RPAREN); err != nil {
+	rparen, err := p.consume(tokens.RPAREN)
+	if err != nil {
 		return nil, err
 	}
 
 	return &ast.ParameterList{
 		Token:      lparen,
 		Parameters: parameters,
+		End:        rparen,
 	}, nil
 }
 
@@ -108,3 +117,49 @@ func (p *Parser) parameterDecl() (*ast.Parameter, error) {
 		Type:  typeId,
 	}, nil
 }
+
+func (p *Parser) funcCall(name *ast.Variable) (*ast.FuncCall, error) {
+	args, rparen, err := p.arguments()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.FuncCall{
+		Token:  name.Token,
+		Module: name.Module,
+		Name:   name.Name,
+		Args:   args,
+		End:    rparen,
+	}, nil
+}
+
+// arguments reads the arguments of a call, and returns them with the closing parenthesis
+func (p *Parser) arguments() ([]ast.Node, *tokens.Token, error) {
+	if _, err := p.consume(tokens.LPAREN); err != nil {
+		return nil, nil, err
+	}
+
+	args := []ast.Node{}
+
+	for tk := p.current(); tk != nil && tk.Type != tokens.RPAREN; tk = p.current() {
+		// we expect a comma between each argument
+		if len(args) > 0 {
+			if _, err := p.consume(tokens.COMMA); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		arg, err := p.expression()
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, arg)
+	}
+
+	rparen, err := p.consume(tokens.RPAREN)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return args, rparen, nil
+}
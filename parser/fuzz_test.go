@@ -0,0 +1,50 @@
+//go:build go1.18
+// +build go1.18
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+func FuzzParse(f *testing.F) {
+	seeds := []string{
+		"import \"lib/a\"\n\ntype Shape = Circle(r:int) | Rect(w:int, h:int)\n",
+		"func area[T](s:Shape, xs:[(T, int)]) :int\n    match s\n        Circle(r) -> 3 * r * r\n        Rect(w, h) ->\n            w * h\n",
+		"q, _ := divmod(7, 2)\nx := -xs[0][1] ^ 2 ++ \"${q}\"\n",
+		"try\n    mod.f((1, \"a\"), [])\ncatch e\n    message(e)\n",
+		"match n\n    -1 -> mod.None\n    Some(_, x) -> x\n",
+		"1\n        2\n    \n\n3",
+		"func f( :int\n    1",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, source string) {
+		p := Parser{}
+		node, err := p.Parse("fuzz.ca", source)
+		if err != nil {
+			if _, ok := err.(*tokens.Error); !ok {
+				t.Fatalf("expected a *tokens.Error - got %v", err)
+			}
+			return
+		}
+		// the tree is complete: its nodes can be formatted, and none of them is nil
+		_ = node.String()
+		ast.Inspect(node, func(n ast.Node) bool {
+			if n == nil {
+				return false
+			}
+			for _, child := range n.Children() {
+				if child == nil {
+					t.Fatalf("expected the children of %s - got nil", n)
+				}
+			}
+			return true
+		})
+	})
+}
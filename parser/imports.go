@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"path"
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+func looksLikeImportDecl(tk *tokens.Token) bool {
+	return tk.Type == tokens.IMPORT
+}
+
+func (p *Parser) importDecl() (*ast.ImportDecl, error) {
+	tk, err := p.consume(tokens.IMPORT)
+	if err != nil {
+		return nil, err
+	}
+
+	modulePath, err := p.consume(tokens.STRING)
+	if err != nil {
+		return nil, err
+	}
+
+	name := ModuleName(modulePath.Value)
+	if !isIdentifier(name) {
+		return nil, errorf(modulePath, "module name %s is not a valid identifier", name)
+	}
+
+	// the end of line is optional before the end of file
+	if p.current().Type == tokens.EOL {
+		if _, err := p.consume(tokens.EOL); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ast.ImportDecl{
+		Token: tk,
+		Path:  modulePath,
+		Name:  name,
+	}, nil
+}
+
+// ModuleName returns the name of the module stored at a path: its last element, without extension
+func ModuleName(modulePath string) string {
+	return strings.TrimSuffix(path.Base(modulePath), ".cairn")
+}
+
+func isIdentifier(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, char := range []byte(name) {
+		isAlphaNum := (char >= 'A' && char <= 'Z') || (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') || char == '_'
+		if !isAlphaNum {
+			return false
+		}
+	}
+	return true
+}
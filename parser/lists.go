@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// listLit reads a list literal such as [1, 2, 3]
+func (p *Parser) listLit() (*ast.ListLit, error) {
+	lbracket, err := p.consume(tokens.LBRACKET)
+	if err != nil {
+		return nil, err
+	}
+
+	elements := []ast.Node{}
+	for tk := p.current(); tk != nil && tk.Type != tokens.RBRACKET; tk = p.current() {
+		// we expect a comma between each element
+		if len(elements) > 0 {
+			if _, err := p.consume(tokens.COMMA); err != nil {
+				return nil, err
+			}
+		}
+
+		element, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+
+	rbracket, err := p.consume(tokens.RBRACKET)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.ListLit{Token: lbracket, Elements: elements, End: rbracket}, nil
+}
+
+// index reads the index following an expression, such as [0] in xs[0]
+func (p *Parser) index(expr ast.Node) (*ast.Index, error) {
+	lbracket, err := p.consume(tokens.LBRACKET)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	rbracket, err := p.consume(tokens.RBRACKET)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.Index{Token: lbracket, Expr: expr, Index: index, End: rbracket}, nil
+}
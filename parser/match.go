@@ -0,0 +1,174 @@
+package parser
+
+import (
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+func looksLikeMatch(tk *tokens.Token) bool {
+	return tk.Type == tokens.MATCH
+}
+
+// match reads a match expression. Its arms are written on indented lines:
+//
+//	match shape
+//	    Circle(r) -> 3 * r * r
+//	    Rect(w, h) -> w * h
+func (p *Parser) match() (*ast.Match, error) {
+	tk, err := p.consume(tokens.MATCH)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.consume(tokens.BEGIN); err != nil {
+		return nil, err
+	}
+
+	arms := []*ast.MatchArm{}
+	for current := p.current(); current.Type != tokens.END && current.Type != tokens.EOF; current = p.current() {
+		if current.Type == tokens.EOL {
+			if _, err := p.consume(tokens.EOL); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		arm, err := p.matchArm()
+		if err != nil {
+			return nil, err
+		}
+		arms = append(arms, arm)
+	}
+
+	if len(arms) == 0 {
+		return nil, errorf(p.current(), "match expects at least one arm")
+	}
+
+	// the end of file closes all the blocks that are still open
+	if p.current().Type != tokens.EOF {
+		if _, err := p.consume(tokens.END); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ast.Match{
+		Token:   tk,
+		Subject: subject,
+		Arms:    arms,
+	}, nil
+}
+
+func (p *Parser) matchArm() (*ast.MatchArm, error) {
+	pattern, err := p.pattern()
+	if err != nil {
+		return nil, err
+	}
+
+	arrow, err := p.consume(tokens.ARROW)
+	if err != nil {
+		return nil, err
+	}
+
+	// the body is either an expression on the same line, or an indented block
+	var body ast.Node
+	if p.current().Type == tokens.BEGIN {
+		body, err = p.block()
+	} else {
+		body, err = p.expression()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.MatchArm{
+		Token:   arrow,
+		Pattern: pattern,
+		Body:    body,
+	}, nil
+}
+
+func (p *Parser) pattern() (ast.Node, error) {
+	tk := p.current()
+
+	switch tk.Type {
+	case tokens.IDENTIFIER:
+		return p.identifierPattern()
+	case tokens.MINUS:
+		// negative number
+		if _, err := p.consume(tokens.MINUS); err != nil {
+			return nil, err
+		}
+		number := p.current()
+		if number.Type != tokens.INTEGER && number.Type != tokens.FLOAT {
+			return nil, errorf(number, "expected a number after - in pattern - got %s", number)
+		}
+		if _, err := p.consume(number.Type); err != nil {
+			return nil, err
+		}
+		negative := &tokens.Token{Type: number.Type, Value: "-" + number.Value, Position: tk.Position, End: number.End}
+		if number.Type == tokens.FLOAT {
+			return &ast.Float{Token: negative, Value: negative.Value}, nil
+		}
+		return &ast.Num{Token: negative, Value: negative.Value}, nil
+	case tokens.INTEGER, tokens.FLOAT, tokens.STRING, tokens.BOOL:
+		return p.basicLit()
+	default:
+		return nil, errorf(tk, "expected a pattern - got %s", tk)
+	}
+}
+
+// identifierPattern reads a wildcard, a binding or a constructor pattern.
+// Constructors start with a capital letter, are qualified or have arguments
+func (p *Parser) identifierPattern() (ast.Node, error) {
+	id, err := p.consume(tokens.IDENTIFIER)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := &ast.ConstructorPattern{Token: id, Name: id.Value, Args: []ast.Node{}}
+	switch {
+	case id.Value == "_":
+		return &ast.WildcardPattern{Token: id}, nil
+	case p.current().Type == tokens.DOT:
+		ident, err := p.qualifiedIdent()
+		if err != nil {
+			return nil, err
+		}
+		pattern.Module = id.Value
+		pattern.Name = ident.Value
+		pattern.End = ident
+	case p.current().Type != tokens.LPAREN && !isCapitalized(id.Value):
+		return &ast.BindingPattern{Token: id, Name: id.Value}, nil
+	}
+
+	if p.current().Type != tokens.LPAREN {
+		return pattern, nil
+	}
+	if _, err := p.consume(tokens.LPAREN); err != nil {
+		return nil, err
+	}
+	for tk := p.current(); tk.Type != tokens.RPAREN; tk = p.current() {
+		// we expect a comma between each argument
+		if len(pattern.Args) > 0 {
+			if _, err := p.consume(tokens.COMMA); err != nil {
+				return nil, err
+			}
+		}
+
+		arg, err := p.pattern()
+		if err != nil {
+			return nil, err
+		}
+		pattern.Args = append(pattern.Args, arg)
+	}
+	if pattern.End, err = p.consume(tokens.RPAREN); err != nil {
+		return nil, err
+	}
+
+	return pattern, nil
+}
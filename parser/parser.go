@@ -11,39 +11,92 @@ import (
 // Parser reads a text and converts it to an AST using the Tokenizer
 type Parser struct {
 	buffer TokenBuffer
+	// tokenizerErr is the first error returned by the tokenizer
+	tokenizerErr error
 }
 
-// Parse builds an AST from a text
+// Parse builds an AST from a text.
+// Syntax errors are returned as *tokens.Error
 func (p *Parser) Parse(fileName, text string) (ast.Node, error) {
-	p.buffer = NewTokenBuffer(tokenizer.Tokenize(fileName, text), 2)
+	t := tokenizer.Tokenize(fileName, text)
+	p.buffer = NewTokenBuffer(t, 2)
+	p.tokenizerErr = nil
+	// the tokenizer blocks until its tokens are read: a syntax error would leave it running forever
+	defer t.Drain()
 
 	return p.sourceFile()
 }
 
+// current returns the current token. A tokenizer error is returned as an ERROR token
+// so that the parser fails with the tokenizer message
 func (p *Parser) current() *tokens.Token {
-	// LookAhead(0) never returns an error since it does not have to preload a new token
-	current, _ := p.buffer.LookAhead(0)
+	current, err := p.lookAhead(0)
+	if err != nil {
+		tk := &tokens.Token{Type: tokens.ERROR, Value: p.tokenizerErr.Error()}
+		if serr, ok := p.tokenizerErr.(*tokens.Error); ok {
+			tk.Value = serr.Message
+			tk.Position = serr.Pos
+		}
+		return tk
+	}
 	return current
 }
 
+// errorf creates a syntax error located at a token
+func errorf(tk *tokens.Token, format string, args ...interface{}) error {
+	if tk.Type == tokens.ERROR {
+		// the tokenizer error explains the problem better
+		return &tokens.Error{Pos: tk.Position, Message: tk.Value}
+	}
+	return &tokens.Error{Pos: tk.Position, Message: fmt.Sprintf(format, args...)}
+}
+
 func (p *Parser) lookAhead(n int) (*tokens.Token, error) {
-	return p.buffer.LookAhead(n)
+	tk, err := p.buffer.LookAhead(n)
+	if err != nil && p.tokenizerErr == nil {
+		// the tokenizer stops after an error, so it must be kept for later
+		p.tokenizerErr = err
+	}
+	return tk, err
 }
 
 func (p *Parser) consume(tkType tokens.TokenType) (*tokens.Token, error) {
-	tk, newBuffer, err := p.buffer.Consume()
+	tk := p.current()
 	if tk.Type != tkType {
-		return nil, fmt.Errorf("wrong input type. Expected %s - got %s", tkType, p.current())
+		return nil, errorf(tk, "wrong input type. Expected %s - got %s", tkType, tk)
+	}
+
+	_, newBuffer, err := p.buffer.Consume()
+	if err != nil {
+		return nil, err
 	}
 
 	// let's use mutation for now
 	p.buffer = newBuffer
-	return tk, err
+	return tk, nil
 }
 
 func (p *Parser) sourceFile() (*ast.SourceFile, error) {
+	imports := []*ast.ImportDecl{}
+	for tk := p.skipEmptyLines(); looksLikeImportDecl(tk); tk = p.skipEmptyLines() {
+		i, err := p.importDecl()
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, i)
+	}
+
+	types := []*ast.TypeDecl{}
+	for tk := p.skipEmptyLines(); looksLikeTypeDecl(tk); tk = p.skipEmptyLines() {
+		t, err := p.typeDecl()
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+
 	functions := []*ast.FuncDecl{}
-	for tk := p.current(); looksLikeFunctionDecl(tk); tk = p.current() {
+	for tk := p.skipEmptyLines(); looksLikeFunctionDecl(tk); tk = p.skipEmptyLines() {
 		f, err := p.functionDecl()
 		if err != nil {
 			return nil, err
@@ -57,11 +110,21 @@ func (p *Parser) sourceFile() (*ast.SourceFile, error) {
 	}
 
 	return &ast.SourceFile{
+		Imports:    imports,
+		Types:      types,
 		Functions:  functions,
 		Statements: statements,
 	}, nil
 }
 
+// skipEmptyLines consumes the ends of line separating declarations, and returns the current token
+func (p *Parser) skipEmptyLines() *tokens.Token {
+	for p.current().Type == tokens.EOL {
+		p.consume(tokens.EOL)
+	}
+	return p.current()
+}
+
 func (p *Parser) statementList() (*ast.StatementList, error) {
 	statements := []ast.Statement{}
 
@@ -77,6 +140,10 @@ func (p *Parser) statementList() (*ast.StatementList, error) {
 		if err != nil {
 			return nil, err
 		}
+		// a blank line indented deeper than the statements opens a block holding nothing
+		if block, ok := st.(*ast.BlockStmt); ok && len(block.Statements.Statements) == 0 {
+			continue
+		}
 		statements = append(statements, st)
 	}
 	return &ast.StatementList{Statements: statements}, nil
@@ -102,9 +169,12 @@ func (p *Parser) block() (*ast.BlockStmt, error) {
 		return nil, err
 	}
 
-	end, err := p.consume(tokens.END)
-	if err != nil {
-		return nil, err
+	// the end of file closes all the blocks that are still open
+	end := p.current()
+	if end.Type != tokens.EOF {
+		if end, err = p.consume(tokens.END); err != nil {
+			return nil, err
+		}
 	}
 
 	return &ast.BlockStmt{
@@ -121,12 +191,20 @@ func (p *Parser) simpleStmt() (ast.Node, error) {
 	switch {
 	case looksLikeAssignment(tk, next):
 		return p.assignment()
+	case looksLikeDestructuring(tk, next):
+		return p.destructuring()
 	default:
 		return p.expression()
 	}
 }
 
 func (p *Parser) expression() (ast.Node, error) {
+	if looksLikeMatch(p.current()) {
+		return p.match()
+	}
+	if looksLikeTry(p.current()) {
+		return p.try()
+	}
 	return p.computeExpression(0)
 }
 
@@ -216,11 +294,29 @@ func (p *Parser) unaryExpr() (ast.Node, error) {
 }
 
 func looksLikePrimaryExpression(tk *tokens.Token) bool {
-	return looksLikeOperandName(tk) || tk.Type == tokens.LPAREN || looksLikeLitteral(tk)
+	return looksLikeOperandName(tk) || tk.Type == tokens.LPAREN || tk.Type == tokens.LBRACKET || looksLikeLitteral(tk)
 }
 
 func (p *Parser) primaryExpression() (ast.Node, error) {
-	return p.operand()
+	nd, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	// only named functions can be called for now
+	if v, ok := nd.(*ast.Variable); ok && p.current().Type == tokens.LPAREN {
+		if nd, err = p.funcCall(v); err != nil {
+			return nil, err
+		}
+	}
+
+	for p.current().Type == tokens.LBRACKET {
+		if nd, err = p.index(nd); err != nil {
+			return nil, err
+		}
+	}
+
+	return nd, nil
 }
 
 func (p *Parser) operand() (ast.Node, error) {
@@ -230,20 +326,9 @@ func (p *Parser) operand() (ast.Node, error) {
 	case looksLikeOperandName(tk):
 		return p.operandName()
 	case tk.Type == tokens.LPAREN:
-		if _, err := p.consume(tokens.LPAREN); err != nil {
-			return nil, err
-		}
-
-		nd, err := p.expression()
-		if err != nil {
-			return nil, err
-		}
-
-		if _, err := p.consume(tokens.RPAREN); err != nil {
-			return nil, err
-		}
-
-		return nd, nil
+		return p.parenthesized()
+	case tk.Type == tokens.LBRACKET:
+		return p.listLit()
 	default:
 		return p.literal()
 	}
@@ -258,23 +343,78 @@ func (p *Parser) operandName() (ast.Node, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	if p.current().Type == tokens.DOT {
+		ident, err := p.qualifiedIdent()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Variable{Token: id, Module: id.Value, Name: ident.Value, End: ident}, nil
+	}
+
 	return &ast.Variable{Token: id, Name: id.Value}, nil
 }
 
 func looksLikeLitteral(tk *tokens.Token) bool {
-	return tk.Type == tokens.INTEGER || tk.Type == tokens.STRING || tk.Type == tokens.BOOL
+	switch tk.Type {
+	case tokens.INTEGER, tokens.FLOAT, tokens.STRING, tokens.BOOL, tokens.STRINGSTART:
+		return true
+	default:
+		return false
+	}
 }
 
 func (p *Parser) literal() (ast.Node, error) {
+	if p.current().Type == tokens.STRINGSTART {
+		return p.interpolation()
+	}
 	return p.basicLit()
 }
 
+func (p *Parser) interpolation() (ast.Node, error) {
+	start, err := p.consume(tokens.STRINGSTART)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &ast.Interpolation{Token: start, Parts: []ast.Node{}}
+	if start.Value != "" {
+		node.Parts = append(node.Parts, &ast.String{Token: start, Value: start.Value})
+	}
+
+	for {
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		node.Parts = append(node.Parts, expr)
+
+		tk := p.current()
+		if tk.Type != tokens.STRINGPART && tk.Type != tokens.STRINGEND {
+			return nil, errorf(tk, "expected } at the end of an embedded expression - got %s", tk)
+		}
+		if _, err := p.consume(tk.Type); err != nil {
+			return nil, err
+		}
+		if tk.Value != "" {
+			node.Parts = append(node.Parts, &ast.String{Token: tk, Value: tk.Value})
+		}
+		if tk.Type == tokens.STRINGEND {
+			node.End = tk
+			return node, nil
+		}
+	}
+}
+
 func (p *Parser) basicLit() (ast.Node, error) {
 	tk := p.current()
 	switch tk.Type {
 	case tokens.INTEGER:
 		p.consume(tk.Type)
 		return &ast.Num{Token: tk, Value: tk.Value}, nil
+	case tokens.FLOAT:
+		p.consume(tk.Type)
+		return &ast.Float{Token: tk, Value: tk.Value}, nil
 	case tokens.STRING:
 		p.consume(tk.Type)
 		return &ast.String{Token: tk, Value: tk.Value}, nil
@@ -282,7 +422,7 @@ func (p *Parser) basicLit() (ast.Node, error) {
 		p.consume(tk.Type)
 		return &ast.Bool{Token: tk, Value: tk.Value}, nil
 	default:
-		return nil, fmt.Errorf("unexpected basic litteral: %s:%s", tk.Value, tk.Type)
+		return nil, errorf(tk, "expected a literal - got %s", tk.Describe())
 	}
 }
 
@@ -292,13 +432,20 @@ func (p *Parser) typeId() (*ast.TypeId, error) {
 		return nil, err
 	}
 
-	name, err := p.consume(tokens.IDENTIFIER)
+	typeId, err := p.typeName()
 	if err != nil {
 		return nil, err
 	}
 
-	return &ast.TypeId{
-		Token: tk,
-		Name:  name.Value,
-	}, nil
+	// type errors are reported at the column
+	typeId.Token = tk
+	return typeId, nil
+}
+
+// qualifiedIdent reads the identifier following a module name and a DOT
+func (p *Parser) qualifiedIdent() (*tokens.Token, error) {
+	if _, err := p.consume(tokens.DOT); err != nil {
+		return nil, err
+	}
+	return p.consume(tokens.IDENTIFIER)
 }
@@ -2,8 +2,11 @@ package parser
 
 import (
 	"fmt"
+	"runtime"
 	"testing"
+	"time"
 
+	"github.com/fchoquet/cairn/tokens"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -102,6 +105,10 @@ func TestParser(t *testing.T) {
 				`true && (false || true)`,
 				`BinOp(&&:AND Bool(true:BOOL) BinOp(||:OR Bool(false:BOOL) Bool(true:BOOL)))`,
 			},
+			{
+				`1.5 * 2`,
+				`BinOp(*:MULT Float(1.5:FLOAT) Num(2:INTEGER))`,
+			},
 			// complex operator precedence
 			{
 				`2*2==2^2 && true==(2==2)`,
@@ -118,4 +125,350 @@ func TestParser(t *testing.T) {
 			assert.Equal(fmt.Sprintf("SourceFile( StatementList(%s))", f.ast), node.String())
 		}
 	})
+
+	t.Run("function calls", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			ast    string
+		}{
+			{
+				`foo()`,
+				`FuncCall(foo )`,
+			},
+			{
+				`add(1, 2 * 3)`,
+				`FuncCall(add Num(1:INTEGER) BinOp(*:MULT Num(2:INTEGER) Num(3:INTEGER)))`,
+			},
+			{
+				`-add(foo(1), bar) + 1`,
+				`BinOp(+:PLUS UnaryOp(-:MINUS FuncCall(add FuncCall(foo Num(1:INTEGER)) Variable(bar))) Num(1:INTEGER))`,
+			},
+		}
+
+		for _, f := range fixtures {
+			parser := Parser{}
+			node, err := parser.Parse("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				break
+			}
+			assert.Equal(fmt.Sprintf("SourceFile( StatementList(%s))", f.ast), node.String())
+		}
+
+		for _, source := range []string{`add(1 2)`, `add(1,)`, `add(1`} {
+			parser := Parser{}
+			_, err := parser.Parse("test.ca", source)
+			assert.Error(err, source)
+		}
+	})
+
+	t.Run("interpolations", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			ast    string
+		}{
+			{
+				`"hello ${name}!"`,
+				`Interpolation(String(hello :STRINGSTART) Variable(name) String(!:STRINGEND))`,
+			},
+			{
+				`"${a}${b + 1}"`,
+				`Interpolation(Variable(a) BinOp(+:PLUS Variable(b) Num(1:INTEGER)))`,
+			},
+		}
+
+		for _, f := range fixtures {
+			parser := Parser{}
+			node, err := parser.Parse("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				break
+			}
+			assert.Equal(fmt.Sprintf("SourceFile( StatementList(%s))", f.ast), node.String())
+		}
+	})
+
+	t.Run("imports", func(t *testing.T) {
+		parser := Parser{}
+		node, err := parser.Parse("test.ca", "import \"lib/util\"\nimport \"math.cairn\"\nutil.F(math.Pi) + util.x")
+		if assert.Nil(err) {
+			assert.Equal(
+				`SourceFile(Import(lib/util); Import(math.cairn) StatementList(BinOp(+:PLUS FuncCall(util.F Variable(math.Pi)) Variable(util.x))))`,
+				node.String(),
+			)
+		}
+
+		for _, source := range []string{`import "lib/util-x"`, "1\nimport \"util\"", `import util`} {
+			parser := Parser{}
+			_, err := parser.Parse("test.ca", source)
+			assert.Error(err, source)
+		}
+	})
+
+	t.Run("sum types and match", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			ast    string
+		}{
+			{
+				"type Shape = Circle(r:int) | Rect(w:int, h:int) | Empty\n1",
+				`SourceFile(TypeDecl(Shape Constructor(Circle Parameter(r Type(int))) | Constructor(Rect Parameter(w Type(int)) Parameter(h Type(int))) | Constructor(Empty )) StatementList(Num(1:INTEGER)))`,
+			},
+			{
+				"type Color =\n    | Red\n    | geo.Point\n",
+				"",
+			},
+			{
+				"type Color =\n    | Red\n    | Green\n",
+				`SourceFile(TypeDecl(Color Constructor(Red ) | Constructor(Green )) StatementList())`,
+			},
+			{
+				"x := match s\n    Circle(r) -> r\n    geo.Point(_, -1.5) -> 0\n    Empty -> 1\n    \"a\" ->\n        a := 2\n        a\n    other -> 3\nx",
+				`SourceFile( StatementList(Assign(Variable(x) Match(Variable(s) ` +
+					`Arm(Pattern(Circle Binding(r)) -> Variable(r)) ` +
+					`Arm(Pattern(geo.Point Wildcard Float(-1.5:FLOAT)) -> Num(0:INTEGER)) ` +
+					`Arm(Pattern(Empty ) -> Num(1:INTEGER)) ` +
+					`Arm(String(a:STRING) -> BlockStmt(BEGIN2:BEGIN StatementList(Assign(Variable(a) Num(2:INTEGER)); Variable(a)) END2:END)) ` +
+					`Arm(Binding(other) -> Num(3:INTEGER)))); Variable(x)))`,
+			},
+		}
+
+		for _, f := range fixtures {
+			parser := Parser{}
+			node, err := parser.Parse("test.ca", f.source)
+			if f.ast == "" {
+				assert.Error(err, f.source)
+				continue
+			}
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.ast, node.String(), f.source)
+		}
+
+		for _, source := range []string{"type Shape = circle", "type Shape = Circle(r)", "match x\n1", "match x\n    1 2", "match x\n    Some(1 -> 2"} {
+			parser := Parser{}
+			_, err := parser.Parse("test.ca", source)
+			assert.Error(err, source)
+		}
+	})
+
+	t.Run("generics and lists", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			ast    string
+		}{
+			{
+				"func first[T](xs:[T]) :T\n    xs[0]\nfirst([1, 2])",
+				`SourceFile(FuncDecl(first:IDENTIFIER Signature([T] ParameterList(Parameter(xs Type([T]))) Type(T)) ` +
+					`BlockStmt(BEGIN1:BEGIN StatementList(Index(Variable(xs) Num(0:INTEGER))) END1:END)) ` +
+					`StatementList(FuncCall(first List(Num(1:INTEGER) Num(2:INTEGER)))))`,
+			},
+			{
+				"type Pair[A, B] = Pair(first:A, second:geo.Option[[B]])\n[]",
+				`SourceFile(TypeDecl(Pair[A, B] Constructor(Pair Parameter(first Type(A)) Parameter(second Type(geo.Option[[B]])))) StatementList(List()))`,
+			},
+			{
+				"xs := [[1], f(2)[0]]\nxs[0][1 + 1]",
+				`SourceFile( StatementList(Assign(Variable(xs) List(List(Num(1:INTEGER)) Index(FuncCall(f Num(2:INTEGER)) Num(0:INTEGER)))); ` +
+					`Index(Index(Variable(xs) Num(0:INTEGER)) BinOp(+:PLUS Num(1:INTEGER) Num(1:INTEGER)))))`,
+			},
+			// declarations may be separated by empty lines
+			{
+				"type A = A\n\nfunc f() :int\n    1\n\nfunc g() :int\n    2\n\nf()",
+				`SourceFile(TypeDecl(A Constructor(A )); FuncDecl(f:IDENTIFIER Signature(ParameterList() Type(int)) BlockStmt(BEGIN1:BEGIN StatementList(Num(1:INTEGER)) END1:END)); ` +
+					`FuncDecl(g:IDENTIFIER Signature(ParameterList() Type(int)) BlockStmt(BEGIN1:BEGIN StatementList(Num(2:INTEGER)) END1:END)) StatementList(FuncCall(f )))`,
+			},
+		}
+
+		for _, f := range fixtures {
+			parser := Parser{}
+			node, err := parser.Parse("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.ast, node.String(), f.source)
+		}
+
+		for _, source := range []string{"func f[](x:int) :int\n    1", "func f[T x:T) :int\n    1", "func f(x:[int) :int\n    1", "type Box[T = Box(v:T)", "[1, 2", "xs[]", "xs[1"} {
+			parser := Parser{}
+			_, err := parser.Parse("test.ca", source)
+			assert.Error(err, source)
+		}
+	})
+
+	t.Run("tuples", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			ast    string
+		}{
+			{
+				"func divmod(a:int, b:int) :(int, int)\n    (a / b, 0)\nq, _ := divmod(7, 2)",
+				`SourceFile(FuncDecl(divmod:IDENTIFIER Signature(ParameterList(Parameter(a Type(int)) Parameter(b Type(int))) Type((int, int))) ` +
+					`BlockStmt(BEGIN1:BEGIN StatementList(Tuple(BinOp(/:DIV Variable(a) Variable(b)) Num(0:INTEGER))) END1:END)) ` +
+					`StatementList(Destructure(Variable(q) Variable(_) FuncCall(divmod Num(7:INTEGER) Num(2:INTEGER)))))`,
+			},
+			{
+				"type Pair = Pair(p:((int, string), [(bool, int)]), q:(int))\n((1 + 2), (3, 4))",
+				`SourceFile(TypeDecl(Pair Constructor(Pair Parameter(p Type(((int, string), [(bool, int)]))) Parameter(q Type(int)))) ` +
+					`StatementList(Tuple(BinOp(+:PLUS Num(1:INTEGER) Num(2:INTEGER)) Tuple(Num(3:INTEGER) Num(4:INTEGER)))))`,
+			},
+		}
+
+		for _, f := range fixtures {
+			parser := Parser{}
+			node, err := parser.Parse("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.ast, node.String(), f.source)
+		}
+
+		for _, source := range []string{"(1, 2", "(1, )", "a, := 1", "a, b = 1", "a, 1 := 1", "func f() :(int, ) \n    1"} {
+			parser := Parser{}
+			_, err := parser.Parse("test.ca", source)
+			assert.Error(err, source)
+		}
+	})
+
+	t.Run("try", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			ast    string
+		}{
+			{
+				"x := try\n    1 / 0\ncatch e\n    message(e)\nx",
+				`SourceFile( StatementList(Assign(Variable(x) Try(BlockStmt(BEGIN1:BEGIN StatementList(BinOp(/:DIV Num(1:INTEGER) Num(0:INTEGER))) END1:END) ` +
+					`Catch(Variable(e) BlockStmt(BEGIN1:BEGIN StatementList(FuncCall(message Variable(e))) END1:END)))); Variable(x)))`,
+			},
+			{
+				// nested try, and blank lines before catch
+				"try\n    try\n        1\n    catch e\n        2\n\ncatch _\n    3",
+				`SourceFile( StatementList(Try(BlockStmt(BEGIN1:BEGIN StatementList(Try(BlockStmt(BEGIN2:BEGIN StatementList(Num(1:INTEGER)) END2:END) ` +
+					`Catch(Variable(e) BlockStmt(BEGIN2:BEGIN StatementList(Num(2:INTEGER)) END2:END)))) END1:END) ` +
+					`Catch(Variable(_) BlockStmt(BEGIN1:BEGIN StatementList(Num(3:INTEGER)) :EOF)))))`,
+			},
+		}
+
+		for _, f := range fixtures {
+			parser := Parser{}
+			node, err := parser.Parse("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.ast, node.String(), f.source)
+		}
+
+		errors := []struct {
+			source string
+			err    string
+		}{
+			{"try 1\ncatch e\n    2", "test.ca:1:5: expected an indented block after try - got 1:INTEGER"},
+			{"try\n    1\n2", "test.ca:3:1: expected catch after the try block - got 2:INTEGER"},
+			{"try\n    1\ncatch\n    2", "test.ca:3:6: wrong input type. Expected IDENTIFIER - got BEGIN1:BEGIN"},
+			{"try\n    1\ncatch e 2", "test.ca:3:9: expected an indented block after catch - got 2:INTEGER"},
+		}
+		for _, f := range errors {
+			parser := Parser{}
+			_, err := parser.Parse("test.ca", f.source)
+			if assert.Error(err, f.source) {
+				assert.Equal(f.err, err.Error(), f.source)
+			}
+		}
+	})
+
+	t.Run("the end of file closes blocks", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			ast    string
+		}{
+			{
+				"func f() :int\n    1\n\nf()",
+				`SourceFile(FuncDecl(f:IDENTIFIER Signature(ParameterList() Type(int)) BlockStmt(BEGIN1:BEGIN StatementList(Num(1:INTEGER)) END1:END)) StatementList(FuncCall(f )))`,
+			},
+			{
+				"func f() :int\n    1",
+				`SourceFile(FuncDecl(f:IDENTIFIER Signature(ParameterList() Type(int)) BlockStmt(BEGIN1:BEGIN StatementList(Num(1:INTEGER)) :EOF)) StatementList())`,
+			},
+			{
+				// nested blocks are all closed
+				"func f() :int\n    try\n        1\n    catch e\n        2",
+				`SourceFile(FuncDecl(f:IDENTIFIER Signature(ParameterList() Type(int)) BlockStmt(BEGIN1:BEGIN StatementList(Try(BlockStmt(BEGIN2:BEGIN StatementList(Num(1:INTEGER)) END2:END) ` +
+					`Catch(Variable(e) BlockStmt(BEGIN2:BEGIN StatementList(Num(2:INTEGER)) :EOF)))) :EOF)) StatementList())`,
+			},
+			{
+				// a blank line indented deeper than the statements does not open an empty block
+				"func f() :int\n    1\n        \n    2\n        ",
+				`SourceFile(FuncDecl(f:IDENTIFIER Signature(ParameterList() Type(int)) BlockStmt(BEGIN1:BEGIN StatementList(Num(1:INTEGER); Num(2:INTEGER)) :EOF)) StatementList())`,
+			},
+		}
+
+		for _, f := range fixtures {
+			parser := Parser{}
+			node, err := parser.Parse("test.ca", f.source)
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+			assert.Equal(f.ast, node.String(), f.source)
+		}
+	})
+
+	t.Run("syntax errors are located", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			pos    string
+		}{
+			{`1 +`, `test.ca:1:4`},
+			{`add(1 2)`, `test.ca:1:7`},
+			{"a := 1\nb := \"foo", `test.ca:2:6`},
+			{`"a ${}"`, `test.ca:1:4`},
+			{`"a ${x} ${ }"`, `test.ca:1:9`},
+			{`"a ${1 +}"`, `test.ca:1:9`},
+			{`"${x y}"`, `test.ca:1:6`},
+			{`"ok ${"\q"}"`, `test.ca:1:8`},
+		}
+
+		for _, f := range fixtures {
+			parser := Parser{}
+			_, err := parser.Parse("test.ca", f.source)
+			serr, ok := err.(*tokens.Error)
+			if !assert.True(ok, f.source) {
+				continue
+			}
+			assert.Equal(f.pos, fmt.Sprintf("%s:%d:%d", serr.Pos.File, serr.Pos.Line, serr.Pos.Col), f.source)
+		}
+	})
+
+	t.Run("syntax errors name the tokens as they are written", func(t *testing.T) {
+		fixtures := []struct {
+			source   string
+			expected string
+		}{
+			{`1 +`, `test.ca:1:4: expected a literal - got end of file`},
+			{`x := )`, `test.ca:1:6: expected a literal - got )`},
+			{`"a ${1 +}"`, `test.ca:1:9: expected a literal - got }`},
+			{`"a ${x`, `test.ca:1:7: could not find end of string literal`},
+		}
+
+		for _, f := range fixtures {
+			parser := Parser{}
+			_, err := parser.Parse("test.ca", f.source)
+			if assert.Error(err, f.source) {
+				assert.Equal(f.expected, err.Error(), f.source)
+			}
+		}
+	})
+}
+
+func TestParserStopsTheTokenizer(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for index := 0; index < 100; index++ {
+		p := Parser{}
+		_, err := p.Parse("test.ca", "func f( 1 2 3 4 5 6")
+		assert.Error(t, err)
+	}
+
+	// the tokenizers end once their channel is closed
+	for attempt := 0; attempt < 100 && runtime.NumGoroutine() > before; attempt++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, runtime.NumGoroutine() <= before, "the tokenizers of invalid programs must end")
 }
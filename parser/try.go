@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+func looksLikeTry(tk *tokens.Token) bool {
+	return tk.Type == tokens.TRY
+}
+
+// try reads a try expression. Both the guarded code and the handler are indented blocks:
+//
+//	try
+//	    parseInt(s)
+//	catch e
+//	    0
+func (p *Parser) try() (*ast.Try, error) {
+	tk, err := p.consume(tokens.TRY)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.guardedBlock(tk)
+	if err != nil {
+		return nil, err
+	}
+
+	if current := p.skipEmptyLines(); current.Type != tokens.CATCH {
+		return nil, errorf(current, "expected catch after the try block - got %s", current)
+	}
+	catch, err := p.consume(tokens.CATCH)
+	if err != nil {
+		return nil, err
+	}
+	id, err := p.consume(tokens.IDENTIFIER)
+	if err != nil {
+		return nil, err
+	}
+
+	handler, err := p.guardedBlock(catch)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.Try{
+		Token:    tk,
+		Body:     body,
+		Variable: &ast.Variable{Token: id, Name: id.Value},
+		Handler:  handler,
+	}, nil
+}
+
+// guardedBlock reads the indented block following a try or a catch keyword
+func (p *Parser) guardedBlock(keyword *tokens.Token) (*ast.BlockStmt, error) {
+	if current := p.current(); current.Type != tokens.BEGIN {
+		return nil, errorf(current, "expected an indented block after %s - got %s", keyword.Value, current)
+	}
+	return p.block()
+}
@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// parenthesized reads an expression between parentheses, or a tuple literal such as (1, "a")
+func (p *Parser) parenthesized() (ast.Node, error) {
+	lparen, err := p.consume(tokens.LPAREN)
+	if err != nil {
+		return nil, err
+	}
+
+	nd, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.current().Type == tokens.COMMA {
+		tuple := &ast.TupleLit{Token: lparen, Elements: []ast.Node{nd}}
+		for p.current().Type == tokens.COMMA {
+			if _, err := p.consume(tokens.COMMA); err != nil {
+				return nil, err
+			}
+			element, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			tuple.Elements = append(tuple.Elements, element)
+		}
+		nd = tuple
+	}
+
+	rparen, err := p.consume(tokens.RPAREN)
+	if err != nil {
+		return nil, err
+	}
+
+	if tuple, ok := nd.(*ast.TupleLit); ok {
+		tuple.End = rparen
+	}
+	return nd, nil
+}
+
+// tupleType reads a tuple type such as (int, string). A single type between parentheses is not a tuple
+func (p *Parser) tupleType() (*ast.TypeId, error) {
+	lparen, err := p.consume(tokens.LPAREN)
+	if err != nil {
+		return nil, err
+	}
+
+	elements := []*ast.TypeId{}
+	for {
+		element, err := p.typeName()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+
+		if p.current().Type != tokens.COMMA {
+			break
+		}
+		if _, err := p.consume(tokens.COMMA); err != nil {
+			return nil, err
+		}
+	}
+
+	rparen, err := p.consume(tokens.RPAREN)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(elements) == 1 {
+		return elements[0], nil
+	}
+	return &ast.TypeId{Token: lparen, Name: ast.TupleType, Args: elements, End: rparen}, nil
+}
+
+func looksLikeDestructuring(tk1 *tokens.Token, tk2 *tokens.Token) bool {
+	return tk1.Type == tokens.IDENTIFIER && tk2 != nil && tk2.Type == tokens.COMMA
+}
+
+// destructuring reads the assignment of the elements of a tuple, such as q, r := divmod(7, 2)
+func (p *Parser) destructuring() (ast.Node, error) {
+	variables := []*ast.Variable{}
+	for {
+		id, err := p.consume(tokens.IDENTIFIER)
+		if err != nil {
+			return nil, err
+		}
+		variables = append(variables, &ast.Variable{Token: id, Name: id.Value})
+
+		if p.current().Type != tokens.COMMA {
+			break
+		}
+		if _, err := p.consume(tokens.COMMA); err != nil {
+			return nil, err
+		}
+	}
+
+	op, err := p.consume(tokens.ASSIGN)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.Destructuring{
+		Token:     op,
+		Variables: variables,
+		Right:     right,
+	}, nil
+}
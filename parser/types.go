@@ -0,0 +1,244 @@
+package parser
+
+import (
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+func looksLikeTypeDecl(tk *tokens.Token) bool {
+	return tk.Type == tokens.TYPE
+}
+
+// typeDecl reads a sum type declaration. Constructors are either written on the same line:
+//
+//	type Shape = Circle(r:int) | Rect(w:int, h:int)
+//
+// or on their own indented lines, each one starting with a |
+func (p *Parser) typeDecl() (*ast.TypeDecl, error) {
+	tk, err := p.consume(tokens.TYPE)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := p.consume(tokens.IDENTIFIER)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := p.typeParams()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.consume(tokens.DEFINE); err != nil {
+		return nil, err
+	}
+
+	var constructors []*ast.Constructor
+	if p.current().Type == tokens.BEGIN {
+		constructors, err = p.constructorLines()
+	} else {
+		constructors, err = p.constructorList()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the end of line is optional before the end of file
+	if p.current().Type == tokens.EOL {
+		if _, err := p.consume(tokens.EOL); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ast.TypeDecl{
+		Token:        tk,
+		Name:         name,
+		Params:       params,
+		Constructors: constructors,
+	}, nil
+}
+
+// constructorList reads constructors separated by | on a single line
+func (p *Parser) constructorList() ([]*ast.Constructor, error) {
+	constructors := []*ast.Constructor{}
+	// a leading | is allowed
+	if p.current().Type == tokens.PIPE {
+		if _, err := p.consume(tokens.PIPE); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		c, err := p.constructor()
+		if err != nil {
+			return nil, err
+		}
+		constructors = append(constructors, c)
+
+		if p.current().Type != tokens.PIPE {
+			return constructors, nil
+		}
+		if _, err := p.consume(tokens.PIPE); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// constructorLines reads an indented block of constructors, one per line
+func (p *Parser) constructorLines() ([]*ast.Constructor, error) {
+	if _, err := p.consume(tokens.BEGIN); err != nil {
+		return nil, err
+	}
+
+	constructors := []*ast.Constructor{}
+	for tk := p.current(); tk.Type != tokens.END && tk.Type != tokens.EOF; tk = p.current() {
+		if tk.Type == tokens.EOL {
+			if _, err := p.consume(tokens.EOL); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if _, err := p.consume(tokens.PIPE); err != nil {
+			return nil, err
+		}
+		c, err := p.constructor()
+		if err != nil {
+			return nil, err
+		}
+		constructors = append(constructors, c)
+	}
+
+	// the end of file closes all the blocks that are still open
+	if p.current().Type != tokens.EOF {
+		if _, err := p.consume(tokens.END); err != nil {
+			return nil, err
+		}
+	}
+	return constructors, nil
+}
+
+func (p *Parser) constructor() (*ast.Constructor, error) {
+	name, err := p.consume(tokens.IDENTIFIER)
+	if err != nil {
+		return nil, err
+	}
+	if !isCapitalized(name.Value) {
+		return nil, errorf(name, "constructor %s must start with a capital letter", name.Value)
+	}
+
+	c := &ast.Constructor{Token: name, Name: name.Value, Fields: []*ast.Parameter{}}
+	if p.current().Type == tokens.LPAREN {
+		pl, err := p.parameterList()
+		if err != nil {
+			return nil, err
+		}
+		c.Fields = pl.Parameters
+		c.End = pl.End
+	}
+
+	return c, nil
+}
+
+// isCapitalized tells whether an identifier starts with a capital letter.
+// In patterns, such identifiers are constructors while the others are bindings
+func isCapitalized(name string) bool {
+	return name != "" && name[0] >= 'A' && name[0] <= 'Z'
+}
+
+// typeParams reads the type parameters of a generic declaration, such as [K, V].
+// They are optional: no parameter is returned when there is no opening bracket
+func (p *Parser) typeParams() ([]*tokens.Token, error) {
+	params := []*tokens.Token{}
+	if p.current().Type != tokens.LBRACKET {
+		return params, nil
+	}
+	if _, err := p.consume(tokens.LBRACKET); err != nil {
+		return nil, err
+	}
+
+	for {
+		param, err := p.consume(tokens.IDENTIFIER)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, param)
+
+		if p.current().Type != tokens.COMMA {
+			break
+		}
+		if _, err := p.consume(tokens.COMMA); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.consume(tokens.RBRACKET); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// typeName reads the name of a type: int, mod.Type, a list type such as [int], a tuple type
+// such as (int, bool), or a generic type with its type arguments such as Pair[string, [int]]
+func (p *Parser) typeName() (*ast.TypeId, error) {
+	tk := p.current()
+	if tk.Type == tokens.LPAREN {
+		return p.tupleType()
+	}
+	if tk.Type == tokens.LBRACKET {
+		if _, err := p.consume(tokens.LBRACKET); err != nil {
+			return nil, err
+		}
+		elem, err := p.typeName()
+		if err != nil {
+			return nil, err
+		}
+		rbracket, err := p.consume(tokens.RBRACKET)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.TypeId{Token: tk, Name: ast.ListType, Args: []*ast.TypeId{elem}, End: rbracket}, nil
+	}
+
+	name, err := p.consume(tokens.IDENTIFIER)
+	if err != nil {
+		return nil, err
+	}
+
+	typeId := &ast.TypeId{Token: name, Name: name.Value, Args: []*ast.TypeId{}}
+	if p.current().Type == tokens.DOT {
+		// qualified type name, such as mod.Type
+		ident, err := p.qualifiedIdent()
+		if err != nil {
+			return nil, err
+		}
+		typeId.Name += "." + ident.Value
+		typeId.End = ident
+	}
+
+	if p.current().Type == tokens.LBRACKET {
+		if _, err := p.consume(tokens.LBRACKET); err != nil {
+			return nil, err
+		}
+		for {
+			arg, err := p.typeName()
+			if err != nil {
+				return nil, err
+			}
+			typeId.Args = append(typeId.Args, arg)
+
+			if p.current().Type != tokens.COMMA {
+				break
+			}
+			if _, err := p.consume(tokens.COMMA); err != nil {
+				return nil, err
+			}
+		}
+		if typeId.End, err = p.consume(tokens.RBRACKET); err != nil {
+			return nil, err
+		}
+	}
+
+	return typeId, nil
+}
@@ -0,0 +1,31 @@
+//go:build go1.18
+// +build go1.18
+
+package printer
+
+import (
+	"testing"
+
+	"github.com/fchoquet/cairn/conformance"
+)
+
+// FuzzRoundTrip checks that the programs that can be parsed are formatted as sources
+// giving back the same AST
+func FuzzRoundTrip(f *testing.F) {
+	cases, err := conformance.Load("../conformance/testdata")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, c := range cases {
+		f.Add(c.Source)
+	}
+	f.Add("(match n\n    _ -> 1\n) + f(match m\n    _ -> 2\n, 3)\n")
+	f.Add("\"${\"a\"}b\\${c} \\n\"\n1\n    2\n\n    3\n        4")
+
+	f.Fuzz(func(t *testing.T, source string) {
+		if _, err := parse(source); err != nil {
+			return
+		}
+		roundTrip(t, source)
+	})
+}
@@ -0,0 +1,410 @@
+// Package printer formats ASTs as cairn source code.
+//
+// Parsing the formatted source gives back the same AST, positions apart: parentheses are added
+// where the precedence of the operators requires them, and strings are quoted with escape sequences.
+// Blocks are indented with 4 spaces. As an empty line closes all the open blocks, the source of
+// a function, of a match or of a try expression never contains one.
+package printer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// indentation is the indentation of a block
+const indentation = "    "
+
+// Precedences of the operands that are not binary operations
+const (
+	multiLinePrec = 0
+	unaryPrec     = 7
+	primaryPrec   = 8
+)
+
+// Format returns the source code of a node. Files end with a new line
+func Format(node ast.Node) string {
+	p := &printer{}
+	switch n := node.(type) {
+	case *ast.SourceFile:
+		p.sourceFile(n)
+		return strings.TrimPrefix(p.buf.String(), "\n") + "\n"
+	case *ast.StatementList:
+		p.statementList(n)
+		return strings.TrimPrefix(p.buf.String(), "\n")
+	default:
+		p.node(node)
+		return p.buf.String()
+	}
+}
+
+type printer struct {
+	buf strings.Builder
+	// indent is the indentation level of the current line
+	indent int
+	// pending tells that an indented block was written: the code following it must start a new line
+	pending bool
+}
+
+// write writes code on the current line
+func (p *printer) write(code string) {
+	if p.pending {
+		p.newline()
+	}
+	p.buf.WriteString(code)
+}
+
+// newline starts a new line at the current indentation
+func (p *printer) newline() {
+	p.buf.WriteString("\n" + strings.Repeat(indentation, p.indent))
+	p.pending = false
+}
+
+// emptyLine separates declarations. It closes the open blocks
+func (p *printer) emptyLine() {
+	p.buf.WriteString("\n")
+}
+
+func (p *printer) sourceFile(file *ast.SourceFile) {
+	for _, i := range file.Imports {
+		p.newline()
+		p.node(i)
+	}
+	for index, t := range file.Types {
+		if index == 0 {
+			p.separate()
+		}
+		p.newline()
+		p.node(t)
+	}
+	for _, f := range file.Functions {
+		p.separate()
+		p.newline()
+		p.node(f)
+	}
+	if file.Statements == nil || len(file.Statements.Statements) == 0 {
+		return
+	}
+	p.separate()
+	if _, ok := file.Statements.Statements[0].(*ast.BlockStmt); ok && p.buf.Len() == 0 {
+		// the indentation of the first line is ignored: a block can not start the file
+		p.emptyLine()
+	}
+	p.statementList(file.Statements)
+}
+
+// separate writes an empty line between declarations
+func (p *printer) separate() {
+	if p.buf.Len() > 0 {
+		p.emptyLine()
+	}
+}
+
+// statementList writes statements on their own lines. A nested block has no line of its own:
+// its statements are indented
+func (p *printer) statementList(sl *ast.StatementList) {
+	for index, st := range sl.Statements {
+		block, ok := st.(*ast.BlockStmt)
+		if !ok {
+			p.newline()
+			p.node(st)
+			continue
+		}
+		if index > 0 {
+			if _, ok := sl.Statements[index-1].(*ast.BlockStmt); ok {
+				// a line without code ends the previous block, so that the blocks are not merged
+				p.newline()
+			}
+		}
+		p.block(block)
+	}
+}
+
+// block writes the statements of a block, indented on the following lines
+func (p *printer) block(bs *ast.BlockStmt) {
+	p.indent++
+	if bs.Statements == nil || len(bs.Statements.Statements) == 0 {
+		// an indented line without code is an empty block
+		p.newline()
+	} else {
+		p.statementList(bs.Statements)
+	}
+	p.indent--
+	p.pending = true
+}
+
+func (p *printer) node(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.SourceFile:
+		p.sourceFile(n)
+	case *ast.StatementList:
+		p.statementList(n)
+	case *ast.BlockStmt:
+		p.block(n)
+	case *ast.ImportDecl:
+		p.write("import " + quote(n.Path.Value))
+	case *ast.TypeDecl:
+		p.typeDecl(n)
+	case *ast.Constructor:
+		p.constructor(n)
+	case *ast.FuncDecl:
+		p.write("func " + n.Name.Value)
+		p.signature(n.Signature)
+		p.block(n.Body)
+	case *ast.Signature:
+		p.signature(n)
+	case *ast.ParameterList:
+		p.parameters(n.Parameters)
+	case *ast.Parameter:
+		p.write(n.Name + ":" + n.Type.TypeName())
+	case *ast.TypeId:
+		p.write(n.TypeName())
+	case *ast.Assignment:
+		p.write(n.Variable.Name + " := ")
+		p.node(n.Right)
+	case *ast.Destructuring:
+		names := []string{}
+		for _, v := range n.Variables {
+			names = append(names, v.Name)
+		}
+		p.write(strings.Join(names, ", ") + " := ")
+		p.node(n.Right)
+	case *ast.Match:
+		p.match(n)
+	case *ast.MatchArm:
+		p.arm(n)
+	case *ast.Try:
+		p.write("try")
+		p.block(n.Body)
+		p.newline()
+		p.write("catch " + n.Variable.Name)
+		p.block(n.Handler)
+	case *ast.BinOp:
+		p.binOp(n)
+	case *ast.UnaryOp:
+		p.write(n.Op.Value)
+		if inner, ok := n.Expr.(*ast.UnaryOp); ok && inner.Op.Value == "+" {
+			// ++ is the concatenation
+			p.write(" ")
+		}
+		p.operand(n.Expr, unaryPrec)
+	case *ast.Num:
+		p.write(n.Value)
+	case *ast.Float:
+		p.write(n.Value)
+	case *ast.Bool:
+		p.write(n.Value)
+	case *ast.String:
+		p.write(quote(n.Value))
+	case *ast.Interpolation:
+		p.interpolation(n)
+	case *ast.Variable:
+		p.write(qualifiedName(n.Module, n.Name))
+	case *ast.FuncCall:
+		p.write(qualifiedName(n.Module, n.Name))
+		p.list("(", n.Args, ")")
+	case *ast.ListLit:
+		p.list("[", n.Elements, "]")
+	case *ast.TupleLit:
+		p.list("(", n.Elements, ")")
+	case *ast.Index:
+		p.operand(n.Expr, primaryPrec)
+		p.write("[")
+		p.node(n.Index)
+		p.write("]")
+	case *ast.ConstructorPattern:
+		name := qualifiedName(n.Module, n.Name)
+		p.write(name)
+		if len(n.Args) > 0 || (n.Module == "" && !isCapitalized(n.Name)) {
+			// without parentheses, a lower case name is a binding
+			p.list("(", n.Args, ")")
+		}
+	case *ast.BindingPattern:
+		p.write(n.Name)
+	case *ast.WildcardPattern:
+		p.write("_")
+	default:
+		p.write(node.String())
+	}
+}
+
+func (p *printer) typeDecl(t *ast.TypeDecl) {
+	p.write("type " + t.Name.Value + typeParams(t.Params) + " = ")
+	for index, c := range t.Constructors {
+		if index > 0 {
+			p.write(" | ")
+		}
+		p.constructor(c)
+	}
+}
+
+func (p *printer) constructor(c *ast.Constructor) {
+	p.write(c.Name)
+	if len(c.Fields) > 0 {
+		p.parameters(c.Fields)
+	}
+}
+
+func (p *printer) signature(s *ast.Signature) {
+	p.write(typeParams(s.TypeParams))
+	p.parameters(s.Parameters.Parameters)
+	p.write(" :" + s.ReturnType.TypeName())
+}
+
+func (p *printer) parameters(params []*ast.Parameter) {
+	p.write("(")
+	for index, param := range params {
+		if index > 0 {
+			p.write(", ")
+		}
+		p.node(param)
+	}
+	p.write(")")
+}
+
+// list writes expressions separated by commas
+func (p *printer) list(open string, nodes []ast.Node, close string) {
+	p.write(open)
+	for index, node := range nodes {
+		if index > 0 {
+			p.write(", ")
+		}
+		p.node(node)
+	}
+	p.write(close)
+}
+
+// match writes the subject on the current line, and an arm per indented line
+func (p *printer) match(m *ast.Match) {
+	p.write("match ")
+	p.node(m.Subject)
+	p.indent++
+	for _, arm := range m.Arms {
+		p.newline()
+		p.arm(arm)
+	}
+	p.indent--
+	p.pending = true
+}
+
+func (p *printer) arm(a *ast.MatchArm) {
+	p.node(a.Pattern)
+	if block, ok := a.Body.(*ast.BlockStmt); ok {
+		p.write(" ->")
+		p.block(block)
+		return
+	}
+	p.write(" -> ")
+	p.node(a.Body)
+}
+
+func (p *printer) binOp(op *ast.BinOp) {
+	prec := parser.BinaryOpPrecedence[op.Op.Type]
+	left, right := prec, prec+1
+	if parser.BinaryOpAssociativity[op.Op.Type] == parser.AssocRight {
+		left, right = prec+1, prec
+	}
+	p.operand(op.Left, left)
+	p.write(" " + op.Op.Value + " ")
+	p.operand(op.Right, right)
+}
+
+// operand writes an expression between parentheses when its precedence is lower than minPrec
+func (p *printer) operand(node ast.Node, minPrec int) {
+	if precedence(node) >= minPrec {
+		p.node(node)
+		return
+	}
+	p.write("(")
+	p.node(node)
+	p.write(")")
+}
+
+// precedence returns how tightly an expression binds its operands
+func precedence(node ast.Node) int {
+	switch n := node.(type) {
+	case *ast.BinOp:
+		return parser.BinaryOpPrecedence[n.Op.Type]
+	case *ast.UnaryOp:
+		return unaryPrec
+	case *ast.Match, *ast.Try, *ast.BlockStmt, *ast.Assignment, *ast.Destructuring:
+		return multiLinePrec
+	default:
+		return primaryPrec
+	}
+}
+
+func (p *printer) interpolation(i *ast.Interpolation) {
+	p.write(`"`)
+	for _, part := range i.Parts {
+		if s, ok := part.(*ast.String); ok && isText(s) {
+			p.write(escape(s.Value))
+			continue
+		}
+		p.write("${")
+		p.node(part)
+		p.write("}")
+	}
+	p.write(`"`)
+}
+
+// isText tells whether a string of an interpolation is its text, rather than an embedded string literal
+func isText(s *ast.String) bool {
+	return s.Token == nil || s.Token.Type != tokens.STRING
+}
+
+// quote returns a string literal
+func quote(value string) string {
+	return `"` + escape(value) + `"`
+}
+
+// escape writes the characters of a string literal that can not be written as they are as
+// escape sequences. $ is always escaped so that it does not start an embedded expression
+func escape(value string) string {
+	buf := &strings.Builder{}
+	for _, r := range value {
+		switch {
+		case r == '\\' || r == '"' || r == '$':
+			buf.WriteString(`\` + string(r))
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == 0:
+			buf.WriteString(`\0`)
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(buf, `\x%02x`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+func qualifiedName(module, name string) string {
+	if module == "" {
+		return name
+	}
+	return module + "." + name
+}
+
+// typeParams formats the type parameters of a declaration, such as [K, V]
+func typeParams(params []*tokens.Token) string {
+	if len(params) == 0 {
+		return ""
+	}
+	names := []string{}
+	for _, param := range params {
+		names = append(names, param.Value)
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+func isCapitalized(name string) bool {
+	return name != "" && name[0] >= 'A' && name[0] <= 'Z'
+}
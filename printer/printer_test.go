@@ -0,0 +1,161 @@
+package printer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/conformance"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+// parse parses a source, and drops the tokens ending the blocks: the end of file closes
+// the blocks of a source that does not end with a new line
+func parse(source string) (*ast.SourceFile, error) {
+	p := parser.Parser{}
+	node, err := p.Parse("test.ca", source)
+	if err != nil {
+		return nil, err
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		if block, ok := n.(*ast.BlockStmt); ok {
+			block.End = nil
+		}
+		return true
+	})
+	return node.(*ast.SourceFile), nil
+}
+
+// roundTrip formats the AST of a source, and checks that the formatted source gives the same AST,
+// and is formatted as it is
+func roundTrip(t *testing.T, source string) string {
+	node, err := parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted := Format(node)
+	reparsed, err := parse(formatted)
+	if err != nil {
+		t.Fatalf("%s in\n%s", err, formatted)
+	}
+	assert.Equal(t, node.String(), reparsed.String(), formatted)
+	assert.Equal(t, formatted, Format(reparsed))
+	return formatted
+}
+
+func TestFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("formatted sources are kept", func(t *testing.T) {
+		fixtures := []string{
+			"1 + 2 * 3\n",
+			"(1 + 2) * 3\n",
+			"1 - (2 - 3)\n",
+			"1 - 2 - 3\n",
+			"2 ^ 3 ^ 2\n",
+			"(2 ^ 3) ^ 2\n",
+			"-(1 + 2) * -x\n",
+			"--1\n",
+			"+ +1\n",
+			"!(a && b) || c == d\n",
+			"a ++ b + c\n",
+			"(-x)[0]\n",
+			"(a ++ b)[1]\n",
+			"xs[0][1] + f(1, g(2))\n",
+			"mod.f(mod.x, [1, 2], (1, \"a\"), [])\n",
+			`"a \"quoted\" \\ \$ \n\t\r\0 \x01 é"` + "\n",
+			`"total: ${n + 1}${"!"} \${not embedded}"` + "\n",
+			"1.5e-9 + 1000\n",
+			"q, _ := divmod(7, 2)\n",
+			"import \"lib/greetings\"\n\ntype Shape = Circle(r:int) | Rect(w:int, h:int) | Empty\n",
+			"type Option[T] = None | Some(value:T)\n\nfunc first[T](xs:[T], pairs:[(T, Option[T])]) :mod.Type[T]\n    xs[0]\n",
+			"func f() :int\n    x := 1\n    x + 1\n\nfunc g() :int\n    2\n\nf() + g()\n",
+			"match n\n    0 -> \"zero\"\n    -1 -> \"minus one\"\n    Some(x, _) -> x\n    mod.None -> y\n    nil() -> 0\n    other ->\n        println(other)\n        other\n",
+			"x := match n\n    0 ->\n        match m\n            1 -> 2\n            _ -> 3\n    _ -> 4\nx\n",
+			"(match n\n    _ -> 1\n) + f(match m\n    _ -> 2\n, 3)\n",
+			"try\n    f()\ncatch e\n    message(e)\n",
+			"func f(n:int) :int\n    try\n        100 / n\n    catch e\n        -1\n",
+			"1\n    2\n        3\n    4\n",
+		}
+
+		for _, fixture := range fixtures {
+			t.Run(fixture, func(t *testing.T) {
+				assert.Equal(fixture, roundTrip(t, fixture))
+			})
+		}
+	})
+
+	t.Run("sources are formatted", func(t *testing.T) {
+		fixtures := []struct {
+			source   string
+			expected string
+		}{
+			{"1+(2*3)", "1 + 2 * 3\n"},
+			{"1_000", "1000\n"},
+			{"((x))", "x\n"},
+			{"`raw\\n`", "\"raw\\\\n\"\n"},
+			{"\"\"\"\n    a\n    b\n    \"\"\"", "\"a\\nb\"\n"},
+			{"type T =\n    | A\n    | B(x:int)\nB(1)", "type T = A | B(x:int)\n\nB(1)\n"},
+			{"func f( a : int ) : int\n\tmatch a\n\t\t_->a", "func f(a:int) :int\n    match a\n        _ -> a\n"},
+			{"try\n    1\n\ncatch e\n    2", "try\n    1\ncatch e\n    2\n"},
+			// nested blocks and empty blocks are kept: a line without code separates blocks
+			{"1\n    2\n\n    3", "1\n    2\n\n    3\n"},
+			{"1\n    2\n    \n    3", "1\n    2\n    3\n"},
+			{"1\n        2", "1\n        2\n"},
+			{"func f() :int\n    \n1", "func f() :int\n    \n\n1\n"},
+		}
+
+		for _, fixture := range fixtures {
+			t.Run(fixture.source, func(t *testing.T) {
+				assert.Equal(fixture.expected, roundTrip(t, fixture.source))
+			})
+		}
+	})
+
+	t.Run("nodes", func(t *testing.T) {
+		node, err := parse("func f(a:int) :[int]\n    [a]")
+		if !assert.Nil(err) {
+			return
+		}
+		f := node.Functions[0]
+		assert.Equal("(a:int) :[int]", Format(f.Signature))
+		assert.Equal("a:int", Format(f.Signature.Parameters.Parameters[0]))
+		assert.Equal("[a]", Format(f.Body.Statements))
+	})
+}
+
+func TestFormatPrograms(t *testing.T) {
+	sources := map[string]string{}
+	cases, err := conformance.Load("../conformance/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		sources[c.Path] = c.Source
+	}
+	for _, pattern := range []string{"../gogen/testdata/*.ca", "../watgen/testdata/*.ca"} {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			source, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sources[file] = string(source)
+		}
+	}
+
+	for file, source := range sources {
+		t.Run(file, func(t *testing.T) {
+			if _, err := parse(source); err != nil {
+				// the programs that can not be parsed are tested by the conformance suite
+				return
+			}
+			roundTrip(t, source)
+		})
+	}
+}
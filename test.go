@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/coverage"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/modules"
+	"github.com/fchoquet/cairn/testrunner"
+)
+
+// test implements the test command
+func test(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	format := flags.String("format", "text", "the format of the results: text, tap or json")
+	checked := flags.Bool("checked", false, "report integer overflows instead of promoting to big integers")
+	cover := flags.Bool("cover", false, "display the coverage of the statements and branches of each function")
+	coverProfile := flags.String("coverprofile", "", "write the coverage profile to this file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "text" && *format != "tap" && *format != "json" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := testrunner.Find(paths...)
+	if err != nil {
+		fmt.Println("!!! " + err.Error())
+		return 1
+	}
+
+	// the tests read an empty input, so that they do not depend on the standard input
+	options := hostCapabilities(strings.NewReader(""))
+	loader := modules.NewLoader(searchPath()...)
+	runner := &testrunner.Runner{}
+	var profile *coverage.Profile
+	if *cover || *coverProfile != "" {
+		profile = coverage.New()
+		loader.Transform = func(module *ast.SourceFile) *ast.SourceFile {
+			profile.Add(module)
+			return module
+		}
+		runner.Parsed = profile.Add
+		options = append(options, profile.Option())
+	}
+	options = append(options, interpreter.Loader(loader))
+	if *checked {
+		options = append(options, interpreter.CheckedArithmetic())
+	}
+	runner.Options = options
+
+	results := runner.Run(files...)
+	switch *format {
+	case "tap":
+		testrunner.WriteTAP(os.Stdout, results)
+	case "json":
+		testrunner.WriteJSON(os.Stdout, results)
+	default:
+		testrunner.WriteText(os.Stdout, results)
+	}
+
+	if profile != nil {
+		if status := reportCoverage(profile.Blocks(), *cover, *coverProfile); status != 0 {
+			return status
+		}
+	}
+	if testrunner.Failed(results) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,182 @@
+package testrunner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fchoquet/cairn/interpreter"
+)
+
+// Failed tells whether a test failed
+func Failed(results []*Result) bool {
+	for _, r := range results {
+		if !r.Passed {
+			return true
+		}
+	}
+	return false
+}
+
+// files groups results by file, in their order
+func files(results []*Result) [][]*Result {
+	groups := [][]*Result{}
+	for index, r := range results {
+		if index == 0 || r.File != results[index-1].File {
+			groups = append(groups, []*Result{})
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], r)
+	}
+	return groups
+}
+
+// lines splits a text into lines, ignoring the last new line
+func lines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// status returns PASS or FAIL
+func status(passed bool) string {
+	if passed {
+		return "PASS"
+	}
+	return "FAIL"
+}
+
+// seconds formats a duration like go test
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
+
+// report lists the lines describing a result, like go test -v: the output and the error of a
+// failed test are indented below its status
+func report(r *Result) []string {
+	if r.Test == "" {
+		return []string{"--- FAIL: " + r.File, "    " + r.Err.Error()}
+	}
+	header := fmt.Sprintf("--- %s: %s (%s)", status(r.Passed), r.Test, seconds(r.Elapsed))
+	if r.Passed {
+		return []string{header}
+	}
+	report := []string{header}
+	for _, line := range lines(r.Output) {
+		report = append(report, "    "+line)
+	}
+	return append(report, "    "+r.Err.Error())
+}
+
+// WriteText writes the results of each file, then a summary
+func WriteText(w io.Writer, results []*Result) {
+	failed := 0
+	for _, group := range files(results) {
+		fmt.Fprintf(w, "=== %s\n", group[0].File)
+		for _, r := range group {
+			if !r.Passed {
+				failed++
+			}
+			fmt.Fprintln(w, strings.Join(report(r), "\n"))
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "FAIL: %d of %d tests failed\n", failed, len(results))
+		return
+	}
+	fmt.Fprintf(w, "PASS: %d tests\n", len(results))
+}
+
+// WriteTAP writes the results in the Test Anything Protocol, version 13. The failures are described
+// by a YAML block holding the error, its position and kind for runtime errors, and the output of the test
+func WriteTAP(w io.Writer, results []*Result) {
+	fmt.Fprintf(w, "TAP version 13\n1..%d\n", len(results))
+	for index, r := range results {
+		name := r.File
+		if r.Test != "" {
+			name += ": " + r.Test
+		}
+		if r.Passed {
+			fmt.Fprintf(w, "ok %d - %s\n", index+1, name)
+			continue
+		}
+
+		fmt.Fprintf(w, "not ok %d - %s\n  ---\n", index+1, name)
+		if rerr, ok := r.Err.(*interpreter.RuntimeError); ok {
+			fmt.Fprintf(w, "  message: %s\n", strconv.Quote(rerr.Message))
+			fmt.Fprintf(w, "  kind: %s\n", strconv.Quote(string(rerr.Kind)))
+			fmt.Fprintf(w, "  at: %s\n", strconv.Quote(fmt.Sprintf("%s:%d:%d", rerr.Pos.File, rerr.Pos.Line, rerr.Pos.Col)))
+		} else {
+			fmt.Fprintf(w, "  message: %s\n", strconv.Quote(r.Err.Error()))
+		}
+		if r.Output != "" {
+			fmt.Fprintf(w, "  output: %s\n", strconv.Quote(r.Output))
+		}
+		fmt.Fprintln(w, "  ...")
+	}
+}
+
+// event is an event of go test -json. The file of a test stands for its package
+type event struct {
+	Time    *time.Time `json:",omitempty"`
+	Action  string
+	Package string   `json:",omitempty"`
+	Test    string   `json:",omitempty"`
+	Elapsed *float64 `json:",omitempty"`
+	Output  string   `json:",omitempty"`
+}
+
+// WriteJSON writes the results as the events of go test -json, so that the tools reading them
+// can read the results of cairn tests
+func WriteJSON(w io.Writer, results []*Result) error {
+	encoder := json.NewEncoder(w)
+	emit := func(t time.Time, action, file, test string, elapsed *time.Duration, output string) error {
+		e := &event{Time: &t, Action: action, Package: file, Test: test, Output: output}
+		if elapsed != nil {
+			s := elapsed.Seconds()
+			e.Elapsed = &s
+		}
+		return encoder.Encode(e)
+	}
+
+	for _, group := range files(results) {
+		file := group[0].File
+		passed := true
+		var elapsed time.Duration
+		end := group[0].Start
+		for _, r := range group {
+			passed = passed && r.Passed
+			elapsed += r.Elapsed
+			end = r.Start.Add(r.Elapsed)
+			if r.Test != "" {
+				if err := emit(r.Start, "run", file, r.Test, nil, ""); err != nil {
+					return err
+				}
+				if err := emit(r.Start, "output", file, r.Test, nil, "=== RUN   "+r.Test+"\n"); err != nil {
+					return err
+				}
+			}
+			for _, line := range report(r) {
+				if err := emit(end, "output", file, r.Test, nil, line+"\n"); err != nil {
+					return err
+				}
+			}
+			if r.Test != "" {
+				action := strings.ToLower(status(r.Passed))
+				if err := emit(end, action, file, r.Test, &r.Elapsed, ""); err != nil {
+					return err
+				}
+			}
+		}
+		if err := emit(end, "output", file, "", nil, status(passed)+"\n"); err != nil {
+			return err
+		}
+		if err := emit(end, strings.ToLower(status(passed)), file, "", &elapsed, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+// Package testrunner runs the tests written in cairn.
+//
+// Test files are named *_test.cairn. Their tests are the functions named test, or whose names
+// start with test followed by an upper-case letter or _, such as testDouble. They take no arguments. Each test runs in a new interpreter: the declarations and the top level
+// statements of its file run first, then the test function is called. A test fails when it raises
+// a runtime error, such as the errors of the assert and assertEqual builtins.
+// The results are reported as text, as TAP or as the JSON events of go test -json.
+package testrunner
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/checker"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// Suffix ends the names of the test files
+const Suffix = "_test.cairn"
+
+// Result is the outcome of a test. A file that can not be parsed or checked gets a single
+// failed result, without test name
+type Result struct {
+	File string
+	// Test is the name of the test function
+	Test   string
+	Passed bool
+	// Err is the error failing the test
+	Err error
+	// Output is what the test printed
+	Output  string
+	Start   time.Time
+	Elapsed time.Duration
+}
+
+// Runner runs test files
+type Runner struct {
+	// Options configure the interpreters running the tests. Their output is always captured
+	Options []interpreter.Option
+	// Parsed is called with each test file once it is parsed, when it is not nil
+	Parsed func(file *ast.SourceFile)
+	// Clock returns the current time. It defaults to time.Now
+	Clock func() time.Time
+}
+
+// Find returns the test files among paths. Directories are searched recursively for the files
+// named *_test.cairn, and files are kept whatever their names
+func Find(paths ...string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(file, Suffix) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Run runs the tests of files
+func (r *Runner) Run(files ...string) []*Result {
+	results := []*Result{}
+	for _, file := range files {
+		results = append(results, r.RunFile(file)...)
+	}
+	return results
+}
+
+// RunFile runs the tests of a file, in the order they are declared
+func (r *Runner) RunFile(file string) []*Result {
+	start := r.now()
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return []*Result{{File: file, Err: err, Start: start}}
+	}
+	node, err := parse(file, string(source))
+	if err != nil {
+		return []*Result{{File: file, Err: err, Start: start, Elapsed: r.now().Sub(start)}}
+	}
+	if r.Parsed != nil {
+		r.Parsed(node)
+	}
+
+	results := []*Result{}
+	for _, f := range node.Functions {
+		if !isTest(f.Name.Value) {
+			continue
+		}
+		result, err := r.runTest(node, f)
+		if err != nil {
+			// none of the tests of the file can run
+			return []*Result{{File: file, Err: err, Start: start, Elapsed: r.now().Sub(start)}}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// isTest tells whether a function is a test: helpers such as tested or testerHelper are not
+func isTest(name string) bool {
+	if !strings.HasPrefix(name, "test") {
+		return false
+	}
+	rest := strings.TrimPrefix(name, "test")
+	if rest == "" {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return r == '_' || unicode.IsUpper(r)
+}
+
+// runTest runs a test function. The error is returned when the file is invalid: it was found
+// by the checker, or by the loader of the imported modules
+func (r *Runner) runTest(file *ast.SourceFile, f *ast.FuncDecl) (*Result, error) {
+	result := &Result{File: file.Pos().File, Test: f.Name.Value, Start: r.now()}
+	defer func() { result.Elapsed = r.now().Sub(result.Start) }()
+
+	if params := f.Signature.Parameters.Parameters; len(params) > 0 {
+		result.Err = &tokens.Error{Pos: params[0].Pos(), Message: "test functions take no arguments"}
+		return result, nil
+	}
+
+	output := &bytes.Buffer{}
+	options := append(append([]interpreter.Option{}, r.Options...), interpreter.Stdout(output))
+	i := interpreter.New(&parser.Parser{}, options...)
+	defer func() { result.Output = output.String() }()
+
+	if _, err := i.Exec(file); err != nil {
+		switch err.(type) {
+		case checker.Errors, *tokens.Error:
+			return nil, err
+		}
+		result.Err = err
+		return result, nil
+	}
+	call := &ast.FuncCall{Token: f.Name, Name: f.Name.Value}
+	if _, err := i.Exec(call); err != nil {
+		result.Err = err
+		return result, nil
+	}
+	result.Passed = true
+	return result, nil
+}
+
+func (r *Runner) now() time.Time {
+	if r.Clock == nil {
+		return time.Now()
+	}
+	return r.Clock()
+}
+
+// parse parses a file. The parser panics on bugs: they must not stop the other files
+func parse(file, source string) (node *ast.SourceFile, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Parser error: %v", r)
+		}
+	}()
+	p := parser.Parser{}
+	n, err := p.Parse(file, source)
+	if err != nil {
+		return nil, err
+	}
+	return n.(*ast.SourceFile), nil
+}
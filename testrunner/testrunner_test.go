@@ -0,0 +1,267 @@
+package testrunner
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/stretchr/testify/assert"
+)
+
+const mathTests = `func double(n:int) :int
+    n * 2
+
+func testDouble() :bool
+    assertEqual(4, double(2))
+
+func testFails() :bool
+    println("computing")
+    assertEqual(5, double(2))
+
+func testCrash() :int
+    1 / 0
+
+func testArgs(n:int) :bool
+    true
+
+func helper() :bool
+    assert(false)
+
+func testerHelper(n:int) :bool
+    assert(n == 1)
+
+func tested() :bool
+    assert(false)
+`
+
+// writeFiles creates files in a temporary directory, and returns the directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "testrunner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// fixedClock returns a clock whose time advances by a millisecond at each call
+func fixedClock() func() time.Time {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+}
+
+// summarize describes results as file:test=error
+func summarize(results []*Result) []string {
+	lines := []string{}
+	for _, r := range results {
+		line := r.File + ":" + r.Test + "="
+		if r.Err != nil {
+			line += r.Err.Error()
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRunner(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeFiles(t, map[string]string{
+		"math_test.cairn":        mathTests,
+		"lib/state_test.cairn":   "func testCount() :bool\n    assertEqual(1, count)\ncount := 1",
+		"lib/invalid_test.cairn": "func testMatch() :bool\n    match 1\n        1 -> true",
+		"lib/syntax_test.cairn":  "func testSyntax( :bool\n    true",
+		"lib/helpers.cairn":      "func testNotRun() :bool\n    false",
+	})
+	defer os.RemoveAll(dir)
+
+	t.Run("finds the test files", func(t *testing.T) {
+		files, err := Find(dir, filepath.Join(dir, "lib/helpers.cairn"))
+		assert.Nil(err)
+		for index := range files {
+			files[index], _ = filepath.Rel(dir, files[index])
+		}
+		assert.Equal([]string{
+			"lib/helpers.cairn",
+			"lib/invalid_test.cairn",
+			"lib/state_test.cairn",
+			"lib/syntax_test.cairn",
+			"math_test.cairn",
+		}, files)
+
+		_, err = Find(filepath.Join(dir, "missing"))
+		assert.NotNil(err)
+	})
+
+	t.Run("runs the test functions", func(t *testing.T) {
+		wd, _ := os.Getwd()
+		defer os.Chdir(wd)
+		os.Chdir(dir)
+
+		runner := &Runner{Clock: fixedClock()}
+		results := runner.Run("math_test.cairn", "lib/state_test.cairn", "lib/invalid_test.cairn", "lib/syntax_test.cairn")
+		assert.Equal([]string{
+			"math_test.cairn:testDouble=",
+			"math_test.cairn:testFails=math_test.cairn:9:5: assertion failed: assertEqual: expected 5 - got 4",
+			"math_test.cairn:testCrash=math_test.cairn:12:7: division by zero: 1 / 0",
+			"math_test.cairn:testArgs=math_test.cairn:14:15: test functions take no arguments",
+			// the top level statements run before the test
+			"lib/state_test.cairn:testCount=",
+			"lib/invalid_test.cairn:=lib/invalid_test.cairn:2:5: match is not exhaustive: _ is not covered",
+			"lib/syntax_test.cairn:=lib/syntax_test.cairn:1:18: wrong input type. Expected IDENTIFIER - got COLUMN:COLUMN",
+		}, summarize(results))
+		assert.Equal("computing\n", results[1].Output)
+		assert.Equal(time.Millisecond, results[0].Elapsed)
+		assert.True(Failed(results))
+		assert.False(Failed(results[:1]))
+	})
+
+	t.Run("passes options to the interpreters", func(t *testing.T) {
+		dir := writeFiles(t, map[string]string{"big_test.cairn": "func testBig() :int\n    2 ^ 64"})
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "big_test.cairn")
+
+		assert.False(Failed((&Runner{}).Run(file)))
+		results := (&Runner{Options: []interpreter.Option{interpreter.CheckedArithmetic()}}).Run(file)
+		if assert.Len(results, 1) {
+			rerr, ok := results[0].Err.(*interpreter.RuntimeError)
+			if assert.True(ok) {
+				assert.Equal(interpreter.Overflow, rerr.Kind)
+			}
+		}
+	})
+}
+
+func TestReports(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeFiles(t, map[string]string{
+		"math_test.cairn":    mathTests,
+		"invalid_test.cairn": "func testMatch() :bool\n    match 1\n        1 -> true",
+	})
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	runner := &Runner{Clock: fixedClock()}
+	results := runner.Run("math_test.cairn", "invalid_test.cairn")
+
+	t.Run("text", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		WriteText(buf, results)
+		assert.Equal(strings.Join([]string{
+			"=== math_test.cairn",
+			"--- PASS: testDouble (0.00s)",
+			"--- FAIL: testFails (0.00s)",
+			"    computing",
+			"    math_test.cairn:9:5: assertion failed: assertEqual: expected 5 - got 4",
+			"--- FAIL: testCrash (0.00s)",
+			"    math_test.cairn:12:7: division by zero: 1 / 0",
+			"--- FAIL: testArgs (0.00s)",
+			"    math_test.cairn:14:15: test functions take no arguments",
+			"=== invalid_test.cairn",
+			"--- FAIL: invalid_test.cairn",
+			"    invalid_test.cairn:2:5: match is not exhaustive: _ is not covered",
+			"FAIL: 4 of 5 tests failed",
+			"",
+		}, "\n"), buf.String())
+
+		buf.Reset()
+		WriteText(buf, results[:1])
+		assert.True(strings.HasSuffix(buf.String(), "PASS: 1 tests\n"))
+	})
+
+	t.Run("tap", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		WriteTAP(buf, results)
+		assert.Equal(strings.Join([]string{
+			"TAP version 13",
+			"1..5",
+			"ok 1 - math_test.cairn: testDouble",
+			"not ok 2 - math_test.cairn: testFails",
+			"  ---",
+			`  message: "assertEqual: expected 5 - got 4"`,
+			`  kind: "assertion failed"`,
+			`  at: "math_test.cairn:9:5"`,
+			`  output: "computing\n"`,
+			"  ...",
+			"not ok 3 - math_test.cairn: testCrash",
+			"  ---",
+			`  message: "1 / 0"`,
+			`  kind: "division by zero"`,
+			`  at: "math_test.cairn:12:7"`,
+			"  ...",
+			"not ok 4 - math_test.cairn: testArgs",
+			"  ---",
+			`  message: "math_test.cairn:14:15: test functions take no arguments"`,
+			"  ...",
+			"not ok 5 - invalid_test.cairn",
+			"  ---",
+			`  message: "invalid_test.cairn:2:5: match is not exhaustive: _ is not covered"`,
+			"  ...",
+			"",
+		}, "\n"), buf.String())
+	})
+
+	t.Run("go test -json", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		assert.Nil(WriteJSON(buf, results))
+		events := []map[string]interface{}{}
+		decoder := json.NewDecoder(buf)
+		for decoder.More() {
+			e := map[string]interface{}{}
+			if !assert.Nil(decoder.Decode(&e)) {
+				return
+			}
+			events = append(events, e)
+		}
+
+		actions := []string{}
+		for _, e := range events {
+			action := e["Action"].(string) + " " + e["Package"].(string)
+			if test, ok := e["Test"]; ok {
+				action += " " + test.(string)
+			}
+			if output, ok := e["Output"]; ok {
+				action += " " + strings.TrimSpace(output.(string))
+			}
+			actions = append(actions, action)
+		}
+		assert.Equal([]string{
+			"run math_test.cairn testDouble",
+			"output math_test.cairn testDouble === RUN   testDouble",
+			"output math_test.cairn testDouble --- PASS: testDouble (0.00s)",
+			"pass math_test.cairn testDouble",
+		}, actions[:4])
+		assert.Equal([]string{
+			"output invalid_test.cairn --- FAIL: invalid_test.cairn",
+			"output invalid_test.cairn invalid_test.cairn:2:5: match is not exhaustive: _ is not covered",
+			"output invalid_test.cairn FAIL",
+			"fail invalid_test.cairn",
+		}, actions[len(actions)-4:])
+		assert.Contains(actions, "output math_test.cairn testFails computing")
+		assert.Contains(actions, "fail math_test.cairn testFails")
+		assert.Contains(actions, "fail math_test.cairn")
+
+		assert.Equal("2018-06-01T12:00:00.002Z", events[0]["Time"])
+		assert.Equal(0.001, events[3]["Elapsed"])
+	})
+}
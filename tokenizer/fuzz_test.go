@@ -0,0 +1,56 @@
+//go:build go1.18
+// +build go1.18
+
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// seeds are the inputs the fuzzers start from
+var seeds = []string{
+	"x := 1_000 + 2.5e-3 * -y",
+	"func f(a:int) :int\n    match a\n        0 -> 1\n        _ -> a ^ 2\n",
+	"type Option[T] = None | Some(value:T)\n",
+	"\"a ${x + \"b${y}\"} \\u00e9 \\$\"",
+	"\"\"\"\n    multi\n    line\n    \"\"\"",
+	"`raw ${x}`",
+	"try\n\tf()\ncatch e\n\tmessage(e)",
+	"a && b || !c != (d == e) ++ [1, 2][0] |",
+	"1abc & #",
+}
+
+func FuzzTokenize(f *testing.F) {
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, source string) {
+		tokenizer := Tokenize("fuzz.ca", source)
+		previous := tokens.Position{Line: 1, Col: 1}
+		for {
+			tk, err := tokenizer.NextToken()
+			if err != nil {
+				if _, ok := err.(*tokens.Error); !ok {
+					t.Fatalf("expected a *tokens.Error - got %v", err)
+				}
+				break
+			}
+			pos := tk.Position
+			if pos.Line < previous.Line || (pos.Line == previous.Line && pos.Col < previous.Col) {
+				t.Fatalf("expected a token after %d:%d - got %s", previous.Line, previous.Col, tk.Debug())
+			}
+			previous = pos
+			if tk.Type == tokens.EOF {
+				break
+			}
+		}
+
+		// the tokenizer stops after the end of file or an error
+		if _, err := tokenizer.NextToken(); err == nil {
+			t.Fatal("expected the end of the tokens")
+		}
+	})
+}
@@ -1,74 +1,259 @@
 package tokenizer
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
 
-func readString(input string) (string, error) {
-	if input == "" {
-		return "", errors.New("unexpected end of string")
-	}
-
-	if input[0] != '"' {
-		return "", errors.New("expected \" at the beginning of string")
-	}
+// stringError is an error found at an offset of the text of a string literal
+type stringError struct {
+	offset int
+	err    error
+}
 
-	if len(input) < 2 {
-		return "", errors.New("a string litteral must be at least 2 chars long (including surrounding quotes)")
-	}
+func (e *stringError) Error() string {
+	return e.err.Error()
+}
 
-	return readStringContents(input[1:])
+// errorAt locates an error at an offset of a text
+func errorAt(offset int, err error) error {
+	return shift(&stringError{err: err}, offset)
 }
 
-func readStringContents(text string) (string, error) {
-	if len(text) == 0 {
-		return "", errors.New("could not find end of string litteral")
+// shift moves the offset of a located error, found in the part of a text starting at offset.
+// The other errors are left unlocated
+func shift(err error, offset int) error {
+	if serr, ok := err.(*stringError); ok {
+		return &stringError{offset: serr.offset + offset, err: serr.err}
 	}
+	return err
+}
 
-	// let's skip the initial "
-	head := text[0]
-	tail := text[1:]
-
-	var left string
-
-	switch head {
-	case '"':
-		// end of string reached. stop recursion
-		return "", nil
-	case '\\':
-		var err error
-		left, err = readEscapeSequence(tail)
+// readString reads a string literal at the beginning of input.
+// It returns the value of the string and the raw text of the literal, surrounding quotes included.
+// The raw text may differ in length from the value because of escape sequences, and may span lines.
+//
+// When the string embeds an expression, only the text up to the ${ is read and interpolated is true.
+func readString(input string) (value string, raw string, interpolated bool, err error) {
+	switch {
+	case input == "":
+		return "", "", false, errors.New("unexpected end of string")
+	case strings.HasPrefix(input, `"""`):
+		value, raw, err := readMultiLineString(input)
+		return value, raw, false, err
+	case input[0] == '"':
+		value, length, interpolated, err := readStringContents(input[1:])
 		if err != nil {
-			return "", err
+			return "", "", false, shift(err, 1)
 		}
-		tail = tail[len(left):]
-	case '\n':
-		return "", errors.New("could not find end of string litteral")
+		return value, input[:length+1], interpolated, nil
+	case input[0] == '`':
+		value, raw, err := readRawString(input)
+		return value, raw, false, err
 	default:
-		left = string(head)
+		return "", "", false, errors.New("expected \" at the beginning of string")
 	}
+}
 
-	// reads the rest of the string recursively
-	right, err := readStringContents(tail)
-	if err != nil {
-		return "", err
+// readStringContents decodes a string up to its closing quote, or up to an embedded expression.
+// It returns the decoded value and the length of the raw text, closing quote or ${ included.
+// Invalid characters and escape sequences are located in the text
+func readStringContents(text string) (value string, length int, interpolated bool, err error) {
+	buf := &strings.Builder{}
+	for length < len(text) {
+		r, size := utf8.DecodeRuneInString(text[length:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			return "", 0, false, errorAt(length, errors.New("invalid UTF-8 encoding in string literal"))
+		case r == '"':
+			// end of string reached
+			return buf.String(), length + 1, false, nil
+		case r == '$' && strings.HasPrefix(text[length+1:], "{"):
+			// beginning of an embedded expression
+			return buf.String(), length + 2, true, nil
+		case r == '\n':
+			return "", 0, false, errorAt(length, errors.New("could not find end of string literal"))
+		case r == '\\':
+			escaped, escapeLength, err := readEscapeSequence(text[length+1:])
+			if err != nil {
+				return "", 0, false, errorAt(length, err)
+			}
+			buf.WriteString(escaped)
+			size += escapeLength
+		default:
+			buf.WriteString(text[length : length+size])
+		}
+		length += size
 	}
 
-	return (left + right), nil
+	return "", 0, false, errors.New("could not find end of string literal")
+}
+
+// emptyInterpolation tells whether the embedded expression starting a text is empty
+func emptyInterpolation(text string) bool {
+	return strings.HasPrefix(strings.TrimLeft(text, " \t"), "}")
 }
 
-func readEscapeSequence(text string) (string, error) {
+// readEscapeSequence decodes the escape sequence following a backslash.
+// It returns the decoded value and the length of the sequence, backslash excluded
+func readEscapeSequence(text string) (string, int, error) {
 	// starting an escape sequence
 	if len(text) == 0 {
-		return "", errors.New("invalid escape sequence. did you mean \\\\?")
+		return "", 0, errors.New("invalid escape sequence. did you mean \\\\?")
 	}
 
 	switch text[0] {
 	case '\\':
-		return "\\", nil
+		return "\\", 1, nil
 	case '"':
-		return "\"", nil
+		return "\"", 1, nil
+	case '$':
+		return "$", 1, nil
 	case 'n':
-		return "\n", nil
+		return "\n", 1, nil
+	case 't':
+		return "\t", 1, nil
+	case 'r':
+		return "\r", 1, nil
+	case '0':
+		return "\x00", 1, nil
+	case 'x':
+		return readCodePoint(text, 2)
+	case 'u':
+		return readCodePoint(text, 4)
+	case 'U':
+		return readCodePoint(text, 8)
 	default:
-		return "", errors.New("invalid escape sequence")
+		r, _ := utf8.DecodeRuneInString(text)
+		return "", 0, fmt.Errorf("invalid escape sequence \\%c", r)
+	}
+}
+
+// readCodePoint decodes an escape sequence such as xNN, uNNNN or UNNNNNNNN,
+// made of a letter followed by a fixed number of hexadecimal digits
+func readCodePoint(text string, digits int) (string, int, error) {
+	if len(text) < digits+1 {
+		return "", 0, fmt.Errorf("invalid escape sequence \\%s: expected %d hexadecimal digits", text, digits)
+	}
+
+	code, err := strconv.ParseUint(text[1:digits+1], 16, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid escape sequence \\%s: expected %d hexadecimal digits", text[:digits+1], digits)
+	}
+	if !utf8.ValidRune(rune(code)) {
+		return "", 0, fmt.Errorf("invalid escape sequence \\%s: not a unicode code point", text[:digits+1])
+	}
+
+	return string(rune(code)), digits + 1, nil
+}
+
+// readRawString reads a string between backticks. Raw strings have no escape sequences and may span lines
+func readRawString(input string) (value string, raw string, err error) {
+	end := strings.IndexByte(input[1:], '`')
+	if end < 0 {
+		return "", "", errors.New("could not find end of raw string literal")
+	}
+
+	value = input[1 : end+1]
+	if !utf8.ValidString(value) {
+		return "", "", errors.New("invalid UTF-8 encoding in string literal")
+	}
+	return value, input[:end+2], nil
+}
+
+// readMultiLineString reads a string between triple quotes.
+//
+// The opening quotes must end their line, and the closing quotes must stand on their own line.
+// The indentation of the closing quotes is removed from every line, so that the string can
+// be indented with the code around it. Escape sequences are decoded line by line.
+func readMultiLineString(input string) (value string, raw string, err error) {
+	firstLine := strings.IndexByte(input, '\n')
+	if firstLine < 0 || strings.TrimSpace(input[3:firstLine]) != "" {
+		return "", "", errors.New("a multi-line string must start on a new line after \"\"\"")
+	}
+
+	lines := []string{}
+	// starts holds the offsets of the lines in the input
+	starts := []int{}
+	offset := firstLine + 1
+	for {
+		if offset >= len(input) {
+			return "", "", errors.New("could not find end of multi-line string literal")
+		}
+
+		line := input[offset:]
+		if end := strings.IndexByte(line, '\n'); end >= 0 {
+			line = line[:end]
+		}
+
+		closing := indexClosingQuotes(line)
+		if closing < 0 {
+			lines = append(lines, line)
+			starts = append(starts, offset)
+			offset += len(line) + 1
+			continue
+		}
+
+		indent := line[:closing]
+		if strings.TrimLeft(indent, " \t") != "" {
+			return "", "", errorAt(offset+closing, errors.New("the closing \"\"\" of a multi-line string must be on its own line"))
+		}
+		raw = input[:offset+closing+3]
+
+		for index, l := range lines {
+			switch {
+			case strings.TrimLeft(l, " \t") == "":
+				// blank lines do not need to be indented
+				lines[index] = ""
+			case strings.HasPrefix(l, indent):
+				decoded, err := decodeEscapeSequences(l[len(indent):])
+				if err != nil {
+					return "", "", shift(err, starts[index]+len(indent))
+				}
+				lines[index] = decoded
+			default:
+				return "", "", errorAt(starts[index], errors.New("the lines of a multi-line string must be indented at least like the closing \"\"\""))
+			}
+		}
+		return strings.Join(lines, "\n"), raw, nil
+	}
+}
+
+// indexClosingQuotes returns the index of the first """ of a line that is not escaped, or -1
+func indexClosingQuotes(line string) int {
+	for index := 0; index < len(line); index++ {
+		switch {
+		case line[index] == '\\':
+			// skip the escaped character
+			index++
+		case strings.HasPrefix(line[index:], `"""`):
+			return index
+		}
+	}
+	return -1
+}
+
+// decodeEscapeSequences decodes the escape sequences of a whole text. Errors are located in the text
+func decodeEscapeSequences(text string) (string, error) {
+	if !utf8.ValidString(text) {
+		return "", errorAt(0, errors.New("invalid UTF-8 encoding in string literal"))
+	}
+
+	buf := &strings.Builder{}
+	for index := 0; index < len(text); index++ {
+		if text[index] != '\\' {
+			buf.WriteByte(text[index])
+			continue
+		}
+		escaped, length, err := readEscapeSequence(text[index+1:])
+		if err != nil {
+			return "", errorAt(index, err)
+		}
+		buf.WriteString(escaped)
+		index += length
 	}
+	return buf.String(), nil
 }
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/fchoquet/cairn/tokens"
 )
@@ -11,6 +13,11 @@ import (
 // Tokenizer transforms a string into a stream of tokens
 type Tokenizer struct {
 	Channel chan *tokens.Token
+
+	// interpolations counts the interpolated strings whose embedded expression is being read
+	interpolations int
+	// pending holds the tokens read from the current character, until their end is known
+	pending []*tokens.Token
 }
 
 // Tokenize returns a Tokenizer ready to return tokens
@@ -22,9 +29,11 @@ func Tokenize(fileName, text string) *Tokenizer {
 	go func() {
 		t.tokenize(text, tokens.Position{
 			File: fileName,
-			Line: 0,
-			Col:  0,
+			Line: 1,
+			Col:  1,
 		}, 0)
+		// the tokens ending the input, such as EOF, have no length
+		t.send(tokens.Position{})
 
 		// close the channel to notify completion
 		close(t.Channel)
@@ -45,200 +54,383 @@ func (t *Tokenizer) NextToken() (*tokens.Token, error) {
 	}
 
 	if tk.Type == tokens.ERROR {
-		return nil, errors.New(tk.Value)
+		return nil, &tokens.Error{Pos: tk.Position, Message: tk.Value}
 	}
 
 	return tk, nil
 }
 
 func (t *Tokenizer) yieldToken(tkType tokens.TokenType, value string, pos tokens.Position) {
-	t.Channel <- &tokens.Token{
+	t.pending = append(t.pending, &tokens.Token{
 		Type:     tkType,
 		Value:    value,
 		Position: pos,
+	})
+}
+
+// send sends the pending tokens, once their end is known. A token whose end is not known
+// ends where it starts
+func (t *Tokenizer) send(end tokens.Position) {
+	for _, tk := range t.pending {
+		tk.End = end
+		if end == (tokens.Position{}) {
+			tk.End = tk.Position
+		}
+		t.Channel <- tk
 	}
+	t.pending = nil
 }
 
-// tokenize process a string recursively
+// tokenize process a string, one token at a time. It loops rather than recursing on the rest
+// of the text, so that the length of the input does not bound the depth of the stack
 func (t *Tokenizer) tokenize(text string, pos tokens.Position, indent int) {
-	if len(text) == 0 {
-		t.yieldToken(tokens.EOF, "", pos)
-		return
-	}
+	for {
+		if len(text) == 0 {
+			if t.interpolations > 0 {
+				t.yieldToken(tokens.ERROR, "could not find end of string literal", pos)
+				return
+			}
+			t.yieldToken(tokens.EOF, "", pos)
+			return
+		}
 
-	head := text[0]
-	tail := text[1:]
+		head := text[0]
+		tail := text[1:]
+		start := pos
 
-	switch {
-	case head == '\n':
-		oldIndent := indent
-		var consumed int
-		indent, consumed = consumeTab(tail)
-		diff := indent - oldIndent
 		switch {
-		case diff > 0:
-			// indentation increased => begin block
-			for i := 0; i < diff; i++ {
-				t.yieldToken(tokens.BEGIN, "BEGIN"+strconv.Itoa(oldIndent+1+i), pos)
+		case head == '\n' && t.interpolations > 0:
+			t.yieldToken(tokens.ERROR, "could not find end of string literal", pos)
+			return
+		case head == '\n':
+			// the lines holding only a comment are skipped, so that they do not change the indentation
+			skipped := 0
+			for {
+				line := strings.TrimLeft(tail, " \t")
+				if !strings.HasPrefix(line, "#") {
+					break
+				}
+				end := strings.IndexByte(line, '\n')
+				if end < 0 {
+					// the last line: its comment is read like the comments ending lines
+					tail = line
+					break
+				}
+				tail = line[end+1:]
+				skipped++
 			}
-		case diff < 0:
-			// indentation decreased => end block
-			for i := 0; i < -diff; i++ {
-				t.yieldToken(tokens.END, "END"+strconv.Itoa(oldIndent-i), pos)
+
+			oldIndent := indent
+			indent, _ = consumeTab(tail)
+			diff := indent - oldIndent
+			switch {
+			case diff > 0:
+				// indentation increased => begin block
+				for i := 0; i < diff; i++ {
+					t.yieldToken(tokens.BEGIN, "BEGIN"+strconv.Itoa(oldIndent+1+i), pos)
+				}
+			case diff < 0:
+				// indentation decreased => end block
+				for i := 0; i < -diff; i++ {
+					t.yieldToken(tokens.END, "END"+strconv.Itoa(oldIndent-i), pos)
+				}
+			default:
+				// no indentation change. Simply yields an EOL
+				t.yieldToken(tokens.EOL, "EOL", pos)
 			}
-		default:
-			// no indentation change. Simply yields an EOL
-			t.yieldToken(tokens.EOL, "EOL", pos)
-		}
 
-		pos.Col += 1 + consumed
-	case isWhiteSpace(head):
-		pos.Col++
-		// simply skip
-	case isDigit(head):
-		value := readInteger(text)
-		tail = text[len(value):]
-		t.yieldToken(tokens.INTEGER, value, pos)
-		pos.Col += len(value)
-	case isAlpha(head):
-		value := readIdentifier(text)
-		tail = text[len(value):]
-		// keywords should not be treated as identifiers!
-		switch value {
-		case "true", "false":
-			t.yieldToken(tokens.BOOL, value, pos)
-		case "func":
-			t.yieldToken(tokens.FUNC, value, pos)
-		default:
-			t.yieldToken(tokens.IDENTIFIER, value, pos)
-		}
-		pos.Col += len(value)
-	case head == ',':
-		t.yieldToken(tokens.COMMA, "COMMA", pos)
-		pos.Col++
-	case head == '+':
-		if len(tail) > 0 && tail[0] == '+' {
-			tail = text[2:]
-			t.yieldToken(tokens.CONCAT, "++", pos)
-			pos.Col += 2
-		} else {
-			t.yieldToken(tokens.PLUS, "+", pos)
+			// the indentation is skipped as white spaces
+			pos.Line += 1 + skipped
+			pos.Col = 1
+		case isWhiteSpace(head):
 			pos.Col++
-		}
-	case head == '-':
-		t.yieldToken(tokens.MINUS, "-", pos)
-		pos.Col++
-	case head == '*':
-		t.yieldToken(tokens.MULT, "*", pos)
-		pos.Col++
-	case head == '/':
-		t.yieldToken(tokens.DIV, "/", pos)
-		pos.Col++
-	case head == '^':
-		t.yieldToken(tokens.POW, "^", pos)
-		pos.Col++
-	case head == '(':
-		t.yieldToken(tokens.LPAREN, "LPAREN", pos)
-		pos.Col++
-	case head == ')':
-		t.yieldToken(tokens.RPAREN, "RPAREN", pos)
-		pos.Col++
-	case head == '"':
-		value, err := readString(text)
-		if err != nil {
-			t.yieldToken(tokens.ERROR, err.Error(), pos)
-			return
-		}
-
-		// value does not contain the surrounding quotes, so let's add 2
-		length := len(value) + 2
-		tail = text[length:]
-		t.yieldToken(tokens.STRING, value, pos)
-		pos.Col += length
-	case head == ':':
-		if len(tail) > 0 && tail[0] == '=' {
-			tail = tail[1:]
-			t.yieldToken(tokens.ASSIGN, ":=", pos)
-			pos.Col += 2
-		} else {
-			t.yieldToken(tokens.COLUMN, "COLUMN", pos)
+			// simply skip
+		case head == '#':
+			// a comment runs to the end of the line
+			comment := text
+			if end := strings.IndexByte(text, '\n'); end >= 0 {
+				comment = text[:end]
+			}
+			tail = text[len(comment):]
+			pos = advance(pos, comment)
+		case isDigit(head):
+			literal, isFloat := readNumber(text)
+			tail = text[len(literal):]
+			if len(tail) > 0 && (isAlpha(tail[0]) || tail[0] == '.') {
+				t.yieldToken(tokens.ERROR, fmt.Sprintf("malformed number %s", readMalformedNumber(text)), pos)
+				return
+			}
+			// underscores only separate digits
+			value := strings.Replace(literal, "_", "", -1)
+			if isFloat {
+				t.yieldToken(tokens.FLOAT, value, pos)
+			} else {
+				t.yieldToken(tokens.INTEGER, value, pos)
+			}
+			pos.Col += len(literal)
+		case isAlpha(head):
+			value := readIdentifier(text)
+			tail = text[len(value):]
+			// keywords should not be treated as identifiers!
+			switch value {
+			case "true", "false":
+				t.yieldToken(tokens.BOOL, value, pos)
+			case "func":
+				t.yieldToken(tokens.FUNC, value, pos)
+			case "import":
+				t.yieldToken(tokens.IMPORT, value, pos)
+			case "type":
+				t.yieldToken(tokens.TYPE, value, pos)
+			case "match":
+				t.yieldToken(tokens.MATCH, value, pos)
+			case "try":
+				t.yieldToken(tokens.TRY, value, pos)
+			case "catch":
+				t.yieldToken(tokens.CATCH, value, pos)
+			default:
+				t.yieldToken(tokens.IDENTIFIER, value, pos)
+			}
+			pos.Col += len(value)
+		case head == ',':
+			t.yieldToken(tokens.COMMA, "COMMA", pos)
 			pos.Col++
-		}
-	case head == '=':
-		// might be an equality comparison
-		if len(tail) == 0 || tail[0] != '=' {
-			t.yieldToken(tokens.ERROR, "Unexpected :", pos)
+		case head == '.':
+			t.yieldToken(tokens.DOT, ".", pos)
+			pos.Col++
+		case head == '+':
+			if len(tail) > 0 && tail[0] == '+' {
+				tail = text[2:]
+				t.yieldToken(tokens.CONCAT, "++", pos)
+				pos.Col += 2
+			} else {
+				t.yieldToken(tokens.PLUS, "+", pos)
+				pos.Col++
+			}
+		case head == '-':
+			if len(tail) > 0 && tail[0] == '>' {
+				tail = tail[1:]
+				t.yieldToken(tokens.ARROW, "->", pos)
+				pos.Col += 2
+			} else {
+				t.yieldToken(tokens.MINUS, "-", pos)
+				pos.Col++
+			}
+		case head == '*':
+			t.yieldToken(tokens.MULT, "*", pos)
+			pos.Col++
+		case head == '/':
+			t.yieldToken(tokens.DIV, "/", pos)
+			pos.Col++
+		case head == '^':
+			t.yieldToken(tokens.POW, "^", pos)
+			pos.Col++
+		case head == '(':
+			t.yieldToken(tokens.LPAREN, "LPAREN", pos)
+			pos.Col++
+		case head == ')':
+			t.yieldToken(tokens.RPAREN, "RPAREN", pos)
+			pos.Col++
+		case head == '[':
+			t.yieldToken(tokens.LBRACKET, "LBRACKET", pos)
+			pos.Col++
+		case head == ']':
+			t.yieldToken(tokens.RBRACKET, "RBRACKET", pos)
+			pos.Col++
+		case head == '"' || head == '`':
+			value, raw, interpolated, err := readString(text)
+			if err != nil {
+				t.yieldToken(tokens.ERROR, err.Error(), errorPos(pos, text, err))
+				return
+			}
+
+			// the raw literal is longer than the value when it contains escape sequences
+			tail = text[len(raw):]
+			if interpolated && emptyInterpolation(tail) {
+				t.yieldToken(tokens.ERROR, "empty interpolation", interpolationPos(pos, raw))
+				return
+			}
+			if interpolated {
+				// the embedded expression is tokenized as usual, up to the closing }
+				t.interpolations++
+				t.yieldToken(tokens.STRINGSTART, value, pos)
+			} else {
+				t.yieldToken(tokens.STRING, value, pos)
+			}
+			pos = advance(pos, raw)
+		case head == '}' && t.interpolations > 0:
+			// end of an embedded expression. The string goes on
+			value, length, interpolated, err := readStringContents(tail)
+			if err != nil {
+				t.yieldToken(tokens.ERROR, err.Error(), errorPos(pos, text, shift(err, 1)))
+				return
+			}
+
+			raw := text[:length+1]
+			tail = text[len(raw):]
+			if interpolated && emptyInterpolation(tail) {
+				t.yieldToken(tokens.ERROR, "empty interpolation", interpolationPos(pos, raw))
+				return
+			}
+			if interpolated {
+				t.yieldToken(tokens.STRINGPART, value, pos)
+			} else {
+				t.interpolations--
+				t.yieldToken(tokens.STRINGEND, value, pos)
+			}
+			pos = advance(pos, raw)
+		case head == ':':
+			if len(tail) > 0 && tail[0] == '=' {
+				tail = tail[1:]
+				t.yieldToken(tokens.ASSIGN, ":=", pos)
+				pos.Col += 2
+			} else {
+				t.yieldToken(tokens.COLUMN, "COLUMN", pos)
+				pos.Col++
+			}
+		case head == '=':
+			if len(tail) > 0 && tail[0] == '=' {
+				tail = tail[1:]
+				t.yieldToken(tokens.EQ, "==", pos)
+				pos.Col += 2
+			} else {
+				t.yieldToken(tokens.DEFINE, "=", pos)
+				pos.Col++
+			}
+		case head == '!':
+			if len(tail) > 0 && tail[0] == '=' {
+				tail = tail[1:]
+				t.yieldToken(tokens.NEQ, "!=", pos)
+				pos.Col += 2
+			} else {
+				t.yieldToken(tokens.NOT, "!", pos)
+				pos.Col++
+			}
+		case head == '|':
+			if len(tail) > 0 && tail[0] == '|' {
+				tail = tail[1:]
+				t.yieldToken(tokens.OR, "||", pos)
+				pos.Col += 2
+			} else {
+				t.yieldToken(tokens.PIPE, "|", pos)
+				pos.Col++
+			}
+		case head == '&':
+			if len(tail) > 0 && tail[0] == '&' {
+				tail = tail[1:]
+				t.yieldToken(tokens.AND, "&&", pos)
+				pos.Col += 2
+			} else {
+				t.yieldToken(tokens.ERROR, fmt.Sprintf("syntax error: unexpected & in %s", text), pos)
+				return
+			}
+		default:
+			r, _ := utf8.DecodeRuneInString(text)
+			t.yieldToken(tokens.ERROR, fmt.Sprintf("syntax error: unexpected %q in %s", r, text), pos)
+			// stop recursion
 			return
 		}
 
-		tail = tail[1:]
-		t.yieldToken(tokens.EQ, "==", pos)
-		pos.Col += 2
-	case head == '!':
-		if len(tail) > 0 && tail[0] == '=' {
-			tail = tail[1:]
-			t.yieldToken(tokens.NEQ, "!=", pos)
-			pos.Col += 2
-		} else {
-			t.yieldToken(tokens.NOT, "!", pos)
-			pos.Col++
-		}
-	case head == '|':
-		if len(tail) > 0 && tail[0] == '|' {
-			tail = tail[1:]
-			t.yieldToken(tokens.OR, "||", pos)
-			pos.Col += 2
-		} else {
-			t.yieldToken(tokens.ERROR, fmt.Sprintf("syntax error: unexpected | in %s", text), pos)
-			return
+		t.send(advance(start, text[:len(text)-len(tail)]))
+
+		// tokenize the rest of the string
+		text = tail
+	}
+}
+
+// readNumber reads an integer or a float literal such as 1_000, 3.14 or 1e-9
+func readNumber(input string) (literal string, isFloat bool) {
+	literal = readDigits(input)
+	tail := input[len(literal):]
+
+	if len(tail) > 1 && tail[0] == '.' && isDigit(tail[1]) {
+		fraction := readDigits(tail[1:])
+		literal += "." + fraction
+		tail = tail[len(fraction)+1:]
+		isFloat = true
+	}
+
+	if len(tail) > 0 && (tail[0] == 'e' || tail[0] == 'E') {
+		sign := ""
+		if len(tail) > 1 && (tail[1] == '+' || tail[1] == '-') {
+			sign = tail[1:2]
 		}
-	case head == '&':
-		if len(tail) > 0 && tail[0] == '&' {
-			tail = tail[1:]
-			t.yieldToken(tokens.AND, "&&", pos)
-			pos.Col += 2
-		} else {
-			t.yieldToken(tokens.ERROR, fmt.Sprintf("syntax error: unexpected & in %s", text), pos)
-			return
+		exponent := readDigits(tail[1+len(sign):])
+		if exponent != "" {
+			literal += tail[:1] + sign + exponent
+			isFloat = true
 		}
-	default:
-		t.yieldToken(tokens.ERROR, fmt.Sprintf("syntax error in %s", text), pos)
-		// stop recursion
-		return
 	}
 
-	// recursively tokenize the rest of the string
-	t.tokenize(tail, pos, indent)
+	return literal, isFloat
 }
 
-func readInteger(input string) string {
-	if input == "" {
+// readDigits reads digits, optionally separated by single underscores
+func readDigits(input string) string {
+	if input == "" || !isDigit(input[0]) {
 		return ""
 	}
 
-	head := input[0]
-	tail := input[1:]
+	length := 1
+	for length < len(input) {
+		switch {
+		case isDigit(input[length]):
+			length++
+		case input[length] == '_' && length+1 < len(input) && isDigit(input[length+1]):
+			length += 2
+		default:
+			return input[:length]
+		}
+	}
+	return input
+}
 
-	if isDigit(head) {
-		return string(head) + readInteger(tail)
+// readMalformedNumber returns the text of an invalid number literal, for error messages
+func readMalformedNumber(input string) string {
+	for length := 0; length < len(input); length++ {
+		head := input[length]
+		if !isDigit(head) && !isAlpha(head) && head != '.' {
+			return input[:length]
+		}
 	}
+	return input
+}
 
-	return ""
+// advance moves a position after a text. Columns are counted in runes
+func advance(pos tokens.Position, text string) tokens.Position {
+	for _, r := range text {
+		if r == '\n' {
+			pos.Line++
+			pos.Col = 1
+		} else {
+			pos.Col++
+		}
+	}
+	return pos
 }
 
-func readIdentifier(input string) string {
-	if input == "" {
-		return ""
+// errorPos returns the position of an error found in a string literal of a text starting at pos.
+// The errors that are not located in the literal are reported at its beginning
+func errorPos(pos tokens.Position, text string, err error) tokens.Position {
+	if serr, ok := err.(*stringError); ok {
+		return advance(pos, text[:serr.offset])
 	}
+	return pos
+}
 
-	head := input[0]
-	tail := input[1:]
+// interpolationPos returns the position of the ${ ending the raw text of a string starting at pos
+func interpolationPos(pos tokens.Position, raw string) tokens.Position {
+	pos = advance(pos, raw)
+	pos.Col -= 2
+	return pos
+}
 
-	if isAlpha(head) {
-		return string(head) + readIdentifier(tail)
+func readIdentifier(input string) string {
+	for length := 0; length < len(input); length++ {
+		if !isAlpha(input[length]) {
+			return input[:length]
+		}
 	}
-
-	return ""
+	return input
 }
 
 func isWhiteSpace(char byte) bool {
@@ -254,26 +446,26 @@ func isAlpha(char byte) bool {
 }
 
 func consumeTab(s string) (tabs int, consumed int) {
-	if len(s) == 0 {
-		return
-	}
-
-	switch s[0] {
-	// space
-	case ' ':
-		if len(s) < 4 {
+	for {
+		switch {
+		// space
+		case strings.HasPrefix(s[consumed:], "    "):
+			consumed += 4
+		// tab
+		case strings.HasPrefix(s[consumed:], "\t"):
+			consumed++
+		default:
 			return
 		}
-		if string(s[0:4]) == "    " {
-			tabs, consumed = consumeTab(s[4:])
-			return tabs + 1, consumed + 4
-		}
-	// tab
-	case '	':
-		tabs, consumed = consumeTab(s[1:])
-		return tabs + 1, consumed + 1
+		tabs++
+	}
+}
+
+// Drain reads and drops the remaining tokens, so that the tokenizer ends when its reader
+// stops before the end of file
+func (t *Tokenizer) Drain() {
+	for range t.Channel {
 	}
-	return
 }
 
 // Flush all remaining tokens
@@ -1,6 +1,7 @@
 package tokenizer
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -23,6 +24,17 @@ func TestPrimaryTypes(t *testing.T) {
 			{`"foo\nbar\nbaz"`, `foo` + "\n" + `bar` + "\n" + `baz`},
 			{`"foo\\bar"`, `foo\bar`},
 			{`"foo\"bar\"baz"`, `foo"bar"baz`},
+			{`"a\tb\rc\0d"`, "a\tb\rc\x00d"},
+			{`"\x41\x7e"`, `A~`},
+			{`"caf\u00e9 \U0001F600"`, `café 😀`},
+			{`"café 😀"`, `café 😀`},
+			// raw strings
+			{"`foo\\n\"bar\"`", `foo\n"bar"`},
+			{"`foo\n    bar`", "foo\n    bar"},
+			// multi-line strings
+			{"\"\"\"\n    foo\n      bar\n\n    baz\n    \"\"\"", "foo\n  bar\n\nbaz"},
+			{"\"\"\"  \n\t\"quoted\" \\\"\"\" \\u00e9\n\t\"\"\"", `"quoted" """ é`},
+			{"\"\"\"\n\"\"\"", ``},
 		}
 
 		for _, f := range fixtures {
@@ -44,6 +56,17 @@ func TestPrimaryTypes(t *testing.T) {
 			`"foo\*bar"`,
 			`"foo`,
 			`"foo` + "\n" + `bar"`,
+			`"\x4"`,
+			`"\xzz"`,
+			`"\u00e"`,
+			`"\uD800"`,
+			`"\U00110000"`,
+			"\"\xff\"",
+			"`foo",
+			`"""foo"""`,
+			"\"\"\"\nfoo",
+			"\"\"\"\n    foo\n  bar\n    \"\"\"",
+			"\"\"\"\n    foo\"\"\"",
 		}
 
 		for _, f := range fixtures {
@@ -52,6 +75,29 @@ func TestPrimaryTypes(t *testing.T) {
 		}
 	})
 
+	t.Run("locates the errors of strings", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			err    string
+		}{
+			{`x := "foo\bar"`, `test.ca:1:10: invalid escape sequence \b`},
+			{`"é\x4"`, `test.ca:1:3: invalid escape sequence \x4": expected 2 hexadecimal digits`},
+			{"x := \"foo\nbar\"", "test.ca:1:10: could not find end of string literal"},
+			{`"foo`, "test.ca:1:1: could not find end of string literal"},
+			{`"${x} \q"`, `test.ca:1:7: invalid escape sequence \q`},
+			{"x := \"\"\"\n    foo\n    a\\qb\n    \"\"\"", `test.ca:3:6: invalid escape sequence \q`},
+			{"\"\"\"\n    foo\n  bar\n    \"\"\"", "test.ca:3:1: the lines of a multi-line string must be indented at least like the closing \"\"\""},
+			{"\"\"\"\n    foo\"\"\"", "test.ca:2:8: the closing \"\"\" of a multi-line string must be on its own line"},
+		}
+
+		for _, f := range fixtures {
+			_, err := Tokenize("test.ca", f.source).Flush()
+			if assert.Error(err, f.source) {
+				assert.Equal(f.err, err.Error(), f.source)
+			}
+		}
+	})
+
 	t.Run("reads integers", func(t *testing.T) {
 		fixtures := []struct {
 			input    string
@@ -59,6 +105,7 @@ func TestPrimaryTypes(t *testing.T) {
 		}{
 			{`0`, `0`},
 			{`123`, `123`},
+			{`1_000_000`, `1000000`},
 		}
 
 		for _, f := range fixtures {
@@ -72,6 +119,48 @@ func TestPrimaryTypes(t *testing.T) {
 
 	})
 
+	t.Run("reads floats", func(t *testing.T) {
+		fixtures := []struct {
+			input    string
+			expected string
+		}{
+			{`3.14`, `3.14`},
+			{`0.5`, `0.5`},
+			{`1e9`, `1e9`},
+			{`1E9`, `1E9`},
+			{`2.5e-3`, `2.5e-3`},
+			{`6.02e+23`, `6.02e+23`},
+			{`1_000.000_1`, `1000.0001`},
+		}
+
+		for _, f := range fixtures {
+			tks, err := Tokenize("test.ca", f.input).Flush()
+			if !assert.Nil(err, f.input) || !assert.Len(tks, 1, f.input) {
+				continue
+			}
+			assert.Equal(tokens.FLOAT, tks[0].Type, f.input)
+			assert.Equal(f.expected, tks[0].Value, f.input)
+		}
+	})
+
+	t.Run("detects malformed numbers", func(t *testing.T) {
+		fixtures := []string{
+			`1_`,
+			`1__000`,
+			`1.`,
+			`1.e3`,
+			`1e`,
+			`1e+`,
+			`1.2.3`,
+			`12abc`,
+		}
+
+		for _, f := range fixtures {
+			_, err := Tokenize("test.ca", f).Flush()
+			assert.Error(err, f)
+		}
+	})
+
 	t.Run("reads booleans", func(t *testing.T) {
 		fixtures := []struct {
 			input    string
@@ -113,6 +202,10 @@ func TestBasicExpressions(t *testing.T) {
 			{`!true`, `!:NOT,true:BOOL`},
 			{`true && false`, `true:BOOL,&&:AND,false:BOOL`},
 			{`true || false`, `true:BOOL,||:OR,false:BOOL`},
+			{`type T = A | B`, `type:TYPE,T:IDENTIFIER,=:DEFINE,A:IDENTIFIER,|:PIPE,B:IDENTIFIER`},
+			{`match x`, `match:MATCH,x:IDENTIFIER`},
+			{`try catch e`, `try:TRY,catch:CATCH,e:IDENTIFIER`},
+			{`_ -> -1`, `_:IDENTIFIER,->:ARROW,-:MINUS,1:INTEGER`},
 		}
 
 		for _, f := range fixtures {
@@ -133,9 +226,8 @@ func TestBasicExpressions(t *testing.T) {
 
 	t.Run("syntaxically invalid basic expressions", func(t *testing.T) {
 		fixtures := []string{
-			`12 = 34`,
+			`12 ~ 34`,
 			`true & false`,
-			`true | false`,
 		}
 
 		for _, f := range fixtures {
@@ -229,6 +321,45 @@ func TestIndentation(t *testing.T) {
 	})
 }
 
+func TestComments(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		input    string
+		expected string
+	}{
+		{"# a comment", ``},
+		{"12 # a comment\n34", `12:INTEGER,EOL:EOL,34:INTEGER`},
+		{"\"# a string\" # a comment", `# a string:STRING`},
+		// the lines holding only a comment do not change the indentation
+		{"12\n    34\n# a comment\n        # a comment\n    56", `12:INTEGER,BEGIN1:BEGIN,34:INTEGER,EOL:EOL,56:INTEGER`},
+		{"12\n    34\n    # a comment", `12:INTEGER,BEGIN1:BEGIN,34:INTEGER,END1:END`},
+	}
+
+	for _, f := range fixtures {
+		tks, err := Tokenize("test.ca", f.input).Flush()
+		if !assert.Nil(err, f.input) {
+			continue
+		}
+
+		stringTks := []string{}
+		for _, tk := range tks {
+			stringTks = append(stringTks, tk.String())
+		}
+		assert.Equal(f.expected, strings.Join(stringTks, ","), f.input)
+	}
+
+	// the lines of comments are counted
+	tks, err := Tokenize("test.ca", "# a comment\n  # a comment\nfoo # a comment\nbar").Flush()
+	if assert.Nil(err) {
+		positions := []string{}
+		for _, tk := range tks {
+			positions = append(positions, fmt.Sprintf("%s@%d:%d", tk.Value, tk.Position.Line, tk.Position.Col))
+		}
+		assert.Equal([]string{"EOL@1:12", "foo@3:1", "EOL@3:16", "bar@4:1"}, positions)
+	}
+}
+
 func TestFunctions(t *testing.T) {
 	assert := assert.New(t)
 
@@ -239,6 +370,7 @@ func TestFunctions(t *testing.T) {
 		}{
 			{`func foo() :int`, `func:FUNC,foo:IDENTIFIER,LPAREN:LPAREN,RPAREN:RPAREN,COLUMN:COLUMN,int:IDENTIFIER`},
 			{`func foo(bar:string, baz:int) :bool`, `func:FUNC,foo:IDENTIFIER,LPAREN:LPAREN,bar:IDENTIFIER,COLUMN:COLUMN,string:IDENTIFIER,COMMA:COMMA,baz:IDENTIFIER,COLUMN:COLUMN,int:IDENTIFIER,RPAREN:RPAREN,COLUMN:COLUMN,bool:IDENTIFIER`},
+			{`func first[T](xs:[T]) :T`, `func:FUNC,first:IDENTIFIER,LBRACKET:LBRACKET,T:IDENTIFIER,RBRACKET:RBRACKET,LPAREN:LPAREN,xs:IDENTIFIER,COLUMN:COLUMN,LBRACKET:LBRACKET,T:IDENTIFIER,RBRACKET:RBRACKET,RPAREN:RPAREN,COLUMN:COLUMN,T:IDENTIFIER`},
 		}
 
 		for _, f := range fixtures {
@@ -294,3 +426,177 @@ func TestBuffer(t *testing.T) {
 		assert.Error(err)
 	})
 }
+
+func TestPositions(t *testing.T) {
+	assert := assert.New(t)
+
+	tks, err := Tokenize("test.ca", "foo := 12\nfunc bar() :int\n    \"baz\" ++ foo").Flush()
+	if !assert.Nil(err) {
+		return
+	}
+
+	positions := []string{}
+	for _, tk := range tks {
+		positions = append(positions, fmt.Sprintf("%s@%d:%d", tk.Value, tk.Position.Line, tk.Position.Col))
+	}
+
+	assert.Equal([]string{
+		"foo@1:1", ":=@1:5", "12@1:8", "EOL@1:10",
+		"func@2:1", "bar@2:6", "LPAREN@2:9", "RPAREN@2:10", "COLUMN@2:12", "int@2:13", "BEGIN1@2:16",
+		"baz@3:5", "++@3:11", "foo@3:14",
+	}, positions)
+}
+
+func TestEnds(t *testing.T) {
+	assert := assert.New(t)
+
+	tks, err := Tokenize("test.ca", "x := 1_000 ++ \"é\\n\"\ny := \"a ${x} b\"").Flush()
+	if !assert.Nil(err) {
+		return
+	}
+
+	spans := []string{}
+	for _, tk := range tks {
+		spans = append(spans, fmt.Sprintf("%s@%d:%d-%d:%d", tk.Type, tk.Position.Line, tk.Position.Col, tk.End.Line, tk.End.Col))
+	}
+
+	assert.Equal([]string{
+		"IDENTIFIER@1:1-1:2", "ASSIGN@1:3-1:5", "INTEGER@1:6-1:11", "CONCAT@1:12-1:14", "STRING@1:15-1:20", "EOL@1:20-2:1",
+		"IDENTIFIER@2:1-2:2", "ASSIGN@2:3-2:5", "STRINGSTART@2:6-2:11", "IDENTIFIER@2:11-2:12", "STRINGEND@2:12-2:16",
+	}, spans)
+}
+
+func TestStringPositions(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		source    string
+		positions []string
+	}{
+		{
+			// escape sequences are longer than their values
+			`"a\tb\u00e9" ++ x`,
+			[]string{"STRING@1:1", "++@1:14", "x@1:17"},
+		},
+		{
+			// columns are counted in runes
+			`"héllo 😀" ++ x`,
+			[]string{"STRING@1:1", "++@1:11", "x@1:14"},
+		},
+		{
+			"x := `a\nbc` ++ y",
+			[]string{"x@1:1", ":=@1:3", "STRING@1:6", "++@2:5", "y@2:8"},
+		},
+		{
+			"x := \"\"\"\n    foo\n    \"\"\"\ny",
+			[]string{"x@1:1", ":=@1:3", "STRING@1:6", "EOL@3:8", "y@4:1"},
+		},
+	}
+
+	for _, f := range fixtures {
+		tks, err := Tokenize("test.ca", f.source).Flush()
+		if !assert.Nil(err, f.source) {
+			continue
+		}
+
+		positions := []string{}
+		for _, tk := range tks {
+			value := tk.Value
+			if tk.Type == tokens.STRING {
+				value = "STRING"
+			}
+			positions = append(positions, fmt.Sprintf("%s@%d:%d", value, tk.Position.Line, tk.Position.Col))
+		}
+		assert.Equal(f.positions, positions, f.source)
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("splits strings around embedded expressions", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			tokens []string
+		}{
+			{
+				`"hello ${name}, you are ${age + 1}!"`,
+				[]string{"hello :STRINGSTART@1:1", "name:IDENTIFIER@1:10", ", you are :STRINGPART@1:14", "age:IDENTIFIER@1:27", "+:PLUS@1:31", "1:INTEGER@1:33", "!:STRINGEND@1:34"},
+			},
+			{
+				`"a${"b${c}"}d"`,
+				[]string{"a:STRINGSTART@1:1", "b:STRINGSTART@1:5", "c:IDENTIFIER@1:9", ":STRINGEND@1:10", "d:STRINGEND@1:12"},
+			},
+			{
+				`"\${x} $x"`,
+				[]string{"${x} $x:STRING@1:1"},
+			},
+		}
+
+		for _, f := range fixtures {
+			tks, err := Tokenize("test.ca", f.source).Flush()
+			if !assert.Nil(err, f.source) {
+				continue
+			}
+
+			debug := []string{}
+			for _, tk := range tks {
+				debug = append(debug, fmt.Sprintf("%s@%d:%d", tk, tk.Position.Line, tk.Position.Col))
+			}
+			assert.Equal(f.tokens, debug, f.source)
+		}
+	})
+
+	t.Run("detects unterminated embedded expressions", func(t *testing.T) {
+		fixtures := []string{
+			`"${x"`,
+			`"${x}`,
+			"\"${x\n}\"",
+			`"${"}"`,
+		}
+
+		for _, f := range fixtures {
+			_, err := Tokenize("test.ca", f).Flush()
+			assert.Error(err, f)
+		}
+	})
+
+	t.Run("detects empty embedded expressions", func(t *testing.T) {
+		fixtures := []struct {
+			source string
+			err    string
+		}{
+			{`"${}"`, "test.ca:1:2: empty interpolation"},
+			{`"a ${ }"`, "test.ca:1:4: empty interpolation"},
+			{`"é ${x} ${}"`, "test.ca:1:9: empty interpolation"},
+		}
+
+		for _, f := range fixtures {
+			_, err := Tokenize("test.ca", f.source).Flush()
+			if assert.Error(err, f.source) {
+				assert.Equal(f.err, err.Error(), f.source)
+			}
+		}
+	})
+}
+
+func TestLongInputs(t *testing.T) {
+	assert := assert.New(t)
+
+	// a token per character used to be a nested call, and identifiers were read a character at a time
+	long := strings.Repeat("a", 1<<20)
+	tks, err := Tokenize("test.ca", long+" 1_0"+strings.Repeat("_0", 1<<16)+strings.Repeat(" +", 1<<18)).Flush()
+	if assert.Nil(err) {
+		assert.Len(tks, 2+1<<18)
+		assert.Equal(long, tks[0].Value)
+		assert.Equal("1"+strings.Repeat("0", 1+1<<16), tks[1].Value)
+	}
+
+	t.Run("drains the remaining tokens", func(t *testing.T) {
+		tokenizer := Tokenize("test.ca", "1 2 3")
+		tokenizer.NextToken()
+		tokenizer.Drain()
+		_, err := tokenizer.NextToken()
+		assert.Error(err)
+	})
+}
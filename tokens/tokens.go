@@ -14,17 +14,38 @@ const (
 	END        TokenType = "END"
 	LPAREN     TokenType = "LPAREN"
 	RPAREN     TokenType = "RPAREN"
+	LBRACKET   TokenType = "LBRACKET"
+	RBRACKET   TokenType = "RBRACKET"
 	ASSIGN     TokenType = "ASSIGN"
 	IDENTIFIER TokenType = "IDENTIFIER"
 	FUNC       TokenType = "FUNC"
+	IMPORT     TokenType = "IMPORT"
+	TYPE       TokenType = "TYPE"
+	MATCH      TokenType = "MATCH"
+	TRY        TokenType = "TRY"
+	CATCH      TokenType = "CATCH"
+	DOT        TokenType = "DOT"
 	COLUMN     TokenType = "COLUMN"
 	COMMA      TokenType = "COMMA"
+	// DEFINE separates the name of a type from its definition
+	DEFINE TokenType = "DEFINE"
+	// PIPE separates the constructors of a sum type
+	PIPE TokenType = "PIPE"
+	// ARROW separates a pattern from the expression of a match arm
+	ARROW TokenType = "ARROW"
 
 	// primaty type litterals
 	INTEGER TokenType = "INTEGER"
+	FLOAT   TokenType = "FLOAT"
 	STRING  TokenType = "STRING"
 	BOOL    TokenType = "BOOL"
 
+	// interpolated strings are split around their embedded expressions:
+	// "a ${x} b ${y} c" gives STRINGSTART(a ) x STRINGPART( b ) y STRINGEND( c)
+	STRINGSTART TokenType = "STRINGSTART"
+	STRINGPART  TokenType = "STRINGPART"
+	STRINGEND   TokenType = "STRINGEND"
+
 	// operators
 	PLUS   TokenType = "PLUS"
 	MINUS  TokenType = "MINUS"
@@ -41,26 +62,73 @@ const (
 
 // Token reprensents the result of a lexical analysis
 type Token struct {
-	Type     TokenType
-	Value    string
-	Position Position
+	Type     TokenType `json:"type"`
+	Value    string    `json:"value"`
+	Position Position  `json:"pos"`
+	// End is the position following the last character of the token
+	End Position `json:"end"`
 }
 
 func (t *Token) String() string {
 	return fmt.Sprintf("%s:%s", t.Value, t.Type)
 }
 
+// Describe returns the token as it is written in the source, for error messages
+func (t *Token) Describe() string {
+	switch t.Type {
+	case EOF:
+		return "end of file"
+	case EOL:
+		return "end of line"
+	case BEGIN:
+		return "indented block"
+	case END:
+		return "end of block"
+	case LPAREN:
+		return "("
+	case RPAREN:
+		return ")"
+	case LBRACKET:
+		return "["
+	case RBRACKET:
+		return "]"
+	case COMMA:
+		return ","
+	case COLUMN:
+		return ":"
+	case STRING:
+		return fmt.Sprintf("%q", t.Value)
+	case STRINGSTART:
+		return "interpolated string"
+	case STRINGPART, STRINGEND:
+		// the } ending an embedded expression
+		return "}"
+	default:
+		return t.Value
+	}
+}
+
 func (t *Token) Debug() string {
 	return fmt.Sprintf("%s:%s@%s", t.Value, t.Type, t.Position)
 }
 
 // Position represents the position of a token in the source code
 type Position struct {
-	File string
-	Line int
-	Col  int
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Col  int    `json:"col"`
 }
 
 func (p Position) String() string {
 	return fmt.Sprintf("Pos(%s, %d, %d)", p.File, p.Line, p.Col)
 }
+
+// Error is a syntax error located in the source code
+type Error struct {
+	Pos     Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Pos.File, e.Pos.Line, e.Pos.Col, e.Message)
+}
@@ -0,0 +1,358 @@
+package watgen
+
+import (
+	"strconv"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// nothing is the type of the statements leaving no value
+const nothing = "nothing"
+
+// one turns a sequence of instructions leaving a value into a single instruction,
+// so that it can be the operand of another instruction
+func one(instrs []*sexpr, typ string) *sexpr {
+	if len(instrs) == 1 {
+		return instrs[0]
+	}
+	return form("block", append([]*sexpr{form("result", atom(wasmTypes[typ]))}, instrs...)...)
+}
+
+func localGet(name string) *sexpr {
+	return form("local.get", atom("$"+name))
+}
+
+// call calls a helper function
+func (g *generator) call(helper string, args ...*sexpr) *sexpr {
+	g.helpers[helper] = true
+	return form("call", append([]*sexpr{atom(helper)}, args...)...)
+}
+
+// statementList translates statements to instructions. Only the last statement leaves its value
+func (g *generator) statementList(sl *ast.StatementList) ([]*sexpr, string, error) {
+	instrs := []*sexpr{}
+	typ := nothing
+	for index, st := range sl.Statements {
+		last := index == len(sl.Statements)-1
+		if assignment, ok := st.(*ast.Assignment); ok {
+			instr, t, err := g.assignment(assignment, last)
+			if err != nil {
+				return nil, "", err
+			}
+			instrs, typ = append(instrs, instr), t
+			continue
+		}
+
+		code, t, err := g.expr(st)
+		if err != nil {
+			return nil, "", err
+		}
+		if !last && t != nothing {
+			code = []*sexpr{form("drop", one(code, t))}
+			t = nothing
+		}
+		instrs, typ = append(instrs, code...), t
+	}
+	return instrs, typ, nil
+}
+
+// assignment sets a local variable. The last statement of a block also leaves the value
+func (g *generator) assignment(node *ast.Assignment, keep bool) (*sexpr, string, error) {
+	right, typ, err := g.expr(node.Right)
+	if err != nil {
+		return nil, "", err
+	}
+	if typ == nothing {
+		return nil, "", errorf(node.Right, "%s has no value", node.Right)
+	}
+	if err := g.declare(node.Right, node.Variable.Name, typ); err != nil {
+		return nil, "", err
+	}
+
+	if keep {
+		return form("local.tee", atom("$"+node.Variable.Name), one(right, typ)), typ, nil
+	}
+	return form("local.set", atom("$"+node.Variable.Name), one(right, typ)), nothing, nil
+}
+
+// expr translates an expression to instructions leaving its value
+func (g *generator) expr(node ast.Node) ([]*sexpr, string, error) {
+	switch n := node.(type) {
+	case *ast.Num:
+		if _, err := strconv.ParseInt(n.Value, 10, 64); err != nil {
+			return nil, "", errorf(n, "integer literal %s is too large", n.Value)
+		}
+		return []*sexpr{form("i64.const", atom(n.Value))}, "int", nil
+	case *ast.Bool:
+		if n.Value == "true" {
+			return []*sexpr{form("i32.const", atom("1"))}, "bool", nil
+		}
+		return []*sexpr{form("i32.const", atom("0"))}, "bool", nil
+	case *ast.Variable:
+		if n.Module != "" {
+			return nil, "", errorf(n, "imports are not supported by the WebAssembly backend")
+		}
+		if _, ok := g.fn.locals[n.Name]; !ok {
+			return nil, "", errorf(n, "unknown identifier %s", n.Name)
+		}
+		typ, err := g.typeOf(n)
+		if err != nil {
+			return nil, "", err
+		}
+		return []*sexpr{localGet(n.Name)}, typ, nil
+	case *ast.BlockStmt:
+		return g.statementList(n.Statements)
+	case *ast.UnaryOp:
+		return g.unaryOp(n)
+	case *ast.BinOp:
+		return g.binOp(n)
+	case *ast.FuncCall:
+		return g.funcCall(n)
+	case *ast.Match:
+		return g.match(n)
+	default:
+		return nil, "", unsupported(node)
+	}
+}
+
+// unsupported creates the error returned for the constructs the WebAssembly backend does not translate
+func unsupported(node ast.Node) error {
+	what := "this expression is"
+	switch node.(type) {
+	case *ast.Float:
+		what = "floats are"
+	case *ast.String, *ast.Interpolation:
+		what = "strings are"
+	case *ast.ListLit, *ast.Index:
+		what = "lists are"
+	case *ast.TupleLit, *ast.Destructuring:
+		what = "tuples are"
+	case *ast.Try:
+		what = "try expressions are"
+	case *ast.ConstructorPattern:
+		what = "constructor patterns are"
+	}
+	return errorf(node, "%s not supported by the WebAssembly backend", what)
+}
+
+func (g *generator) unaryOp(node *ast.UnaryOp) ([]*sexpr, string, error) {
+	instrs, typ, err := g.expr(node.Expr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// the checker verified the type of the operand
+	switch {
+	case node.Op.Type == tokens.NOT:
+		return []*sexpr{form("i32.eqz", one(instrs, typ))}, "bool", nil
+	case node.Op.Type == tokens.PLUS:
+		return instrs, typ, nil
+	case isNum(node.Expr):
+		// the literal was checked to fit in 64 bits, and so does its opposite
+		return []*sexpr{form("i64.const", atom("-"+node.Expr.(*ast.Num).Value))}, "int", nil
+	default:
+		// 0 - a traps when a is the smallest integer, like the negation of the interpreter
+		return []*sexpr{g.call("$rt.sub", form("i64.const", atom("0")), one(instrs, typ))}, "int", nil
+	}
+}
+
+func isNum(node ast.Node) bool {
+	_, ok := node.(*ast.Num)
+	return ok
+}
+
+// intOperators maps the operators on integers to instructions, or to the helpers checking overflows
+var intOperators = map[tokens.TokenType]string{
+	tokens.PLUS:  "$rt.add",
+	tokens.MINUS: "$rt.sub",
+	tokens.MULT:  "$rt.mul",
+	// the division traps on zero and on overflows, and truncates toward zero like cairn
+	tokens.DIV: "i64.div_s",
+	tokens.POW: "$rt.pow",
+	tokens.EQ:  "i64.eq",
+	tokens.NEQ: "i64.ne",
+}
+
+// boolOperators maps the operators on booleans to instructions.
+// Both operands are evaluated, as cairn does not short-circuit
+var boolOperators = map[tokens.TokenType]string{
+	tokens.AND: "i32.and",
+	tokens.OR:  "i32.or",
+	tokens.EQ:  "i32.eq",
+	tokens.NEQ: "i32.ne",
+}
+
+func (g *generator) binOp(node *ast.BinOp) ([]*sexpr, string, error) {
+	left, leftType, err := g.expr(node.Left)
+	if err != nil {
+		return nil, "", err
+	}
+	right, rightType, err := g.expr(node.Right)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if leftType == nothing {
+		return nil, "", errorf(node.Left, "%s has no value", node.Left)
+	}
+	if rightType == nothing {
+		return nil, "", errorf(node.Right, "%s has no value", node.Right)
+	}
+	// the checker verified the types of the operands, and gives the type of the result
+	typ, err := g.typeOf(node)
+	if err != nil {
+		return nil, "", err
+	}
+
+	instr := boolOperators[node.Op.Type]
+	if leftType == "int" {
+		instr = intOperators[node.Op.Type]
+	}
+	if instr == "" {
+		return nil, "", unsupported(node)
+	}
+	if instr[0] == '$' {
+		return []*sexpr{g.call(instr, one(left, leftType), one(right, rightType))}, typ, nil
+	}
+	return []*sexpr{form(instr, one(left, leftType), one(right, rightType))}, typ, nil
+}
+
+// builtins maps the builtin functions taking and returning integers to the helper functions implementing them
+var builtins = map[string]string{
+	"abs": "$rt.abs",
+	"min": "$rt.min",
+	"max": "$rt.max",
+	"pow": "$rt.pow",
+}
+
+func (g *generator) funcCall(node *ast.FuncCall) ([]*sexpr, string, error) {
+	if node.Module != "" {
+		return nil, "", errorf(node, "imports are not supported by the WebAssembly backend")
+	}
+
+	// the checker verified the arguments
+	args := []*sexpr{}
+	for _, arg := range node.Args {
+		instrs, typ, err := g.expr(arg)
+		if err != nil {
+			return nil, "", err
+		}
+		if typ == nothing {
+			return nil, "", errorf(arg, "%s has no value", arg)
+		}
+		args = append(args, one(instrs, typ))
+	}
+
+	target := "$" + node.Name
+	if _, ok := g.functions[node.Name]; !ok {
+		helper, ok := builtins[node.Name]
+		if !ok {
+			return nil, "", errorf(node, "unknown function %s", node.Name)
+		}
+		target = helper
+		g.helpers[helper] = true
+	}
+	typ, err := g.typeOf(node)
+	if err != nil {
+		return nil, "", err
+	}
+	return []*sexpr{form("call", append([]*sexpr{atom(target)}, args...)...)}, typ, nil
+}
+
+// match translates a match expression to a chain of if instructions.
+// The subject is evaluated once: it is kept in a local variable unless it is one
+func (g *generator) match(node *ast.Match) ([]*sexpr, string, error) {
+	subjectCode, subjectType, err := g.expr(node.Subject)
+	if err != nil {
+		return nil, "", err
+	}
+	if subjectType == nothing {
+		return nil, "", errorf(node.Subject, "%s has no value", node.Subject)
+	}
+
+	instrs := []*sexpr{}
+	subject := one(subjectCode, subjectType)
+	if _, ok := node.Subject.(*ast.Variable); !ok {
+		temp := g.temp(subjectType)
+		instrs = append(instrs, form("local.set", atom("$"+temp), subject))
+		subject = localGet(temp)
+	}
+
+	type arm struct {
+		// cond is nil for the arm matching every value
+		cond *sexpr
+		body []*sexpr
+	}
+	arms := []arm{}
+	typ := ""
+	for _, a := range node.Arms {
+		var cond *sexpr
+		body := []*sexpr{}
+		switch p := a.Pattern.(type) {
+		case *ast.WildcardPattern:
+		case *ast.BindingPattern:
+			if err := g.declare(p, p.Name, subjectType); err != nil {
+				return nil, "", err
+			}
+			body = append(body, form("local.set", atom("$"+p.Name), subject))
+		case *ast.ConstructorPattern:
+			return nil, "", unsupported(p)
+		default:
+			literal, literalType, err := g.expr(p)
+			if err != nil {
+				return nil, "", err
+			}
+			// a literal only matches the values of its type
+			if literalType != subjectType {
+				continue
+			}
+			cond = g.equals(subject, literal[0], subjectType)
+		}
+
+		code, t, err := g.expr(a.Body)
+		if err != nil {
+			return nil, "", err
+		}
+		if t == nothing {
+			return nil, "", errorf(a.Body, "%s has no value", a.Body)
+		}
+		if typ == "" {
+			typ = t
+		}
+		if t != typ {
+			return nil, "", errorf(a.Body, "the arms of the match must give a %s - got %s", typ, t)
+		}
+		arms = append(arms, arm{cond: cond, body: append(body, code...)})
+		if cond == nil {
+			break
+		}
+	}
+
+	if len(arms) == 0 {
+		return nil, "", errorf(node, "no pattern of the match can match a %s", subjectType)
+	}
+
+	// the chain is built from the last arm. No value matches when the last arm has a condition
+	chain := []*sexpr{form("unreachable")}
+	for index := len(arms) - 1; index >= 0; index-- {
+		if arms[index].cond == nil {
+			chain = arms[index].body
+			continue
+		}
+		chain = []*sexpr{form("if", form("result", atom(wasmTypes[typ])), arms[index].cond,
+			form("then", arms[index].body...), form("else", chain...))}
+	}
+	return append(instrs, chain...), typ, nil
+}
+
+// equals compares the subject of a match with a literal pattern
+func (g *generator) equals(subject, literal *sexpr, typ string) *sexpr {
+	if typ == "int" {
+		return form("i64.eq", subject, literal)
+	}
+	if literal.list[1].atom == "1" {
+		return subject
+	}
+	return form("i32.eqz", subject)
+}
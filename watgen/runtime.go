@@ -0,0 +1,68 @@
+package watgen
+
+// helpers are the functions added to the modules for the operations that differ from WebAssembly's.
+// Integer overflows trap, like the interpreter reports them with --checked.
+// Their names contain a dot, that cairn identifiers can not contain
+var helpers = map[string]string{
+	"$rt.add": `(func $rt.add (param $a i64) (param $b i64) (result i64)
+  (local $r i64)
+  (local.set $r (i64.add (local.get $a) (local.get $b)))
+  ;; the operands have the same sign, and the result another one
+  (if (i64.lt_s (i64.and (i64.xor (local.get $a) (local.get $r)) (i64.xor (local.get $b) (local.get $r))) (i64.const 0))
+    (then (unreachable)))
+  (local.get $r))`,
+	"$rt.sub": `(func $rt.sub (param $a i64) (param $b i64) (result i64)
+  (local $r i64)
+  (local.set $r (i64.sub (local.get $a) (local.get $b)))
+  ;; the operands have different signs, and the result is not of the sign of a
+  (if (i64.lt_s (i64.and (i64.xor (local.get $a) (local.get $b)) (i64.xor (local.get $a) (local.get $r))) (i64.const 0))
+    (then (unreachable)))
+  (local.get $r))`,
+	"$rt.mul": `(func $rt.mul (param $a i64) (param $b i64) (result i64)
+  (local $r i64)
+  (if (i64.eqz (local.get $a))
+    (then (return (i64.const 0))))
+  (if (i32.and (i64.eq (local.get $a) (i64.const -1)) (i64.eq (local.get $b) (i64.const 0x8000000000000000)))
+    (then (unreachable)))
+  (local.set $r (i64.mul (local.get $a) (local.get $b)))
+  (if (i64.ne (i64.div_s (local.get $r) (local.get $a)) (local.get $b))
+    (then (unreachable)))
+  (local.get $r))`,
+	// a negative exponent gives 1 / base ^ -exp, truncated toward zero like the division
+	"$rt.pow": `(func $rt.pow (param $base i64) (param $exp i64) (result i64)
+  (local $r i64)
+  (if (i64.eq (local.get $base) (i64.const 1))
+    (then (return (i64.const 1))))
+  (if (i64.eq (local.get $base) (i64.const -1))
+    (then (return (select (i64.const -1) (i64.const 1) (i32.wrap_i64 (i64.and (local.get $exp) (i64.const 1)))))))
+  (if (i64.lt_s (local.get $exp) (i64.const 0))
+    (then
+      (if (i64.eqz (local.get $base))
+        (then (unreachable)))
+      (return (i64.const 0))))
+  (if (i64.eqz (local.get $base))
+    (then (return (i64.extend_i32_u (i64.eqz (local.get $exp))))))
+  (local.set $r (i64.const 1))
+  ;; the result overflows after 63 multiplications at most
+  (block $done
+    (loop $next
+      (br_if $done (i64.eqz (local.get $exp)))
+      (local.set $r (call $rt.mul (local.get $r) (local.get $base)))
+      (local.set $exp (i64.sub (local.get $exp) (i64.const 1)))
+      (br $next)))
+  (local.get $r))`,
+	"$rt.abs": `(func $rt.abs (param $a i64) (result i64)
+  (if (result i64) (i64.lt_s (local.get $a) (i64.const 0))
+    (then (call $rt.sub (i64.const 0) (local.get $a)))
+    (else (local.get $a))))`,
+	"$rt.min": `(func $rt.min (param $a i64) (param $b i64) (result i64)
+  (select (local.get $a) (local.get $b) (i64.lt_s (local.get $a) (local.get $b))))`,
+	"$rt.max": `(func $rt.max (param $a i64) (param $b i64) (result i64)
+  (select (local.get $a) (local.get $b) (i64.gt_s (local.get $a) (local.get $b))))`,
+}
+
+// dependencies lists the helpers called by other helpers
+var dependencies = map[string][]string{
+	"$rt.pow": {"$rt.mul"},
+	"$rt.abs": {"$rt.sub"},
+}
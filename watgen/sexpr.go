@@ -0,0 +1,71 @@
+package watgen
+
+import (
+	"bytes"
+	"strings"
+)
+
+// lineWidth is the width under which an s-expression is printed on a single line
+const lineWidth = 80
+
+// annotations are the lists kept on the first line of a broken list, like the atoms
+var annotations = map[string]bool{"export": true, "param": true, "result": true}
+
+// sexpr is an s-expression of the WebAssembly text format: an atom or a list
+type sexpr struct {
+	atom string
+	list []*sexpr
+}
+
+func atom(text string) *sexpr {
+	return &sexpr{atom: text}
+}
+
+// form builds a list starting with a keyword, such as (i64.add a b)
+func form(keyword string, args ...*sexpr) *sexpr {
+	return &sexpr{list: append([]*sexpr{atom(keyword)}, args...)}
+}
+
+func (s *sexpr) isAtom() bool {
+	return s.list == nil
+}
+
+// leading tells whether an item stays on the first line of a broken list
+func (s *sexpr) leading() bool {
+	return s.isAtom() || annotations[s.list[0].atom]
+}
+
+// flat formats an s-expression on a single line
+func (s *sexpr) flat() string {
+	if s.isAtom() {
+		return s.atom
+	}
+	items := []string{}
+	for _, item := range s.list {
+		items = append(items, item.flat())
+	}
+	return "(" + strings.Join(items, " ") + ")"
+}
+
+// write formats an s-expression, breaking the lists that do not fit on a line: their leading atoms
+// and annotations stay on the first line, and the other items are indented below
+func (s *sexpr) write(buf *bytes.Buffer, indent int) {
+	if flat := s.flat(); s.isAtom() || indent+len(flat) <= lineWidth {
+		buf.WriteString(flat)
+		return
+	}
+
+	buf.WriteString("(")
+	index := 0
+	for ; index < len(s.list) && s.list[index].leading(); index++ {
+		if index > 0 {
+			buf.WriteString(" ")
+		}
+		buf.WriteString(s.list[index].flat())
+	}
+	for ; index < len(s.list); index++ {
+		buf.WriteString("\n" + strings.Repeat(" ", indent+2))
+		s.list[index].write(buf, indent+2)
+	}
+	buf.WriteString(")")
+}
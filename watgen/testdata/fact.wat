@@ -0,0 +1,62 @@
+;; Code generated by cairn from testdata/fact.ca. DO NOT EDIT.
+
+(module
+  (func $fact (export "fact") (param $n i64) (result i64)
+    (if (result i64)
+      (i64.eq (local.get $n) (i64.const 0))
+      (then (i64.const 1))
+      (else
+        (call $rt.mul
+          (local.get $n)
+          (call $fact (call $rt.sub (local.get $n) (i64.const 1)))))))
+  (func $collatz (export "collatz") (param $n i64) (result i64)
+    (local $half i64)
+    (local $match.1 i32)
+    (local $next i64)
+    (if (result i64)
+      (i64.eq (local.get $n) (i64.const 1))
+      (then (i64.const 0))
+      (else
+        (local.set $half (i64.div_s (local.get $n) (i64.const 2)))
+        (local.set $next
+          (block (result i64)
+            (local.set $match.1
+              (i64.eq
+                (local.get $n)
+                (call $rt.mul (local.get $half) (i64.const 2))))
+            (if (result i64)
+              (local.get $match.1)
+              (then (local.get $half))
+              (else
+                (if (result i64)
+                  (i32.eqz (local.get $match.1))
+                  (then
+                    (call $rt.add
+                      (call $rt.mul (i64.const 3) (local.get $n))
+                      (i64.const 1)))
+                  (else (unreachable)))))))
+        (call $rt.add (i64.const 1) (call $collatz (local.get $next))))))
+  (func $rt.add (param $a i64) (param $b i64) (result i64)
+    (local $r i64)
+    (local.set $r (i64.add (local.get $a) (local.get $b)))
+    ;; the operands have the same sign, and the result another one
+    (if (i64.lt_s (i64.and (i64.xor (local.get $a) (local.get $r)) (i64.xor (local.get $b) (local.get $r))) (i64.const 0))
+      (then (unreachable)))
+    (local.get $r))
+  (func $rt.mul (param $a i64) (param $b i64) (result i64)
+    (local $r i64)
+    (if (i64.eqz (local.get $a))
+      (then (return (i64.const 0))))
+    (if (i32.and (i64.eq (local.get $a) (i64.const -1)) (i64.eq (local.get $b) (i64.const 0x8000000000000000)))
+      (then (unreachable)))
+    (local.set $r (i64.mul (local.get $a) (local.get $b)))
+    (if (i64.ne (i64.div_s (local.get $r) (local.get $a)) (local.get $b))
+      (then (unreachable)))
+    (local.get $r))
+  (func $rt.sub (param $a i64) (param $b i64) (result i64)
+    (local $r i64)
+    (local.set $r (i64.sub (local.get $a) (local.get $b)))
+    ;; the operands have different signs, and the result is not of the sign of a
+    (if (i64.lt_s (i64.and (i64.xor (local.get $a) (local.get $b)) (i64.xor (local.get $a) (local.get $r))) (i64.const 0))
+      (then (unreachable)))
+    (local.get $r)))
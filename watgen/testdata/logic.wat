@@ -0,0 +1,107 @@
+;; Code generated by cairn from testdata/logic.ca. DO NOT EDIT.
+
+(module
+  (func $xor (export "xor") (param $a i32) (param $b i32) (result i32)
+    (i32.and
+      (i32.or (local.get $a) (local.get $b))
+      (i32.eqz (i32.and (local.get $a) (local.get $b)))))
+  (func $sign (export "sign") (param $n i64) (result i64)
+    (local $match.1 i32)
+    (local $match.2 i32)
+    (local.set $match.1 (i64.eq (local.get $n) (i64.const 0)))
+    (if (result i64)
+      (local.get $match.1)
+      (then (i64.const 0))
+      (else
+        (if (result i64)
+          (i32.eqz (local.get $match.1))
+          (then
+            (local.set $match.2
+              (i64.eq (call $rt.abs (local.get $n)) (local.get $n)))
+            (if (result i64)
+              (local.get $match.2)
+              (then (i64.const 1))
+              (else
+                (if (result i64)
+                  (i32.eqz (local.get $match.2))
+                  (then (i64.const -1))
+                  (else (unreachable))))))
+          (else (unreachable))))))
+  (func $clamp (export "clamp") (param $n i64) (param $low i64) (param $high i64) (result i64)
+    (call $rt.max
+      (local.get $low)
+      (call $rt.min (local.get $n) (local.get $high))))
+  (func $power (export "power") (param $base i64) (param $exp i64) (result i64)
+    (call $rt.sub
+      (call $rt.add
+        (call $rt.pow (local.get $base) (local.get $exp))
+        (call $rt.pow (local.get $base) (i64.const 0)))
+      (i64.const 1)))
+  (func $classify (export "classify") (param $n i64) (result i64)
+    (local $match.1 i64)
+    (local $other i64)
+    (local.set $match.1 (call $rt.sub (local.get $n) (i64.const 1)))
+    (if (result i64)
+      (i64.eq (local.get $match.1) (i64.const 0))
+      (then (i64.const 10))
+      (else
+        (if (result i64)
+          (i64.eq (local.get $match.1) (i64.const -1))
+          (then (i64.const 20))
+          (else
+            (local.set $other (local.get $match.1))
+            (call $rt.mul (local.get $other) (i64.const 100)))))))
+  (func $rt.abs (param $a i64) (result i64)
+    (if (result i64) (i64.lt_s (local.get $a) (i64.const 0))
+      (then (call $rt.sub (i64.const 0) (local.get $a)))
+      (else (local.get $a))))
+  (func $rt.add (param $a i64) (param $b i64) (result i64)
+    (local $r i64)
+    (local.set $r (i64.add (local.get $a) (local.get $b)))
+    ;; the operands have the same sign, and the result another one
+    (if (i64.lt_s (i64.and (i64.xor (local.get $a) (local.get $r)) (i64.xor (local.get $b) (local.get $r))) (i64.const 0))
+      (then (unreachable)))
+    (local.get $r))
+  (func $rt.max (param $a i64) (param $b i64) (result i64)
+    (select (local.get $a) (local.get $b) (i64.gt_s (local.get $a) (local.get $b))))
+  (func $rt.min (param $a i64) (param $b i64) (result i64)
+    (select (local.get $a) (local.get $b) (i64.lt_s (local.get $a) (local.get $b))))
+  (func $rt.mul (param $a i64) (param $b i64) (result i64)
+    (local $r i64)
+    (if (i64.eqz (local.get $a))
+      (then (return (i64.const 0))))
+    (if (i32.and (i64.eq (local.get $a) (i64.const -1)) (i64.eq (local.get $b) (i64.const 0x8000000000000000)))
+      (then (unreachable)))
+    (local.set $r (i64.mul (local.get $a) (local.get $b)))
+    (if (i64.ne (i64.div_s (local.get $r) (local.get $a)) (local.get $b))
+      (then (unreachable)))
+    (local.get $r))
+  (func $rt.pow (param $base i64) (param $exp i64) (result i64)
+    (local $r i64)
+    (if (i64.eq (local.get $base) (i64.const 1))
+      (then (return (i64.const 1))))
+    (if (i64.eq (local.get $base) (i64.const -1))
+      (then (return (select (i64.const -1) (i64.const 1) (i32.wrap_i64 (i64.and (local.get $exp) (i64.const 1)))))))
+    (if (i64.lt_s (local.get $exp) (i64.const 0))
+      (then
+        (if (i64.eqz (local.get $base))
+          (then (unreachable)))
+        (return (i64.const 0))))
+    (if (i64.eqz (local.get $base))
+      (then (return (i64.extend_i32_u (i64.eqz (local.get $exp))))))
+    (local.set $r (i64.const 1))
+    ;; the result overflows after 63 multiplications at most
+    (block $done
+      (loop $next
+        (br_if $done (i64.eqz (local.get $exp)))
+        (local.set $r (call $rt.mul (local.get $r) (local.get $base)))
+        (local.set $exp (i64.sub (local.get $exp) (i64.const 1)))
+        (br $next)))
+    (local.get $r))
+  (func $rt.sub (param $a i64) (param $b i64) (result i64)
+    (local $r i64)
+    (local.set $r (i64.sub (local.get $a) (local.get $b)))
+    ;; the operands have different signs, and the result is not of the sign of a
+    (if (i64.lt_s (i64.and (i64.xor (local.get $a) (local.get $b)) (i64.xor (local.get $a) (local.get $r))) (i64.const 0))
+      (then (unreachable)))
+    (local.get $r)))
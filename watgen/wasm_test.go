@@ -0,0 +1,412 @@
+package watgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// This file holds a small evaluator of WebAssembly text modules, limited to the folded instructions
+// emitted by the generator. It lets the tests run the generated functions without a WebAssembly runtime
+
+// wasmModule is a parsed module
+type wasmModule struct {
+	funcs map[string]*wasmFunc
+	// exports maps the exported names to the function names
+	exports map[string]string
+}
+
+type wasmFunc struct {
+	params []string
+	locals []string
+	body   []*sexpr
+}
+
+// trap is raised by unreachable and by the integer operations WebAssembly rejects
+type trap struct {
+	message string
+}
+
+// branch is raised by br and br_if, and caught by the block or loop of the label
+type branch struct {
+	label string
+}
+
+// returned is raised by return, and caught by the function call
+type returned struct{}
+
+// parseWat reads a module in text format
+func parseWat(text string) (*wasmModule, error) {
+	items, err := readSexprs(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) != 1 || items[0].isAtom() || items[0].list[0].atom != "module" {
+		return nil, fmt.Errorf("expected a single module - got %d items", len(items))
+	}
+
+	m := &wasmModule{funcs: map[string]*wasmFunc{}, exports: map[string]string{}}
+	for _, item := range items[0].list[1:] {
+		if item.isAtom() || item.list[0].atom != "func" || len(item.list) < 2 {
+			return nil, fmt.Errorf("expected a function - got %s", item.flat())
+		}
+		name := item.list[1].atom
+		if _, ok := m.funcs[name]; ok {
+			return nil, fmt.Errorf("function %s is declared twice", name)
+		}
+		f := &wasmFunc{}
+		for _, field := range item.list[2:] {
+			switch keyword(field) {
+			case "export":
+				m.exports[strings.Trim(field.list[1].atom, `"`)] = name
+			case "param":
+				f.params = append(f.params, field.list[1].atom)
+			case "local":
+				f.locals = append(f.locals, field.list[1].atom)
+			case "result":
+			default:
+				f.body = append(f.body, field)
+			}
+		}
+		m.funcs[name] = f
+	}
+	return m, nil
+}
+
+// keyword returns the first atom of a list, or an empty string
+func keyword(s *sexpr) string {
+	if s.isAtom() || len(s.list) == 0 {
+		return ""
+	}
+	return s.list[0].atom
+}
+
+// readSexprs splits a text into s-expressions, skipping the line comments
+func readSexprs(text string) ([]*sexpr, error) {
+	stack := [][]*sexpr{{}}
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case strings.HasPrefix(text[i:], ";;"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '(':
+			stack = append(stack, []*sexpr{})
+			i++
+		case c == ')':
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("unexpected ) at offset %d", i)
+			}
+			list := &sexpr{list: stack[len(stack)-1]}
+			stack = stack[:len(stack)-1]
+			stack[len(stack)-1] = append(stack[len(stack)-1], list)
+			i++
+		default:
+			start := i
+			for i < len(text) && text[i] != '(' && text[i] != ')' && !unicode.IsSpace(rune(text[i])) {
+				i++
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], atom(text[start:i]))
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("expected ) - got the end of the text")
+	}
+	return stack[0], nil
+}
+
+// call runs an exported function. The i32 values are held by int64 too
+func (m *wasmModule) call(name string, args ...int64) (result int64, err error) {
+	fn, ok := m.exports[name]
+	if !ok {
+		return 0, fmt.Errorf("%s is not exported", name)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			t, ok := r.(trap)
+			if !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("trap: %s", t.message)
+		}
+	}()
+	return m.invoke(fn, args), nil
+}
+
+// frame holds the locals and the operand stack of a function call
+type frame struct {
+	module *wasmModule
+	locals map[string]int64
+	stack  []int64
+}
+
+func (m *wasmModule) invoke(name string, args []int64) (result int64) {
+	f, ok := m.funcs[name]
+	if !ok {
+		panic(fmt.Sprintf("unknown function %s", name))
+	}
+	if len(args) != len(f.params) {
+		panic(fmt.Sprintf("%s expects %d arguments - got %d", name, len(f.params), len(args)))
+	}
+	fr := &frame{module: m, locals: map[string]int64{}}
+	for i, p := range f.params {
+		fr.locals[p] = args[i]
+	}
+	for _, l := range f.locals {
+		fr.locals[l] = 0
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(returned); !ok {
+				panic(r)
+			}
+			result = fr.top()
+		}
+	}()
+	fr.run(f.body)
+	return fr.top()
+}
+
+func (fr *frame) push(v int64) {
+	fr.stack = append(fr.stack, v)
+}
+
+func (fr *frame) pop() int64 {
+	if len(fr.stack) == 0 {
+		panic("the operand stack is empty")
+	}
+	v := fr.stack[len(fr.stack)-1]
+	fr.stack = fr.stack[:len(fr.stack)-1]
+	return v
+}
+
+// top returns the result of a function, or 0 when it has none
+func (fr *frame) top() int64 {
+	if len(fr.stack) == 0 {
+		return 0
+	}
+	return fr.stack[len(fr.stack)-1]
+}
+
+func (fr *frame) run(instrs []*sexpr) {
+	for _, instr := range instrs {
+		fr.exec(instr)
+	}
+}
+
+// operands runs the folded operands of an instruction: its list items that are not annotations
+func (fr *frame) operands(instr *sexpr) {
+	for _, item := range instr.list[1:] {
+		if !item.isAtom() && keyword(item) != "result" {
+			fr.exec(item)
+		}
+	}
+}
+
+func (fr *frame) local(instr *sexpr) string {
+	name := instr.list[1].atom
+	if _, ok := fr.locals[name]; !ok {
+		panic(fmt.Sprintf("unknown local %s", name))
+	}
+	return name
+}
+
+// label returns the label of a block or a loop, and its instructions
+func label(instr *sexpr) (string, []*sexpr) {
+	body := instr.list[1:]
+	name := ""
+	if len(body) > 0 && body[0].isAtom() {
+		name, body = body[0].atom, body[1:]
+	}
+	if len(body) > 0 && keyword(body[0]) == "result" {
+		body = body[1:]
+	}
+	return name, body
+}
+
+// block runs instructions until they end or branch to the label
+func (fr *frame) block(name string, body []*sexpr, hasResult bool) (restart bool) {
+	height := len(fr.stack)
+	defer func() {
+		if r := recover(); r != nil {
+			if b, ok := r.(branch); !ok || b.label != name {
+				panic(r)
+			}
+			var result int64
+			if hasResult {
+				result = fr.top()
+			}
+			fr.stack = fr.stack[:height]
+			if hasResult {
+				fr.push(result)
+			}
+			restart = true
+		}
+	}()
+	fr.run(body)
+	return false
+}
+
+func hasResult(instr *sexpr) bool {
+	for _, item := range instr.list[1:] {
+		if keyword(item) == "result" {
+			return true
+		}
+	}
+	return false
+}
+
+func (fr *frame) exec(instr *sexpr) {
+	op := keyword(instr)
+	switch op {
+	case "i64.const", "i32.const":
+		text := instr.list[1].atom
+		var n int64
+		if strings.HasPrefix(text, "0x") {
+			u, err := strconv.ParseUint(text[2:], 16, 64)
+			if err != nil {
+				panic(err)
+			}
+			n = int64(u)
+		} else {
+			var err error
+			if n, err = strconv.ParseInt(text, 10, 64); err != nil {
+				panic(err)
+			}
+		}
+		if op == "i32.const" {
+			n = int64(uint32(n))
+		}
+		fr.push(n)
+		return
+	case "local.get":
+		fr.push(fr.locals[fr.local(instr)])
+		return
+	case "block":
+		name, body := label(instr)
+		fr.block(name, body, hasResult(instr))
+		return
+	case "loop":
+		name, body := label(instr)
+		for fr.block(name, body, false) {
+		}
+		return
+	case "if":
+		var then, els []*sexpr
+		for _, item := range instr.list[1:] {
+			switch keyword(item) {
+			case "then":
+				then = item.list[1:]
+			case "else":
+				els = item.list[1:]
+			case "result":
+			default:
+				fr.exec(item)
+			}
+		}
+		body := els
+		if fr.pop() != 0 {
+			body = then
+		}
+		// an if is a block without label
+		fr.block("", body, hasResult(instr))
+		return
+	case "br":
+		panic(branch{instr.list[1].atom})
+	case "br_if":
+		fr.operands(instr)
+		if fr.pop() != 0 {
+			panic(branch{instr.list[1].atom})
+		}
+		return
+	case "return":
+		fr.operands(instr)
+		panic(returned{})
+	case "unreachable":
+		panic(trap{"unreachable"})
+	}
+
+	fr.operands(instr)
+	switch op {
+	case "local.set":
+		fr.locals[fr.local(instr)] = fr.pop()
+	case "local.tee":
+		v := fr.pop()
+		fr.locals[fr.local(instr)] = v
+		fr.push(v)
+	case "call":
+		f, ok := fr.module.funcs[instr.list[1].atom]
+		if !ok {
+			panic(fmt.Sprintf("unknown function %s", instr.list[1].atom))
+		}
+		args := make([]int64, len(f.params))
+		for i := len(args) - 1; i >= 0; i-- {
+			args[i] = fr.pop()
+		}
+		fr.push(fr.module.invoke(instr.list[1].atom, args))
+	case "drop":
+		fr.pop()
+	case "select":
+		c, b, a := fr.pop(), fr.pop(), fr.pop()
+		if c != 0 {
+			fr.push(a)
+		} else {
+			fr.push(b)
+		}
+	case "i64.eqz", "i32.eqz":
+		fr.push(boolean(fr.pop() == 0))
+	case "i32.wrap_i64":
+		fr.push(int64(uint32(fr.pop())))
+	case "i64.extend_i32_u":
+		fr.push(fr.pop())
+	default:
+		b, a := fr.pop(), fr.pop()
+		fr.push(binary(op, a, b))
+	}
+}
+
+func binary(op string, a, b int64) int64 {
+	switch op {
+	case "i64.add":
+		return a + b
+	case "i64.sub":
+		return a - b
+	case "i64.mul":
+		return a * b
+	case "i64.div_s":
+		if b == 0 {
+			panic(trap{"integer divide by zero"})
+		}
+		if b == -1 && a == -1<<63 {
+			panic(trap{"integer overflow"})
+		}
+		return a / b
+	case "i64.and", "i32.and":
+		return a & b
+	case "i32.or":
+		return a | b
+	case "i64.xor":
+		return a ^ b
+	case "i64.eq", "i32.eq":
+		return boolean(a == b)
+	case "i64.ne", "i32.ne":
+		return boolean(a != b)
+	case "i64.lt_s":
+		return boolean(a < b)
+	case "i64.gt_s":
+		return boolean(a > b)
+	}
+	panic(fmt.Sprintf("unsupported instruction %s", op))
+}
+
+func boolean(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
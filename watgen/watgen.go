@@ -0,0 +1,194 @@
+// Package watgen lowers typed cairn functions to the WebAssembly text format.
+//
+// Each function declaration becomes a function of the module, exported under its cairn name.
+// Integers are i64 and booleans i32. Match expressions become chains of if instructions, and
+// the integer operations call helper functions trapping on overflows. The top level statements
+// are not translated: a module is a library of functions called by its host.
+// The types of the expressions are inferred by the checker.
+// Floats, strings, sum types, lists, tuples, generic functions, try expressions and imports
+// are not supported yet.
+package watgen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/checker"
+	"github.com/fchoquet/cairn/tokens"
+)
+
+// wasmTypes maps the cairn types supported by the generator to WebAssembly types
+var wasmTypes = map[string]string{
+	"int":  "i64",
+	"bool": "i32",
+}
+
+// generator holds the declarations of the program being translated
+type generator struct {
+	// types gives the types of the expressions
+	types     *checker.Checker
+	functions map[string]*ast.FuncDecl
+	// helpers holds the names of the helper functions called by the module
+	helpers map[string]bool
+	// fn is the function being generated
+	fn *function
+}
+
+// function is a function being generated
+type function struct {
+	name string
+	// locals holds the types the parameters and the local variables are declared with
+	locals map[string]string
+	// order lists the local variables that are not parameters
+	order []string
+	temps int
+}
+
+// Generate translates the functions of a cairn program to a WebAssembly module in text format.
+// The program must have been checked by types, a checker knowing the builtins
+func Generate(file *ast.SourceFile, types *checker.Checker) ([]byte, error) {
+	g := &generator{types: types, functions: map[string]*ast.FuncDecl{}, helpers: map[string]bool{}}
+	if len(file.Imports) > 0 {
+		return nil, errorf(file.Imports[0], "imports are not supported by the WebAssembly backend")
+	}
+	if len(file.Types) > 0 {
+		return nil, errorf(file.Types[0], "type declarations are not supported by the WebAssembly backend")
+	}
+	for _, f := range file.Functions {
+		if err := checkSignature(f); err != nil {
+			return nil, err
+		}
+		g.functions[f.Name.Value] = f
+	}
+
+	funcs := []*sexpr{}
+	for _, f := range file.Functions {
+		fn, err := g.function(f)
+		if err != nil {
+			return nil, err
+		}
+		funcs = append(funcs, fn)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, ";; Code generated by cairn from %s. DO NOT EDIT.\n\n(module", file.Pos().File)
+	for _, fn := range funcs {
+		buf.WriteString("\n  ")
+		fn.write(buf, 2)
+	}
+	for _, name := range g.helperNames() {
+		buf.WriteString("\n  " + strings.Replace(helpers[name], "\n", "\n  ", -1))
+	}
+	buf.WriteString(")\n")
+	return buf.Bytes(), nil
+}
+
+// checkSignature tells whether the signature of a function can be translated
+func checkSignature(f *ast.FuncDecl) error {
+	if len(f.Signature.TypeParams) > 0 {
+		return errorf(f, "generic functions are not supported by the WebAssembly backend")
+	}
+	types := []*ast.TypeId{f.Signature.ReturnType}
+	for _, p := range f.Signature.Parameters.Parameters {
+		types = append(types, p.Type)
+	}
+	for _, t := range types {
+		if _, ok := wasmTypes[t.Name]; !ok || len(t.Args) > 0 {
+			return errorf(t, "the type %s is not supported by the WebAssembly backend", t.TypeName())
+		}
+	}
+	return nil
+}
+
+func (g *generator) function(f *ast.FuncDecl) (*sexpr, error) {
+	name := f.Name.Value
+	g.fn = &function{name: name, locals: map[string]string{}}
+	defer func() { g.fn = nil }()
+
+	header := []*sexpr{atom("$" + name), form("export", atom(fmt.Sprintf("%q", name)))}
+	for _, p := range f.Signature.Parameters.Parameters {
+		g.fn.locals[p.Name] = p.Type.Name
+		header = append(header, form("param", atom("$"+p.Name), atom(wasmTypes[p.Type.Name])))
+	}
+	result := f.Signature.ReturnType.Name
+	header = append(header, form("result", atom(wasmTypes[result])))
+
+	body, typ, err := g.statementList(f.Body.Statements)
+	if err != nil {
+		return nil, err
+	}
+	if typ != result {
+		return nil, errorf(lastStatement(f.Body.Statements), "%s must return a %s - got %s", name, result, typ)
+	}
+
+	for _, local := range g.fn.order {
+		header = append(header, form("local", atom("$"+local), atom(wasmTypes[g.fn.locals[local]])))
+	}
+	return form("func", append(header, body...)...), nil
+}
+
+func lastStatement(sl *ast.StatementList) ast.Node {
+	return sl.Statements[len(sl.Statements)-1]
+}
+
+// helperNames returns the helpers called by the module and by the other helpers, sorted
+func (g *generator) helperNames() []string {
+	names := []string{}
+	var add func(name string)
+	add = func(name string) {
+		for _, n := range names {
+			if n == name {
+				return
+			}
+		}
+		names = append(names, name)
+		for _, dep := range dependencies[name] {
+			add(dep)
+		}
+	}
+	for name := range g.helpers {
+		add(name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// declare adds a local variable to the function. A variable can not change its type
+func (g *generator) declare(node ast.Node, name, typ string) error {
+	existing, ok := g.fn.locals[name]
+	switch {
+	case !ok:
+		g.fn.locals[name] = typ
+		g.fn.order = append(g.fn.order, name)
+	case existing != typ:
+		return errorf(node, "%s is a %s - it can not be assigned a %s", name, existing, typ)
+	}
+	return nil
+}
+
+// typeOf returns the type the checker inferred for an expression
+func (g *generator) typeOf(node ast.Node) (string, error) {
+	typ := g.types.TypeOf(node)
+	if typ == "" {
+		return "", errorf(node, "the type of %s is not known before the program runs", node)
+	}
+	return typ, nil
+}
+
+// temp declares a local variable holding an intermediate value.
+// Its name contains a dot, that cairn identifiers can not contain
+func (g *generator) temp(typ string) string {
+	g.fn.temps++
+	name := fmt.Sprintf("match.%d", g.fn.temps)
+	g.fn.locals[name] = typ
+	g.fn.order = append(g.fn.order, name)
+	return name
+}
+
+// errorf creates an error located at a node
+func errorf(node ast.Node, format string, args ...interface{}) error {
+	return &tokens.Error{Pos: node.Pos(), Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,245 @@
+package watgen
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fchoquet/cairn/ast"
+	"github.com/fchoquet/cairn/checker"
+	"github.com/fchoquet/cairn/interpreter"
+	"github.com/fchoquet/cairn/modules"
+	"github.com/fchoquet/cairn/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+func parse(t *testing.T, file, source string) *ast.SourceFile {
+	p := parser.Parser{}
+	node, err := p.Parse(file, source)
+	if err != nil {
+		t.Fatalf("can not parse %s: %s", file, err)
+	}
+	return node.(*ast.SourceFile)
+}
+
+// generate checks a program like the build command does, then translates it
+func generate(node *ast.SourceFile) ([]byte, error) {
+	c := checker.New()
+	c.Builtins = interpreter.Signatures()
+	c.StaticGlobals = true
+	if err := c.Check(&modules.Module{Path: node.Pos().File, File: node}); err != nil {
+		return nil, err
+	}
+	return Generate(node, c)
+}
+
+// interpret calls a function of a program with the interpreter, and returns its result.
+// Runtime errors are returned as traps, which hold no message in WebAssembly
+func interpret(t *testing.T, file, source, call string) string {
+	node := parse(t, file, source+"\n"+call)
+	output, err := interpreter.New(&parser.Parser{}, interpreter.CheckedArithmetic()).Exec(node)
+	if err != nil {
+		if _, ok := err.(*interpreter.RuntimeError); !ok {
+			t.Fatalf("can not run %s: %s", call, err)
+		}
+		return "trap"
+	}
+	return output
+}
+
+// calls lists the calls to the functions of testdata compared with the interpreter
+var calls = map[string][]struct {
+	name string
+	args []interface{}
+}{
+	"fact.ca": {
+		{"fact", []interface{}{0}},
+		{"fact", []interface{}{5}},
+		{"fact", []interface{}{20}},
+		{"fact", []interface{}{21}},
+		{"collatz", []interface{}{1}},
+		{"collatz", []interface{}{27}},
+	},
+	"logic.ca": {
+		{"xor", []interface{}{true, true}},
+		{"xor", []interface{}{true, false}},
+		{"xor", []interface{}{false, true}},
+		{"xor", []interface{}{false, false}},
+		{"sign", []interface{}{-7}},
+		{"sign", []interface{}{0}},
+		{"sign", []interface{}{12}},
+		{"clamp", []interface{}{-5, 0, 10}},
+		{"clamp", []interface{}{5, 0, 10}},
+		{"clamp", []interface{}{15, 0, 10}},
+		{"power", []interface{}{2, 10}},
+		{"power", []interface{}{-3, 3}},
+		{"power", []interface{}{-1, 7}},
+		{"power", []interface{}{0, 0}},
+		{"power", []interface{}{0, -1}},
+		{"power", []interface{}{5, -2}},
+		{"power", []interface{}{2, 63}},
+		{"power", []interface{}{-2, 63}},
+		{"classify", []interface{}{1}},
+		{"classify", []interface{}{0}},
+		{"classify", []interface{}{-4}},
+	},
+	"overflow.ca": {
+		{"negate", []interface{}{5}},
+		{"negate", []interface{}{-9223372036854775807}},
+		{"smallest", []interface{}{}},
+		{"halve", []interface{}{7, 2}},
+		{"halve", []interface{}{-7, 2}},
+		{"halve", []interface{}{7, 0}},
+		{"halve", []interface{}{-9223372036854775807, 1}},
+		{"largest", []interface{}{0}},
+		{"largest", []interface{}{1}},
+		{"product", []interface{}{4294967296, 2147483648}},
+		{"product", []interface{}{4294967296, -2147483648}},
+		{"product", []interface{}{-1, -9223372036854775807}},
+	},
+}
+
+// TestGolden translates the programs of testdata, and compares the generated modules with the golden files.
+// The functions of the modules must give the same results as the interpreter
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			assert := assert.New(t)
+
+			source, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := generate(parse(t, file, string(source)))
+			if !assert.Nil(err) {
+				return
+			}
+
+			golden := strings.TrimSuffix(file, ".ca") + ".wat"
+			if *update {
+				if err := ioutil.WriteFile(golden, code, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(string(expected), string(code))
+
+			module, err := parseWat(string(code))
+			if !assert.Nil(err) {
+				return
+			}
+			for _, c := range calls[filepath.Base(file)] {
+				args := []string{}
+				values := []int64{}
+				for _, arg := range c.args {
+					args = append(args, fmt.Sprint(arg))
+					switch arg := arg.(type) {
+					case int:
+						values = append(values, int64(arg))
+					case bool:
+						values = append(values, boolean(arg))
+					}
+				}
+				call := c.name + "(" + strings.Join(args, ", ") + ")"
+				expected := interpret(t, file, string(source), call)
+
+				result, err := module.call(c.name, values...)
+				actual := fmt.Sprint(result)
+				switch {
+				case err != nil:
+					actual = "trap"
+				case expected == "true" || expected == "false":
+					actual = fmt.Sprint(result != 0)
+				}
+				assert.Equal(expected, actual, call)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("signatures", func(t *testing.T) {
+		code, err := generate(parse(t, "test.ca", "func isZero(n:int) :bool\n    n == 0\nisZero(1)"))
+		assert.Nil(err)
+		assert.Contains(string(code), `(func $isZero (export "isZero") (param $n i64) (result i32)`)
+		assert.NotContains(string(code), "$rt.")
+	})
+
+	t.Run("expressions", func(t *testing.T) {
+		fixtures := []struct {
+			input    string
+			expected string
+		}{
+			{"1 + 2 * 3", "(call $rt.add (i64.const 1) (call $rt.mul (i64.const 2) (i64.const 3)))"},
+			{"n / 2", "(i64.div_s (local.get $n) (i64.const 2))"},
+			{"-n", "(call $rt.sub (i64.const 0) (local.get $n))"},
+			{"-5", "(i64.const -5)"},
+			{"+n", "(local.get $n)"},
+			{"n != 2", "(i64.ne (local.get $n) (i64.const 2))"},
+			{"!(n == 1) || false", "(i32.or (i32.eqz (i64.eq (local.get $n) (i64.const 1))) (i32.const 0))"},
+			{"true == (n == 1)", "(i32.eq (i32.const 1) (i64.eq (local.get $n) (i64.const 1)))"},
+			{"min(n, 3)", "(call $rt.min (local.get $n) (i64.const 3))"},
+			{"f(n)", "(call $f (local.get $n))"},
+		}
+
+		for _, fixture := range fixtures {
+			t.Run(fixture.input, func(t *testing.T) {
+				source := "func f(n:int) :int\n    n\nfunc g(n:int) :int\n    x := " + fixture.input + "\n    1\n"
+				code, err := generate(parse(t, "test.ca", source))
+				if assert.Nil(err) {
+					assert.Contains(strings.Join(strings.Fields(string(code)), " "), "(local.set $x "+fixture.expected+")")
+				}
+			})
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		fixtures := []struct {
+			input    string
+			expected string
+		}{
+			{"func f() :float\n    1.5", "test.ca:1:10: the type float is not supported by the WebAssembly backend"},
+			{"func f(l:[int]) :int\n    1", "test.ca:1:9: the type [int] is not supported by the WebAssembly backend"},
+			{"func id[T](x:T) :T\n    x", "test.ca:1:1: generic functions are not supported by the WebAssembly backend"},
+			{"type Box = Box(v:int)\n1", "test.ca:1:1: type declarations are not supported by the WebAssembly backend"},
+			{"func f() :int\n    x := \"a\"\n    1", "test.ca:2:10: strings are not supported by the WebAssembly backend"},
+			{"func f() :int\n    x := [1]\n    1", "test.ca:2:10: lists are not supported by the WebAssembly backend"},
+			{"func f() :int\n    x := 1\n    x := true\n    1", "test.ca:3:10: x is a int - it can not be assigned a bool"},
+			{"func f(n:int) :bool\n    n", "test.ca:2:5: f must return a bool - got int"},
+			{"func f() :int\n    g(1)", "test.ca:2:5: unknown function g"},
+			{"func f(n:int) :int\n    f(true)", "test.ca:2:7: argument n of f must be a int - got bool"},
+			{"func f(n:int) :int\n    n + true", "test.ca:2:7: operator + is not defined on int and bool"},
+			{"func f(n:int) :bool\n    n == true", "test.ca:2:7: can not compare int and bool"},
+			{"func f() :int\n    y", "test.ca:2:5: unknown identifier y"},
+			{"func f(b:bool) :int\n    match b\n        1 -> 1", "test.ca:2:5: match is not exhaustive: _ is not covered"},
+			{
+				"func f(b:bool) :int\n    match b\n        true -> 1\n        false -> false",
+				"test.ca:4:18: the arms of the match must give a int - got bool",
+			},
+		}
+
+		for _, fixture := range fixtures {
+			t.Run(fixture.input, func(t *testing.T) {
+				_, err := generate(parse(t, "test.ca", fixture.input))
+				if assert.NotNil(err) {
+					assert.Equal(fixture.expected, err.Error())
+				}
+			})
+		}
+	})
+}